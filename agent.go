@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+	"github.com/sorenisanerd/gotty/pkg/tunnel"
+	"github.com/sorenisanerd/gotty/utils"
+)
+
+type agentOptions struct {
+	AgentHub   string `hcl:"agent_hub" flagName:"agent-hub" flagDescribe:"Serve through the hub at this URL instead of listening, for hosts without inbound ports (ex: wss://hub.example.com/)" default:""`
+	AgentName  string `hcl:"agent_name" flagName:"agent-name" flagDescribe:"Name of this agent on the hub, which serves it at <hub>/agents/<name>/, the host name when empty" default:""`
+	AgentToken string `hcl:"agent_token" flagName:"agent-token" flagDescribe:"Token to register to the hub with" default:"" secret:"true"`
+}
+
+// listenAgent registers to the hub of options, if any.
+func listenAgent(options *agentOptions, enableTLS bool) (net.Listener, error) {
+	if options.AgentHub == "" {
+		return nil, nil
+	}
+	if enableTLS {
+		return nil, errors.New("TLS is not supported through a hub, which terminates TLS itself")
+	}
+	name := options.AgentName
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return tunnel.Listen(context.Background(), options.AgentHub, name, &tunnel.AgentOptions{Token: options.AgentToken})
+}
+
+type hubOptions struct {
+	Address    string `flagName:"address" flagSName:"a" flagDescribe:"IP address to listen" default:"0.0.0.0"`
+	Port       string `flagName:"port" flagSName:"p" flagDescribe:"Port number to listen" default:"8080"`
+	Token      string `flagName:"agent-token" flagDescribe:"Token agents register with (default: any agent is accepted)" default:"" secret:"true"`
+	UsersFile  string `flagName:"users-file" flagDescribe:"File of users allowed to access agents, as user:password:agent-patterns lines (default: no authentication)" default:""`
+	EnableTLS  bool   `flagName:"tls" flagSName:"t" flagDescribe:"Enable TLS/SSL" default:"false"`
+	TLSCrtFile string `flagName:"tls-crt" flagDescribe:"TLS/SSL certificate file path" default:"~/.gotty.crt"`
+	TLSKeyFile string `flagName:"tls-key" flagDescribe:"TLS/SSL key file path" default:"~/.gotty.key"`
+}
+
+func hubCommand() *cli.Command {
+	options := &hubOptions{}
+	if err := utils.ApplyDefaultValues(options); err != nil {
+		exit(err, 1)
+	}
+	cliFlags, flagMappings, err := utils.GenerateFlags(options)
+	if err != nil {
+		exit(err, 3)
+	}
+
+	return &cli.Command{
+		Name:  "hub",
+		Usage: "Relay clients to GoTTY agents started with --agent-hub, which need no inbound ports",
+		Flags: cliFlags,
+		Action: func(c *cli.Context) error {
+			utils.ApplyFlags(cliFlags, flagMappings, c, options)
+			if err := runHub(options); err != nil {
+				exit(err, 8)
+			}
+			return nil
+		},
+	}
+}
+
+func runHub(options *hubOptions) error {
+	if options.Token == "" {
+		slog.Warn("No agent token given, accepting any agent")
+	}
+	var opts []tunnel.HubOption
+	if options.UsersFile != "" {
+		users, err := tunnel.LoadUsers(options.UsersFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, tunnel.WithUsers(users))
+	} else {
+		slog.Warn("No users file given, agents authenticate users themselves")
+	}
+	hub := tunnel.NewHub(options.Token, opts...)
+	srv := &http.Server{
+		Addr:    net.JoinHostPort(options.Address, options.Port),
+		Handler: hub,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Hub is listening", "address", srv.Addr, "tls", options.EnableTLS)
+		if options.EnableTLS {
+			errs <- srv.ListenAndServeTLS(homedir.Expand(options.TLSCrtFile), homedir.Expand(options.TLSKeyFile))
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+
+	err := waitSignals(errs, func() { srv.Close() }, func() { srv.Shutdown(context.Background()) }, 0, nil)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("hub failed: %w", err)
+	}
+	return nil
+}
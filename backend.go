@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/sorenisanerd/gotty/backend/docker"
+	"github.com/sorenisanerd/gotty/backend/kubernetes"
+	"github.com/sorenisanerd/gotty/backend/localcommand"
+	"github.com/sorenisanerd/gotty/backend/serial"
+	"github.com/sorenisanerd/gotty/backend/ssh"
+	"github.com/sorenisanerd/gotty/backend/tmux"
+	"github.com/sorenisanerd/gotty/server"
+)
+
+type backendOptions struct {
+	Backend string   `hcl:"backend" flagName:"backend" flagDescribe:"Backend clients are connected to: command, docker, k8s, ssh, serial or tmux" default:"command"`
+	Command []string `hcl:"command"` // run when none is given on the command line
+}
+
+// newFactory creates the factory of the selected backend.
+// argv is the command to run, which is optional for every backend but command.
+func newFactory(cfg *config, argv []string) (server.Factory, error) {
+	switch cfg.backend.Backend {
+	case "command":
+		if len(argv) == 0 {
+			return nil, fmt.Errorf("no command given")
+		}
+		return localcommand.NewFactory(argv[0], argv[1:], cfg.command)
+	case "docker":
+		if cfg.docker.Discover {
+			return docker.NewDiscovery(argv, cfg.docker, cfg.upstream, cfg.command, cfg.app)
+		}
+		return docker.NewFactory(argv, cfg.docker, cfg.upstream, cfg.command)
+	case "k8s":
+		return kubernetes.NewFactory(argv, cfg.kubernetes, cfg.upstream, cfg.command)
+	case "ssh":
+		return ssh.NewFactory(argv, cfg.ssh, cfg.upstream, cfg.command)
+	case "serial":
+		return serial.NewFactory(cfg.serial)
+	case "tmux":
+		return tmux.NewFactory(argv, cfg.tmux, cfg.command)
+	}
+	return nil, fmt.Errorf("unknown backend `%s`, expected command, docker, k8s, ssh, serial or tmux", cfg.backend.Backend)
+}
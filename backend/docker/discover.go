@@ -0,0 +1,282 @@
+package docker
+
+import (
+	"context"
+	"crypto/subtle"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/backend/localcommand"
+	"github.com/sorenisanerd/gotty/backend/upstream"
+	"github.com/sorenisanerd/gotty/server"
+)
+
+// DiscoveryInterval is how often Discovery lists the containers.
+const DiscoveryInterval = 2 * time.Second
+
+// Discovery exposes a terminal for each running container carrying a label
+// at <path>containers/<name>/, and the list of the containers at
+// <path>containers/. Mount it with server.WithOuterMiddleware(d.Middleware)
+// on a server it is also the factory of, and keep it updated with Run.
+type Discovery struct {
+	docker         string
+	dockerArgs     []string // global ones, of the upstream options
+	argv           []string
+	label          string
+	commandOptions *localcommand.Options
+	serverOptions  *server.Options
+	serverOpts     []server.ServerOption
+	logger         *slog.Logger
+	path           string
+
+	mu         sync.Mutex
+	containers map[string]*containerHandler
+}
+
+type containerHandler struct {
+	server  *server.Server // created on first use
+	handler http.Handler
+	cancel  context.CancelFunc
+}
+
+// NewDiscovery creates a discovery running argv, or a shell when empty, in
+// the containers labeled options.Label. Each container is served by its own
+// server created with serverOptions and serverOpts.
+func NewDiscovery(argv []string, options *Options, upstreamOptions *upstream.Options, commandOptions *localcommand.Options, serverOptions *server.Options, serverOpts ...server.ServerOption) (*Discovery, error) {
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return nil, errors.Wrapf(err, "docker backend")
+	}
+	if len(argv) == 0 {
+		argv = []string{"sh"}
+	}
+
+	path := serverOptions.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return &Discovery{
+		docker:         docker,
+		dockerArgs:     upstreamOptions.DockerArgs(),
+		argv:           argv,
+		label:          options.Label,
+		commandOptions: commandOptions,
+		serverOptions:  serverOptions,
+		serverOpts:     serverOpts,
+		logger:         slog.Default(),
+		path:           path + "containers/",
+		containers:     map[string]*containerHandler{},
+	}, nil
+}
+
+func (d *Discovery) Name() string {
+	return "docker"
+}
+
+// New fails, as terminals are served at <path>containers/<name>/.
+func (d *Discovery) New(params map[string][]string, headers map[string][]string) (server.Slave, error) {
+	return nil, errors.New("docker discovery: open a container at " + d.path + "<name>/")
+}
+
+// Run updates the containers every DiscoveryInterval until ctx is canceled.
+func (d *Discovery) Run(ctx context.Context) error {
+	ticker := time.NewTicker(DiscoveryInterval)
+	defer ticker.Stop()
+	for {
+		names, err := d.list(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Warn("Failed to list containers", "error", err)
+		} else if err == nil {
+			d.update(names)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			d.update(nil)
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *Discovery) list(ctx context.Context) ([]string, error) {
+	args := slices.Concat(d.dockerArgs, []string{"ps", "--filter", "label=" + d.label, "--format", "{{.Names}}"})
+	output, err := exec.CommandContext(ctx, d.docker, args...).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "docker ps")
+	}
+	return strings.Fields(string(output)), nil
+}
+
+func (d *Discovery) update(names []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	running := map[string]bool{}
+	for _, name := range names {
+		running[name] = true
+		if _, ok := d.containers[name]; !ok {
+			d.containers[name] = &containerHandler{}
+			d.logger.Info("Container discovered", "container", name, "path", d.path+name+"/")
+		}
+	}
+	for name, container := range d.containers {
+		if !running[name] {
+			if container.cancel != nil {
+				container.cancel()
+			}
+			delete(d.containers, name)
+			d.logger.Info("Container gone", "container", name)
+		}
+	}
+}
+
+// Containers returns the names of the discovered containers, sorted.
+func (d *Discovery) Containers() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	names := make([]string, 0, len(d.containers))
+	for name := range d.containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handler returns the handler of container name, creating it if needed,
+// or nil if the container is not discovered.
+func (d *Discovery) handler(name string) (http.Handler, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	container, ok := d.containers[name]
+	if !ok {
+		return nil, nil
+	}
+	if container.handler != nil {
+		return container.handler, nil
+	}
+
+	args := slices.Concat(d.dockerArgs, []string{"exec", "-i", "-t"}, clientEnv, []string{name}, d.argv)
+	factory, err := localcommand.NewFactory(d.docker, args, d.commandOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	options := *d.serverOptions
+	options.Path = d.path + name + "/"
+	options.EnableRandomUrl = false
+	options.Once = false
+	options.Timeout = 0
+	options.TitleVariables = map[string]interface{}{}
+	for key, value := range d.serverOptions.TitleVariables {
+		options.TitleVariables[key] = value
+	}
+	options.TitleVariables["command"] = name
+	options.TitleVariables["command_name"] = name
+
+	srv, err := server.New(&options, append([]server.ServerOption{server.WithFactory(&Factory{Factory: factory})}, d.serverOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	container.server = srv
+	container.handler = srv.HandlerContext(ctx)
+	container.cancel = cancel
+	return container.handler, nil
+}
+
+// reset replaces the handler of container name by a new one on next use
+// unless a session is running, as servers stop serving after their session.
+func (d *Discovery) reset(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	container, ok := d.containers[name]
+	if !ok || container.server == nil || len(container.server.Sessions().List()) > 0 {
+		return
+	}
+	container.cancel()
+	d.containers[name] = &containerHandler{}
+}
+
+// authenticate checks the credential of the options for the list, while
+// each container authenticates its clients itself.
+func (d *Discovery) authenticate(r *http.Request) bool {
+	if !d.serverOptions.EnableBasicAuth {
+		return true
+	}
+	user, password, _ := r.BasicAuth()
+	return subtle.ConstantTimeCompare([]byte(user+":"+password), []byte(d.serverOptions.Credential)) == 1
+}
+
+var indexTemplate = template.Must(template.New("containers").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>GoTTY</title></head>
+<body>
+<h1>Containers</h1>
+<ul>
+{{range .}}<li><a href="{{.}}/">{{.}}</a></li>
+{{else}}<li>No containers labeled for GoTTY are running</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// Middleware serves the containers, passing other requests to next.
+func (d *Discovery) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == strings.TrimSuffix(d.path, "containers/") {
+			http.Redirect(w, r, d.path, http.StatusFound)
+			return
+		}
+		rest, ok := strings.CutPrefix(r.URL.Path, d.path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if rest == "" {
+			if !d.authenticate(r) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			indexTemplate.Execute(w, d.Containers())
+			return
+		}
+
+		name, page, found := strings.Cut(rest, "/")
+		handler, err := d.handler(name)
+		if err != nil {
+			d.logger.Error("Failed to serve container", "container", name, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if handler == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if !found {
+			http.Redirect(w, r, d.path+name+"/", http.StatusFound)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+		if page == "ws" {
+			d.reset(name)
+		}
+	})
+}
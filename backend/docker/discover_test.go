@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorenisanerd/gotty/backend/localcommand"
+	"github.com/sorenisanerd/gotty/backend/upstream"
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/utils"
+)
+
+func TestDiscovery(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = ps ] && echo web && echo db\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	options := &server.Options{}
+	if err := utils.ApplyDefaultValues(options); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDiscovery(nil, &Options{Label: "gotty.enable=true"}, &upstream.Options{}, &localcommand.Options{}, options)
+	if err != nil {
+		t.Fatalf("NewDiscovery() returned error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+	for i := 0; len(d.Containers()) == 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if containers := d.Containers(); strings.Join(containers, ",") != "db,web" {
+		t.Fatalf("containers = %v, expected db and web", containers)
+	}
+
+	handler := d.Middleware(http.NotFoundHandler())
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		body, _ := io.ReadAll(w.Result().Body)
+		return w.Code, string(body)
+	}
+
+	if status, body := get("/containers/"); status != http.StatusOK || !strings.Contains(body, `href="web/"`) {
+		t.Errorf("list = %d %s, expected the containers", status, body)
+	}
+	if status, _ := get("/containers/web/"); status != http.StatusOK {
+		t.Errorf("status = %d for the page of a container, expected %d", status, http.StatusOK)
+	}
+	if status, _ := get("/containers/other/"); status != http.StatusNotFound {
+		t.Errorf("status = %d for an unknown container, expected %d", status, http.StatusNotFound)
+	}
+}
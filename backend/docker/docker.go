@@ -0,0 +1,63 @@
+// Package docker provides a server.Factory that runs the command
+// in a Docker container through the docker CLI.
+package docker
+
+import (
+	"os/exec"
+	"slices"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/backend/localcommand"
+	"github.com/sorenisanerd/gotty/backend/upstream"
+)
+
+type Options struct {
+	Image     string `hcl:"docker_image" flagName:"docker-image" flagDescribe:"Image to start a new container from for each client (docker backend)" default:""`
+	Container string `hcl:"docker_container" flagName:"docker-container" flagDescribe:"Running container to execute the command in (docker backend)" default:""`
+	Discover  bool   `hcl:"docker_discover" flagName:"docker-discover" flagDescribe:"Serve a terminal for each running container with --docker-label at <path>containers/<name>/ (docker backend)" default:"false"`
+	Label     string `hcl:"docker_label" flagName:"docker-label" flagDescribe:"Label of the containers to discover (docker backend)" default:"gotty.enable=true"`
+}
+
+// clientEnv passes the terminal and the locale of the client on to the
+// container, which docker leaves out otherwise.
+var clientEnv = []string{"-e", "TERM", "-e", "LANG", "-e", "TZ"}
+
+type Factory struct {
+	*localcommand.Factory
+}
+
+// NewFactory creates a factory running argv in a container,
+// or a shell when argv is empty, connecting with upstreamOptions.
+func NewFactory(argv []string, options *Options, upstreamOptions *upstream.Options, commandOptions *localcommand.Options) (*Factory, error) {
+	var dockerArgs []string
+	switch {
+	case options.Image != "" && options.Container != "":
+		return nil, errors.New("docker backend: only one of --docker-image and --docker-container can be given")
+	case options.Image != "":
+		dockerArgs = slices.Concat([]string{"run", "--rm", "-i", "-t"}, clientEnv, []string{options.Image}, argv)
+	case options.Container != "":
+		if len(argv) == 0 {
+			argv = []string{"sh"}
+		}
+		dockerArgs = slices.Concat([]string{"exec", "-i", "-t"}, clientEnv, []string{options.Container}, argv)
+	default:
+		return nil, errors.New("docker backend: --docker-image or --docker-container is required")
+	}
+
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return nil, errors.Wrapf(err, "docker backend")
+	}
+
+	dockerArgs = append(upstreamOptions.DockerArgs(), dockerArgs...)
+	factory, err := localcommand.NewFactory(docker, dockerArgs, commandOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &Factory{Factory: factory}, nil
+}
+
+func (factory *Factory) Name() string {
+	return "docker"
+}
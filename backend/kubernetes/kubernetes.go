@@ -0,0 +1,62 @@
+// Package kubernetes provides a server.Factory that runs the command
+// in a Kubernetes pod through kubectl.
+package kubernetes
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/backend/localcommand"
+	"github.com/sorenisanerd/gotty/backend/upstream"
+)
+
+type Options struct {
+	Pod       string `hcl:"k8s_pod" flagName:"k8s-pod" flagDescribe:"Pod to execute the command in (k8s backend)" default:""`
+	Container string `hcl:"k8s_container" flagName:"k8s-container" flagDescribe:"Container in the pod (k8s backend, default: the pod's default container)" default:""`
+	Namespace string `hcl:"k8s_namespace" flagName:"k8s-namespace" flagDescribe:"Namespace of the pod (k8s backend, default: the context's namespace)" default:""`
+	Context   string `hcl:"k8s_context" flagName:"k8s-context" flagDescribe:"kubeconfig context to use (k8s backend, default: the current context)" default:""`
+}
+
+type Factory struct {
+	*localcommand.Factory
+}
+
+// NewFactory creates a factory running argv in a pod,
+// or a shell when argv is empty, connecting with upstreamOptions.
+func NewFactory(argv []string, options *Options, upstreamOptions *upstream.Options, commandOptions *localcommand.Options) (*Factory, error) {
+	if options.Pod == "" {
+		return nil, errors.New("k8s backend: --k8s-pod is required")
+	}
+
+	kubectlArgs := upstreamOptions.KubectlArgs()
+	if options.Context != "" {
+		kubectlArgs = append(kubectlArgs, "--context", options.Context)
+	}
+	if options.Namespace != "" {
+		kubectlArgs = append(kubectlArgs, "--namespace", options.Namespace)
+	}
+	kubectlArgs = append(kubectlArgs, "exec", "-i", "-t", options.Pod)
+	if options.Container != "" {
+		kubectlArgs = append(kubectlArgs, "--container", options.Container)
+	}
+	if len(argv) == 0 {
+		argv = []string{"sh"}
+	}
+	kubectlArgs = append(append(kubectlArgs, "--"), argv...)
+
+	kubectl, err := exec.LookPath("kubectl")
+	if err != nil {
+		return nil, errors.Wrapf(err, "k8s backend")
+	}
+
+	factory, err := localcommand.NewFactory(kubectl, kubectlArgs, commandOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &Factory{Factory: factory}, nil
+}
+
+func (factory *Factory) Name() string {
+	return "kubernetes"
+}
@@ -0,0 +1,76 @@
+package localcommand
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+)
+
+// environment returns the variables of the env file followed by the ones
+// given with --env, so that the latter take precedence.
+func environment(options *Options) ([]string, error) {
+	var env []string
+	if options.EnvFile != "" {
+		fileEnv, err := readEnvFile(homedir.Expand(options.EnvFile))
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, fileEnv...)
+	}
+
+	for _, variable := range options.Env {
+		if err := validateEnv(variable); err != nil {
+			return nil, err
+		}
+		env = append(env, variable)
+	}
+	return env, nil
+}
+
+// readEnvFile reads KEY=VALUE lines, skipping blank lines and # comments.
+// Values may be wrapped in single or double quotes.
+func readEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open env file `%s`", path)
+	}
+	defer file.Close()
+
+	var env []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+
+		variable := text
+		if key, value, ok := strings.Cut(text, "="); ok {
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+			variable = strings.TrimSpace(key) + "=" + value
+		}
+		if err := validateEnv(variable); err != nil {
+			return nil, errors.Wrapf(err, "%s:%d", path, line)
+		}
+		env = append(env, variable)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read env file `%s`", path)
+	}
+	return env, nil
+}
+
+func validateEnv(variable string) error {
+	key, _, ok := strings.Cut(variable, "=")
+	if !ok || strings.TrimSpace(key) == "" || strings.ContainsAny(strings.TrimSpace(key), " \t") {
+		return errors.Errorf("invalid environment variable `%s`, expected KEY=VALUE", variable)
+	}
+	return nil
+}
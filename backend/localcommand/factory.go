@@ -1,35 +1,93 @@
 package localcommand
 
 import (
+	"path"
+	"regexp"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/sorenisanerd/gotty/server"
 )
 
 type Options struct {
-	CloseSignal  int `hcl:"close_signal" flagName:"close-signal" flagSName:"" flagDescribe:"Signal sent to the command process when gotty close it (default: SIGHUP)" default:"1"`
-	CloseTimeout int `hcl:"close_timeout" flagName:"close-timeout" flagSName:"" flagDescribe:"Time in seconds to force kill process after client is disconnected (default: -1)" default:"-1"`
+	CloseSignal  int      `hcl:"close_signal" flagName:"close-signal" flagSName:"" flagDescribe:"Signal sent to the command process when gotty close it (default: SIGHUP)" default:"1"`
+	CloseTimeout int      `hcl:"close_timeout" flagName:"close-timeout" flagSName:"" flagDescribe:"Time in seconds to force kill process after client is disconnected (default: -1)" default:"-1"`
+	Env          []string `hcl:"env" flagName:"env" flagDescribe:"Environment variable (KEY=VALUE) to set for the command (can be repeated)"`
+	EnvFile      string   `hcl:"env_file" flagName:"env-file" flagDescribe:"File of KEY=VALUE lines to set as environment variables for the command" default:""`
+	Term         string   `hcl:"term" flagName:"term" flagDescribe:"TERM of the command, passed on by the docker and ssh backends" default:"xterm-256color"`
+	Locales      []string `hcl:"client_locales" flagName:"client-locale" flagDescribe:"Locale clients may set LANG to, as a pattern such as en_* (can be repeated, any by default)"`
+	Timezones    []string `hcl:"client_timezones" flagName:"client-timezone" flagDescribe:"Time zone clients may set TZ to, as a pattern such as Europe/* (can be repeated, any by default)"`
+	Params       []string `hcl:"params" flagName:"param" flagDescribe:"Parameter clients give the command in the query, validated and set as the environment variable of its upper-cased name, NAME[=DEFAULT]:TYPE[:REGEXP] with TYPE string, int or bool, required without DEFAULT (can be repeated)"`
+	PassParams   []string `hcl:"pass_params" flagName:"pass-param" flagDescribe:"Query parameter clients may set as the environment variable of its upper-cased name without checks, besides the ones of --param (can be repeated)"`
 }
 
+// envParamPattern matches the names of parameters that can be environment
+// variables.
+var envParamPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type Factory struct {
 	command string
 	argv    []string
 	options *Options
 	opts    []Option
+	params  []server.Param
+	// envParams are the parameters passed on as environment variables, of
+	// Options.Params and Options.PassParams.
+	envParams map[string]bool
 }
 
 func NewFactory(command string, argv []string, options *Options) (*Factory, error) {
 	opts := []Option{WithCloseSignal(syscall.Signal(options.CloseSignal))}
+	if options.Term != "" {
+		if strings.ContainsAny(options.Term, "= \t") {
+			return nil, errors.Errorf("invalid TERM `%s`", options.Term)
+		}
+		opts = append(opts, WithTerm(options.Term))
+	}
+	for _, pattern := range append(options.Locales, options.Timezones...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Errorf("invalid pattern `%s`", pattern)
+		}
+	}
 	if options.CloseTimeout >= 0 {
 		opts = append(opts, WithCloseTimeout(time.Duration(options.CloseTimeout)*time.Second))
 	}
 
+	env, err := environment(options)
+	if err != nil {
+		return nil, err
+	}
+	if len(env) > 0 {
+		opts = append(opts, WithEnv(env))
+	}
+
+	var params []server.Param
+	envParams := map[string]bool{}
+	for _, s := range options.Params {
+		param, err := server.ParseParam(s)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, param)
+		envParams[param.Name] = true
+	}
+	for _, name := range options.PassParams {
+		if !envParamPattern.MatchString(name) {
+			return nil, errors.Errorf("invalid parameter name `%s`", name)
+		}
+		envParams[name] = true
+	}
+
 	return &Factory{
-		command: command,
-		argv:    argv,
-		options: options,
-		opts:    opts,
+		command:   command,
+		argv:      argv,
+		options:   options,
+		opts:      opts,
+		params:    params,
+		envParams: envParams,
 	}, nil
 }
 
@@ -37,12 +95,62 @@ func (factory *Factory) Name() string {
 	return "local command"
 }
 
+// Params returns the parameters of Options.Params.
+func (factory *Factory) Params() []server.Param {
+	return factory.params
+}
+
 func (factory *Factory) New(params map[string][]string, headers map[string][]string) (server.Slave, error) {
+	return factory.NewForClient(params, headers, server.ClientInfo{})
+}
+
+// NewForClient starts the command with the initial terminal size of client,
+// and its time zone, locale and session name in TZ, LANG and
+// GOTTY_SESSION_NAME, unless Options.Timezones or Options.Locales leave
+// them out.
+func (factory *Factory) NewForClient(params map[string][]string, headers map[string][]string, client server.ClientInfo) (server.Slave, error) {
 	argv := make([]string, len(factory.argv))
 	copy(argv, factory.argv)
 	if params["arg"] != nil && len(params["arg"]) > 0 {
 		argv = append(argv, params["arg"]...)
 	}
 
-	return New(factory.command, argv, headers, params, factory.opts...)
+	var env []string
+	if client.Timezone != "" && allowed(factory.options.Timezones, client.Timezone) {
+		env = append(env, "TZ="+client.Timezone)
+	}
+	if locale := strings.ReplaceAll(client.Locale, "-", "_"); locale != "" && allowed(factory.options.Locales, locale) {
+		env = append(env, "LANG="+locale+".UTF-8")
+	}
+	if client.SessionName != "" {
+		env = append(env, "GOTTY_SESSION_NAME="+client.SessionName)
+	}
+	opts := append([]Option{WithSize(client.Columns, client.Rows), WithClientEnv(env)}, factory.opts...)
+	return New(factory.command, argv, headers, factory.allowedParams(params), opts...)
+}
+
+// allowedParams returns the parameters of Options.Params and
+// Options.PassParams, the others never reaching the environment of the
+// command.
+func (factory *Factory) allowedParams(params map[string][]string) map[string][]string {
+	allowed := map[string][]string{}
+	for name, values := range params {
+		if factory.envParams[name] {
+			allowed[name] = values
+		}
+	}
+	return allowed
+}
+
+// allowed tells whether value matches one of patterns, or there are none.
+func allowed(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
 }
@@ -1,6 +1,7 @@
 package localcommand
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"strings"
@@ -14,6 +15,7 @@ import (
 const (
 	DefaultCloseSignal  = syscall.SIGINT
 	DefaultCloseTimeout = 10 * time.Second
+	DefaultTerm         = "xterm-256color"
 )
 
 type LocalCommand struct {
@@ -22,16 +24,38 @@ type LocalCommand struct {
 
 	closeSignal  syscall.Signal
 	closeTimeout time.Duration
+	term         string
+	env          []string
+	clientEnv    []string
+	columns      uint16
+	rows         uint16
 
 	cmd       *exec.Cmd
 	pty       *os.File
 	ptyClosed chan struct{}
+	waitErr   error // set when ptyClosed is closed
 }
 
+// New starts command with the environment of the process, headers as HTTP_
+// variables and params, but arg, as variables of their upper-cased names,
+// all of them given to this command only.
 func New(command string, argv []string, headers map[string][]string, params map[string][]string, options ...Option) (*LocalCommand, error) {
+	lcmd := &LocalCommand{
+		command: command,
+		argv:    argv,
+
+		closeSignal:  DefaultCloseSignal,
+		closeTimeout: DefaultCloseTimeout,
+		term:         DefaultTerm,
+	}
+
+	for _, option := range options {
+		option(lcmd)
+	}
+
 	cmd := exec.Command(command, argv...)
 
-	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	cmd.Env = append(os.Environ(), "TERM="+lcmd.term)
 
 	// Combine headers into key=value pairs to set as env vars
 	// Prefix the headers with "http_" so we don't overwrite any other env vars
@@ -44,7 +68,8 @@ func New(command string, argv []string, headers map[string][]string, params map[
 		cmd.Env = append(cmd.Env, h)
 	}
 
-	// Add query parameters as environment variables (excluding special 'arg' param)
+	// Add query parameters as environment variables (excluding special 'arg' param),
+	// the factory leaving out those not allowed
 	if params != nil {
 		for key, values := range params {
 			if key != "arg" && len(values) > 0 {
@@ -58,28 +83,23 @@ func New(command string, argv []string, headers map[string][]string, params map[
 		}
 	}
 
-	pty, err := pty.Start(cmd)
+	cmd.Env = append(cmd.Env, lcmd.clientEnv...)
+	// Static variables come last so that clients can't override them
+	cmd.Env = append(cmd.Env, lcmd.env...)
+
+	var size *pty.Winsize
+	if lcmd.columns > 0 && lcmd.rows > 0 {
+		size = &pty.Winsize{Cols: lcmd.columns, Rows: lcmd.rows}
+	}
+	pty, err := pty.StartWithSize(cmd, size)
 	if err != nil {
 		// todo close cmd?
 		return nil, errors.Wrapf(err, "failed to start command `%s`", command)
 	}
-	ptyClosed := make(chan struct{})
-
-	lcmd := &LocalCommand{
-		command: command,
-		argv:    argv,
-
-		closeSignal:  DefaultCloseSignal,
-		closeTimeout: DefaultCloseTimeout,
-
-		cmd:       cmd,
-		pty:       pty,
-		ptyClosed: ptyClosed,
-	}
 
-	for _, option := range options {
-		option(lcmd)
-	}
+	lcmd.cmd = cmd
+	lcmd.pty = pty
+	lcmd.ptyClosed = make(chan struct{})
 
 	// When the process is closed by the user,
 	// close pty so that Read() on the pty breaks with an EOF.
@@ -89,7 +109,7 @@ func New(command string, argv []string, headers map[string][]string, params map[
 			close(lcmd.ptyClosed)
 		}()
 
-		lcmd.cmd.Wait()
+		lcmd.waitErr = lcmd.cmd.Wait()
 	}()
 
 	return lcmd, nil
@@ -104,19 +124,51 @@ func (lcmd *LocalCommand) Write(p []byte) (n int, err error) {
 }
 
 func (lcmd *LocalCommand) Close() error {
+	return lcmd.Stop(context.Background())
+}
+
+// Start does nothing, as the command is started by New
+// so that its window title variables are known.
+func (lcmd *LocalCommand) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop sends the close signal to the command, and kills it when it does
+// not exit before ctx is done or the close timeout.
+func (lcmd *LocalCommand) Stop(ctx context.Context) error {
 	if lcmd.cmd != nil && lcmd.cmd.Process != nil {
 		lcmd.cmd.Process.Signal(lcmd.closeSignal)
 	}
+	done, timeout := ctx.Done(), lcmd.closeTimeoutC()
 	for {
 		select {
 		case <-lcmd.ptyClosed:
 			return nil
-		case <-lcmd.closeTimeoutC():
+		case <-done:
+			done = nil
+			lcmd.cmd.Process.Signal(syscall.SIGKILL)
+		case <-timeout:
+			timeout = nil
 			lcmd.cmd.Process.Signal(syscall.SIGKILL)
 		}
 	}
 }
 
+// Wait waits for the command to exit and returns its exit code,
+// which is -1 when it was killed by a signal.
+func (lcmd *LocalCommand) Wait() (int, error) {
+	<-lcmd.ptyClosed
+	if _, ok := lcmd.waitErr.(*exec.ExitError); lcmd.waitErr != nil && !ok {
+		return 0, lcmd.waitErr
+	}
+	return lcmd.cmd.ProcessState.ExitCode(), nil
+}
+
+// Pid returns the process ID of the command.
+func (lcmd *LocalCommand) Pid() int {
+	return lcmd.cmd.Process.Pid
+}
+
 func (lcmd *LocalCommand) WindowTitleVariables() map[string]interface{} {
 	return map[string]interface{}{
 		"command": lcmd.command,
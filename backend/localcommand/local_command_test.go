@@ -2,9 +2,15 @@ package localcommand
 
 import (
 	"bytes"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/sorenisanerd/gotty/server"
 )
 
 func TestNewFactory(t *testing.T) {
@@ -92,3 +98,156 @@ func TestFactoryNew(t *testing.T) {
 	}
 
 }
+
+func TestFactoryEnv(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	err := os.WriteFile(envFile, []byte("# comment\nGOTTY_A=file\nexport GOTTY_B=\"quoted value\"\n\n"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+
+	factory, err := NewFactory("/bin/sh", []string{"-c", "echo $GOTTY_A,$GOTTY_B,$GOTTY_C"}, &Options{
+		Env:     []string{"GOTTY_A=flag", "GOTTY_C=c"},
+		EnvFile: envFile,
+	})
+	if err != nil {
+		t.Fatalf("NewFactory() returned error: %v", err)
+	}
+
+	// clients can't override static variables
+	slave, err := factory.New(map[string][]string{"gotty_a": {"client"}}, nil)
+	if err != nil {
+		t.Fatalf("factory.New() returned error: %v", err)
+	}
+	defer slave.Close()
+
+	output, _ := io.ReadAll(slave)
+	if expected := "flag,quoted value,c\r\n"; string(output) != expected {
+		t.Errorf("output = %q, expected %q", output, expected)
+	}
+
+	if _, err := NewFactory("/bin/sh", nil, &Options{Env: []string{"INVALID"}}); err == nil {
+		t.Errorf("NewFactory() accepted an invalid variable")
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	for _, test := range []struct {
+		line     string
+		expected string // variable, or else the error
+	}{
+		{"GOTTY_A ='a b'", "GOTTY_A=a b"},
+		{"export GOTTY_A=", "GOTTY_A="},
+		{"GOTTY_A", "env:1: invalid environment variable `GOTTY_A`, expected KEY=VALUE"},
+		{"GOTTY A=a", "env:1: invalid environment variable `GOTTY A=a`, expected KEY=VALUE"},
+		{"export =a", "env:1: invalid environment variable `=a`, expected KEY=VALUE"},
+	} {
+		if err := os.WriteFile(envFile, []byte(test.line+"\n"), 0600); err != nil {
+			t.Fatalf("failed to write env file: %v", err)
+		}
+		env, err := readEnvFile(envFile)
+		if err != nil {
+			if !strings.HasSuffix(err.Error(), test.expected) {
+				t.Errorf("readEnvFile() of %q returned %v, expected %s", test.line, err, test.expected)
+			}
+			continue
+		}
+		if len(env) != 1 || env[0] != test.expected {
+			t.Errorf("readEnvFile() of %q = %q, expected %s", test.line, env, test.expected)
+		}
+	}
+}
+
+func TestFactoryPassParams(t *testing.T) {
+	factory, err := NewFactory("/bin/sh", []string{"-c", "echo $GOTTY_HOST,$GOTTY_PORT,$GOTTY_OTHER"}, &Options{
+		Params:     []string{"gotty_port=22:int"},
+		PassParams: []string{"gotty_host"},
+	})
+	if err != nil {
+		t.Fatalf("NewFactory() returned error: %v", err)
+	}
+
+	params := map[string][]string{"gotty_host": {"example.com"}, "gotty_port": {"2222"}, "gotty_other": {"x"}}
+	slave, err := factory.New(params, nil)
+	if err != nil {
+		t.Fatalf("factory.New() returned error: %v", err)
+	}
+	defer slave.Close()
+
+	output, _ := io.ReadAll(slave)
+	if expected := "example.com,2222,\r\n"; string(output) != expected {
+		t.Errorf("output = %q, expected %q", output, expected)
+	}
+
+	if _, err := NewFactory("/bin/sh", nil, &Options{PassParams: []string{"LD-PRELOAD"}}); err == nil {
+		t.Errorf("NewFactory() accepted an invalid parameter name")
+	}
+}
+
+func TestFactoryNewForClient(t *testing.T) {
+	factory, err := NewFactory("/bin/sh", []string{"-c", "echo $TZ,$LANG,$GOTTY_SESSION_NAME; stty size"}, &Options{})
+	if err != nil {
+		t.Fatalf("NewFactory() returned error: %v", err)
+	}
+
+	client := server.ClientInfo{Columns: 120, Rows: 40, Timezone: "Europe/Paris", Locale: "fr-FR", SessionName: "deploy"}
+	slave, err := factory.NewForClient(nil, nil, client)
+	if err != nil {
+		t.Fatalf("factory.NewForClient() returned error: %v", err)
+	}
+	defer slave.Close()
+
+	output, _ := io.ReadAll(slave)
+	if expected := "Europe/Paris,fr_FR.UTF-8,deploy\r\n40 120\r\n"; string(output) != expected {
+		t.Errorf("output = %q, expected %q", output, expected)
+	}
+}
+
+func TestFactoryClientAllowlist(t *testing.T) {
+	factory, err := NewFactory("/bin/sh", []string{"-c", "echo $TERM,$TZ,$LANG"}, &Options{
+		Term:      "screen",
+		Locales:   []string{"en_*"},
+		Timezones: []string{"Europe/*"},
+	})
+	if err != nil {
+		t.Fatalf("NewFactory() returned error: %v", err)
+	}
+
+	slave, err := factory.NewForClient(nil, nil, server.ClientInfo{Timezone: "Asia/Tokyo", Locale: "en-GB"})
+	if err != nil {
+		t.Fatalf("factory.NewForClient() returned error: %v", err)
+	}
+	defer slave.Close()
+
+	// TZ is left as it is in the environment of the test
+	output, _ := io.ReadAll(slave)
+	if expected := "screen," + os.Getenv("TZ") + ",en_GB.UTF-8\r\n"; string(output) != expected {
+		t.Errorf("output = %q, expected %q", output, expected)
+	}
+
+	if _, err := NewFactory("/bin/sh", nil, &Options{Locales: []string{"["}}); err == nil {
+		t.Errorf("NewFactory() accepted an invalid pattern")
+	}
+}
+
+func TestWait(t *testing.T) {
+	factory, err := NewFactory("/bin/sh", []string{"-c", "exit 3"}, &Options{})
+	if err != nil {
+		t.Fatalf("NewFactory() returned error: %v", err)
+	}
+	slave, err := factory.New(nil, nil)
+	if err != nil {
+		t.Fatalf("factory.New() returned error: %v", err)
+	}
+	defer slave.Close()
+
+	io.Copy(io.Discard, slave)
+	code, err := slave.(*LocalCommand).Wait()
+	if err != nil {
+		t.Fatalf("Wait() returned error: %v", err)
+	}
+	if code != 3 {
+		t.Errorf("exit code = %d, expected %d", code, 3)
+	}
+}
@@ -18,3 +18,33 @@ func WithCloseTimeout(timeout time.Duration) Option {
 		lcmd.closeTimeout = timeout
 	}
 }
+
+// WithSize sets the initial size of the terminal of the command.
+func WithSize(columns int, rows int) Option {
+	return func(lcmd *LocalCommand) {
+		lcmd.columns = uint16(columns)
+		lcmd.rows = uint16(rows)
+	}
+}
+
+// WithTerm sets the TERM of the command, DefaultTerm by default.
+func WithTerm(term string) Option {
+	return func(lcmd *LocalCommand) {
+		lcmd.term = term
+	}
+}
+
+// WithClientEnv adds KEY=VALUE pairs derived from the client to the
+// environment of the command, which WithEnv overrides.
+func WithClientEnv(env []string) Option {
+	return func(lcmd *LocalCommand) {
+		lcmd.clientEnv = append(lcmd.clientEnv, env...)
+	}
+}
+
+// WithEnv adds KEY=VALUE pairs to the environment of the command.
+func WithEnv(env []string) Option {
+	return func(lcmd *LocalCommand) {
+		lcmd.env = env
+	}
+}
@@ -0,0 +1,82 @@
+// Package serial provides an implementation of webtty.Slave
+// connected to a serial line, e.g. the console of a device.
+package serial
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/pkg/rawterm"
+	"github.com/sorenisanerd/gotty/server"
+)
+
+type Options struct {
+	Device string `hcl:"serial_device" flagName:"serial-device" flagDescribe:"Serial device to connect to, e.g. /dev/ttyUSB0 (serial backend)" default:""`
+	Baud   int    `hcl:"serial_baud" flagName:"serial-baud" flagDescribe:"Baud rate of the serial line (serial backend)" default:"115200"`
+}
+
+type Factory struct {
+	options *Options
+}
+
+func NewFactory(options *Options) (*Factory, error) {
+	if options.Device == "" {
+		return nil, errors.New("serial backend: --serial-device is required")
+	}
+	if _, err := os.Stat(options.Device); err != nil {
+		return nil, errors.Wrapf(err, "serial backend")
+	}
+	return &Factory{options: options}, nil
+}
+
+func (factory *Factory) Name() string {
+	return "serial"
+}
+
+func (factory *Factory) New(params map[string][]string, headers map[string][]string) (server.Slave, error) {
+	return New(factory.options.Device, factory.options.Baud)
+}
+
+type Serial struct {
+	device string
+	file   *os.File
+}
+
+// New opens the serial device and configures it as a raw 8N1 line at baud.
+func New(device string, baud int) (*Serial, error) {
+	file, err := os.OpenFile(device, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open serial device `%s`", device)
+	}
+	if err := rawterm.MakeSerial(file, baud); err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "failed to configure serial device `%s`", device)
+	}
+	return &Serial{device: device, file: file}, nil
+}
+
+func (serial *Serial) Read(p []byte) (n int, err error) {
+	return serial.file.Read(p)
+}
+
+func (serial *Serial) Write(p []byte) (n int, err error) {
+	return serial.file.Write(p)
+}
+
+func (serial *Serial) Close() error {
+	return serial.file.Close()
+}
+
+func (serial *Serial) WindowTitleVariables() map[string]interface{} {
+	return map[string]interface{}{
+		"command": serial.device,
+		"argv":    []string{},
+	}
+}
+
+// ResizeTerminal does nothing, a serial line has no window size.
+func (serial *Serial) ResizeTerminal(width int, height int) error {
+	return nil
+}
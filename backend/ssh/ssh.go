@@ -0,0 +1,66 @@
+// Package ssh provides a server.Factory that connects to a remote host
+// with the ssh client.
+package ssh
+
+import (
+	"os/exec"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/backend/localcommand"
+	"github.com/sorenisanerd/gotty/backend/upstream"
+)
+
+type Options struct {
+	Host         string   `hcl:"ssh_host" flagName:"ssh-host" flagDescribe:"Host to connect to, optionally as user@host (ssh backend)" default:""`
+	Port         int      `hcl:"ssh_port" flagName:"ssh-port" flagDescribe:"Port of the SSH server (ssh backend, 0 for the ssh default)" default:"0"`
+	IdentityFile string   `hcl:"ssh_identity_file" flagName:"ssh-identity-file" flagDescribe:"Private key to authenticate with (ssh backend)" default:""`
+	SSHOptions   []string `hcl:"ssh_options" flagName:"ssh-option" flagDescribe:"Option passed to ssh as -o (ssh backend, can be repeated)"`
+}
+
+type Factory struct {
+	*localcommand.Factory
+}
+
+// NewFactory creates a factory running argv on the remote host,
+// or a login shell when argv is empty, verifying it with upstreamOptions.
+func NewFactory(argv []string, options *Options, upstreamOptions *upstream.Options, commandOptions *localcommand.Options) (*Factory, error) {
+	if options.Host == "" {
+		return nil, errors.New("ssh backend: --ssh-host is required")
+	}
+
+	sshArgs := []string{"-t"}
+	if options.Port != 0 {
+		sshArgs = append(sshArgs, "-p", strconv.Itoa(options.Port))
+	}
+	if options.IdentityFile != "" {
+		sshArgs = append(sshArgs, "-i", options.IdentityFile)
+	} else if upstreamOptions.KeyFile != "" && upstreamOptions.CertFile == "" {
+		sshArgs = append(sshArgs, "-i", upstreamOptions.KeyFile)
+	}
+	for _, option := range options.SSHOptions {
+		sshArgs = append(sshArgs, "-o", option)
+	}
+	// after the options of users, as the first value of an option wins
+	sshArgs = append(sshArgs, upstreamOptions.SSHArgs()...)
+	// TERM goes with the pseudo-terminal, the locale of the client where
+	// the server accepts it with AcceptEnv
+	sshArgs = append(sshArgs, "-o", "SendEnv=LANG TZ")
+	sshArgs = append(append(sshArgs, "--", options.Host), argv...)
+
+	ssh, err := exec.LookPath("ssh")
+	if err != nil {
+		return nil, errors.Wrapf(err, "ssh backend")
+	}
+
+	factory, err := localcommand.NewFactory(ssh, sshArgs, commandOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &Factory{Factory: factory}, nil
+}
+
+func (factory *Factory) Name() string {
+	return "ssh"
+}
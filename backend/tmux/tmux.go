@@ -0,0 +1,43 @@
+// Package tmux provides a server.Factory that attaches every client
+// to the same tmux session, creating it when needed.
+package tmux
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/backend/localcommand"
+)
+
+type Options struct {
+	Session string `hcl:"tmux_session" flagName:"tmux-session" flagDescribe:"Name of the tmux session to attach to (tmux backend)" default:"gotty"`
+}
+
+type Factory struct {
+	*localcommand.Factory
+}
+
+// NewFactory creates a factory attaching to the session.
+// argv is the command the session starts with when it does not exist yet.
+func NewFactory(argv []string, options *Options, commandOptions *localcommand.Options) (*Factory, error) {
+	if options.Session == "" {
+		return nil, errors.New("tmux backend: --tmux-session can not be empty")
+	}
+
+	tmux, err := exec.LookPath("tmux")
+	if err != nil {
+		return nil, errors.Wrapf(err, "tmux backend")
+	}
+
+	tmuxArgs := append([]string{"new-session", "-A", "-s", options.Session}, argv...)
+	factory, err := localcommand.NewFactory(tmux, tmuxArgs, commandOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &Factory{Factory: factory}, nil
+}
+
+func (factory *Factory) Name() string {
+	return "tmux"
+}
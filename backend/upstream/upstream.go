@@ -0,0 +1,106 @@
+// Package upstream provides the client configuration shared by the backends
+// connecting to other hosts, so that they verify them the same way:
+// TLS certificates for the docker and k8s backends, host keys and timeouts
+// for the ssh backend.
+package upstream
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+)
+
+// Policies for SSH servers missing from the known hosts.
+const (
+	HostKeyReject    = "reject"
+	HostKeyAcceptNew = "accept-new"
+	// HostKeyAsk shows the fingerprint of the host key to the client in the
+	// terminal, remembering it once the client confirms it.
+	HostKeyAsk = "ask"
+)
+
+type Options struct {
+	CAFile         string `hcl:"upstream_ca_file" flagName:"upstream-ca" flagDescribe:"CA certificate to verify upstream servers with (docker and k8s backends)" default:""`
+	CertFile       string `hcl:"upstream_cert_file" flagName:"upstream-cert" flagDescribe:"Client certificate to authenticate to upstream servers with (docker and k8s backends)" default:""`
+	KeyFile        string `hcl:"upstream_key_file" flagName:"upstream-key" flagDescribe:"Private key of --upstream-cert, or to authenticate to SSH servers with unless --ssh-identity-file is given (docker, k8s and ssh backends)" default:""`
+	KnownHostsFile string `hcl:"upstream_known_hosts_file" flagName:"upstream-known-hosts" flagDescribe:"known_hosts file of the SSH servers, the one of ssh when empty (ssh backend)" default:""`
+	HostKeyPolicy  string `hcl:"upstream_host_key_policy" flagName:"upstream-host-key-policy" flagDescribe:"What to do with SSH servers missing from the known hosts: reject, accept-new to remember them, or ask to show clients the fingerprint of the host key and remember it once they confirm it (ssh backend)" default:"reject"`
+	ConnectTimeout int    `hcl:"upstream_connect_timeout" flagName:"upstream-connect-timeout" flagDescribe:"Seconds to connect to SSH servers within (ssh backend, 0 for the ssh default)" default:"10"`
+}
+
+// Validate checks that the policy is known and the files exist.
+func (options *Options) Validate() error {
+	if p := options.HostKeyPolicy; p != "" && p != HostKeyReject && p != HostKeyAcceptNew && p != HostKeyAsk {
+		return errors.Errorf("invalid host key policy `%s`, expected reject, accept-new or ask", p)
+	}
+	if options.ConnectTimeout < 0 {
+		return errors.New("--upstream-connect-timeout must not be negative")
+	}
+	if options.CertFile != "" && options.KeyFile == "" {
+		return errors.New("--upstream-cert requires --upstream-key")
+	}
+	for _, file := range []string{options.CAFile, options.CertFile, options.KeyFile, options.KnownHostsFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(expand(file)); err != nil {
+			return errors.Wrapf(err, "upstream")
+		}
+	}
+	return nil
+}
+
+// SSHArgs returns the arguments of ssh, to give after those of users so
+// that theirs take precedence.
+func (options *Options) SSHArgs() []string {
+	policy := "yes"
+	switch options.HostKeyPolicy {
+	case HostKeyAcceptNew:
+		policy = "accept-new"
+	case HostKeyAsk:
+		policy = "ask"
+	}
+	args := []string{"-o", "StrictHostKeyChecking=" + policy}
+	if options.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+expand(options.KnownHostsFile))
+	}
+	if options.ConnectTimeout > 0 {
+		args = append(args, "-o", "ConnectTimeout="+strconv.Itoa(options.ConnectTimeout))
+	}
+	return args
+}
+
+// DockerArgs returns the global arguments of docker,
+// which verify the daemon with TLS once a CA is given.
+func (options *Options) DockerArgs() []string {
+	if options.CAFile == "" {
+		return nil
+	}
+	args := []string{"--tlsverify", "--tlscacert", expand(options.CAFile)}
+	if options.CertFile != "" {
+		args = append(args, "--tlscert", expand(options.CertFile), "--tlskey", expand(options.KeyFile))
+	}
+	return args
+}
+
+// KubectlArgs returns the global arguments of kubectl.
+func (options *Options) KubectlArgs() []string {
+	var args []string
+	if options.CAFile != "" {
+		args = append(args, "--certificate-authority", expand(options.CAFile))
+	}
+	if options.CertFile != "" {
+		args = append(args, "--client-certificate", expand(options.CertFile), "--client-key", expand(options.KeyFile))
+	}
+	return args
+}
+
+func expand(path string) string {
+	if len(path) < 2 {
+		return path
+	}
+	return homedir.Expand(path)
+}
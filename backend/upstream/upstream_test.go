@@ -0,0 +1,65 @@
+package upstream
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sorenisanerd/gotty/utils"
+)
+
+func TestArgs(t *testing.T) {
+	options := &Options{}
+	if err := utils.ApplyDefaultValues(options); err != nil {
+		t.Fatal(err)
+	}
+	if err := options.Validate(); err != nil {
+		t.Fatalf("Validate() of the defaults returned error: %v", err)
+	}
+	if args := options.SSHArgs(); !reflect.DeepEqual(args, []string{"-o", "StrictHostKeyChecking=yes", "-o", "ConnectTimeout=10"}) {
+		t.Errorf("default ssh args = %q", args)
+	}
+	if args := options.DockerArgs(); args != nil {
+		t.Errorf("default docker args = %q, expected none", args)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"ca.pem", "cert.pem", "key.pem", "known_hosts"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+	}
+	options.CAFile = filepath.Join(dir, "ca.pem")
+	options.CertFile = filepath.Join(dir, "cert.pem")
+	options.KeyFile = filepath.Join(dir, "key.pem")
+	options.KnownHostsFile = filepath.Join(dir, "known_hosts")
+	options.HostKeyPolicy = HostKeyAcceptNew
+	if err := options.Validate(); err != nil {
+		t.Fatalf("Validate() returned error: %v", err)
+	}
+	expected := []string{"-o", "StrictHostKeyChecking=accept-new", "-o", "UserKnownHostsFile=" + options.KnownHostsFile, "-o", "ConnectTimeout=10"}
+	if args := options.SSHArgs(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("ssh args = %q, expected %q", args, expected)
+	}
+	options.HostKeyPolicy = HostKeyAsk
+	if args := options.SSHArgs(); args[1] != "StrictHostKeyChecking=ask" {
+		t.Errorf("ssh args with the ask policy = %q", args)
+	}
+	expected = []string{"--tlsverify", "--tlscacert", options.CAFile, "--tlscert", options.CertFile, "--tlskey", options.KeyFile}
+	if args := options.DockerArgs(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("docker args = %q, expected %q", args, expected)
+	}
+	expected = []string{"--certificate-authority", options.CAFile, "--client-certificate", options.CertFile, "--client-key", options.KeyFile}
+	if args := options.KubectlArgs(); !reflect.DeepEqual(args, expected) {
+		t.Errorf("kubectl args = %q, expected %q", args, expected)
+	}
+
+	for _, invalid := range []Options{
+		{HostKeyPolicy: "trust"},
+		{CertFile: options.CertFile},
+		{CAFile: filepath.Join(dir, "missing.pem")},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Validate() accepted %+v", invalid)
+		}
+	}
+}
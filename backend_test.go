@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackends(t *testing.T) {
+	// the clients of the backends, which may not be installed
+	bin := t.TempDir()
+	for _, name := range []string{"docker", "kubectl", "ssh", "tmux"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for _, test := range []struct {
+		backend   string
+		argv      []string
+		configure func(cfg *config)
+		expected  string // name of the factory, or else the error
+	}{
+		{"command", []string{"true"}, func(cfg *config) {}, "local command"},
+		{"command", nil, func(cfg *config) {}, "no command given"},
+		{"docker", nil, func(cfg *config) { cfg.docker.Image = "alpine" }, "docker"},
+		{"docker", nil, func(cfg *config) {}, "--docker-image or --docker-container is required"},
+		{"k8s", []string{"sh"}, func(cfg *config) { cfg.kubernetes.Pod = "web" }, "kubernetes"},
+		{"k8s", nil, func(cfg *config) {}, "--k8s-pod is required"},
+		{"ssh", nil, func(cfg *config) { cfg.ssh.Host = "user@example.com" }, "ssh"},
+		{"ssh", nil, func(cfg *config) {}, "--ssh-host is required"},
+		{"serial", nil, func(cfg *config) { cfg.serial.Device = "/dev/ttyUSB0" }, "serial"},
+		{"serial", nil, func(cfg *config) {}, "--serial-device is required"},
+		{"tmux", nil, func(cfg *config) {}, "tmux"},
+		{"telnet", nil, func(cfg *config) {}, "unknown backend `telnet`"},
+	} {
+		cfg := newConfig()
+		cfg.backend.Backend = test.backend
+		test.configure(cfg)
+		factory, err := newFactory(cfg, test.argv)
+		if err != nil {
+			if !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("newFactory() of the %s backend returned %v, expected `%s`", test.backend, err, test.expected)
+			}
+			continue
+		}
+		if name := factory.Name(); name != test.expected {
+			t.Errorf("newFactory() of the %s backend created a %s factory, expected %s", test.backend, name, test.expected)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/sorenisanerd/gotty/bench"
+)
+
+func benchCommand() *cli.Command {
+	defaults := bench.DefaultOptions()
+	return &cli.Command{
+		Name:      "bench",
+		Usage:     "Measure the throughput and latency of GoTTY on this machine",
+		ArgsUsage: "[<scenario>...]",
+		Description: "Runs synthetic sessions through servers on the loopback interface and reports\n" +
+			"the throughput and latency of each scenario: " + strings.Join(bench.Scenarios, ", ") + " (all by default).\n" +
+			"bulk streams output to a client, small echoes keystrokes one by one, and\n" +
+			"concurrent streams output to many clients at once.",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "bytes",
+				Value: defaults.Bytes,
+				Usage: "Output of each session in the bulk and concurrent scenarios",
+			},
+			&cli.IntFlag{
+				Name:  "writes",
+				Value: defaults.Writes,
+				Usage: "Keystrokes echoed in the small scenario",
+			},
+			&cli.IntFlag{
+				Name:  "sessions",
+				Value: defaults.Sessions,
+				Usage: "Simultaneous sessions in the concurrent scenario",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			scenarios := c.Args().Slice()
+			if len(scenarios) == 0 {
+				scenarios = bench.Scenarios
+			}
+			options := bench.Options{
+				Bytes:    c.Int("bytes"),
+				Writes:   c.Int("writes"),
+				Sessions: c.Int("sessions"),
+			}
+			for _, scenario := range scenarios {
+				result, err := bench.Run(context.Background(), scenario, options)
+				if err != nil {
+					exit(err, 1)
+				}
+				fmt.Println(result)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,256 @@
+// Package bench measures the end-to-end throughput and latency of GoTTY,
+// from synthetic backends to WebSocket clients through real servers on the
+// loopback interface, for `gotty bench` and the benchmarks of the package.
+package bench
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/utils"
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// Scenarios are the names of the scenarios of Run.
+var Scenarios = []string{"bulk", "small", "concurrent"}
+
+// Options configures a scenario.
+type Options struct {
+	// Bytes is the output of each session in the bulk and concurrent
+	// scenarios.
+	Bytes int
+	// Writes is the number of keystrokes echoed in the small scenario.
+	Writes int
+	// Sessions is the number of simultaneous sessions of the concurrent
+	// scenario, each served by its own server.
+	Sessions int
+	// Server are the server options, defaults with write permitted if nil.
+	Server *server.Options
+}
+
+// DefaultOptions returns the options of `gotty bench`.
+func DefaultOptions() Options {
+	return Options{Bytes: 64 << 20, Writes: 10000, Sessions: 50}
+}
+
+// Result is the measure of a scenario.
+type Result struct {
+	Scenario string
+	Sessions int
+	Bytes    int64 // output received by clients
+	Messages int64 // output messages received by clients
+	Elapsed  time.Duration
+	// Latencies are the round trips of keystrokes in the small scenario,
+	// and the time to the first output in others, sorted.
+	Latencies []time.Duration
+}
+
+// Throughput returns the received output in bytes per second.
+func (r *Result) Throughput() float64 {
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+// Percentile returns the p-th percentile of the latencies, e.g. 0.99.
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	return r.Latencies[int(p*float64(len(r.Latencies)-1))]
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("%-10s sessions=%d bytes=%d messages=%d elapsed=%s throughput=%.1fMB/s latency_p50=%s latency_p99=%s",
+		r.Scenario, r.Sessions, r.Bytes, r.Messages, r.Elapsed.Round(time.Millisecond),
+		r.Throughput()/(1<<20), r.Percentile(0.5), r.Percentile(0.99))
+}
+
+// Run runs the scenario name.
+func Run(ctx context.Context, name string, options Options) (*Result, error) {
+	switch name {
+	case "bulk":
+		return runOutput(ctx, name, 1, options)
+	case "small":
+		return runEcho(ctx, options)
+	case "concurrent":
+		return runOutput(ctx, name, options.Sessions, options)
+	}
+	return nil, fmt.Errorf("unknown scenario `%s`, expected %s", name, strings.Join(Scenarios, ", "))
+}
+
+// runOutput measures sessions receiving options.Bytes of output each.
+func runOutput(ctx context.Context, name string, sessions int, options Options) (*Result, error) {
+	result := &Result{Scenario: name, Sessions: sessions}
+	clients := make([]*client, sessions)
+	for i := range clients {
+		c, err := start(ctx, options.Server, func() *slave { return &slave{remaining: options.Bytes} })
+		if err != nil {
+			return nil, err
+		}
+		defer c.close()
+		clients[i] = c
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	begin := time.Now()
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *client) {
+			defer wg.Done()
+			err := c.dial()
+			var first time.Duration
+			var bytes, messages int64
+			for err == nil {
+				var n int
+				if n, err = c.output(); err == nil {
+					if first == 0 {
+						first = time.Since(begin)
+					}
+					bytes += int64(n)
+					messages++
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !errors.Is(err, io.EOF) {
+				errs = append(errs, err)
+			}
+			result.Bytes += bytes
+			result.Messages += messages
+			result.Latencies = append(result.Latencies, first)
+		}(c)
+	}
+	wg.Wait()
+	result.Elapsed = time.Since(begin)
+	sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+	return result, errors.Join(errs...)
+}
+
+// runEcho measures the round trips of keystrokes echoed one by one.
+func runEcho(ctx context.Context, options Options) (*Result, error) {
+	c, err := start(ctx, options.Server, func() *slave { return &slave{echo: make(chan []byte, 1)} })
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	if err := c.dial(); err != nil {
+		return nil, err
+	}
+
+	result := &Result{Scenario: "small", Sessions: 1, Latencies: make([]time.Duration, 0, options.Writes)}
+	input := []byte(string(webtty.Input) + "x")
+	begin := time.Now()
+	for i := 0; i < options.Writes; i++ {
+		sent := time.Now()
+		if err := c.conn.WriteMessage(websocket.TextMessage, input); err != nil {
+			return nil, err
+		}
+		n, err := c.output()
+		if err != nil {
+			return nil, err
+		}
+		result.Latencies = append(result.Latencies, time.Since(sent))
+		result.Bytes += int64(n)
+		result.Messages++
+	}
+	result.Elapsed = time.Since(begin)
+	sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+	return result, nil
+}
+
+// client is a server with a single session and its WebSocket client.
+type client struct {
+	url    string
+	cancel context.CancelFunc
+	done   chan struct{}
+	conn   *websocket.Conn
+	buffer []byte
+}
+
+func start(ctx context.Context, options *server.Options, newSlave func() *slave) (*client, error) {
+	if options == nil {
+		options = &server.Options{}
+		if err := utils.ApplyDefaultValues(options); err != nil {
+			return nil, err
+		}
+		options.PermitWrite = true
+		options.TitleVariables = map[string]interface{}{"command": "bench"}
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	srv, err := server.New(options,
+		server.WithFactory(factory(newSlave)),
+		server.WithListener(listener),
+		server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c := &client{url: "ws://" + listener.Addr().String() + "/ws", cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		srv.Run(ctx)
+	}()
+	return c, nil
+}
+
+func (c *client) dial() error {
+	dialer := websocket.Dialer{Subprotocols: webtty.Protocols}
+	conn, _, err := dialer.Dial(c.url, nil)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	init, _ := json.Marshal(server.InitMessage{})
+	return conn.WriteMessage(websocket.TextMessage, init)
+}
+
+// output returns the length of the next output, or io.EOF at the end of
+// the session.
+func (c *client) output() (int, error) {
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, server.CloseSlaveExited) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(message) == 0 || message[0] != webtty.Output {
+			continue
+		}
+		if n := base64.StdEncoding.DecodedLen(len(message) - 1); len(c.buffer) < n {
+			c.buffer = make([]byte, n)
+		}
+		return base64.StdEncoding.Decode(c.buffer, message[1:])
+	}
+}
+
+func (c *client) close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.cancel()
+	<-c.done
+}
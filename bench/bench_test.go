@@ -0,0 +1,54 @@
+package bench
+
+import (
+	"context"
+	"testing"
+)
+
+func benchmark(b *testing.B, name string, options Options) {
+	var bytes int64
+	for i := 0; i < b.N; i++ {
+		result, err := Run(context.Background(), name, options)
+		if err != nil {
+			b.Fatal(err)
+		}
+		bytes += result.Bytes
+		b.ReportMetric(float64(result.Percentile(0.99).Microseconds()), "p99-µs")
+	}
+	b.SetBytes(bytes / int64(b.N))
+}
+
+func BenchmarkBulk(b *testing.B) {
+	benchmark(b, "bulk", Options{Bytes: 16 << 20})
+}
+
+func BenchmarkSmallWrites(b *testing.B) {
+	benchmark(b, "small", Options{Writes: 1000})
+}
+
+func BenchmarkConcurrent(b *testing.B) {
+	benchmark(b, "concurrent", Options{Bytes: 1 << 20, Sessions: 20})
+}
+
+func TestRun(t *testing.T) {
+	for _, name := range Scenarios {
+		result, err := Run(context.Background(), name, Options{Bytes: 100000, Writes: 10, Sessions: 3})
+		if err != nil {
+			t.Fatalf("Run(%s) returned error: %v", name, err)
+		}
+		expected := int64(100000)
+		switch name {
+		case "small":
+			expected = 10
+		case "concurrent":
+			expected *= 3
+		}
+		if result.Bytes != expected {
+			t.Errorf("%s received %d bytes, expected %d", name, result.Bytes, expected)
+		}
+	}
+
+	if _, err := Run(context.Background(), "unknown", Options{}); err == nil {
+		t.Errorf("Run() accepted an unknown scenario")
+	}
+}
@@ -0,0 +1,77 @@
+package bench
+
+import (
+	"io"
+	"sync"
+
+	"github.com/sorenisanerd/gotty/server"
+)
+
+// factory creates synthetic slaves, which spare the cost of real commands
+// from the measures.
+type factory func() *slave
+
+func (f factory) Name() string {
+	return "bench"
+}
+
+func (f factory) New(params map[string][]string, headers map[string][]string) (server.Slave, error) {
+	s := f()
+	s.closed = make(chan struct{})
+	return s, nil
+}
+
+// slave outputs remaining bytes as fast as it is read then exits, or
+// echoes its input when echo is set.
+type slave struct {
+	remaining int
+	echo      chan []byte
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (s *slave) Read(p []byte) (int, error) {
+	if s.echo != nil {
+		select {
+		case input := <-s.echo:
+			return copy(p, input), nil
+		case <-s.closed:
+			return 0, io.EOF
+		}
+	}
+	if s.remaining == 0 {
+		return 0, io.EOF
+	}
+	n := min(len(p), s.remaining)
+	for i := range p[:n] {
+		p[i] = 'x'
+	}
+	s.remaining -= n
+	return n, nil
+}
+
+func (s *slave) Write(p []byte) (int, error) {
+	if s.echo == nil {
+		return len(p), nil
+	}
+	select {
+	case s.echo <- append([]byte(nil), p...):
+		return len(p), nil
+	case <-s.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (s *slave) WindowTitleVariables() map[string]interface{} {
+	return map[string]interface{}{"command": "bench"}
+}
+
+func (s *slave) ResizeTerminal(columns int, rows int) error {
+	return nil
+}
+
+func (s *slave) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/sorenisanerd/gotty/pkg/metrics"
+	"github.com/sorenisanerd/gotty/server"
+)
+
+func checkCommand(cfg *config) *cli.Command {
+	cliFlags, flagMappings := commandFlags(cfg)
+
+	return &cli.Command{
+		Name:      "check",
+		Usage:     "Validate the configuration and exit without starting the server",
+		ArgsUsage: "<command> [<arguments...>]",
+		Flags:     cliFlags,
+		Action: func(c *cli.Context) error {
+			loadOptions(c, cliFlags, flagMappings, cfg)
+
+			errs := checkConfiguration(c.Args(), cfg, c.String("config"))
+			for _, err := range errs {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			}
+			if len(errs) > 0 {
+				exit(fmt.Errorf("Configuration check failed with %d error(s)", len(errs)), 1)
+			}
+
+			fmt.Println("Configuration OK")
+			return nil
+		},
+	}
+}
+
+// checkConfiguration runs every check it can, with the tenants of configFile,
+// and returns all the problems found.
+func checkConfiguration(args cli.Args, cfg *config, configFile string) []error {
+	var errs []error
+	argv := commandArgv(args.Slice(), cfg)
+	if cfg.backend.Backend == "command" && len(argv) > 0 {
+		if _, err := exec.LookPath(argv[0]); err != nil {
+			errs = append(errs, fmt.Errorf("command `%s` not found: %s", argv[0], err))
+		}
+	}
+
+	if len(cfg.tenant.Tenants) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := newTenants(ctx, configFile, cfg.tenant.Tenants, tenantsPath(cfg.app), cfg.app, metrics.Nop{}, slog.Default())
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	factory, err := newFactory(cfg, argv)
+	if err != nil {
+		return append(errs, err)
+	}
+
+	srv, err := server.New(cfg.app, server.WithFactory(factory))
+	if err != nil {
+		return append(errs, err)
+	}
+
+	return append(errs, srv.Preflight()...)
+}
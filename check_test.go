@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+// testArgs returns args as the arguments of a command line.
+func testArgs(t *testing.T, args ...string) cli.Args {
+	t.Helper()
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cli.NewContext(nil, set, nil).Args()
+}
+
+func TestCheckConfiguration(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, usedPort, _ := net.SplitHostPort(listener.Addr().String())
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	configFile := writeTenantsConfig(t)
+
+	for _, test := range []struct {
+		description string
+		args        []string
+		configure   func(cfg *config)
+		expected    []string
+	}{
+		{"valid", []string{"true"}, func(cfg *config) {}, nil},
+		{"without a command", nil, func(cfg *config) {}, []string{"no command given"}},
+		{"with a missing command", []string{"gotty-missing-command"}, func(cfg *config) {}, []string{"command `gotty-missing-command` not found"}},
+		{"with a port in use", []string{"true"}, func(cfg *config) {
+			cfg.app.Port = usedPort
+		}, []string{"failed to listen at `127.0.0.1:" + usedPort + "`"}},
+		{"with an invalid title format", []string{"true"}, func(cfg *config) {
+			cfg.app.TitleFormat = "{{ .command"
+		}, []string{"failed to parse window title format"}},
+		{"with the command of the config file", nil, func(cfg *config) {
+			cfg.backend.Command = []string{"true"}
+		}, nil},
+		{"with a missing command of the config file", nil, func(cfg *config) {
+			cfg.backend.Command = []string{"gotty-missing-command"}
+		}, []string{"command `gotty-missing-command` not found"}},
+		{"with tenants", []string{"true"}, func(cfg *config) {
+			cfg.tenant.Tenants = []string{"acme", "globex"}
+		}, nil},
+		{"with an invalid tenant", []string{"true"}, func(cfg *config) {
+			cfg.tenant.Tenants = []string{"acme", "initech"}
+		}, []string{"tenant `initech`: failed to parse window title format"}},
+		{"with every problem", []string{"gotty-missing-command"}, func(cfg *config) {
+			cfg.app.Port = usedPort
+			cfg.app.EnableTLS = true
+			cfg.app.TLSCrtFile = missing
+			cfg.app.TLSKeyFile = missing
+		}, []string{"command `gotty-missing-command` not found", "failed to load TLS crt file", "failed to listen"}},
+	} {
+		cfg := newConfig()
+		cfg.app.Address = "127.0.0.1"
+		cfg.app.Port = "0"
+		test.configure(cfg)
+
+		errs := checkConfiguration(testArgs(t, test.args...), cfg, configFile)
+		if len(errs) != len(test.expected) {
+			t.Errorf("checkConfiguration() %s returned %v, expected %d errors", test.description, errs, len(test.expected))
+			continue
+		}
+		for i, err := range errs {
+			if !strings.Contains(err.Error(), test.expected[i]) {
+				t.Errorf("checkConfiguration() %s returned %v, expected `%s`", test.description, err, test.expected[i])
+			}
+		}
+	}
+}
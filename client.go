@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/sorenisanerd/gotty/client"
+	"github.com/sorenisanerd/gotty/pkg/rawterm"
+	"github.com/sorenisanerd/gotty/utils"
+)
+
+func clientCommand() *cli.Command {
+	clientOptions := &client.Options{}
+	if err := utils.ApplyDefaultValues(clientOptions); err != nil {
+		exit(err, 1)
+	}
+	cliFlags, flagMappings, err := utils.GenerateFlags(clientOptions)
+	if err != nil {
+		exit(err, 3)
+	}
+
+	return &cli.Command{
+		Name:      "client",
+		Usage:     "Connect this terminal to a remote GoTTY server",
+		ArgsUsage: "<url> [<arguments...>]",
+		Flags:     cliFlags,
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				cli.ShowSubcommandHelp(c)
+				exit(fmt.Errorf("Error: No URL given."), 1)
+			}
+			utils.ApplyFlags(cliFlags, flagMappings, c, clientOptions)
+
+			cl, err := client.New(c.Args().First(), clientOptions)
+			if err != nil {
+				exit(err, 3)
+			}
+
+			if err := runClient(cl, c.Args().Tail()); err != nil {
+				exit(err, 8)
+			}
+			return nil
+		},
+	}
+}
+
+func runClient(cl *client.Client, args []string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGWINCH)
+	defer signal.Stop(sigChan)
+
+	size := client.Size{Columns: 80, Rows: 24}
+	if rows, columns, err := pty.Getsize(os.Stdin); err == nil {
+		size = client.Size{Columns: columns, Rows: rows}
+	}
+
+	resize := make(chan client.Size, 1)
+	go func() {
+		for s := range sigChan {
+			if s != syscall.SIGWINCH {
+				cancel()
+				return
+			}
+			if rows, columns, err := pty.Getsize(os.Stdin); err == nil {
+				select {
+				case resize <- client.Size{Columns: columns, Rows: rows}:
+				default:
+				}
+			}
+		}
+	}()
+
+	if rawterm.IsTerminal(os.Stdin) {
+		state, err := rawterm.MakeRaw(os.Stdin)
+		if err != nil {
+			return err
+		}
+		defer rawterm.Restore(os.Stdin, state)
+	}
+
+	err := cl.Run(ctx, args, os.Stdin, os.Stdout, size, resize)
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,318 @@
+// Package client connects a local terminal to a remote GoTTY server,
+// speaking the same protocol as the web frontend.
+package client
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+type Options struct {
+	Credential   string `flagName:"credential" flagSName:"c" flagDescribe:"Credential for Basic Authentication (ex: user:pass)" default:""`
+	Token        string `flagName:"token" flagDescribe:"Access token (see gotty token) or JSON Web Token to authenticate the session with, instead of the credential" default:""`
+	Bearer       string `flagName:"bearer" flagDescribe:"JSON Web Token to send in the Authorization header" default:""`
+	OIDC         bool   `flagName:"oidc" flagDescribe:"Sign in at the OpenID Connect provider of a server with --oidc-issuer, in a browser elsewhere" default:"false"`
+	TLSCACrtFile string `flagName:"tls-ca-crt" flagDescribe:"CA certificate file to verify the server certificate" default:""`
+	TLSCrtFile   string `flagName:"tls-crt" flagDescribe:"Certificate file for TLS client authentication" default:""`
+	TLSKeyFile   string `flagName:"tls-key" flagDescribe:"Key file for TLS client authentication" default:""`
+	Insecure     bool   `flagName:"insecure" flagDescribe:"Don't verify the server certificate (BE CAREFUL)" default:"false"`
+}
+
+// Size is the size of the local terminal.
+type Size struct {
+	Columns int
+	Rows    int
+}
+
+// Client connects to a GoTTY server.
+type Client struct {
+	url        string
+	options    *Options
+	dialer     *websocket.Dialer
+	header     http.Header
+	httpClient *http.Client // for signing in with Options.OIDC
+}
+
+// New creates a client for the GoTTY server at rawURL,
+// which is the URL a browser would open, e.g. https://example.com:8080/
+func New(rawURL string, options *Options) (*Client, error) {
+	wsURL, err := websocketURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := options.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if options.Bearer != "" {
+		header.Set("Authorization", "Bearer "+options.Bearer)
+	} else if options.Credential != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(options.Credential)))
+	}
+
+	return &Client{
+		url:     wsURL,
+		options: options,
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 45 * time.Second,
+			Subprotocols:     webtty.Protocols,
+			TLSClientConfig:  tlsConfig,
+		},
+		header: header,
+		httpClient: &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+			Timeout:   45 * time.Second,
+		},
+	}, nil
+}
+
+func websocketURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL `%s`: %w", rawURL, err)
+	}
+
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported URL scheme `%s`, expected http or https", u.Scheme)
+	}
+	if !strings.HasSuffix(u.Path, "/ws") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/ws"
+	}
+	return u.String(), nil
+}
+
+func (options *Options) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: options.Insecure}
+
+	if options.TLSCACrtFile != "" {
+		caFile := homedir.Expand(options.TLSCACrtFile)
+		caCert, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not open CA crt file `%s`: %w", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("could not parse CA crt file data in `%s`", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if options.TLSCrtFile != "" || options.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(homedir.Expand(options.TLSCrtFile), homedir.Expand(options.TLSKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// Run connects to the server and bridges it with the local terminal until
+// either side closes. args are passed to the server as command arguments,
+// which requires the server to permit them.
+// Sizes received from resize are sent to the server as terminal resizes.
+// With Options.OIDC, it signs in first, telling the user how on stdout.
+func (client *Client) Run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, size Size, resize <-chan Size) error {
+	if client.options.OIDC && client.header.Get("Cookie") == "" {
+		if err := client.SignIn(ctx, stdout); err != nil {
+			return err
+		}
+	}
+
+	conn, resp, err := client.dialer.DialContext(ctx, client.url, client.header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("failed to connect to `%s` (%s): %w", client.url, resp.Status, err)
+		}
+		return fmt.Errorf("failed to connect to `%s`: %w", client.url, err)
+	}
+	defer conn.Close()
+
+	c := &connection{conn: conn, bufferSize: 1024}
+
+	init := server.InitMessage{Version: 2, AuthToken: cmp.Or(client.options.Token, client.options.Credential)}
+	if len(args) > 0 {
+		init.Args = args
+		init.Arguments = "?" + url.Values{"arg": args}.Encode() // for older servers
+	}
+	if size.Columns > 0 && size.Rows > 0 {
+		init.Columns, init.Rows = size.Columns, size.Rows
+	}
+	initMessage, _ := json.Marshal(init)
+	if err := c.write(initMessage); err != nil {
+		return err
+	}
+	if err := c.sendResize(size); err != nil {
+		return err
+	}
+	if err := c.write([]byte{webtty.SetEncoding}, []byte("base64")...); err != nil {
+		return err
+	}
+
+	errs := make(chan error, 3)
+	go func() {
+		errs <- c.receive(stdout)
+	}()
+	go func() {
+		// keep receiving output after the end of input
+		if err := c.send(stdin); err != nil {
+			errs <- err
+		}
+	}()
+	go func() {
+		errs <- c.keepalive(ctx, resize)
+	}()
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return err
+}
+
+type connection struct {
+	conn       *websocket.Conn
+	writeMutex sync.Mutex
+	bufferSize int64
+}
+
+func (c *connection) write(data []byte, rest ...byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, append(data, rest...))
+}
+
+func (c *connection) sendResize(size Size) error {
+	payload, _ := json.Marshal(map[string]int{"columns": size.Columns, "rows": size.Rows})
+	return c.write([]byte{webtty.ResizeTerminal}, payload...)
+}
+
+// receive handles messages from the server until the connection is closed.
+// A connection closed by the server is not an error.
+func (c *connection) receive(stdout io.Writer) error {
+	initialized := false
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				switch {
+				case closeErr.Code == websocket.ClosePolicyViolation:
+					return errors.New("authentication failed (wrong credential?)")
+				case !initialized && closeErr.Code == websocket.CloseAbnormalClosure:
+					return errors.New("connection closed by server before the session started (wrong credential?)")
+				case closeErr.Code == websocket.CloseNormalClosure, closeErr.Code == server.CloseSlaveExited, closeErr.Code == websocket.CloseAbnormalClosure:
+					return nil
+				}
+				return fmt.Errorf("connection closed by server: %s", closeErr.Text)
+			}
+			return fmt.Errorf("failed to read from server: %w", err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		initialized = true
+
+		switch data[0] {
+		case webtty.Output:
+			decoded, err := base64.StdEncoding.DecodeString(string(data[1:]))
+			if err != nil {
+				return fmt.Errorf("received malformed output: %w", err)
+			}
+			if _, err := stdout.Write(decoded); err != nil {
+				return err
+			}
+		case webtty.SetWindowTitle:
+			fmt.Fprintf(stdout, "\x1b]0;%s\x07", data[1:])
+		case webtty.OutputDropped:
+			var dropped int64
+			if err := json.Unmarshal(data[1:], &dropped); err == nil {
+				fmt.Fprintf(stdout, "\r\n\x1b[7m[output truncated: %d KB skipped]\x1b[0m\r\n", (dropped+1023)/1024)
+			}
+		case webtty.SetBufferSize:
+			var size int64
+			if err := json.Unmarshal(data[1:], &size); err == nil && size > 1 {
+				atomic.StoreInt64(&c.bufferSize, size)
+			}
+		}
+	}
+}
+
+// send forwards input in chunks the server can decode into its buffer.
+func (c *connection) send(stdin io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stdin.Read(buf)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		maxChunkSize := int((atomic.LoadInt64(&c.bufferSize)-1)/4) * 3
+		for input := buf[:n]; len(input) > 0; {
+			chunk := input
+			if len(chunk) > maxChunkSize {
+				chunk = chunk[:maxChunkSize]
+			}
+			input = input[len(chunk):]
+
+			encoded := base64.StdEncoding.EncodeToString(chunk)
+			if err := c.write([]byte{webtty.Input}, []byte(encoded)...); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *connection) keepalive(ctx context.Context, resize <-chan Size) error {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case size := <-resize:
+			if err := c.sendResize(size); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := c.write([]byte{webtty.Ping}); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sorenisanerd/gotty/client"
+	"github.com/sorenisanerd/gotty/pkg/accesstoken"
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/utils"
+)
+
+// echoSlave outputs its input and records its arguments and size.
+type echoSlave struct {
+	params map[string][]string
+	output chan []byte
+	exited chan struct{}
+	once   sync.Once
+
+	mutex   sync.Mutex
+	columns int
+	rows    int
+}
+
+func (s *echoSlave) Read(p []byte) (int, error) {
+	select {
+	case data := <-s.output:
+		return copy(p, data), nil
+	case <-s.exited:
+		return 0, io.EOF
+	}
+}
+
+func (s *echoSlave) Write(p []byte) (int, error) {
+	s.output <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func (s *echoSlave) WindowTitleVariables() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func (s *echoSlave) ResizeTerminal(columns int, rows int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.columns, s.rows = columns, rows
+	return nil
+}
+
+func (s *echoSlave) size() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.columns, s.rows
+}
+
+// exit ends the command of the session.
+func (s *echoSlave) exit() {
+	s.once.Do(func() { close(s.exited) })
+}
+
+func (s *echoSlave) Close() error {
+	s.exit()
+	return nil
+}
+
+type echoFactory struct {
+	mutex  sync.Mutex
+	slaves []*echoSlave
+}
+
+func (f *echoFactory) Name() string {
+	return "echo"
+}
+
+func (f *echoFactory) New(params map[string][]string, headers map[string][]string) (server.Slave, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	slave := &echoSlave{params: params, output: make(chan []byte, 16), exited: make(chan struct{})}
+	f.slaves = append(f.slaves, slave)
+	return slave, nil
+}
+
+func (f *echoFactory) started() []*echoSlave {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]*echoSlave(nil), f.slaves...)
+}
+
+// startServer runs a server serving sessions after each other with the basic
+// credential user:pass, and the options set by configure if not nil, until
+// the end of the test, returning its URL.
+func startServer(t *testing.T, factory server.Factory, configure func(options *server.Options)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := &server.Options{}
+	if err := utils.ApplyDefaultValues(options); err != nil {
+		t.Fatal(err)
+	}
+	options.PermitWrite = true
+	options.PermitArguments = true
+	options.EnableBasicAuth = true
+	options.Credential = "user:pass"
+	options.TitleFormat = "gotty@test"
+	options.Quiet = true
+	if configure != nil {
+		configure(options)
+	}
+	srv, err := server.New(options, server.WithFactory(factory), server.WithListener(listener), server.WithReuse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return "http://" + listener.Addr().String() + "/"
+}
+
+// output is the stdout of a client.
+type output struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *output) String() string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.buf.String()
+}
+
+// wait waits for cond, failing the test after a second.
+func wait(t *testing.T, description string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	factory := &echoFactory{}
+	url := startServer(t, factory, nil)
+
+	cl, err := client.New(url, &client.Options{Credential: "user:pass"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, input := io.Pipe()
+	defer input.Close()
+	stdout := &output{}
+	resize := make(chan client.Size)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- cl.Run(context.Background(), []string{"-l"}, stdin, stdout, client.Size{Columns: 100, Rows: 30}, resize)
+	}()
+
+	wait(t, "the session", func() bool { return len(factory.started()) == 1 })
+	slave := factory.started()[0]
+	wait(t, "the size", func() bool { columns, rows := slave.size(); return columns == 100 && rows == 30 })
+	if args := slave.params["arg"]; len(args) != 1 || args[0] != "-l" {
+		t.Errorf("args = %v, expected -l", args)
+	}
+
+	input.Write([]byte("héllo"))
+	wait(t, "the output", func() bool { return strings.Contains(stdout.String(), "héllo") })
+	if !strings.HasPrefix(stdout.String(), "\x1b]0;gotty@test\x07") {
+		t.Errorf("output = %q, expected the window title first", stdout.String())
+	}
+	resize <- client.Size{Columns: 120, Rows: 40}
+	wait(t, "the resize", func() bool { columns, rows := slave.size(); return columns == 120 && rows == 40 })
+
+	// the end of the session is not an error
+	slave.exit()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("Run() returned %v once the command exited", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run() did not return once the command exited")
+	}
+}
+
+func TestRunTokens(t *testing.T) {
+	factory := &echoFactory{}
+	url := startServer(t, factory, func(options *server.Options) {
+		options.TokenSecret = "token-secret"
+		options.JWTSecret = "jwt-secret"
+	})
+
+	accessToken, err := accesstoken.Sign([]byte("token-secret"), accesstoken.New(time.Hour, false, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte("jwt-secret"))
+	mac.Write([]byte(signed))
+	jwt := signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	for i, test := range []struct {
+		options     *client.Options
+		description string
+	}{
+		{&client.Options{Token: accessToken}, "with an access token"},
+		{&client.Options{Token: jwt}, "with a JWT"},
+		{&client.Options{Bearer: jwt}, "with a JWT as bearer"},
+	} {
+		cl, err := client.New(url, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := make(chan error, 1)
+		go func() {
+			errs <- cl.Run(context.Background(), nil, strings.NewReader(""), io.Discard, client.Size{}, nil)
+		}()
+		wait(t, "the session "+test.description, func() bool { return len(factory.started()) == i+1 })
+		factory.started()[i].exit()
+		if err := <-errs; err != nil {
+			t.Errorf("Run() %s returned %v", test.description, err)
+		}
+	}
+
+	for _, options := range []*client.Options{{Token: "wrong"}, {Bearer: "wrong"}} {
+		cl, err := client.New(url, options)
+		if err == nil {
+			err = cl.Run(context.Background(), nil, strings.NewReader(""), io.Discard, client.Size{}, nil)
+		}
+		if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+			t.Errorf("client with %+v returned %v, expected the authentication to fail", options, err)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	url := startServer(t, &echoFactory{}, nil)
+
+	for _, test := range []struct {
+		url         string
+		options     *client.Options
+		expected    string
+		description string
+	}{
+		{url, &client.Options{Credential: "user:wrong"}, "wrong credential", "with a wrong credential"},
+		{strings.Replace(url, "http", "ftp", 1), &client.Options{}, "unsupported URL scheme `ftp`", "with another scheme"},
+		{url, &client.Options{TLSCACrtFile: "/nonexistent/ca.pem"}, "could not open CA crt file", "without the CA certificate"},
+	} {
+		cl, err := client.New(test.url, test.options)
+		if err == nil {
+			err = cl.Run(context.Background(), nil, strings.NewReader(""), io.Discard, client.Size{}, nil)
+		}
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("client %s returned %v, expected `%s`", test.description, err, test.expected)
+		}
+	}
+}
+
+func TestRunOIDC(t *testing.T) {
+	var provider *httptest.Server
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                        provider.URL,
+				"authorization_endpoint":        provider.URL + "/authorize",
+				"token_endpoint":                provider.URL + "/token",
+				"device_authorization_endpoint": provider.URL + "/device",
+			})
+		case "/device":
+			json.NewEncoder(w).Encode(map[string]any{"device_code": "device", "user_code": "ABCD-EFGH", "verification_uri": provider.URL + "/activate", "expires_in": 60, "interval": 1})
+		case "/token":
+			if r.FormValue("device_code") != "device" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			claims, _ := json.Marshal(map[string]any{"iss": provider.URL, "aud": "gotty", "exp": time.Now().Add(time.Hour).Unix(), "preferred_username": "alice"})
+			json.NewEncoder(w).Encode(map[string]string{"id_token": "e30." + base64.RawURLEncoding.EncodeToString(claims) + ".c2ln"})
+		}
+	}))
+	defer provider.Close()
+
+	factory := &echoFactory{}
+	url := startServer(t, factory, func(options *server.Options) {
+		options.EnableBasicAuth = false
+		options.Credential = ""
+		options.OIDCIssuer = provider.URL
+		options.OIDCClientID = "gotty"
+		options.OIDCClientSecret = "secret"
+		options.TitleFormat = "{{ .user }}"
+	})
+
+	cl, err := client.New(url, &client.Options{OIDC: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := &output{}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- cl.Run(context.Background(), nil, strings.NewReader(""), stdout, client.Size{}, nil)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); len(factory.started()) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no session after signing in, output %q", stdout.String())
+		}
+	}
+	wait(t, "the window title", func() bool { return strings.Contains(stdout.String(), "\x1b]0;alice\x07") })
+	if out := stdout.String(); !strings.Contains(out, provider.URL+"/activate and enter the code ABCD-EFGH") || !strings.Contains(out, "Signed in as alice") {
+		t.Errorf("output = %q, expected where to sign in", out)
+	}
+	factory.started()[0].exit()
+	if err := <-errs; err != nil {
+		t.Errorf("Run() returned %v", err)
+	}
+
+	cl, err = client.New(url, &client.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Run(context.Background(), nil, strings.NewReader(""), io.Discard, client.Size{}, nil); err == nil {
+		t.Error("Run() succeeded without signing in")
+	}
+}
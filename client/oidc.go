@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// oidcCookieName is the session cookie of servers with --oidc-issuer.
+const oidcCookieName = "gotty.oidc"
+
+// deviceAuthorization is the response of <path>oidc/device, relayed by the
+// server from its OpenID Connect provider.
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// SignIn signs in at the OpenID Connect provider of the server with the
+// device authorization grant: it writes to prompt where the user signs in,
+// in a browser on any device, and waits for it. The connections of Run
+// then carry the session cookie of the server.
+func (client *Client) SignIn(ctx context.Context, prompt io.Writer) error {
+	endpoint := client.signInURL()
+	var authorization deviceAuthorization
+	if err := client.post(ctx, endpoint, nil, &authorization); err != nil {
+		return fmt.Errorf("failed to sign in: %w", err)
+	}
+	if authorization.VerificationURIComplete != "" {
+		fmt.Fprintf(prompt, "To sign in, open %s\r\n", authorization.VerificationURIComplete)
+	} else {
+		fmt.Fprintf(prompt, "To sign in, open %s and enter the code %s\r\n", authorization.VerificationURI, authorization.UserCode)
+	}
+
+	interval := 5 * time.Second
+	if authorization.Interval > 0 {
+		interval = time.Duration(authorization.Interval) * time.Second
+	}
+	if authorization.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(authorization.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to sign in: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+
+		var session struct {
+			User string `json:"user"`
+		}
+		form := url.Values{"device_code": {authorization.DeviceCode}}
+		err := client.post(ctx, endpoint+"/token", form, &session)
+		var pending *pendingError
+		switch {
+		case errors.As(err, &pending) && pending.code == "slow_down":
+			interval += 5 * time.Second
+		case errors.As(err, &pending):
+		case err != nil:
+			return fmt.Errorf("failed to sign in: %w", err)
+		default:
+			fmt.Fprintf(prompt, "Signed in as %s\r\n", session.User)
+			return nil
+		}
+	}
+}
+
+// signInURL returns the URL of the device authorization grant of the
+// server, next to its WebSocket endpoint.
+func (client *Client) signInURL() string {
+	u, _ := url.Parse(strings.TrimSuffix(client.url, "ws") + "oidc/device")
+	u.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	return u.String()
+}
+
+// pendingError is returned by post while the user has not signed in yet.
+type pendingError struct {
+	code string // authorization_pending or slow_down
+}
+
+func (e *pendingError) Error() string {
+	return e.code
+}
+
+// post posts form to endpoint, decoding the JSON response into result, and
+// keeps the session cookie it sets for the connections of Run.
+func (client *Client) post(ctx context.Context, endpoint string, form url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var response struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&response)
+		if response.Error == "authorization_pending" || response.Error == "slow_down" {
+			return &pendingError{code: response.Error}
+		}
+		if response.Error == "" {
+			response.Error = resp.Status
+		}
+		return fmt.Errorf("%s: %s", endpoint, response.Error)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == oidcCookieName {
+			client.header.Set("Cookie", (&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String())
+		}
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
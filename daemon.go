@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+)
+
+// daemonizedEnv marks the re-executed process as the daemon itself.
+const daemonizedEnv = "GOTTY_DAEMONIZED"
+
+type daemonOptions struct {
+	Daemon  bool   `hcl:"daemon" flagName:"daemon" flagDescribe:"Run in the background" default:"false"`
+	PidFile string `hcl:"pid_file" flagName:"pidfile" flagDescribe:"Write the process ID to this file" default:""`
+	LogFile string `hcl:"log_file" flagName:"log-file" flagDescribe:"Log file when running in the background (discarded by default)" default:""`
+}
+
+// daemonize re-executes the current command in a new session in the background
+// and exits once the daemon is up. It returns in the daemon itself.
+func daemonize(options *daemonOptions) error {
+	if os.Getenv(daemonizedEnv) != "" {
+		// not to be inherited by the commands of the sessions
+		os.Unsetenv(daemonizedEnv)
+		return nil
+	}
+	if !options.Daemon {
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return errors.Wrapf(err, "failed to find the executable")
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer null.Close()
+
+	output := null
+	if options.LogFile != "" {
+		logFile := homedir.Expand(options.LogFile)
+		output, err = os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open log file `%s`", logFile)
+		}
+		defer output.Close()
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonizedEnv+"=1")
+	cmd.Stdin = null
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "failed to start daemon")
+	}
+
+	// catch errors like an unavailable port, which make the daemon exit right away
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	select {
+	case err := <-exited:
+		if err == nil {
+			err = errors.New("exited")
+		}
+		if options.LogFile == "" {
+			return errors.Wrapf(err, "daemon failed to start (use --log-file to see why)")
+		}
+		return errors.Wrapf(err, "daemon failed to start (see `%s` for details)", options.LogFile)
+	case <-time.After(time.Second):
+	}
+
+	fmt.Printf("GoTTY is running in the background (pid %d)\n", cmd.Process.Pid)
+	os.Exit(0)
+	return nil
+}
+
+// writePidFile writes the process ID to path,
+// unless it belongs to another GoTTY that is still running.
+// The file is written aside and then linked, or renamed over a stale one, in
+// place, so that GoTTYs starting at the same time never both see no pid file,
+// nor a partially written one.
+func writePidFile(path string) error {
+	path = homedir.Expand(path)
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrapf(err, "failed to write pid file `%s`", path)
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to write pid file `%s`", path)
+	}
+
+	for {
+		err := os.Link(temp.Name(), path)
+		if err == nil {
+			return nil
+		}
+		if !os.IsExist(err) {
+			return errors.Wrapf(err, "failed to write pid file `%s`", path)
+		}
+
+		pid, err := readPidFile(path)
+		if os.IsNotExist(err) {
+			// removed in the meantime
+			continue
+		}
+		if err == nil && processExists(pid) {
+			return errors.Errorf("GoTTY is already running (pid %d in `%s`)", pid, path)
+		}
+		if err := os.Rename(temp.Name(), path); err != nil {
+			return errors.Wrapf(err, "failed to write pid file `%s`", path)
+		}
+		return nil
+	}
+}
+
+func removePidFile(path string) {
+	os.Remove(homedir.Expand(path))
+}
+
+func readPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, errors.Errorf("invalid pid file `%s`", path)
+	}
+	return pid, nil
+}
+
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func pidFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:     "pidfile",
+		Usage:    "Pid file of the running GoTTY",
+		EnvVars:  []string{"GOTTY_PIDFILE"},
+		Required: true,
+	}
+}
+
+func stopCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "stop",
+		Usage: "Stop a GoTTY started with --pidfile",
+		Flags: []cli.Flag{
+			pidFileFlag(),
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Value: 10 * time.Second,
+				Usage: "Time to wait for GoTTY to exit",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			path := homedir.Expand(c.String("pidfile"))
+			pid, err := readPidFile(path)
+			if err != nil {
+				exit(err, 1)
+			}
+			if !processExists(pid) {
+				removePidFile(path)
+				exit(fmt.Errorf("GoTTY is not running (stale pid %d in `%s`)", pid, path), 1)
+			}
+
+			if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+				exit(errors.Wrapf(err, "failed to stop pid %d", pid), 1)
+			}
+			deadline := time.Now().Add(c.Duration("timeout"))
+			for processExists(pid) {
+				if time.Now().After(deadline) {
+					exit(fmt.Errorf("GoTTY (pid %d) did not exit within %s", pid, c.Duration("timeout")), 1)
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+			fmt.Printf("Stopped GoTTY (pid %d)\n", pid)
+			return nil
+		},
+	}
+}
+
+func statusCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "status",
+		Usage: "Show whether a GoTTY started with --pidfile is running (exit status 0 if running, 1 if dead, 3 if not running)",
+		Flags: []cli.Flag{
+			pidFileFlag(),
+		},
+		Action: func(c *cli.Context) error {
+			path := homedir.Expand(c.String("pidfile"))
+			pid, err := readPidFile(path)
+			if os.IsNotExist(err) {
+				fmt.Println("not running")
+				os.Exit(3)
+			}
+			if err != nil {
+				exit(err, 1)
+			}
+			if !processExists(pid) {
+				fmt.Printf("dead (stale pid %d in `%s`)\n", pid, path)
+				os.Exit(1)
+			}
+			fmt.Printf("running (pid %d)\n", pid)
+			return nil
+		},
+	}
+}
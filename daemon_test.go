@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+func TestPidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gotty.pid")
+	if err := writePidFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := readPidFile(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("readPidFile() = %d, %v, expected %d", pid, err, os.Getpid())
+	}
+	// this process is running
+	if err := writePidFile(path); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("writePidFile() of a running GoTTY returned %v", err)
+	}
+
+	// a stale pid file is replaced
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0o644)
+	if err := writePidFile(path); err != nil {
+		t.Errorf("writePidFile() over a stale pid file returned %v", err)
+	}
+
+	os.WriteFile(path, []byte("gotty\n"), 0o644)
+	if _, err := readPidFile(path); err == nil {
+		t.Error("readPidFile() of an invalid pid file returned no error")
+	}
+	if err := writePidFile(path); err != nil {
+		t.Errorf("writePidFile() over an invalid pid file returned %v", err)
+	}
+	if pid, err := readPidFile(path); err != nil || pid != os.Getpid() {
+		t.Errorf("readPidFile() = %d, %v, expected %d", pid, err, os.Getpid())
+	}
+	// nothing is left aside
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("the directory of the pid file holds %v", entries)
+	}
+	removePidFile(path)
+	if _, err := readPidFile(path); !os.IsNotExist(err) {
+		t.Errorf("readPidFile() of a removed pid file returned %v", err)
+	}
+}
+
+func TestPidFileRace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gotty.pid")
+	errs := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() { errs <- writePidFile(path) }()
+	}
+	written := 0
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err == nil {
+			written++
+		}
+	}
+	if written != 1 {
+		t.Errorf("%d GoTTYs starting at the same time wrote the pid file, expected 1", written)
+	}
+}
+
+func TestStop(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	path := filepath.Join(t.TempDir(), "gotty.pid")
+	os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0o644)
+
+	app := &cli.App{Commands: []*cli.Command{statusCommand(), stopCommand()}}
+	for _, command := range []string{"status", "stop"} {
+		if err := app.Run([]string{"gotty", command, "--pidfile", path}); err != nil {
+			t.Fatalf("%s returned %v", command, err)
+		}
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Error("the process did not exit")
+	}
+}
+
+func TestDaemonizeInDaemon(t *testing.T) {
+	t.Setenv(daemonizedEnv, "1")
+	if err := daemonize(&daemonOptions{Daemon: true}); err != nil {
+		t.Errorf("daemonize() in the daemon returned %v", err)
+	}
+	if _, ok := os.LookupEnv(daemonizedEnv); ok {
+		t.Errorf("%s is inherited by the commands of the sessions", daemonizedEnv)
+	}
+}
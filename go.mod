@@ -3,6 +3,7 @@ module github.com/sorenisanerd/gotty
 go 1.23
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/NYTimes/gziphandler v1.1.1
 	github.com/creack/pty v1.1.11
 	github.com/fatih/structs v1.1.0
@@ -10,6 +11,7 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/urfave/cli/v2 v2.3.0
 	github.com/yudai/hcl v0.0.0-20151013225006-5fa2393b3552
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
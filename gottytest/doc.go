@@ -0,0 +1,15 @@
+// Package gottytest provides utilities to test GoTTY and applications
+// embedding it without real PTYs or browsers: an in-memory webtty Master,
+// a scriptable fake Slave and its Factory, and a Server on a random port
+// with a WebSocket client speaking the protocol of the frontend.
+//
+//	factory := gottytest.NewFactory(nil) // echo slaves
+//	srv := gottytest.NewServer(t, factory, nil)
+//	conn, err := srv.Dial(server.InitMessage{}, nil)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	conn.SetEncoding("base64")
+//	conn.Input("hello")
+//	output, err := conn.ReadOutput("hello")
+package gottytest
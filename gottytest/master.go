@@ -0,0 +1,74 @@
+package gottytest
+
+import (
+	"io"
+	"sync"
+)
+
+// Master is an in-memory webtty.Master, driven like a client.
+// Pass it to webtty.New() and use its methods to talk to the WebTTY.
+type Master struct {
+	*peer
+
+	toTTY     chan []byte
+	toClient  chan []byte
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewMaster creates a Master.
+func NewMaster() *Master {
+	m := &Master{
+		toTTY:    make(chan []byte, 64),
+		toClient: make(chan []byte, 64),
+		closed:   make(chan struct{}),
+	}
+	m.peer = newPeer(
+		func() ([]byte, error) {
+			select {
+			case data := <-m.toClient:
+				return data, nil
+			case <-m.closed:
+				return nil, io.EOF
+			}
+		},
+		func(data []byte) error {
+			select {
+			case m.toTTY <- data:
+				return nil
+			case <-m.closed:
+				return io.ErrClosedPipe
+			}
+		},
+	)
+	return m
+}
+
+// Read returns the next message sent by the client side, for the WebTTY.
+func (m *Master) Read(p []byte) (int, error) {
+	select {
+	case data := <-m.toTTY:
+		if len(data) > len(p) {
+			return 0, io.ErrShortBuffer
+		}
+		return copy(p, data), nil
+	case <-m.closed:
+		return 0, io.EOF
+	}
+}
+
+// Write receives a message from the WebTTY for the client side.
+func (m *Master) Write(p []byte) (int, error) {
+	select {
+	case m.toClient <- append([]byte(nil), p...):
+		return len(p), nil
+	case <-m.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+// Close disconnects the client, which makes the WebTTY return webtty.ErrMasterClosed.
+func (m *Master) Close() error {
+	m.closeOnce.Do(func() { close(m.closed) })
+	return nil
+}
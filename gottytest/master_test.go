@@ -0,0 +1,61 @@
+package gottytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+func TestMasterAndSlave(t *testing.T) {
+	master := NewMaster()
+	slave := NewEchoSlave()
+	tty, err := webtty.New(master, slave, webtty.WithPermitWrite())
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- tty.Run(context.Background())
+	}()
+
+	master.SetEncoding("base64")
+	master.Input("hello")
+	if _, err := master.ReadOutput("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if input := slave.Input(); input != "hello" {
+		t.Errorf("input = %q, expected %q", input, "hello")
+	}
+
+	master.Close()
+	if err := <-errs; !errors.Is(err, webtty.ErrMasterClosed) {
+		t.Errorf("Run() returned %v, expected %v", err, webtty.ErrMasterClosed)
+	}
+}
+
+func TestSlaveExitCode(t *testing.T) {
+	master := NewMaster()
+	slave := NewSlave()
+	tty, err := webtty.New(master, slave)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- tty.Run(context.Background())
+	}()
+
+	slave.ExitWith(3)
+	err = <-errs
+	var exitErr *webtty.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("Run() returned %v, expected exit status 3", err)
+	}
+	if !errors.Is(err, webtty.ErrSlaveClosed) {
+		t.Errorf("Run() returned %v, expected to wrap %v", err, webtty.ErrSlaveClosed)
+	}
+}
@@ -0,0 +1,108 @@
+package gottytest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// Timeout is how long peers wait for a message.
+const Timeout = 5 * time.Second
+
+type message struct {
+	data []byte
+	err  error
+}
+
+// peer speaks the webtty protocol from the client side over a message transport.
+type peer struct {
+	write    func(data []byte) error
+	messages chan message
+	base64   bool
+}
+
+func newPeer(read func() ([]byte, error), write func(data []byte) error) *peer {
+	p := &peer{write: write, messages: make(chan message, 64)}
+	go func() {
+		for {
+			data, err := read()
+			p.messages <- message{data, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Send sends a message of msgType with payload.
+func (p *peer) Send(msgType byte, payload []byte) error {
+	return p.write(append([]byte{msgType}, payload...))
+}
+
+// SetEncoding selects the encoding of input, "base64" or "null".
+func (p *peer) SetEncoding(encoding string) error {
+	if err := p.Send(webtty.SetEncoding, []byte(encoding)); err != nil {
+		return err
+	}
+	p.base64 = encoding == "base64"
+	return nil
+}
+
+// Input sends s as if it was typed.
+func (p *peer) Input(s string) error {
+	payload := []byte(s)
+	if p.base64 {
+		payload = []byte(base64.StdEncoding.EncodeToString(payload))
+	}
+	return p.Send(webtty.Input, payload)
+}
+
+// Resize sends the size of the terminal.
+func (p *peer) Resize(columns int, rows int) error {
+	payload, _ := json.Marshal(map[string]int{"columns": columns, "rows": rows})
+	return p.Send(webtty.ResizeTerminal, payload)
+}
+
+// Next returns the next message, waiting at most Timeout.
+func (p *peer) Next() (msgType byte, payload []byte, err error) {
+	select {
+	case m := <-p.messages:
+		if m.err != nil {
+			// keep returning the error
+			p.messages <- m
+			return 0, nil, m.err
+		}
+		if len(m.data) == 0 {
+			return 0, nil, fmt.Errorf("received an empty message")
+		}
+		return m.data[0], m.data[1:], nil
+	case <-time.After(Timeout):
+		return 0, nil, fmt.Errorf("no message within %s", Timeout)
+	}
+}
+
+// ReadOutput reads messages until the output received contains substr,
+// and returns that output. Other messages are skipped.
+func (p *peer) ReadOutput(substr string) (string, error) {
+	output := ""
+	for !strings.Contains(output, substr) {
+		msgType, payload, err := p.Next()
+		if err != nil {
+			return output, fmt.Errorf("output `%s` does not contain `%s`: %w", output, substr, err)
+		}
+		if msgType != webtty.Output {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(payload))
+		if err != nil {
+			return output, fmt.Errorf("received malformed output: %w", err)
+		}
+		output += string(decoded)
+	}
+	return output, nil
+}
@@ -0,0 +1,137 @@
+package gottytest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/utils"
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// Options returns the default server options with write permitted.
+func Options() *server.Options {
+	options := &server.Options{}
+	if err := utils.ApplyDefaultValues(options); err != nil {
+		panic(err)
+	}
+	options.PermitWrite = true
+	options.TitleVariables = map[string]interface{}{"command": "gottytest", "hostname": "localhost"}
+	return options
+}
+
+// Server is a GoTTY server running on a random port of the loopback interface.
+type Server struct {
+	*server.Server
+
+	// URL is the URL of the page, e.g. http://127.0.0.1:12345/
+	URL string
+}
+
+// NewServer starts a server with options, or Options() when nil, until the
+// end of the test. Logs are discarded unless opts contain server.WithLogger().
+func NewServer(t testing.TB, factory server.Factory, options *server.Options, opts ...server.ServerOption) *Server {
+	t.Helper()
+	if options == nil {
+		options = Options()
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	opts = append([]server.ServerOption{
+		server.WithFactory(factory),
+		server.WithListener(listener),
+		server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}, opts...)
+	srv, err := server.New(options, opts...)
+	if err != nil {
+		listener.Close()
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	path := options.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return &Server{Server: srv, URL: "http://" + listener.Addr().String() + path}
+}
+
+// Conn is a WebSocket connection to a Server, driven like a client.
+type Conn struct {
+	*peer
+
+	conn *websocket.Conn
+}
+
+// Dial opens a WebSocket connection to the server and sends init.
+// header is sent with the handshake, e.g. for Basic Authentication.
+func (s *Server) Dial(init server.InitMessage, header http.Header) (*Conn, error) {
+	dialer := websocket.Dialer{Subprotocols: webtty.Protocols}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"ws", header)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{conn: conn}
+	c.peer = newPeer(
+		func() ([]byte, error) {
+			_, data, err := conn.ReadMessage()
+			return data, err
+		},
+		func(data []byte) error {
+			return conn.WriteMessage(websocket.TextMessage, data)
+		},
+	)
+
+	payload, _ := json.Marshal(init)
+	if err := c.write(payload); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// CloseCode waits for the server to close the connection and returns the
+// close code, or -1 when the connection failed otherwise.
+func (c *Conn) CloseCode() int {
+	for {
+		_, _, err := c.Next()
+		if err == nil {
+			continue
+		}
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			return closeErr.Code
+		}
+		return -1
+	}
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,227 @@
+package gottytest
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/sorenisanerd/gotty/server"
+)
+
+// Slave is a fake server.Slave whose output is scripted by tests.
+// It implements webtty.SlaveLifecycle.
+type Slave struct {
+	output    chan []byte
+	pending   []byte // output not read yet, only used by Read
+	closeOnce sync.Once
+	closed    chan struct{}
+	exitCode  int
+
+	mu      sync.Mutex
+	input   strings.Builder
+	echo    bool
+	expects []expect
+	columns int
+	rows    int
+
+	// Params are the parameters the slave was created with by a Factory.
+	Params map[string][]string
+	// Headers are the headers the slave was created with by a Factory.
+	Headers map[string][]string
+	// Client is what the client told about itself in its init message.
+	Client server.ClientInfo
+	// TitleVariables are returned by WindowTitleVariables().
+	TitleVariables map[string]interface{}
+}
+
+type expect struct {
+	input  string
+	output string
+}
+
+// NewSlave creates a Slave that outputs nothing until told to.
+func NewSlave() *Slave {
+	return &Slave{
+		output: make(chan []byte, 64),
+		closed: make(chan struct{}),
+	}
+}
+
+// NewEchoSlave creates a Slave that outputs its input, like a terminal.
+func NewEchoSlave() *Slave {
+	s := NewSlave()
+	s.echo = true
+	return s
+}
+
+// Print outputs s.
+func (s *Slave) Print(str string) {
+	select {
+	case s.output <- []byte(str):
+	case <-s.closed:
+	}
+}
+
+// Expect outputs output once the input received contains input.
+// Expectations are met in the order they were added.
+func (s *Slave) Expect(input string, output string) *Slave {
+	s.mu.Lock()
+	s.expects = append(s.expects, expect{input, output})
+	s.mu.Unlock()
+	s.check()
+	return s
+}
+
+func (s *Slave) check() {
+	s.mu.Lock()
+	var outputs []string
+	for len(s.expects) > 0 && strings.Contains(s.input.String(), s.expects[0].input) {
+		outputs = append(outputs, s.expects[0].output)
+		s.expects = s.expects[1:]
+	}
+	s.mu.Unlock()
+
+	for _, output := range outputs {
+		s.Print(output)
+	}
+}
+
+// Input returns all input received so far.
+func (s *Slave) Input() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.input.String()
+}
+
+// Size returns the last size the terminal was resized to.
+func (s *Slave) Size() (columns int, rows int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.columns, s.rows
+}
+
+// Exit ends the output, as if the command exited successfully.
+func (s *Slave) Exit() {
+	s.ExitWith(0)
+}
+
+// ExitWith ends the output, as if the command exited with code.
+func (s *Slave) ExitWith(code int) {
+	s.closeOnce.Do(func() {
+		s.exitCode = code
+		close(s.closed)
+	})
+}
+
+// Closed returns whether the slave has been closed.
+func (s *Slave) Closed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Slave) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		select {
+		case s.pending = <-s.output:
+		case <-s.closed:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *Slave) Write(p []byte) (int, error) {
+	if s.Closed() {
+		return 0, io.ErrClosedPipe
+	}
+	s.mu.Lock()
+	s.input.Write(p)
+	echo := s.echo
+	s.mu.Unlock()
+
+	if echo {
+		s.Print(string(p))
+	}
+	s.check()
+	return len(p), nil
+}
+
+func (s *Slave) WindowTitleVariables() map[string]interface{} {
+	return s.TitleVariables
+}
+
+func (s *Slave) ResizeTerminal(columns int, rows int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.columns, s.rows = columns, rows
+	return nil
+}
+
+func (s *Slave) Close() error {
+	s.ExitWith(-1)
+	return nil
+}
+
+func (s *Slave) Start(ctx context.Context) error {
+	return nil
+}
+
+func (s *Slave) Stop(ctx context.Context) error {
+	return s.Close()
+}
+
+func (s *Slave) Wait() (int, error) {
+	<-s.closed
+	return s.exitCode, nil
+}
+
+// Factory is a server.Factory creating Slaves.
+type Factory struct {
+	newSlave func() *Slave
+
+	mu     sync.Mutex
+	slaves []*Slave
+}
+
+// NewFactory creates a Factory that creates slaves with newSlave,
+// or echo slaves when it is nil.
+func NewFactory(newSlave func() *Slave) *Factory {
+	if newSlave == nil {
+		newSlave = NewEchoSlave
+	}
+	return &Factory{newSlave: newSlave}
+}
+
+func (factory *Factory) Name() string {
+	return "gottytest"
+}
+
+func (factory *Factory) New(params map[string][]string, headers map[string][]string) (server.Slave, error) {
+	return factory.NewForClient(params, headers, server.ClientInfo{})
+}
+
+func (factory *Factory) NewForClient(params map[string][]string, headers map[string][]string, client server.ClientInfo) (server.Slave, error) {
+	slave := factory.newSlave()
+	slave.Params = params
+	slave.Headers = headers
+	slave.Client = client
+
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	factory.slaves = append(factory.slaves, slave)
+	return slave, nil
+}
+
+// Slaves returns the slaves created so far.
+func (factory *Factory) Slaves() []*Slave {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	return append([]*Slave(nil), factory.slaves...)
+}
@@ -6,20 +6,41 @@ import { GoTTYXterm } from "./xterm";
 declare var gotty_auth_token: string | undefined;
 declare var gotty_term: string | undefined;
 declare var gotty_ws_query_args: string | undefined;
+declare var gotty_ws_url: string | undefined;
+declare var gotty_present: { columns: number, rows: number } | null | undefined;
+declare var gotty_playback: { columns: number, rows: number } | null | undefined;
+declare var gotty_share_selections: boolean | undefined;
+declare var gotty_chat: boolean | undefined;
+declare var gotty_markers: boolean | undefined;
 
 const elem = document.getElementById("terminal")
 
 if (elem !== null) {
     var term: Terminal;
-    term = new GoTTYXterm(elem);
+    const xterm = new GoTTYXterm(elem);
+    // a read-only view of another session, e.g. on a projector
+    if (typeof gotty_present !== 'undefined' && gotty_present !== null) {
+        xterm.present(gotty_present.columns, gotty_present.rows);
+    }
+    // the replay of a recording, at its size
+    if (typeof gotty_playback !== 'undefined' && gotty_playback !== null) {
+        xterm.present(gotty_playback.columns, gotty_playback.rows);
+    }
+    term = xterm;
 
     const httpsEnabled = window.location.protocol == "https:";
-    const queryArgs = window.location.search || ((typeof gotty_ws_query_args !== 'undefined' && gotty_ws_query_args !== "") ? "?" + gotty_ws_query_args : "");
-    const url = (httpsEnabled ? 'wss://' : 'ws://') + window.location.host + window.location.pathname + 'ws' + queryArgs;
+    const queryArgs = window.location.search + ((typeof gotty_ws_query_args !== 'undefined' && gotty_ws_query_args !== "") ? (window.location.search ? "&" : "?") + gotty_ws_query_args : "");
+    // the WebSocket endpoint may be served apart from the page
+    const wsURL = (typeof gotty_ws_url !== 'undefined' && gotty_ws_url !== "") ? gotty_ws_url : (httpsEnabled ? 'wss://' : 'ws://') + window.location.host + window.location.pathname + 'ws';
+    const url = wsURL + queryArgs;
     const args = window.location.search;
     const factory = new ConnectionFactory(url, protocols);
     const authToken = typeof gotty_auth_token !== 'undefined' ? gotty_auth_token : '';
     const wt = new WebTTY(term, factory, args, authToken);
+    wt.shareSelections = typeof gotty_share_selections !== 'undefined' && gotty_share_selections;
+    wt.chat = typeof gotty_chat !== 'undefined' && gotty_chat;
+    wt.markers = typeof gotty_markers !== 'undefined' && gotty_markers;
+    wt.playback = typeof gotty_playback !== 'undefined' && gotty_playback !== null;
     const closer = wt.open();
 
     // According to https://developer.mozilla.org/en-US/docs/Web/API/Window/unload_event
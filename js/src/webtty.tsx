@@ -1,10 +1,15 @@
-export const protocols = ["webtty"];
+// by preference, webtty for servers predating the versions
+export const protocols = ["gotty.v2", "webtty"];
 
 export const msgInputUnknown = '0';
 export const msgInput = '1';
 export const msgPing = '2';
 export const msgResizeTerminal = '3';
 export const msgSetEncoding = '4';
+export const msgSelection = '5';
+export const msgChat = '6';
+export const msgMarker = '7';
+export const msgPlayback = '8';
 
 export const msgUnknownOutput = '0';
 export const msgOutput = '1';
@@ -13,7 +18,65 @@ export const msgSetWindowTitle = '3';
 export const msgSetPreferences = '4';
 export const msgSetReconnect = '5';
 export const msgSetBufferSize = '6';
+export const msgSetPermitWrite = '7';
+export const msgOutputDropped = '8';
+export const msgSetResumeToken = '9';
+export const msgSetSelection = 'a';
+export const msgShowChat = 'b';
+export const msgShowNotice = 'c';
+export const msgSessionSummary = 'd';
+export const msgSetPlayback = 'e';
+export const msgSetTerminalSize = 'f';
+
+// A text selection, its rows counted from the bottom of the buffer, as
+// terminals of the same session may keep more or less scrollback.
+export interface Selection {
+    start: [number, number];
+    end: [number, number];
+}
+
+// The selection of another participant of the session, null once cleared.
+export interface SharedSelection {
+    participant: number;
+    name?: string;
+    color: string;
+    selection: Selection | null;
+}
 
+// The summary of a session that ended, sent right before the connection
+// is closed.
+export interface SessionSummary {
+    session_id: string;
+    duration: number; // in seconds
+    exit_status?: number;
+    bytes_in: number;
+    bytes_out: number;
+    recording?: string; // URL
+}
+
+// A chat message of a participant of the session.
+export interface ChatMessage {
+    participant: number;
+    name?: string;
+    color: string;
+    text: string;
+    time: string;
+}
+
+// The state of the playback of a recording.
+export interface PlaybackState {
+    time: number; // in seconds
+    duration: number;
+    paused: boolean;
+    speed: number;
+}
+
+// A control of the playback of a recording, of the fields given.
+export interface PlaybackControl {
+    paused?: boolean;
+    time?: number;
+    speed?: number;
+}
 
 export interface Terminal {
     /*
@@ -62,6 +125,46 @@ export interface Terminal {
      */
     onResize(callback: (colmuns: number, rows: number) => void): void;
 
+    /*
+     * Show the terminal at the size the server gave the session
+     */
+    showSize(columns: number, rows: number): void;
+
+    /*
+     * Sets a handler of the changes of the text selection
+     */
+    onSelection(callback: (selection: Selection | null) => void): void;
+
+    /*
+     * Highlight the selection of another participant
+     */
+    showSelection(shared: SharedSelection): void;
+
+    /*
+     * Sets a handler of the chat messages typed by the user
+     */
+    onChat(callback: (text: string) => void): void;
+
+    /*
+     * Show a chat message of a participant
+     */
+    showChat(message: ChatMessage): void;
+
+    /*
+     * Sets a handler of the markers dropped by the user
+     */
+    onMarker(callback: (label: string) => void): void;
+
+    /*
+     * Sets a handler of the controls of the playback of a recording
+     */
+    onPlayback(callback: (control: PlaybackControl) => void): void;
+
+    /*
+     * Show the state of the playback of a recording
+     */
+    showPlayback(state: PlaybackState): void;
+
     reset(): void;
     deactivate(): void;
     close(): void;
@@ -126,6 +229,34 @@ export class WebTTY {
      */
     bufSize: number;
 
+    /*
+     * Token to resume the session with after reconnecting, if the server
+     * gave one.
+     */
+    resumeToken: string;
+
+    /*
+     * Whether to share the text selection with the other participants of
+     * the session, and show theirs.
+     */
+    shareSelections: boolean;
+
+    /*
+     * Whether to chat with the other participants of the session.
+     */
+    chat: boolean;
+
+    /*
+     * Whether the user may drop markers into the recording of the session.
+     */
+    markers: boolean;
+
+    /*
+     * Whether the connection plays a recording, under the controls of the
+     * user.
+     */
+    playback: boolean;
+
     constructor(term: Terminal, connectionFactory: ConnectionFactory, args: string, authToken: string) {
         this.term = term;
         this.connectionFactory = connectionFactory;
@@ -133,19 +264,27 @@ export class WebTTY {
         this.authToken = authToken;
         this.reconnect = -1;
         this.bufSize = 1024;
+        this.resumeToken = "";
+        this.shareSelections = false;
+        this.chat = false;
+        this.markers = false;
+        this.playback = false;
     };
 
     open() {
         let connection = this.connectionFactory.create();
         let pingTimer: NodeJS.Timeout;
         let reconnectTimeout: NodeJS.Timeout;
+        let summary: SessionSummary | null = null;
+        let reconnectAttempts = 0;
         this.connection = connection;
 
         const setup = () => {
             connection.onOpen(() => {
+                reconnectAttempts = 0;
                 const termInfo = this.term.info();
 
-                this.initializeConnection(this.args, this.authToken);
+                this.initializeConnection(this.args, this.authToken, termInfo.columns, termInfo.rows);
 
                 this.term.onResize((columns: number, rows: number) => {
                     this.sendResizeTerminal(columns, rows);
@@ -155,6 +294,30 @@ export class WebTTY {
 
                 this.sendSetEncoding("base64");
 
+                if (this.shareSelections) {
+                    this.term.onSelection((selection: Selection | null) => {
+                        this.sendSelection(selection);
+                    });
+                }
+
+                if (this.chat) {
+                    this.term.onChat((text: string) => {
+                        this.sendChat(text);
+                    });
+                }
+
+                if (this.markers) {
+                    this.term.onMarker((label: string) => {
+                        this.sendMarker(label);
+                    });
+                }
+
+                if (this.playback) {
+                    this.term.onPlayback((control: PlaybackControl) => {
+                        this.sendPlayback(control);
+                    });
+                }
+
                 this.term.onInput(
                     (input: string | Uint8Array) => {
                         this.sendInput(input);
@@ -190,6 +353,44 @@ export class WebTTY {
                         const bufSize = JSON.parse(payload);
                         this.bufSize = bufSize;
                         break;
+                    case msgSetPermitWrite:
+                        const permitWrite = JSON.parse(payload);
+                        this.term.showMessage(permitWrite ? "Input enabled" : "Read-only", 2000);
+                        break;
+                    case msgOutputDropped:
+                        const skipped = Math.ceil(JSON.parse(payload) / 1024);
+                        this.term.output(new TextEncoder().encode("\r\n\x1b[7m[output truncated: " + skipped + " KB skipped]\x1b[0m\r\n"));
+                        break;
+                    case msgSetResumeToken:
+                        const resumeToken = JSON.parse(payload);
+                        if (this.resumeToken !== "" && resumeToken !== this.resumeToken) {
+                            // the session was not resumed, a new one started
+                            this.term.reset();
+                        }
+                        this.resumeToken = resumeToken;
+                        break;
+                    case msgSetTerminalSize:
+                        const size = JSON.parse(payload);
+                        this.term.showSize(size.columns, size.rows);
+                        break;
+                    case msgSetSelection:
+                        this.term.showSelection(JSON.parse(payload));
+                        break;
+                    case msgShowChat:
+                        this.term.showChat(JSON.parse(payload));
+                        break;
+                    case msgShowNotice:
+                        // as text, not HTML
+                        const notice = document.createElement("div");
+                        notice.textContent = JSON.parse(payload);
+                        this.term.showMessage(notice.innerHTML, 5000);
+                        break;
+                    case msgSessionSummary:
+                        summary = JSON.parse(payload);
+                        break;
+                    case msgSetPlayback:
+                        this.term.showPlayback(JSON.parse(payload));
+                        break;
                 }
             });
 
@@ -197,6 +398,12 @@ export class WebTTY {
                 clearInterval(pingTimer);
                 this.term.deactivate();
 
+                // the session ended, instead of the connection
+                if (summary !== null) {
+                    this.term.showMessage(summaryHTML(summary), 0);
+                    return;
+                }
+
                 // Check if connection was closed due to max connections (code 4000)
                 if (code === 4000) {
                     this.term.showMessage("Another session is active. Refreshing page in 5 seconds...", 5000);
@@ -206,13 +413,51 @@ export class WebTTY {
                     return;
                 }
 
+                // the server does not speak the protocol of this page anymore
+                if (code === 4006) {
+                    this.term.showMessage('This page is out of date. <a href="#" onclick="window.location.reload(); return false;" style="color: #00ff00; text-decoration: underline;">Click Here to Reload</a>', 0);
+                    return;
+                }
+
+                // reconnecting would use it up again
+                if (code === 4007) {
+                    this.term.showMessage("The bandwidth quota of this session is used up.", 0);
+                    return;
+                }
+
+                // the same parameters would be refused again
+                if (code === 4004) {
+                    const message = document.createElement("div");
+                    message.textContent = reason || "Invalid request.";
+                    this.term.showMessage(message.innerHTML, 0);
+                    return;
+                }
+
+                // the command exited, reconnecting would start it again
+                if (code === 4008) {
+                    const message = document.createElement("div");
+                    message.textContent = "Session ended" + (reason ? " with " + reason : "") + ".";
+                    this.term.showMessage(message.innerHTML + ' <a href="#" onclick="window.location.reload(); return false;" style="color: #00ff00; text-decoration: underline;">Click Here to Start Again</a>', 0);
+                    return;
+                }
+
                 this.term.showMessage('Connection Closed. <a href="#" onclick="window.location.reload(); return false;" style="color: #00ff00; text-decoration: underline;">Click Here to Reload</a>', 0);
-                if (this.reconnect > 0) {
+                // not when the server closed it on purpose, e.g. terminating the
+                // session; lost connections are retried after 1, 2, 4...
+                // seconds up to the reconnect time
+                if (this.reconnect > 0 && code !== 1000) {
+                    const delay = Math.min(2 ** reconnectAttempts, this.reconnect);
+                    reconnectAttempts++;
                     reconnectTimeout = setTimeout(() => {
-                        connection = this.connectionFactory.create();
-                        this.term.reset();
+                        this.connection = connection = this.connectionFactory.create();
+                        // a resumed session goes on where the terminal stopped
+                        if (this.resumeToken === "") {
+                            this.term.reset();
+                        } else {
+                            this.term.removeMessage();
+                        }
                         setup();
-                    }, this.reconnect * 1000);
+                    }, delay * 1000);
                 }
             });
 
@@ -226,11 +471,16 @@ export class WebTTY {
         }
     };
 
-    private initializeConnection(args, authToken) {
+    private initializeConnection(args, authToken, columns: number, rows: number) {
         this.connection.send(JSON.stringify(
             {
+                Version: 2,
                 Arguments: args,
                 AuthToken: authToken,
+                Columns: columns,
+                Rows: rows,
+                Capabilities: ["resume"],
+                ResumeToken: this.resumeToken,
             }
         ));
     }
@@ -273,8 +523,68 @@ export class WebTTY {
         );
     }
 
+    private sendSelection(selection: Selection | null) {
+        this.connection.send(msgSelection + JSON.stringify(selection));
+    }
+
+    private sendChat(text: string) {
+        this.connection.send(msgChat + text);
+    }
+
+    private sendMarker(label: string) {
+        this.connection.send(msgMarker + label);
+    }
+
+    private sendPlayback(control: PlaybackControl) {
+        this.connection.send(msgPlayback + JSON.stringify(control));
+    }
+
     private sendSetEncoding(encoding: "base64" | "null") {
         this.connection.send(msgSetEncoding + encoding)
     }
 
 };
+
+// summaryHTML renders the summary of a session that ended.
+function summaryHTML(summary: SessionSummary): string {
+    const page = document.createElement("div");
+    const line = (text: string) => {
+        const div = document.createElement("div");
+        div.textContent = text;
+        page.appendChild(div);
+    };
+    line("Session ended after " + formatDuration(summary.duration) +
+        (summary.exit_status === undefined ? "" : " with exit status " + summary.exit_status));
+    line(formatBytes(summary.bytes_in) + " in, " + formatBytes(summary.bytes_out) + " out");
+    if (summary.recording) {
+        const link = document.createElement("a");
+        link.href = summary.recording;
+        link.textContent = "Recording";
+        link.style.color = "#00ff00";
+        page.appendChild(link);
+    }
+    return page.innerHTML + '<div><a href="#" onclick="window.location.reload(); return false;" style="color: #00ff00; text-decoration: underline;">Click Here to Start Again</a></div>';
+}
+
+function formatDuration(seconds: number): string {
+    const s = Math.round(seconds);
+    const parts: string[] = [];
+    if (s >= 3600) {
+        parts.push(Math.floor(s / 3600) + "h");
+    }
+    if (s >= 60) {
+        parts.push(Math.floor(s % 3600 / 60) + "m");
+    }
+    parts.push(s % 60 + "s");
+    return parts.join(" ");
+}
+
+function formatBytes(bytes: number): string {
+    if (bytes < 1024) {
+        return bytes + " B";
+    }
+    if (bytes < 1024 * 1024) {
+        return (bytes / 1024).toFixed(1) + " KB";
+    }
+    return (bytes / 1024 / 1024).toFixed(1) + " MB";
+}
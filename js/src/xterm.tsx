@@ -3,6 +3,14 @@ import { FitAddon } from '@xterm/addon-fit';
 import { WebLinksAddon } from '@xterm/addon-web-links';
 import { WebglAddon } from '@xterm/addon-webgl';
 import { ZModemAddon } from "./zmodem";
+import { ChatMessage, PlaybackControl, PlaybackState, Selection, SharedSelection } from "./webtty";
+
+// maxSelectionRows is how many rows of the selection of another participant
+// are highlighted at most.
+const maxSelectionRows = 200;
+
+// playbackSpeeds are the speeds offered by the controls of a playback.
+const playbackSpeeds = [0.5, 1, 2, 4, 8];
 
 export class GoTTYXterm {
     // The HTMLElement that contains our terminal
@@ -12,6 +20,13 @@ export class GoTTYXterm {
     term: Terminal;
 
     resizeListener: () => void;
+    resizeCallback: (columns: number, rows: number) => void;
+
+    // once sized by the server, the size fitting the window at the font size
+    // of the terminal before, reported instead of the size of the terminal
+    fits: { columns: number, rows: number } | undefined;
+    fitFontSize: number;
+    shownSize: string;
 
     message: HTMLElement;
     messageTimeout: number;
@@ -19,6 +34,26 @@ export class GoTTYXterm {
 
     onResizeHandler: IDisposable;
     onDataHandler: IDisposable;
+    onSelectionHandler: IDisposable;
+
+    // the highlights of the selections of the other participants
+    selections: Map<number, IDisposable[]>;
+
+    // the chat sidebar, once opened
+    chat: HTMLElement;
+    chatMessages: HTMLElement;
+    chatInput: HTMLInputElement;
+
+    // the controls of a playback, once shown
+    playback: HTMLElement;
+    playbackButton: HTMLButtonElement;
+    playbackSeek: HTMLInputElement;
+    playbackTime: HTMLElement;
+    playbackSpeed: HTMLSelectElement;
+    playbackTimer: NodeJS.Timeout;
+    playbackControl: (control: PlaybackControl) => void;
+    playbackState: PlaybackState | undefined;
+    playbackReceived: number; // when playbackState was, in milliseconds
 
     fitAddOn: FitAddon;
     zmodemAddon: ZModemAddon;
@@ -27,7 +62,9 @@ export class GoTTYXterm {
 
     constructor(elem: HTMLElement) {
         this.elem = elem;
-        this.term = new Terminal();
+        // decorations highlight the selections of other participants
+        this.term = new Terminal({ allowProposedApi: true });
+        this.selections = new Map();
         this.fitAddOn = new FitAddon();
         this.zmodemAddon = new ZModemAddon({
             toTerminal: (x: Uint8Array) => this.term.write(x),
@@ -55,6 +92,9 @@ export class GoTTYXterm {
     };
 
     info(): { columns: number, rows: number } {
+        if (this.fits !== undefined) {
+            return this.fits;
+        }
         return { columns: this.term.cols, rows: this.term.rows };
     };
 
@@ -131,11 +171,241 @@ export class GoTTYXterm {
     };
 
     onResize(callback: (colmuns: number, rows: number) => void) {
+        this.resizeCallback = callback;
         this.onResizeHandler = this.term.onResize(() => {
-            callback(this.term.cols, this.term.rows);
+            if (this.fits === undefined) {
+                callback(this.term.cols, this.term.rows);
+            }
+        });
+    };
+
+    // showSize shows columns x rows, the size the server gave the session,
+    // with the largest font fitting the window, and reports the size fitting
+    // the window instead, for the server to size the session by its policy.
+    showSize(columns: number, rows: number): void {
+        if (this.shownSize === columns + "x" + rows) {
+            return;
+        }
+        this.shownSize = columns + "x" + rows;
+        if (this.fitFontSize === undefined) {
+            this.fitFontSize = this.term.options.fontSize;
+        }
+        this.resizeListener = () => {
+            const dimensions = this.fitAddOn.proposeDimensions();
+            if (dimensions !== undefined) {
+                const ratio = this.term.options.fontSize / this.fitFontSize;
+                this.fits = { columns: Math.floor(dimensions.cols * ratio), rows: Math.floor(dimensions.rows * ratio) };
+                const scale = Math.min(dimensions.cols / columns, dimensions.rows / rows);
+                this.term.options.fontSize = Math.max(6, Math.floor(this.term.options.fontSize * scale));
+            }
+            this.term.resize(columns, rows);
+            if (this.fits !== undefined && this.resizeCallback !== undefined) {
+                this.resizeCallback(this.fits.columns, this.fits.rows);
+            }
+        };
+        this.resizeListener();
+    }
+
+    onSelection(callback: (selection: Selection | null) => void) {
+        let timer: NodeJS.Timeout;
+        if (this.onSelectionHandler) {
+            this.onSelectionHandler.dispose();
+        }
+        this.onSelectionHandler = this.term.onSelectionChange(() => {
+            // shared once settled, not at each move of the mouse
+            clearTimeout(timer);
+            timer = setTimeout(() => {
+                const position = this.term.getSelectionPosition();
+                const last = this.term.buffer.active.length - 1;
+                callback(position === undefined ? null : {
+                    start: [position.start.x, last - position.start.y],
+                    end: [position.end.x, last - position.end.y],
+                });
+            }, 200);
+        });
+    };
+
+    showSelection(shared: SharedSelection) {
+        this.hideSelection(shared.participant);
+        if (shared.selection === null) {
+            return;
+        }
+        const buffer = this.term.buffer.active;
+        const last = buffer.length - 1;
+        const cursor = buffer.baseY + buffer.cursorY;
+        const first = Math.max(last - shared.selection.start[1], 0);
+        const end = Math.min(last - shared.selection.end[1], first + maxSelectionRows - 1);
+        const highlights: IDisposable[] = [];
+        for (let row = first; row <= end; row++) {
+            const x = row === first ? shared.selection.start[0] : 0;
+            const width = (row === last - shared.selection.end[1] ? shared.selection.end[0] : this.term.cols) - x;
+            const marker = width > 0 ? this.term.registerMarker(row - cursor) : undefined;
+            if (marker === undefined) {
+                continue;
+            }
+            highlights.push(marker);
+            const decoration = this.term.registerDecoration({ marker: marker, x: x, width: width, backgroundColor: shared.color, layer: 'bottom' });
+            if (decoration !== undefined) {
+                highlights.push(decoration);
+            }
+        }
+        this.selections.set(shared.participant, highlights);
+    };
+
+    hideSelection(participant: number) {
+        const highlights = this.selections.get(participant);
+        if (highlights !== undefined) {
+            highlights.forEach((highlight) => highlight.dispose());
+            this.selections.delete(participant);
+        }
+    };
+
+    onChat(callback: (text: string) => void) {
+        this.openChat();
+        this.chatInput.disabled = false;
+        this.chatInput.onkeydown = (event: KeyboardEvent) => {
+            if (event.key === "Enter" && this.chatInput.value.trim() !== "") {
+                callback(this.chatInput.value);
+                this.chatInput.value = "";
+            }
+        };
+    };
+
+    showChat(message: ChatMessage) {
+        this.openChat();
+        const line = this.elem.ownerDocument.createElement("div");
+        line.className = "gotty-chat-message";
+        line.title = new Date(message.time).toLocaleTimeString();
+        const name = this.elem.ownerDocument.createElement("span");
+        name.className = "gotty-chat-name";
+        name.style.color = message.color;
+        name.textContent = message.name ?? "#" + message.participant;
+        line.append(name, " ", message.text);
+        this.chatMessages.appendChild(line);
+        this.chatMessages.scrollTop = this.chatMessages.scrollHeight;
+    };
+
+    // openChat adds the chat sidebar beside the terminal, once.
+    openChat() {
+        if (this.chat !== undefined) {
+            return;
+        }
+        const doc = this.elem.ownerDocument;
+        this.chat = doc.createElement("div");
+        this.chat.className = "gotty-chat";
+        this.chatMessages = doc.createElement("div");
+        this.chatMessages.className = "gotty-chat-messages";
+        this.chatInput = doc.createElement("input");
+        this.chatInput.className = "gotty-chat-input";
+        this.chatInput.placeholder = "Message";
+        this.chatInput.maxLength = 500;
+        this.chat.append(this.chatMessages, this.chatInput);
+        doc.body.appendChild(this.chat);
+        this.elem.classList.add("gotty-with-chat");
+        this.resizeListener();
+    };
+
+    // onMarker prompts for the label of a marker on Ctrl+Shift+M.
+    onMarker(callback: (label: string) => void) {
+        this.term.attachCustomKeyEventHandler((event: KeyboardEvent) => {
+            if (event.type !== "keydown" || !event.ctrlKey || !event.shiftKey || event.code !== "KeyM") {
+                return true;
+            }
+            const label = window.prompt("Label of the marker", new Date().toLocaleTimeString());
+            if (label !== null && label.trim() !== "") {
+                callback(label);
+                this.showMessage("Marker dropped", this.messageTimeout);
+            }
+            return false;
         });
     };
 
+    // onPlayback shows the controls of a playback below the terminal: play
+    // and pause, also with the space bar, seek, also by 5 seconds with the
+    // arrow keys, and the speed.
+    onPlayback(callback: (control: PlaybackControl) => void) {
+        this.playbackControl = callback;
+        if (this.playback !== undefined) {
+            return;
+        }
+        const doc = this.elem.ownerDocument;
+        this.playback = doc.createElement("div");
+        this.playback.className = "gotty-playback";
+        this.playbackButton = doc.createElement("button");
+        this.playbackButton.onclick = () => this.togglePlayback();
+        this.playbackSeek = doc.createElement("input");
+        this.playbackSeek.type = "range";
+        this.playbackSeek.min = "0";
+        this.playbackSeek.step = "0.1";
+        this.playbackSeek.onchange = () => this.playbackControl({ time: Number(this.playbackSeek.value) });
+        this.playbackTime = doc.createElement("span");
+        this.playbackSpeed = doc.createElement("select");
+        playbackSpeeds.forEach((speed) => {
+            this.playbackSpeed.add(new Option(speed + "x", String(speed), speed === 1, speed === 1));
+        });
+        this.playbackSpeed.onchange = () => this.playbackControl({ speed: Number(this.playbackSpeed.value) });
+        this.playback.append(this.playbackButton, this.playbackSeek, this.playbackTime, this.playbackSpeed);
+        doc.body.appendChild(this.playback);
+        this.elem.classList.add("gotty-with-playback");
+
+        doc.addEventListener("keydown", (event: KeyboardEvent) => {
+            // but for the controls, which handle their keys themselves
+            if (this.playbackState === undefined || this.playback.contains(event.target as Node)) {
+                return;
+            }
+            if (event.code === "Space") {
+                this.togglePlayback();
+            } else if (event.code === "ArrowLeft" || event.code === "ArrowRight") {
+                const time = this.playbackPosition() + (event.code === "ArrowLeft" ? -5 : 5);
+                this.playbackControl({ time: Math.max(0, Math.min(time, this.playbackState.duration)) });
+            } else {
+                return;
+            }
+            event.preventDefault();
+        });
+        this.playbackTimer = setInterval(() => this.updatePlayback(), 250);
+        this.resizeListener();
+    };
+
+    showPlayback(state: PlaybackState) {
+        this.playbackState = state;
+        this.playbackReceived = Date.now();
+        this.updatePlayback();
+    };
+
+    togglePlayback() {
+        if (this.playbackState !== undefined) {
+            this.playbackControl({ paused: !this.playbackState.paused });
+        }
+    };
+
+    // playbackPosition returns the time of the playback now, in seconds.
+    playbackPosition(): number {
+        const state = this.playbackState;
+        if (state === undefined) {
+            return 0;
+        }
+        if (state.paused) {
+            return state.time;
+        }
+        return Math.min(state.duration, state.time + (Date.now() - this.playbackReceived) / 1000 * state.speed);
+    };
+
+    updatePlayback() {
+        const state = this.playbackState;
+        if (state === undefined) {
+            return;
+        }
+        const position = this.playbackPosition();
+        this.playbackButton.textContent = state.paused ? "\u25B6" : "\u23F8";
+        this.playbackSeek.max = String(state.duration);
+        if (this.elem.ownerDocument.activeElement !== this.playbackSeek) {
+            this.playbackSeek.value = String(position);
+        }
+        this.playbackTime.textContent = formatTime(position) + " / " + formatTime(state.duration);
+        this.playbackSpeed.value = String(state.speed);
+    };
+
     deactivate(): void {
         if (this.onDataHandler) {
             this.onDataHandler.dispose();
@@ -143,6 +413,19 @@ export class GoTTYXterm {
         if (this.onResizeHandler) {
             this.onResizeHandler.dispose();
         }
+        if (this.onSelectionHandler) {
+            this.onSelectionHandler.dispose();
+        }
+        // the others may not share anymore, nor clear theirs
+        this.selections.forEach((_, participant) => this.hideSelection(participant));
+        if (this.chatInput !== undefined) {
+            this.chatInput.disabled = true;
+        }
+        if (this.playback !== undefined) {
+            clearInterval(this.playbackTimer);
+            this.playbackButton.disabled = this.playbackSeek.disabled = this.playbackSpeed.disabled = true;
+        }
+        this.term.attachCustomKeyEventHandler(() => true);
         this.term.blur();
     }
 
@@ -167,4 +450,18 @@ export class GoTTYXterm {
     focus(): void {
         this.term.focus();
     }
+
+    // present shows columns x rows like showSize, without input nor
+    // scrollback, e.g. for a read-only view of another session.
+    present(columns: number, rows: number): void {
+        this.disableStdin();
+        this.term.options.scrollback = 0;
+        this.showSize(columns, rows);
+    }
+}
+
+// formatTime formats seconds as m:ss.
+function formatTime(seconds: number): string {
+    const s = Math.floor(seconds);
+    return Math.floor(s / 60) + ":" + String(s % 60).padStart(2, "0");
 }
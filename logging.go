@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/pkg/syslog"
+)
+
+type logOptions struct {
+	LogLevel    string `hcl:"log_level" flagName:"log-level" flagDescribe:"Minimum level of logged messages: debug, info, warn or error" default:"info"`
+	LogFormat   string `hcl:"log_format" flagName:"log-format" flagDescribe:"Format of logged messages: text or json" default:"text"`
+	LogSyslog   string `hcl:"log_syslog" flagName:"log-syslog" flagDescribe:"Also send logs to this syslog server in the RFC 5424 format: udp://host:port, tcp://host:port or unix:///dev/log" default:""`
+	LogJournald bool   `hcl:"log_journald" flagName:"log-journald" flagDescribe:"Also send logs to journald" default:"false"`
+	LogTag      string `hcl:"log_tag" flagName:"log-tag" flagDescribe:"Application name of logs sent to syslog or journald" default:"gotty"`
+}
+
+// setupLogging configures the default logger, which every package logs to.
+func setupLogging(options *logOptions, quiet bool) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(options.LogLevel)); err != nil {
+		return errors.Errorf("invalid log level `%s`, expected debug, info, warn or error", options.LogLevel)
+	}
+
+	var output io.Writer = os.Stderr
+	if quiet {
+		output = io.Discard
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	var handlers []slog.Handler
+	if options.LogSyslog != "" {
+		handler, err := syslog.Dial(options.LogSyslog, options.LogTag, handlerOptions)
+		if err != nil {
+			return err
+		}
+		handlers = append(handlers, handler)
+	}
+	if options.LogJournald {
+		handler, err := syslog.DialJournal(options.LogTag, handlerOptions)
+		if err != nil {
+			return err
+		}
+		handlers = append(handlers, handler)
+	}
+
+	switch options.LogFormat {
+	case "text":
+		if len(handlers) == 0 {
+			log.SetOutput(output)
+			slog.SetLogLoggerLevel(level)
+			return nil
+		}
+		// the default handler writes to the log package, which slog.SetDefault() redirects
+		handlers = append(handlers, slog.NewTextHandler(output, handlerOptions))
+	case "json":
+		handlers = append(handlers, slog.NewJSONHandler(output, handlerOptions))
+	default:
+		return errors.Errorf("invalid log format `%s`, expected text or json", options.LogFormat)
+	}
+	if len(handlers) == 1 {
+		slog.SetDefault(slog.New(handlers[0]))
+	} else {
+		slog.SetDefault(slog.New(teeHandler(handlers)))
+	}
+	return nil
+}
+
+// teeHandler sends records to all of its handlers.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			if hErr := h.Handle(ctx, r.Clone()); hErr != nil && err == nil {
+				err = hErr
+			}
+		}
+	}
+	return err
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	t2 := make(teeHandler, len(t))
+	for i, h := range t {
+		t2[i] = h.WithAttrs(attrs)
+	}
+	return t2
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	t2 := make(teeHandler, len(t))
+	for i, h := range t {
+		t2[i] = h.WithGroup(name)
+	}
+	return t2
+}
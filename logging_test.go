@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupLogging(t *testing.T) {
+	logger, stderr := slog.Default(), os.Stderr
+	t.Cleanup(func() {
+		os.Stderr = stderr
+		log.SetOutput(stderr)
+		slog.SetDefault(logger)
+		slog.SetLogLoggerLevel(slog.LevelInfo)
+	})
+
+	for _, options := range []logOptions{
+		{LogLevel: "verbose", LogFormat: "text"},
+		{LogLevel: "info", LogFormat: "xml"},
+	} {
+		if err := setupLogging(&options, false); err == nil {
+			t.Errorf("setupLogging() with %+v returned no error", options)
+		}
+	}
+
+	for _, format := range []string{"text", "json"} {
+		path := filepath.Join(t.TempDir(), "stderr")
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stderr = file
+		if err := setupLogging(&logOptions{LogLevel: "warn", LogFormat: format}, false); err != nil {
+			t.Fatal(err)
+		}
+		slog.Info("hidden")
+		slog.Warn("shown", "port", 8080)
+		file.Close()
+
+		logged, _ := os.ReadFile(path)
+		if strings.Contains(string(logged), "hidden") || !strings.Contains(string(logged), "shown") {
+			t.Errorf("logged %s in %s, expected the warning alone", logged, format)
+		}
+		var record map[string]any
+		if isJSON := json.Unmarshal(logged, &record) == nil; isJSON != (format == "json") || (isJSON && record["port"] != 8080.0) {
+			t.Errorf("logged %s, expected %s", logged, format)
+		}
+	}
+}
+
+func TestTeeHandler(t *testing.T) {
+	var text, jsonOutput bytes.Buffer
+	logger := slog.New(teeHandler{
+		slog.NewTextHandler(&text, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		slog.NewJSONHandler(&jsonOutput, &slog.HandlerOptions{Level: slog.LevelWarn}),
+	}).With("session", "abc").WithGroup("request")
+	logger.Debug("debug", "path", "/")
+	logger.Error("error", "path", "/ws")
+
+	if lines := strings.Count(text.String(), "\n"); lines != 2 || !strings.Contains(text.String(), "session=abc request.path=/ws") {
+		t.Errorf("text handler logged %s", text.String())
+	}
+	if output := jsonOutput.String(); strings.Contains(output, "debug") || !strings.Contains(output, `"session":"abc","request":{"path":"/ws"}`) {
+		t.Errorf("JSON handler logged %s", output)
+	}
+}
@@ -3,16 +3,22 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
 	cli "github.com/urfave/cli/v2"
 
+	"github.com/sorenisanerd/gotty/backend/docker"
+	"github.com/sorenisanerd/gotty/backend/kubernetes"
 	"github.com/sorenisanerd/gotty/backend/localcommand"
+	"github.com/sorenisanerd/gotty/backend/serial"
+	"github.com/sorenisanerd/gotty/backend/ssh"
+	"github.com/sorenisanerd/gotty/backend/tmux"
+	"github.com/sorenisanerd/gotty/backend/upstream"
+	"github.com/sorenisanerd/gotty/notify"
 	"github.com/sorenisanerd/gotty/pkg/homedir"
 	"github.com/sorenisanerd/gotty/server"
 	"github.com/sorenisanerd/gotty/utils"
@@ -24,102 +30,202 @@ func main() {
 	app.Version = Version
 	app.Usage = "Share your terminal as a web application"
 	app.HideHelpCommand = true
-	appOptions := &server.Options{}
+	cfg := newConfig()
 
-	if err := utils.ApplyDefaultValues(appOptions); err != nil {
-		exit(err, 1)
+	cliFlags, flagMappings := commandFlags(cfg)
+	app.Flags = cliFlags
+	app.Commands = []*cli.Command{
+		serveCommand(cfg),
+		recordCommand(cfg),
+		playCommand(),
+		replayCommand(),
+		clientCommand(),
+		benchCommand(),
+		hubCommand(),
+		checkCommand(cfg),
+		tokenCommand(cfg),
+		stopCommand(),
+		statusCommand(),
 	}
-	backendOptions := &localcommand.Options{}
-	if err := utils.ApplyDefaultValues(backendOptions); err != nil {
-		exit(err, 1)
+
+	// `gotty <command>` is an alias of `gotty serve <command>`
+	app.Action = func(c *cli.Context) error {
+		return serve(c, cliFlags, flagMappings, cfg)
+	}
+	app.Run(os.Args)
+}
+
+// config bundles the option sets that can be given as flags or in the config file.
+type config struct {
+	app        *server.Options
+	backend    *backendOptions
+	command    *localcommand.Options
+	docker     *docker.Options
+	kubernetes *kubernetes.Options
+	ssh        *ssh.Options
+	upstream   *upstream.Options
+	serial     *serial.Options
+	tmux       *tmux.Options
+	daemon     *daemonOptions
+	agent      *agentOptions
+	notify     *notify.Options
+	log        *logOptions
+	tenant     *tenantOptions
+}
+
+// newConfig returns the option sets with their default values.
+func newConfig() *config {
+	cfg := &config{
+		app:        &server.Options{},
+		backend:    &backendOptions{},
+		command:    &localcommand.Options{},
+		docker:     &docker.Options{},
+		kubernetes: &kubernetes.Options{},
+		ssh:        &ssh.Options{},
+		upstream:   &upstream.Options{},
+		serial:     &serial.Options{},
+		tmux:       &tmux.Options{},
+		daemon:     &daemonOptions{},
+		agent:      &agentOptions{},
+		notify:     &notify.Options{},
+		log:        &logOptions{},
+		tenant:     &tenantOptions{},
+	}
+	for _, options := range cfg.structs() {
+		if err := utils.ApplyDefaultValues(options); err != nil {
+			exit(err, 1)
+		}
 	}
+	return cfg
+}
+
+func (cfg *config) structs() []interface{} {
+	return []interface{}{
+		cfg.app,
+		cfg.backend,
+		cfg.command,
+		cfg.docker,
+		cfg.kubernetes,
+		cfg.ssh,
+		cfg.upstream,
+		cfg.serial,
+		cfg.tmux,
+		cfg.daemon,
+		cfg.agent,
+		cfg.notify,
+		cfg.log,
+		cfg.tenant,
+	}
+}
 
-	cliFlags, flagMappings, err := utils.GenerateFlags(appOptions, backendOptions)
+// commandFlags generates a fresh set of flags for the options,
+// so that each subcommand gets its own flag instances.
+func commandFlags(cfg *config) ([]cli.Flag, map[string]string) {
+	cliFlags, flagMappings, err := utils.GenerateFlags(cfg.structs()...)
 	if err != nil {
 		exit(err, 3)
 	}
+	return append(cliFlags, configFlag(), profileFlag(), dryRunFlag(), dryRunFormatFlag()), flagMappings
+}
 
-	app.Flags = append(
-		cliFlags,
-		&cli.StringFlag{
-			Name:    "config",
-			Value:   "~/.gotty",
-			Usage:   "Config file path",
-			EnvVars: []string{"GOTTY_CONFIG"},
-		},
-	)
-
-	app.Action = func(c *cli.Context) error {
-		if c.NArg() == 0 {
-			msg := "Error: No command given."
-			cli.ShowAppHelp(c)
-			exit(fmt.Errorf(msg), 1)
-		}
+func configFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "config",
+		Value:   "~/.gotty",
+		Usage:   "Config file path",
+		EnvVars: []string{"GOTTY_CONFIG"},
+	}
+}
 
-		configFile := c.String("config")
-		_, err := os.Stat(homedir.Expand(configFile))
-		if configFile != "~/.gotty" || !os.IsNotExist(err) {
-			if err := utils.ApplyConfigFile(configFile, appOptions, backendOptions); err != nil {
-				exit(err, 2)
-			}
-		}
+func profileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "profile",
+		Usage:   "Profile in the config file to apply on top of the base options",
+		EnvVars: []string{"GOTTY_PROFILE"},
+	}
+}
 
-		utils.ApplyFlags(cliFlags, flagMappings, c, appOptions, backendOptions)
+func dryRunFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print the effective configuration (with secrets masked) and exit",
+	}
+}
 
-		if appOptions.Quiet {
-			log.SetFlags(0)
-			log.SetOutput(io.Discard)
-		}
+func dryRunFormatFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "dry-run-format",
+		Value: "yaml",
+		Usage: "Format of the configuration printed by --dry-run (yaml or json)",
+	}
+}
 
-		if c.IsSet("credential") {
-			appOptions.EnableBasicAuth = true
-		}
-		if c.IsSet("tls-ca-crt") {
-			appOptions.EnableTLSClientAuth = true
-		}
+// loadOptions fills the options from the config file and the flags,
+// and exits when they are not valid.
+func loadOptions(c *cli.Context, cliFlags []cli.Flag, flagMappings map[string]string, cfg *config) {
+	appOptions := cfg.app
 
-		err = appOptions.Validate()
-		if err != nil {
-			exit(err, 6)
-		}
+	if err := applyOptions(c, cliFlags, flagMappings, cfg); err != nil {
+		exit(err, 2)
+	}
 
-		args := c.Args()
-		factory, err := localcommand.NewFactory(args.First(), args.Tail(), backendOptions)
-		if err != nil {
-			exit(err, 3)
-		}
+	if err := setupLogging(cfg.log, appOptions.Quiet); err != nil {
+		exit(err, 6)
+	}
 
-		hostname, _ := os.Hostname()
-		appOptions.TitleVariables = map[string]interface{}{
-			"command":  args.First(),
-			"argv":     args.Tail(),
-			"hostname": hostname,
-		}
+	if c.IsSet("credential") || appOptions.CredentialFile != "" || appOptions.CredentialVault != "" {
+		appOptions.EnableBasicAuth = true
+	}
+	if c.IsSet("tls-ca-crt") {
+		appOptions.EnableTLSClientAuth = true
+	}
 
-		srv, err := server.New(factory, appOptions)
-		if err != nil {
-			exit(err, 3)
+	if c.Bool("dry-run") {
+		if err := utils.WriteConfig(os.Stdout, c.String("dry-run-format"), cfg.structs()...); err != nil {
+			exit(err, 1)
 		}
+	}
 
-		ctx, cancel := context.WithCancel(context.Background())
-		gCtx, gCancel := context.WithCancel(context.Background())
-
-		log.Printf("GoTTY is starting with command: %s", strings.Join(args.Slice(), " "))
+	if err := appOptions.Validate(); err != nil {
+		exit(err, 6)
+	}
+	if err := cfg.upstream.Validate(); err != nil {
+		exit(err, 6)
+	}
 
-		errs := make(chan error, 1)
-		go func() {
-			errs <- srv.Run(ctx, server.WithGracefullContext(gCtx))
-		}()
-		err = waitSignals(errs, cancel, gCancel)
+	if c.Bool("dry-run") {
+		os.Exit(0)
+	}
+}
 
-		if err != nil && err != context.Canceled {
-			fmt.Printf("Error: %s\n", err)
-			exit(err, 8)
+// applyOptions applies the config file, unless it is the default one and
+// missing, then the flags.
+func applyOptions(c *cli.Context, cliFlags []cli.Flag, flagMappings map[string]string, cfg *config) error {
+	configFile := c.String("config")
+	profile := c.String("profile")
+	_, err := os.Stat(homedir.Expand(configFile))
+	if configFile != "~/.gotty" || profile != "" || !os.IsNotExist(err) {
+		if err := utils.ApplyConfigProfile(configFile, profile, cfg.structs()...); err != nil {
+			return err
 		}
+	}
+	utils.ApplyFlags(cliFlags, flagMappings, c, cfg.structs()...)
+	return nil
+}
 
-		return nil
+// reloadLimits reads the options again, e.g. on SIGHUP, and applies their
+// limits to srv.
+func reloadLimits(c *cli.Context, cliFlags []cli.Flag, flagMappings map[string]string, srv *server.Server) {
+	cfg := newConfig()
+	if err := applyOptions(c, cliFlags, flagMappings, cfg); err != nil {
+		slog.Warn("Failed to reload the options, keeping the limits", "error", err)
+		return
 	}
-	app.Run(os.Args)
+	if err := srv.SetLimits(cfg.app.Limits()); err != nil {
+		slog.Warn("Failed to reload the limits, keeping them", "error", err)
+		return
+	}
+	slog.Info("Reloaded the limits")
 }
 
 func exit(err error, code int) {
@@ -129,34 +235,61 @@ func exit(err error, code int) {
 	os.Exit(code)
 }
 
-func waitSignals(errs chan error, cancel context.CancelFunc, gracefullCancel context.CancelFunc) error {
+// waitSignals waits for errs, canceling on SIGTERM and gracefully canceling
+// on SIGINT, or on SIGTERM too when drain is positive, before canceling
+// after drain or another signal. It calls reload, if any, on SIGHUP.
+func waitSignals(errs chan error, cancel context.CancelFunc, gracefullCancel context.CancelFunc, drain time.Duration, reload func()) error {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(
 		sigChan,
 		syscall.SIGINT,
 		syscall.SIGTERM,
 	)
+	hupChan := make(chan os.Signal, 1)
+	if reload != nil {
+		signal.Notify(hupChan, syscall.SIGHUP)
+		defer signal.Stop(hupChan)
+	}
+
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case <-hupChan:
+			reload()
+		case s := <-sigChan:
+			return handleSignal(s, errs, sigChan, cancel, gracefullCancel, drain)
+		}
+	}
+}
 
-	select {
-	case err := <-errs:
-		return err
-
-	case s := <-sigChan:
-		switch s {
-		case syscall.SIGINT:
-			gracefullCancel()
-			fmt.Println("C-C to force close")
-			select {
-			case err := <-errs:
-				return err
-			case <-sigChan:
-				fmt.Println("Force closing...")
-				cancel()
-				return <-errs
-			}
-		default:
+// handleSignal stops on a signal of waitSignals.
+func handleSignal(s os.Signal, errs chan error, sigChan chan os.Signal, cancel context.CancelFunc, gracefullCancel context.CancelFunc, drain time.Duration) error {
+	switch {
+	case s == syscall.SIGINT:
+		gracefullCancel()
+		fmt.Println("C-C to force close")
+		select {
+		case err := <-errs:
+			return err
+		case <-sigChan:
+			fmt.Println("Force closing...")
 			cancel()
 			return <-errs
 		}
+	case drain > 0:
+		slog.Info("Draining before exiting", "timeout", drain)
+		gracefullCancel()
+		select {
+		case err := <-errs:
+			return err
+		case <-sigChan:
+		case <-time.After(drain):
+		}
+		cancel()
+		return <-errs
+	default:
+		cancel()
+		return <-errs
 	}
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sorenisanerd/gotty/utils"
+)
+
+func TestDryRunMasksSecrets(t *testing.T) {
+	cfg := newConfig()
+	cfg.app.Credential = "user:pass"
+	cfg.app.AccessOverride = "ops:override"
+
+	for _, format := range []string{"yaml", "json"} {
+		var buf strings.Builder
+		if err := utils.WriteConfig(&buf, format, cfg.structs()...); err != nil {
+			t.Fatalf("WriteConfig() returned error: %v", err)
+		}
+		for _, secret := range []string{"user:pass", "ops:override"} {
+			if strings.Contains(buf.String(), secret) {
+				t.Errorf("the %s configuration shows the secret %s:\n%s", format, secret, buf.String())
+			}
+		}
+	}
+}
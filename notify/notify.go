@@ -0,0 +1,355 @@
+// Package notify posts the lifecycle events of a GoTTY server to Slack,
+// Matrix or generic webhooks, as server.Events.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// Timeout bounds each post.
+const Timeout = 10 * time.Second
+
+// Event kinds, as given in Options.Events.
+const (
+	EventStart        = "start"
+	EventEnd          = "end"
+	EventDecommission = "decommission"
+	EventAuthFailure  = "auth"
+	EventApproval     = "approval"
+)
+
+type Options struct {
+	Slack       string `hcl:"notify_slack" flagName:"notify-slack" flagDescribe:"Slack incoming webhook URL to post events to" default:"" secret:"true"`
+	Matrix      string `hcl:"notify_matrix" flagName:"notify-matrix" flagDescribe:"Matrix homeserver URL to post events to, with --notify-matrix-room and --notify-matrix-token" default:""`
+	MatrixRoom  string `hcl:"notify_matrix_room" flagName:"notify-matrix-room" flagDescribe:"Matrix room ID to post events to (ex: !abc:example.com)" default:""`
+	MatrixToken string `hcl:"notify_matrix_token" flagName:"notify-matrix-token" flagDescribe:"Matrix access token of the user posting events" default:"" secret:"true"`
+	Webhook     string `hcl:"notify_webhook" flagName:"notify-webhook" flagDescribe:"URL to post events to as JSON" default:"" secret:"true"`
+	Events      string `hcl:"notify_events" flagName:"notify-events" flagDescribe:"Comma-separated events to notify: start, end, decommission, auth and approval (sessions waiting for approval, with the link to decide)" default:"start,end,decommission,approval"`
+}
+
+// Enabled returns whether any destination is set.
+func (options *Options) Enabled() bool {
+	return options.Slack != "" || options.Matrix != "" || options.Webhook != ""
+}
+
+// Message is a notification, rendered for each destination.
+type Message struct {
+	Event   string      // one of the event kinds
+	Title   string      // e.g. "Session started on host"
+	Fields  [][2]string // names and values, e.g. {"User", "alice"}
+	Session *server.SessionInfo
+	Error   string        // why the session ended, if it did
+	Elapsed time.Duration // duration of ended sessions
+}
+
+// Text renders the message as plain text.
+func (m *Message) Text() string {
+	var b strings.Builder
+	b.WriteString(m.Title)
+	for _, field := range m.Fields {
+		fmt.Fprintf(&b, "\n%s: %s", field[0], field[1])
+	}
+	return b.String()
+}
+
+// Sender posts messages to a destination.
+type Sender interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// Notifier sends the events of a server to senders, in the background.
+type Notifier struct {
+	server.NopEvents
+
+	senders  []Sender
+	events   map[string]bool
+	command  string
+	hostname string
+	client   *http.Client
+	logger   *slog.Logger
+}
+
+// New creates a notifier for the destinations of options, or returns nil
+// if there are none. command and hostname describe the server in messages.
+func New(options *Options, command string, hostname string) (*Notifier, error) {
+	if !options.Enabled() {
+		return nil, nil
+	}
+	n := &Notifier{
+		events:   map[string]bool{},
+		command:  command,
+		hostname: hostname,
+		client:   &http.Client{Timeout: Timeout},
+		logger:   slog.Default(),
+	}
+	for _, event := range strings.Split(options.Events, ",") {
+		switch event = strings.TrimSpace(event); event {
+		case EventStart, EventEnd, EventDecommission, EventAuthFailure, EventApproval:
+			n.events[event] = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown event `%s` to notify, expected start, end, decommission, auth or approval", event)
+		}
+	}
+
+	if options.Slack != "" {
+		n.senders = append(n.senders, &Slack{URL: options.Slack, Client: n.client})
+	}
+	if options.Matrix != "" {
+		if options.MatrixRoom == "" || options.MatrixToken == "" {
+			return nil, errors.New("--notify-matrix requires --notify-matrix-room and --notify-matrix-token")
+		}
+		n.senders = append(n.senders, &Matrix{Homeserver: options.Matrix, Room: options.MatrixRoom, Token: options.MatrixToken, Client: n.client})
+	}
+	if options.Webhook != "" {
+		n.senders = append(n.senders, &Webhook{URL: options.Webhook, Client: n.client})
+	}
+	return n, nil
+}
+
+func (n *Notifier) OnSessionStart(session server.SessionInfo) {
+	n.notify(&Message{
+		Event:   EventStart,
+		Title:   "Session started on " + n.hostname,
+		Fields:  n.sessionFields(session),
+		Session: &session,
+	})
+}
+
+func (n *Notifier) OnSessionEnd(session server.SessionInfo, err error) {
+	reason := "client disconnected"
+	var exitErr *webtty.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		reason = fmt.Sprintf("command exited with status %d", exitErr.Code)
+	case errors.Is(err, webtty.ErrSlaveClosed):
+		reason = "command exited"
+	case errors.Is(err, server.ErrSessionTerminated):
+		reason = "terminated"
+	case err != nil && !errors.Is(err, webtty.ErrMasterClosed):
+		reason = err.Error()
+	}
+	elapsed := time.Since(session.StartedAt).Round(time.Second)
+	n.notify(&Message{
+		Event:   EventEnd,
+		Title:   "Session ended on " + n.hostname,
+		Fields:  append(n.sessionFields(session), [2]string{"Duration", elapsed.String()}, [2]string{"Reason", reason}),
+		Session: &session,
+		Error:   reason,
+		Elapsed: elapsed,
+	})
+}
+
+func (n *Notifier) OnAuthFailure(remoteAddr string, err error) {
+	n.notify(&Message{
+		Event:  EventAuthFailure,
+		Title:  "Authentication failed on " + n.hostname,
+		Fields: [][2]string{{"From", remoteAddr}},
+		Error:  err.Error(),
+	})
+}
+
+func (n *Notifier) OnApprovalRequest(request server.ApprovalRequest) {
+	fields := [][2]string{}
+	if request.User != "" {
+		fields = append(fields, [2]string{"User", request.User})
+	}
+	fields = append(fields,
+		[2]string{"From", request.RemoteAddr},
+		[2]string{"Command", n.command},
+		[2]string{"Session", request.SessionID},
+		[2]string{"Expires", request.ExpiresAt.Format(time.RFC3339)},
+	)
+	if request.URL != "" {
+		fields = append(fields, [2]string{"Approve or deny", request.URL})
+	}
+	n.notify(&Message{
+		Event:  EventApproval,
+		Title:  "Session waiting for approval on " + n.hostname,
+		Fields: fields,
+	})
+}
+
+func (n *Notifier) OnDecommission() {
+	n.notify(&Message{
+		Event: EventDecommission,
+		Title: n.hostname + " decommissioned, no longer accepting clients",
+	})
+}
+
+func (n *Notifier) sessionFields(session server.SessionInfo) [][2]string {
+	fields := [][2]string{}
+	if session.User != "" {
+		fields = append(fields, [2]string{"User", session.User})
+	}
+	return append(fields,
+		[2]string{"From", session.RemoteAddr},
+		[2]string{"Command", n.command},
+		[2]string{"Session", session.ID},
+	)
+}
+
+// notify sends m in the background, as events must not block.
+func (n *Notifier) notify(m *Message) {
+	if !n.events[m.Event] {
+		return
+	}
+	for _, sender := range n.senders {
+		go func(sender Sender) {
+			ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+			defer cancel()
+			if err := sender.Send(ctx, m); err != nil {
+				n.logger.Warn("Failed to send a notification", "event", m.Event, "error", err)
+			}
+		}(sender)
+	}
+}
+
+// Slack posts messages to an incoming webhook of Slack.
+type Slack struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *Slack) Send(ctx context.Context, m *Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*", escapeSlack(m.Title))
+	for _, field := range m.Fields {
+		if isLink(field[1]) {
+			fmt.Fprintf(&b, "\n*%s:* <%s>", field[0], escapeSlack(field[1]))
+			continue
+		}
+		fmt.Fprintf(&b, "\n*%s:* `%s`", field[0], escapeSlack(field[1]))
+	}
+	return post(ctx, s.Client, http.MethodPost, s.URL, nil, map[string]string{"text": b.String()})
+}
+
+// isLink tells whether the value of a field is a link, e.g. to approve a
+// session, to be rendered clickable.
+func isLink(value string) bool {
+	return strings.HasPrefix(value, "https://") || strings.HasPrefix(value, "http://")
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "`", "'")
+
+func escapeSlack(s string) string {
+	return slackEscaper.Replace(s)
+}
+
+// Matrix sends messages to a room of a Matrix homeserver.
+type Matrix struct {
+	Homeserver string
+	Room       string
+	Token      string
+	Client     *http.Client
+}
+
+var matrixTxn atomic.Int64
+
+func (mx *Matrix) Send(ctx context.Context, m *Message) error {
+	var formatted strings.Builder
+	fmt.Fprintf(&formatted, "<b>%s</b>", html.EscapeString(m.Title))
+	for _, field := range m.Fields {
+		if isLink(field[1]) {
+			fmt.Fprintf(&formatted, "<br><b>%s:</b> <a href=\"%s\">%[2]s</a>", field[0], html.EscapeString(field[1]))
+			continue
+		}
+		fmt.Fprintf(&formatted, "<br><b>%s:</b> <code>%s</code>", field[0], html.EscapeString(field[1]))
+	}
+
+	txn := fmt.Sprintf("gotty-%d-%d", time.Now().UnixNano(), matrixTxn.Add(1))
+	endpoint := strings.TrimSuffix(mx.Homeserver, "/") + "/_matrix/client/v3/rooms/" +
+		url.PathEscape(mx.Room) + "/send/m.room.message/" + txn
+	header := http.Header{"Authorization": {"Bearer " + mx.Token}}
+	return post(ctx, mx.Client, http.MethodPut, endpoint, header, map[string]string{
+		"msgtype":        "m.text",
+		"body":           m.Text(),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted.String(),
+	})
+}
+
+// Webhook posts messages as JSON objects with the event, the session,
+// the text and, for ended sessions, the reason and the duration.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+type webhookPayload struct {
+	Event           string          `json:"event"`
+	Text            string          `json:"text"`
+	Session         *webhookSession `json:"session,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	DurationSeconds float64         `json:"duration_seconds,omitempty"`
+	Time            time.Time       `json:"time"`
+}
+
+type webhookSession struct {
+	ID         string    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	User       string    `json:"user,omitempty"`
+	Backend    string    `json:"backend"`
+	Node       string    `json:"node,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+func (w *Webhook) Send(ctx context.Context, m *Message) error {
+	payload := webhookPayload{
+		Event:           m.Event,
+		Text:            m.Text(),
+		Error:           m.Error,
+		DurationSeconds: m.Elapsed.Seconds(),
+		Time:            time.Now(),
+	}
+	if session := m.Session; session != nil {
+		payload.Session = &webhookSession{
+			ID:         session.ID,
+			RemoteAddr: session.RemoteAddr,
+			User:       session.User,
+			Backend:    session.Backend,
+			Node:       session.Node,
+			StartedAt:  session.StartedAt,
+		}
+	}
+	return post(ctx, w.Client, http.MethodPost, w.URL, nil, payload)
+}
+
+func post(ctx context.Context, client *http.Client, method string, endpoint string, header http.Header, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s", method, req.URL.Redacted(), resp.Status)
+	}
+	return nil
+}
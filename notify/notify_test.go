@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+func TestNotifier(t *testing.T) {
+	type request struct {
+		method, path, auth string
+		body               map[string]interface{}
+	}
+	requests := make(chan request, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests <- request{r.Method, r.URL.Path, r.Header.Get("Authorization"), body}
+	}))
+	defer ts.Close()
+
+	n, err := New(&Options{
+		Slack:       ts.URL + "/slack",
+		Matrix:      ts.URL,
+		MatrixRoom:  "!room:example.com",
+		MatrixToken: "secret",
+		Webhook:     ts.URL + "/webhook",
+		Events:      "end",
+	}, "top", "host")
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	session := server.SessionInfo{ID: "1", RemoteAddr: "10.0.0.1", User: "alice", StartedAt: time.Now().Add(-time.Minute)}
+	n.OnSessionStart(session) // not selected
+	n.OnSessionEnd(session, &webtty.ExitError{Code: 2})
+
+	got := map[string]request{}
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-requests:
+			got[r.method+" "+strings.SplitN(r.path, "/send/", 2)[0]] = r
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d notifications, expected 3", i)
+		}
+	}
+
+	slack := got["POST /slack"]
+	if text, _ := slack.body["text"].(string); !strings.Contains(text, "*Session ended on host*") || !strings.Contains(text, "*User:* `alice`") {
+		t.Errorf("unexpected Slack text %q", text)
+	}
+
+	matrix, ok := got["PUT /_matrix/client/v3/rooms/!room:example.com"]
+	if !ok || matrix.auth != "Bearer secret" {
+		t.Errorf("unexpected Matrix request %+v", matrix)
+	}
+	if body, _ := matrix.body["body"].(string); !strings.Contains(body, "Command: top") {
+		t.Errorf("unexpected Matrix body %q", body)
+	}
+
+	webhook := got["POST /webhook"]
+	if webhook.body["event"] != "end" || webhook.body["error"] != "command exited with status 2" || webhook.body["duration_seconds"] != 60.0 {
+		t.Errorf("unexpected webhook payload %v", webhook.body)
+	}
+
+	select {
+	case r := <-requests:
+		t.Errorf("unexpected notification %+v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := New(&Options{Webhook: ts.URL, Events: "stop"}, "top", "host"); err == nil {
+		t.Errorf("New() accepted an unknown event")
+	}
+}
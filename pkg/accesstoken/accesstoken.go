@@ -0,0 +1,82 @@
+// Package accesstoken mints and verifies signed, expiring tokens
+// that grant access to a GoTTY server.
+package accesstoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sorenisanerd/gotty/pkg/randomstring"
+)
+
+var (
+	ErrInvalid = errors.New("invalid access token")
+	ErrExpired = errors.New("access token expired")
+)
+
+// Claims are the contents of a token.
+type Claims struct {
+	ID        string `json:"jti"`
+	ExpiresAt int64  `json:"exp"`
+	// Once permits a single session with the token.
+	Once bool `json:"once,omitempty"`
+	// Args, when not nil, replace the arguments sent by the client.
+	Args []string `json:"args,omitempty"`
+}
+
+// New returns claims for a token valid for ttl, with a random ID.
+func New(ttl time.Duration, once bool, args []string) Claims {
+	return Claims{
+		ID:        randomstring.Generate(16),
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+		Once:      once,
+		Args:      args,
+	}
+}
+
+// Sign encodes the claims into a token signed with secret.
+func Sign(secret []byte, claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature(secret, encoded)), nil
+}
+
+// Verify checks the signature and the expiry of token and returns its claims.
+func Verify(secret []byte, token string, now time.Time) (*Claims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalid
+	}
+	decodedSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(decodedSig, signature(secret, encoded)) {
+		return nil, ErrInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ID == "" {
+		return nil, ErrInvalid
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+func signature(secret []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,35 @@
+package accesstoken
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("secret")
+	claims := New(time.Minute, true, []string{"-a", "b"})
+
+	token, err := Sign(secret, claims)
+	if err != nil {
+		t.Fatalf("Sign() returned error: %v", err)
+	}
+
+	verified, err := Verify(secret, token, time.Now())
+	if err != nil {
+		t.Fatalf("Verify() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(*verified, claims) {
+		t.Errorf("claims = %+v, expected %+v", *verified, claims)
+	}
+
+	if _, err := Verify([]byte("other"), token, time.Now()); err != ErrInvalid {
+		t.Errorf("Verify() with another secret: error = %v, expected %v", err, ErrInvalid)
+	}
+	if _, err := Verify(secret, token+"x", time.Now()); err != ErrInvalid {
+		t.Errorf("Verify() of a tampered token: error = %v, expected %v", err, ErrInvalid)
+	}
+	if _, err := Verify(secret, token, time.Now().Add(time.Hour)); err != ErrExpired {
+		t.Errorf("Verify() after expiry: error = %v, expected %v", err, ErrExpired)
+	}
+}
@@ -0,0 +1,180 @@
+// Package asciicast reads and writes terminal recordings
+// in the asciicast v2 format used by asciinema.
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Event types
+const (
+	Output = "o"
+	Input  = "i"
+	Marker = "m"
+	Resize = "r"
+)
+
+// Header is the first line of a recording.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is a single line following the header.
+type Event struct {
+	Time float64
+	Type string
+	Data string
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Type, e.Data})
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("event has %d fields, expected 3", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields[1], &e.Type); err != nil {
+		return err
+	}
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+// Writer writes a recording. It is safe for concurrent use.
+type Writer struct {
+	w     io.Writer
+	start time.Time
+
+	mutex   sync.Mutex
+	partial []byte // incomplete UTF-8 sequence at the end of the last output
+}
+
+// NewWriter writes the header and returns a Writer
+// whose event times are relative to now.
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	header.Version = 2
+	start := time.Now()
+	if header.Timestamp == 0 {
+		header.Timestamp = start.Unix()
+	}
+	line, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, start: start}, nil
+}
+
+// WriteOutput records output of the terminal.
+// UTF-8 sequences split across calls are kept together.
+func (w *Writer) WriteOutput(p []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	data := append(w.partial, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	w.partial = append([]byte{}, data[cut:]...)
+	if cut == 0 {
+		return nil
+	}
+	return w.writeEvent(Output, string(data[:cut]))
+}
+
+// WriteResize records a change of the terminal size.
+func (w *Writer) WriteResize(columns int, rows int) error {
+	return w.WriteEvent(Resize, fmt.Sprintf("%dx%d", columns, rows))
+}
+
+// WriteEvent records an event of any type.
+func (w *Writer) WriteEvent(typ string, data string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writeEvent(typ, data)
+}
+
+func (w *Writer) writeEvent(typ string, data string) error {
+	elapsed := time.Since(w.start).Seconds()
+	line, err := json.Marshal(Event{Time: float64(int64(elapsed*1e6)) / 1e6, Type: typ, Data: data})
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(append(line, '\n'))
+	return err
+}
+
+// Reader reads a recording.
+type Reader struct {
+	Header Header
+
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader reads the header of a recording.
+func NewReader(r io.Reader) (*Reader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	reader := &Reader{scanner: scanner}
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty recording")
+	}
+	reader.line++
+	if err := json.Unmarshal(scanner.Bytes(), &reader.Header); err != nil {
+		return nil, fmt.Errorf("line 1: invalid header: %s", err)
+	}
+	if reader.Header.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciicast version %d", reader.Header.Version)
+	}
+	return reader, nil
+}
+
+// Next returns the next event, or io.EOF at the end of the recording.
+func (r *Reader) Next() (*Event, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+		event := &Event{}
+		if err := json.Unmarshal(r.scanner.Bytes(), event); err != nil {
+			return nil, fmt.Errorf("line %d: invalid event: %s", r.line, err)
+		}
+		return event, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
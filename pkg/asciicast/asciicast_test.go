@@ -0,0 +1,71 @@
+package asciicast
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{Width: 80, Height: 24, Title: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// é split across two outputs is kept together
+	for _, output := range [][]byte{[]byte("caf\xc3"), []byte("\xa9\n")} {
+		if err := w.WriteOutput(output); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.WriteResize(120, 40)
+	w.WriteEvent(Marker, "done")
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header.Version != 2 || r.Header.Width != 80 || r.Header.Height != 24 || r.Header.Title != "test" || r.Header.Timestamp == 0 {
+		t.Errorf("header = %+v", r.Header)
+	}
+	var events []Event
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, *event)
+	}
+	expected := []Event{{Type: Output, Data: "caf"}, {Type: Output, Data: "é\n"}, {Type: Resize, Data: "120x40"}, {Type: Marker, Data: "done"}}
+	if len(events) != len(expected) {
+		t.Fatalf("events = %+v, expected %+v", events, expected)
+	}
+	for i, event := range events {
+		if event.Type != expected[i].Type || event.Data != expected[i].Data || (i > 0 && event.Time < events[i-1].Time) {
+			t.Errorf("event = %+v, expected %+v", event, expected[i])
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, test := range []struct {
+		recording string
+		expected  string
+	}{
+		{"", "empty recording"},
+		{`{"version": 1}`, "unsupported asciicast version 1"},
+		{"{\"version\": 2}\n\n[0.5, \"o\"]\n", "line 3: invalid event: event has 2 fields, expected 3"},
+	} {
+		r, err := NewReader(strings.NewReader(test.recording))
+		if err == nil {
+			_, err = r.Next()
+		}
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("reading %q returned %v, expected %s", test.recording, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRedisTimeout bounds commands whose context has no deadline.
+const DefaultRedisTimeout = 5 * time.Second
+
+const (
+	acquireScript = `local v = redis.call('GET', KEYS[1])
+if v == false or v == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0`
+	releaseScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+)
+
+// RedisError is an error replied by the Redis server.
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+// Redis is a Store in a Redis server, shared by GoTTY instances on any host.
+// It uses a single connection, which is opened on first use and reopened
+// after network errors.
+type Redis struct {
+	addr     string
+	username string
+	password string
+	db       int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedis creates a Redis store for address, which is either host:port
+// or a URL like redis://[[user]:password@]host[:port][/db].
+func NewRedis(address string) (*Redis, error) {
+	if !strings.Contains(address, "://") {
+		return &Redis{addr: address}, nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported Redis URL scheme `%s`", u.Scheme)
+	}
+
+	r := &Redis{addr: u.Host}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database `%s`", db)
+		}
+	}
+	return r, nil
+}
+
+func (r *Redis) Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	reply, err := r.do(ctx, "EVAL", acquireScript, "1", key, owner, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+func (r *Redis) Release(ctx context.Context, key string, owner string) error {
+	_, err := r.do(ctx, "EVAL", releaseScript, "1", key, owner)
+	return err
+}
+
+func (r *Redis) Add(ctx context.Context, key string, delta int64) (int64, error) {
+	reply, err := r.do(ctx, "INCRBY", key, strconv.FormatInt(delta, 10))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply to INCRBY: %v", reply)
+	}
+	return n, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) (string, error) {
+	reply, err := r.do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	value, _ := reply.(string)
+	return value, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", key)
+	return err
+}
+
+// Close closes the connection to the server.
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// do sends a command and returns its reply: a string, an int64, nil or
+// a []interface{} of them.
+func (r *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		if err := r.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultRedisTimeout)
+	}
+	r.conn.SetDeadline(deadline)
+
+	reply, err := r.roundTrip(args...)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return reply, err
+}
+
+func (r *Redis) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	r.conn = conn
+	r.reader = bufio.NewReader(conn)
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultRedisTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.username != "" {
+			args = []string{"AUTH", r.username, r.password}
+		}
+		if _, err = r.roundTrip(args...); err != nil {
+			err = fmt.Errorf("failed to authenticate to Redis: %w", err)
+		}
+	}
+	if err == nil && r.db != 0 {
+		if _, err = r.roundTrip("SELECT", strconv.Itoa(r.db)); err != nil {
+			err = fmt.Errorf("failed to select Redis database %d: %w", r.db, err)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		r.conn = nil
+	}
+	return err
+}
+
+func (r *Redis) roundTrip(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(r.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(r.reader)
+}
+
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed Redis reply `%s`", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, RedisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		elements := make([]interface{}, size)
+		for i := range elements {
+			if elements[i], err = readReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return elements, nil
+	default:
+		return nil, fmt.Errorf("malformed Redis reply `%s`", line)
+	}
+}
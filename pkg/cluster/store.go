@@ -0,0 +1,124 @@
+// Package cluster provides stores for the state GoTTY instances share
+// when they run behind a load balancer: an in-memory store for a single
+// process and a Redis store for several hosts.
+package cluster
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store is a key-value store shared by GoTTY instances.
+// Keys and values are strings; missing keys read as "".
+type Store interface {
+	// Acquire sets key to owner unless it is held by another owner,
+	// and returns whether owner holds it. The key expires after ttl
+	// unless acquired again, which allows owners to refresh it.
+	Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error)
+	// Release deletes key if it is held by owner.
+	Release(ctx context.Context, key string, owner string) error
+	// Add adds delta to the integer at key and returns the result.
+	Add(ctx context.Context, key string, delta int64) (int64, error)
+	// Get returns the value of key.
+	Get(ctx context.Context, key string) (string, error)
+	// Set sets key to value, which expires after ttl unless it is 0.
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	// Delete deletes key.
+	Delete(ctx context.Context, key string) error
+}
+
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+// Memory is a Store kept in memory, shared by the servers of a process.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// NewMemory creates an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]entry)}
+}
+
+// get returns the entry of key, deleting it if expired. mu must be held.
+func (m *Memory) get(key string) (entry, bool) {
+	e, ok := m.entries[key]
+	if ok && !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(m.entries, key)
+		return entry{}, false
+	}
+	return e, ok
+}
+
+func (m *Memory) set(key string, value string, ttl time.Duration) {
+	e := entry{value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	m.entries[key] = e
+}
+
+func (m *Memory) Acquire(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.get(key); ok && e.value != owner {
+		return false, nil
+	}
+	m.set(key, owner, ttl)
+	return true, nil
+}
+
+func (m *Memory) Release(ctx context.Context, key string, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.get(key); ok && e.value == owner {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+func (m *Memory) Add(ctx context.Context, key string, delta int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	e, ok := m.get(key)
+	if ok {
+		n, _ = strconv.ParseInt(e.value, 10, 64)
+	}
+	n += delta
+	e.value = strconv.FormatInt(n, 10)
+	m.entries[key] = e
+	return n, nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _ := m.get(key)
+	return e.value, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(key, value, ttl)
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
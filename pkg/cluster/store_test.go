@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	if ok, _ := m.Acquire(ctx, "session", "a", time.Minute); !ok {
+		t.Fatalf("Acquire() failed on a free key")
+	}
+	if ok, _ := m.Acquire(ctx, "session", "b", time.Minute); ok {
+		t.Errorf("Acquire() succeeded on a key held by another owner")
+	}
+	m.Release(ctx, "session", "b")
+	if value, _ := m.Get(ctx, "session"); value != "a" {
+		t.Errorf("Release() by another owner deleted the key")
+	}
+	m.Release(ctx, "session", "a")
+	if ok, _ := m.Acquire(ctx, "session", "b", time.Millisecond); !ok {
+		t.Errorf("Acquire() failed on a released key")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if value, _ := m.Get(ctx, "session"); value != "" {
+		t.Errorf("key did not expire: %q", value)
+	}
+
+	m.Add(ctx, "connections", 2)
+	if n, _ := m.Add(ctx, "connections", -1); n != 1 {
+		t.Errorf("Add() = %d, expected %d", n, 1)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	commands := make(chan string, 8)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for _, reply := range []string{"+OK\r\n", "+OK\r\n", ":1\r\n", ":3\r\n", "$-1\r\n", "$5\r\nhello\r\n", "-ERR wrong\r\n"} {
+			args, err := readReply(reader)
+			if err != nil {
+				return
+			}
+			var command []string
+			for _, arg := range args.([]interface{}) {
+				command = append(command, arg.(string))
+			}
+			commands <- strings.Join(command, " ")
+			conn.Write([]byte(reply))
+		}
+	}()
+
+	r, err := NewRedis("redis://:secret@" + listener.Addr().String() + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	ctx := context.Background()
+
+	ok, err := r.Acquire(ctx, "k", "owner", time.Second)
+	if err != nil || !ok {
+		t.Fatalf("Acquire() = %v, %v", ok, err)
+	}
+	for _, expected := range []string{"AUTH secret", "SELECT 2"} {
+		if command := <-commands; command != expected {
+			t.Errorf("command = %q, expected %q", command, expected)
+		}
+	}
+	if command := <-commands; !strings.HasPrefix(command, "EVAL ") || !strings.HasSuffix(command, " 1 k owner 1000") {
+		t.Errorf("command = %q, expected EVAL of the acquire script", command)
+	}
+
+	if n, err := r.Add(ctx, "c", 3); err != nil || n != 3 {
+		t.Errorf("Add() = %d, %v, expected 3", n, err)
+	}
+	if value, err := r.Get(ctx, "missing"); err != nil || value != "" {
+		t.Errorf("Get() = %q, %v, expected an empty value", value, err)
+	}
+	if value, err := r.Get(ctx, "k"); err != nil || value != "hello" {
+		t.Errorf("Get() = %q, %v, expected %q", value, err, "hello")
+	}
+	if err := r.Delete(ctx, "k"); err == nil || err.Error() != "redis: ERR wrong" {
+		t.Errorf("Delete() returned %v, expected the error of the server", err)
+	}
+}
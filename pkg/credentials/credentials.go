@@ -0,0 +1,59 @@
+// Package credentials provides stores for the credential of Basic
+// Authentication, which can be rotated while GoTTY runs: a static one kept
+// in memory, a file and a secret in Vault.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrInvalid is returned for credentials that are not user:password.
+var ErrInvalid = errors.New("invalid credential, expected user:password")
+
+// Store keeps a credential, as user:password.
+type Store interface {
+	// Get returns the current credential.
+	Get(ctx context.Context) (string, error)
+	// Rotate replaces the credential. Clients authenticate with the new
+	// one from then on.
+	Rotate(ctx context.Context, credential string) error
+}
+
+// Validate checks that credential is user:password.
+func Validate(credential string) error {
+	user, _, ok := strings.Cut(credential, ":")
+	if !ok || user == "" || strings.ContainsAny(credential, "\r\n") {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Static is a Store kept in memory, rotated by the process only.
+type Static struct {
+	mu         sync.Mutex
+	credential string
+}
+
+// NewStatic creates a Static store with credential.
+func NewStatic(credential string) *Static {
+	return &Static{credential: credential}
+}
+
+func (s *Static) Get(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.credential, nil
+}
+
+func (s *Static) Rotate(ctx context.Context, credential string) error {
+	if err := Validate(credential); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credential = credential
+	return nil
+}
@@ -0,0 +1,84 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "credential")
+	if err := os.WriteFile(path, []byte("user:old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile() returned error: %v", err)
+	}
+	if credential, _ := f.Get(ctx); credential != "user:old" {
+		t.Errorf("Get() = %q, expected user:old", credential)
+	}
+
+	if err := f.Rotate(ctx, "user:new"); err != nil {
+		t.Fatalf("Rotate() returned error: %v", err)
+	}
+	if credential, _ := f.Get(ctx); credential != "user:new" {
+		t.Errorf("Get() = %q after Rotate(), expected user:new", credential)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "user:new\n" {
+		t.Errorf("file = %q, expected the new credential", data)
+	}
+
+	if err := f.Rotate(ctx, "nopassword"); err != ErrInvalid {
+		t.Errorf("Rotate() = %v for an invalid credential, expected ErrInvalid", err)
+	}
+	if _, err := NewFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("NewFile() accepted a missing file")
+	}
+}
+
+func TestVault(t *testing.T) {
+	secret := "user:old"
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" || r.URL.Path != "/v1/secret/data/gotty" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var body struct {
+			Data map[string]string `json:"data"`
+		}
+		switch r.Method {
+		case http.MethodPost:
+			json.NewDecoder(r.Body).Decode(&body)
+			secret = body.Data["credential"]
+		case http.MethodGet:
+			body.Data = map[string]string{"credential": secret}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": body})
+		}
+	}))
+	defer vault.Close()
+
+	ctx := context.Background()
+	v := NewVault(vault.URL+"/v1/secret/data/gotty", "token")
+	if credential, err := v.Get(ctx); err != nil || credential != "user:old" {
+		t.Errorf("Get() = %q, %v, expected user:old", credential, err)
+	}
+	if err := v.Rotate(ctx, "user:new"); err != nil {
+		t.Fatalf("Rotate() returned error: %v", err)
+	}
+	if secret != "user:new" {
+		t.Errorf("secret = %q, expected the new credential", secret)
+	}
+	if credential, _ := v.Get(ctx); credential != "user:new" {
+		t.Errorf("Get() = %q after Rotate(), expected user:new", credential)
+	}
+
+	if _, err := NewVault(vault.URL+"/v1/secret/data/gotty", "wrong").Get(ctx); err == nil {
+		t.Errorf("Get() succeeded with a wrong token")
+	}
+}
@@ -0,0 +1,82 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File is a Store keeping the credential in a file, read again whenever it
+// changes, so that it can also be rotated by replacing the file.
+type File struct {
+	path string
+
+	mu         sync.Mutex
+	credential string
+	modTime    time.Time
+	size       int64
+}
+
+// NewFile creates a File store reading the credential from path.
+func NewFile(path string) (*File, error) {
+	f := &File{path: path}
+	if _, err := f.Get(context.Background()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) Get(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credential file: %w", err)
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.credential, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credential file: %w", err)
+	}
+	credential := strings.TrimRight(string(data), "\r\n")
+	if err := Validate(credential); err != nil {
+		return "", fmt.Errorf("credential file `%s`: %w", f.path, err)
+	}
+	f.credential, f.modTime, f.size = credential, info.ModTime(), info.Size()
+	return f.credential, nil
+}
+
+// Rotate replaces the file atomically, readable by its owner only.
+func (f *File) Rotate(ctx context.Context, credential string) error {
+	if err := Validate(credential); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".credential-*")
+	if err != nil {
+		return fmt.Errorf("failed to write credential file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(credential + "\n")
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write credential file: %w", err)
+	}
+	// read again on the next Get
+	f.modTime = time.Time{}
+	return nil
+}
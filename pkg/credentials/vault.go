@@ -0,0 +1,66 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/secrets"
+)
+
+// VaultCacheTTL is how long a Vault store reuses the credential it read,
+// so that instances sharing the secret pick up rotations within it.
+const VaultCacheTTL = 10 * time.Second
+
+// vaultField is the key of the credential in the secret.
+const vaultField = "credential"
+
+// Vault is a Store keeping the credential in a secret of the KV version 2
+// secrets engine of HashiCorp Vault, under the key "credential".
+type Vault struct {
+	secret *secrets.Vault
+
+	mu         sync.Mutex
+	credential string
+	readAt     time.Time
+}
+
+// NewVault creates a Vault store for the secret at url, e.g.
+// https://vault:8200/v1/secret/data/gotty, authenticating with token.
+func NewVault(url string, token string) *Vault {
+	return &Vault{secret: secrets.NewVault(url, token)}
+}
+
+func (v *Vault) Get(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.readAt.IsZero() && time.Since(v.readAt) < VaultCacheTTL {
+		return v.credential, nil
+	}
+
+	values, err := v.secret.Fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	credential := values[vaultField]
+	if err := Validate(credential); err != nil {
+		return "", fmt.Errorf("%s: %w", v.secret, err)
+	}
+	v.credential, v.readAt = credential, time.Now()
+	return credential, nil
+}
+
+// Rotate writes a new version of the secret, keeping its other values.
+func (v *Vault) Rotate(ctx context.Context, credential string) error {
+	if err := Validate(credential); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.secret.Update(ctx, map[string]string{vaultField: credential}); err != nil {
+		return err
+	}
+	v.credential, v.readAt = credential, time.Now()
+	return nil
+}
@@ -0,0 +1,90 @@
+// Package geoip looks up the country and autonomous system of IP addresses
+// in local MaxMind DB files, such as GeoLite2-Country and GeoLite2-ASN.
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+)
+
+// Record is what the databases know of an address.
+type Record struct {
+	Country      string // ISO 3166-1 alpha-2 code, e.g. DE
+	ASN          uint
+	Organization string // of the autonomous system
+}
+
+// DB is a MaxMind DB file, loaded in memory.
+type DB struct {
+	path string
+	db   *mmdb
+}
+
+// Open loads the MaxMind DB file at path.
+func Open(path string) (*DB, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := parseMMDB(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &DB{path: path, db: db}, nil
+}
+
+// Lookup returns the record of addr, the zero Record if the database has none.
+func (db *DB) Lookup(addr netip.Addr) (Record, error) {
+	var record Record
+	value, err := db.db.lookup(addr)
+	if err != nil {
+		return record, fmt.Errorf("%s: %w", db.path, err)
+	}
+	data, _ := value.(map[string]interface{})
+	for _, key := range []string{"country", "registered_country"} {
+		if country, ok := data[key].(map[string]interface{}); ok && record.Country == "" {
+			record.Country, _ = country["iso_code"].(string)
+		}
+	}
+	if asn, ok := data["autonomous_system_number"].(uint64); ok {
+		record.ASN = uint(asn)
+	}
+	record.Organization, _ = data["autonomous_system_organization"].(string)
+	return record, nil
+}
+
+// Databases are several databases, e.g. one of countries and one of
+// autonomous systems.
+type Databases []*DB
+
+// OpenAll loads the MaxMind DB files at paths.
+func OpenAll(paths []string) (Databases, error) {
+	dbs := make(Databases, 0, len(paths))
+	for _, path := range paths {
+		db, err := Open(path)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// Lookup returns the record of addr, combining those of the databases.
+func (dbs Databases) Lookup(addr netip.Addr) (Record, error) {
+	var record Record
+	for _, db := range dbs {
+		r, err := db.Lookup(addr)
+		if err != nil {
+			return record, err
+		}
+		if record.Country == "" {
+			record.Country = r.Country
+		}
+		if record.ASN == 0 {
+			record.ASN, record.Organization = r.ASN, r.Organization
+		}
+	}
+	return record, nil
+}
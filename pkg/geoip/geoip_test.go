@@ -0,0 +1,123 @@
+package geoip
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// build returns a MaxMind DB with record size 24 mapping the prefixes to
+// their data.
+func build(ipVersion uint64, prefixes map[string]map[string]interface{}) []byte {
+	const empty = -1
+	nodes := [][2]int{{empty, empty}}
+	var data []byte
+	for prefix, value := range prefixes {
+		p := netip.MustParsePrefix(prefix)
+		ip, bits := p.Addr().AsSlice(), p.Bits()
+		if ipVersion == 6 && p.Addr().Is4() {
+			ip, bits = append(make([]byte, 12), ip...), bits+96
+		}
+		node := 0
+		for i := 0; i < bits-1; i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if nodes[node][bit] == empty {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+		nodes[node][ip[(bits-1)/8]>>(7-(bits-1)%8)&1] = -2 - len(data)
+		data = append(data, encode(value)...)
+	}
+
+	var file []byte
+	for _, node := range nodes {
+		for _, record := range node {
+			switch {
+			case record == empty:
+				record = len(nodes)
+			case record < empty:
+				record = len(nodes) + dataSeparator + (-2 - record)
+			}
+			file = append(file, byte(record>>16), byte(record>>8), byte(record))
+		}
+	}
+	file = append(file, make([]byte, dataSeparator)...)
+	file = append(file, data...)
+	file = append(file, metadataMarker...)
+	return append(file, encode(map[string]interface{}{
+		"node_count": uint64(len(nodes)), "record_size": uint64(24), "ip_version": ipVersion,
+	})...)
+}
+
+func encode(value interface{}) []byte {
+	header := func(kind int, size int) []byte {
+		var extra []byte
+		if size >= 29 {
+			size, extra = 29, []byte{byte(size - 29)}
+		}
+		if kind > 7 {
+			return append([]byte{byte(size), byte(kind - 7)}, extra...)
+		}
+		return append([]byte{byte(kind<<5 | size)}, extra...)
+	}
+	switch v := value.(type) {
+	case string:
+		return append(header(typeString, len(v)), v...)
+	case uint64:
+		return append(header(typeUint32, 4), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b := header(typeMap, len(v))
+		for _, key := range keys {
+			b = append(b, encode(key)...)
+			b = append(b, encode(v[key])...)
+		}
+		return b
+	}
+	panic(value)
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	country := filepath.Join(dir, "country.mmdb")
+	os.WriteFile(country, build(6, map[string]map[string]interface{}{
+		"1.2.3.0/24":    {"country": map[string]interface{}{"iso_code": "DE"}},
+		"2001:db8::/32": {"registered_country": map[string]interface{}{"iso_code": "FR"}},
+	}), 0o600)
+	asn := filepath.Join(dir, "asn.mmdb")
+	os.WriteFile(asn, build(4, map[string]map[string]interface{}{
+		"1.2.0.0/16": {"autonomous_system_number": uint64(64500), "autonomous_system_organization": "Example"},
+	}), 0o600)
+
+	dbs, err := OpenAll([]string{country, asn})
+	if err != nil {
+		t.Fatalf("OpenAll() returned error: %v", err)
+	}
+	for addr, expected := range map[string]Record{
+		"1.2.3.4":          {Country: "DE", ASN: 64500, Organization: "Example"},
+		"::ffff:1.2.3.4":   {Country: "DE", ASN: 64500, Organization: "Example"},
+		"1.2.4.4":          {ASN: 64500, Organization: "Example"},
+		"2001:db8::1":      {Country: "FR"},
+		"5.6.7.8":          {},
+		"2001:db9::1":      {},
+		"2001:db8:ffff::1": {Country: "FR"},
+	} {
+		if record, err := dbs.Lookup(netip.MustParseAddr(addr)); err != nil || record != expected {
+			t.Errorf("Lookup(%s) = %+v, %v, expected %+v", addr, record, err, expected)
+		}
+	}
+
+	invalid := filepath.Join(dir, "invalid.mmdb")
+	os.WriteFile(invalid, []byte("not a database"), 0o600)
+	if _, err := Open(invalid); err == nil {
+		t.Errorf("Open() accepted an invalid file")
+	}
+}
@@ -0,0 +1,246 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// metadataMarker starts the metadata at the end of a MaxMind DB file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSeparator is the size of the zeros between the search tree and the
+// data section.
+const dataSeparator = 16
+
+// Types of the data section.
+const (
+	typePointer = 1
+	typeString  = 2
+	typeDouble  = 3
+	typeBytes   = 4
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeInt32   = 8
+	typeUint64  = 9
+	typeUint128 = 10
+	typeArray   = 11
+	typeBool    = 14
+	typeFloat   = 15
+)
+
+var errInvalid = errors.New("invalid MaxMind DB")
+
+// mmdb is a database of the MaxMind DB format, see
+// https://maxmind.github.io/MaxMind-DB/.
+type mmdb struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // node of ::/96 in IPv6 trees, where IPv4 addresses are
+}
+
+func parseMMDB(file []byte) (*mmdb, error) {
+	at := bytes.LastIndex(file, metadataMarker)
+	if at < 0 {
+		return nil, fmt.Errorf("%w: no metadata", errInvalid)
+	}
+	metadata := file[at+len(metadataMarker):]
+	value, _, err := decode(metadata, 0)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", errInvalid)
+	}
+	db := &mmdb{}
+	for key, field := range map[string]*uint{"node_count": &db.nodeCount, "record_size": &db.recordSize, "ip_version": &db.ipVersion} {
+		n, ok := fields[key].(uint64)
+		if !ok {
+			return nil, fmt.Errorf("%w: no %s", errInvalid, key)
+		}
+		*field = uint(n)
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", errInvalid, db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSeparator > uint(at) {
+		return nil, fmt.Errorf("%w: truncated search tree", errInvalid)
+	}
+	db.tree = file[:treeSize]
+	db.data = file[treeSize+dataSeparator : at]
+
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (db *mmdb) record(node uint, bit byte) uint {
+	b := db.tree[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// lookup returns the data of addr, or nil if the database has none.
+func (db *mmdb) lookup(addr netip.Addr) (interface{}, error) {
+	addr = addr.Unmap()
+	node := uint(0)
+	if addr.Is4() && db.ipVersion == 6 {
+		node = db.ipv4Start
+	} else if addr.Is6() && db.ipVersion == 4 {
+		return nil, nil
+	}
+	ip := addr.AsSlice()
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, ip[i/8]>>(7-i%8)&1)
+	}
+	if node <= db.nodeCount {
+		return nil, nil // not found
+	}
+	offset := node - db.nodeCount - dataSeparator
+	if offset >= uint(len(db.data)) {
+		return nil, fmt.Errorf("%w: data offset out of range", errInvalid)
+	}
+	value, _, err := decode(db.data, offset)
+	return value, err
+}
+
+// decode decodes the value at offset of data, returning the offset after it.
+func decode(data []byte, offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(data)) {
+		return nil, 0, fmt.Errorf("%w: offset out of range", errInvalid)
+	}
+	ctrl := data[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+
+	if kind == typePointer {
+		size := uint(ctrl>>3) & 3
+		if offset+size+1 > uint(len(data)) {
+			return nil, 0, fmt.Errorf("%w: truncated pointer", errInvalid)
+		}
+		b := data[offset : offset+size+1]
+		var pointer uint
+		switch size {
+		case 0:
+			pointer = uint(ctrl&7)<<8 | uint(b[0])
+		case 1:
+			pointer = (uint(ctrl&7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			pointer = (uint(ctrl&7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			pointer = uint(binary.BigEndian.Uint32(b))
+		}
+		value, _, err := decode(data, pointer)
+		return value, offset + size + 1, err
+	}
+
+	if kind == 0 {
+		if offset >= uint(len(data)) {
+			return nil, 0, fmt.Errorf("%w: truncated type", errInvalid)
+		}
+		kind = 7 + uint(data[offset])
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(data)) {
+			return nil, 0, fmt.Errorf("%w: truncated size", errInvalid)
+		}
+		extra := uint(0)
+		for _, b := range data[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		size = [...]uint{29, 285, 65821}[n-1] + extra
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := decode(data, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			s, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", errInvalid)
+			}
+			m[s], offset, err = decode(data, next)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, size)
+		for i := range a {
+			var err error
+			if a[i], offset, err = decode(data, offset); err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, fmt.Errorf("%w: truncated value", errInvalid)
+	}
+	b := data[offset : offset+size]
+	offset += size
+	switch kind {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes, typeUint128:
+		return b, offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of %d bytes", errInvalid, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of %d bytes", errInvalid, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset, nil
+	case typeInt32:
+		n := uint32(0)
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), offset, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unsupported type %d", errInvalid, kind)
+}
@@ -2,10 +2,11 @@ package homedir
 
 import (
 	"os"
+	"strings"
 )
 
 func Expand(path string) string {
-	if path[0:2] == "~/" {
+	if strings.HasPrefix(path, "~/") {
 		return os.Getenv("HOME") + path[1:]
 	} else {
 		return path
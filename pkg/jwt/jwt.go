@@ -0,0 +1,261 @@
+// Package jwt verifies JSON Web Tokens signed with HS256 or RS256.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalid = errors.New("invalid JWT")
+	ErrExpired = errors.New("JWT expired")
+)
+
+// Leeway is the clock skew tolerated checking the times of tokens.
+const Leeway = 30 * time.Second
+
+// JWKSRefresh is how often a Verifier fetches its JWKS again at most, when
+// a token is signed with a key it does not know.
+const JWKSRefresh = time.Minute
+
+// Claims are the claims of a token.
+type Claims map[string]interface{}
+
+// String returns the claim name if it is a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns the claim name if it is a string or a list of strings.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Config are the keys and expected claims of the tokens of a Verifier.
+type Config struct {
+	// Secret verifies tokens signed with HS256, if not empty.
+	Secret []byte
+	// PublicKeys and the keys of JWKSURL verify tokens signed with RS256.
+	PublicKeys []*rsa.PublicKey
+	JWKSURL    string
+	// Issuer and Audience are checked when not empty.
+	Issuer   string
+	Audience string
+}
+
+// Verifier verifies tokens, which must have an expiry.
+type Verifier struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	jwks      map[string]*rsa.PublicKey // by key ID
+	fetchedAt time.Time
+}
+
+// New returns a Verifier of the tokens of config.
+func New(config Config) *Verifier {
+	return &Verifier{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature, times, issuer and audience of token and
+// returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalid
+	}
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return nil, ErrInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case h.Alg == "HS256" && len(v.config.Secret) > 0:
+		mac := hmac.New(sha256.New, v.config.Secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrInvalid
+		}
+	case h.Alg == "RS256":
+		digest := sha256.Sum256(signed)
+		keys, err := v.rsaKeys(ctx, h.Kid)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.ContainsFunc(keys, func(key *rsa.PublicKey) bool {
+			return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+		}) {
+			return nil, ErrInvalid
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalid, h.Alg)
+	}
+
+	var claims Claims
+	if err := decodeJSON(parts[1], &claims); err != nil {
+		return nil, ErrInvalid
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalid)
+	}
+	if now.Add(-Leeway).Unix() >= int64(exp) {
+		return nil, ErrExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(Leeway).Unix() < int64(nbf) {
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalid)
+	}
+	if v.config.Issuer != "" && claims.String("iss") != v.config.Issuer {
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalid, claims.String("iss"))
+	}
+	if v.config.Audience != "" && !slices.Contains(claims.Strings("aud"), v.config.Audience) {
+		return nil, fmt.Errorf("%w: not issued for %s", ErrInvalid, v.config.Audience)
+	}
+	return claims, nil
+}
+
+// rsaKeys returns the keys that may have signed a token with the key ID
+// kid: the public keys and the key of the JWKS with the ID, the JWKS being
+// fetched again when it is unknown, or all of its keys without an ID.
+func (v *Verifier) rsaKeys(ctx context.Context, kid string) ([]*rsa.PublicKey, error) {
+	keys := v.config.PublicKeys
+	if v.config.JWKSURL == "" {
+		return keys, nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, known := v.jwks[kid]; !known && time.Since(v.fetchedAt) >= JWKSRefresh {
+		jwks, err := v.fetchJWKS(ctx)
+		v.fetchedAt = time.Now()
+		if err != nil && v.jwks == nil {
+			return nil, err
+		} else if err == nil {
+			v.jwks = jwks
+		}
+	}
+	if key, ok := v.jwks[kid]; ok {
+		return append(slices.Clip(keys), key), nil
+	}
+	if kid == "" {
+		for _, key := range v.jwks {
+			keys = append(slices.Clip(keys), key)
+		}
+	}
+	return keys, nil
+}
+
+// fetchJWKS fetches the RSA keys of the JWKS.
+func (v *Verifier) fetchJWKS(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.config.JWKSURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("JWKS %s: %w", v.config.JWKSURL, err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("JWKS %s: %w", v.config.JWKSURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS %s: %s", v.config.JWKSURL, resp.Status)
+	}
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("JWKS %s: invalid response: %w", v.config.JWKSURL, err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(key.N)
+		e, errE := base64.RawURLEncoding.DecodeString(key.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			continue
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// ParsePublicKey parses a PEM encoded RSA public key, in a PKIX public key
+// or a certificate.
+func ParsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	var key interface{}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		var err error
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+	return rsaKey, nil
+}
+
+func decodeJSON(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
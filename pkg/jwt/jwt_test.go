@@ -0,0 +1,123 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, h header, claims map[string]interface{}, secret []byte, key *rsa.PrivateKey) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(h) + "." + encode(claims)
+	var signature []byte
+	if key != nil {
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret")
+	now := time.Now()
+	exp := float64(now.Add(time.Hour).Unix())
+	v := New(Config{Secret: secret, PublicKeys: []*rsa.PublicKey{&key.PublicKey}, Issuer: "issuer", Audience: "gotty"})
+
+	tests := []struct {
+		name   string
+		token  string
+		expect error
+	}{
+		{"HS256", sign(t, header{Alg: "HS256"}, map[string]interface{}{"sub": "user", "iss": "issuer", "aud": "gotty", "exp": exp}, secret, nil), nil},
+		{"RS256", sign(t, header{Alg: "RS256"}, map[string]interface{}{"sub": "user", "iss": "issuer", "aud": []string{"other", "gotty"}, "exp": exp}, nil, key), nil},
+		{"wrong secret", sign(t, header{Alg: "HS256"}, map[string]interface{}{"iss": "issuer", "aud": "gotty", "exp": exp}, []byte("other"), nil), ErrInvalid},
+		{"wrong key", sign(t, header{Alg: "RS256"}, map[string]interface{}{"iss": "issuer", "aud": "gotty", "exp": exp}, nil, otherKey), ErrInvalid},
+		{"none", sign(t, header{Alg: "none"}, map[string]interface{}{"iss": "issuer", "aud": "gotty", "exp": exp}, secret, nil), ErrInvalid},
+		{"expired", sign(t, header{Alg: "HS256"}, map[string]interface{}{"iss": "issuer", "aud": "gotty", "exp": float64(now.Add(-time.Hour).Unix())}, secret, nil), ErrExpired},
+		{"no expiry", sign(t, header{Alg: "HS256"}, map[string]interface{}{"iss": "issuer", "aud": "gotty"}, secret, nil), ErrInvalid},
+		{"not valid yet", sign(t, header{Alg: "HS256"}, map[string]interface{}{"iss": "issuer", "aud": "gotty", "exp": exp, "nbf": float64(now.Add(time.Minute).Unix())}, secret, nil), ErrInvalid},
+		{"wrong issuer", sign(t, header{Alg: "HS256"}, map[string]interface{}{"iss": "other", "aud": "gotty", "exp": exp}, secret, nil), ErrInvalid},
+		{"wrong audience", sign(t, header{Alg: "HS256"}, map[string]interface{}{"iss": "issuer", "aud": "other", "exp": exp}, secret, nil), ErrInvalid},
+		{"malformed", "token", ErrInvalid},
+	}
+	for _, test := range tests {
+		claims, err := v.Verify(context.Background(), test.token, now)
+		if !errors.Is(err, test.expect) || (test.expect == nil && err != nil) {
+			t.Errorf("%s: Verify() error = %v, expected %v", test.name, err, test.expect)
+		}
+		if err == nil && claims.String("sub") != "user" {
+			t.Errorf("%s: sub = %q, expected %q", test.name, claims.String("sub"), "user")
+		}
+	}
+}
+
+func TestVerifyJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetches := 0
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+	v := New(Config{JWKSURL: jwks.URL})
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	for i := 0; i < 2; i++ {
+		token := sign(t, header{Alg: "RS256", Kid: "key"}, map[string]interface{}{"sub": "user", "exp": exp}, nil, key)
+		if _, err := v.Verify(context.Background(), token, time.Now()); err != nil {
+			t.Errorf("Verify() returned error: %v", err)
+		}
+	}
+	token := sign(t, header{Alg: "RS256", Kid: "unknown"}, map[string]interface{}{"sub": "user", "exp": exp}, nil, key)
+	if _, err := v.Verify(context.Background(), token, time.Now()); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() of an unknown key: error = %v, expected %v", err, ErrInvalid)
+	}
+	token = sign(t, header{Alg: "HS256", Kid: "key"}, map[string]interface{}{"sub": "user", "exp": exp}, []byte(""), nil)
+	if _, err := v.Verify(context.Background(), token, time.Now()); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() of HS256 without a secret: error = %v, expected %v", err, ErrInvalid)
+	}
+	if fetches != 1 {
+		t.Errorf("JWKS fetched %d times, expected 1", fetches)
+	}
+}
@@ -0,0 +1,46 @@
+// Package metrics provides the metrics interface of GoTTY
+// with a no-op and a Prometheus implementation.
+package metrics
+
+import "slices"
+
+// Metrics records counters, gauges and histograms.
+// labels are pairs of label names and values, e.g. "kind", "auth".
+type Metrics interface {
+	// Add adds delta to a counter.
+	Add(name string, delta float64, labels ...string)
+	// Set sets a gauge to value.
+	Set(name string, value float64, labels ...string)
+	// Observe records value in a histogram.
+	Observe(name string, value float64, labels ...string)
+}
+
+// Nop discards all metrics.
+type Nop struct{}
+
+func (Nop) Add(name string, delta float64, labels ...string)     {}
+func (Nop) Set(name string, value float64, labels ...string)     {}
+func (Nop) Observe(name string, value float64, labels ...string) {}
+
+// WithLabels returns m adding labels to every metric, e.g. the tenant of a
+// server sharing the metrics of others.
+func WithLabels(m Metrics, labels ...string) Metrics {
+	return labeled{metrics: m, labels: labels}
+}
+
+type labeled struct {
+	metrics Metrics
+	labels  []string
+}
+
+func (l labeled) Add(name string, delta float64, labels ...string) {
+	l.metrics.Add(name, delta, slices.Concat(labels, l.labels)...)
+}
+
+func (l labeled) Set(name string, value float64, labels ...string) {
+	l.metrics.Set(name, value, slices.Concat(labels, l.labels)...)
+}
+
+func (l labeled) Observe(name string, value float64, labels ...string) {
+	l.metrics.Observe(name, value, slices.Concat(labels, l.labels)...)
+}
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets,
+// which cover durations in seconds from requests to long sessions.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600, 14400, 86400}
+
+type kind int
+
+const (
+	counterKind kind = iota
+	gaugeKind
+	histogramKind
+)
+
+func (k kind) String() string {
+	return [...]string{"counter", "gauge", "histogram"}[k]
+}
+
+type family struct {
+	kind   kind
+	series map[string]*series // by formatted labels
+}
+
+type series struct {
+	value   float64  // counters and gauges, sum of histograms
+	buckets []uint64 // cumulative counts per bucket, histograms only
+	count   uint64
+}
+
+// OtherValue is the value of a label limited by LimitLabel beyond its limit.
+const OtherValue = "other"
+
+// Prometheus keeps metrics in memory and serves them in the Prometheus text format.
+type Prometheus struct {
+	mu       sync.Mutex
+	buckets  []float64
+	families map[string]*family
+	limits   map[string]int                 // of the values of labels
+	values   map[string]map[string]struct{} // of the limited labels, as seen
+}
+
+// NewPrometheus creates an empty Prometheus with DefaultBuckets.
+func NewPrometheus() *Prometheus {
+	return &Prometheus{
+		buckets:  DefaultBuckets,
+		families: map[string]*family{},
+		limits:   map[string]int{},
+		values:   map[string]map[string]struct{}{},
+	}
+}
+
+// LimitLabel keeps at most max values of label across metrics, the first
+// ones seen, and exposes the others as OtherValue, so that labels of
+// unbounded values, e.g. the paths of containers coming and going, do not
+// grow the series without bounds.
+func (p *Prometheus) LimitLabel(label string, max int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limits[label] = max
+	if p.values[label] == nil {
+		p.values[label] = map[string]struct{}{}
+	}
+}
+
+func (p *Prometheus) Add(name string, delta float64, labels ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series(name, counterKind, labels).value += delta
+}
+
+func (p *Prometheus) Set(name string, value float64, labels ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series(name, gaugeKind, labels).value = value
+}
+
+func (p *Prometheus) Observe(name string, value float64, labels ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.series(name, histogramKind, labels)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(p.buckets))
+	}
+	for i, bound := range p.buckets {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+// series returns the series of name with labels, creating it when needed.
+// A name keeps the kind it was first used with.
+func (p *Prometheus) series(name string, k kind, labels []string) *series {
+	f, ok := p.families[name]
+	if !ok {
+		f = &family{kind: k, series: map[string]*series{}}
+		p.families[name] = f
+	}
+	key := formatLabels(p.limitLabels(labels))
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{}
+		f.series[key] = s
+	}
+	return s
+}
+
+// limitLabels returns labels with the values beyond the limits of
+// LimitLabel replaced by OtherValue.
+func (p *Prometheus) limitLabels(labels []string) []string {
+	limited, copied := labels, false
+	for i := 0; i+1 < len(labels); i += 2 {
+		values, ok := p.values[labels[i]]
+		if !ok {
+			continue
+		}
+		if _, ok := values[labels[i+1]]; ok {
+			continue
+		}
+		if len(values) < p.limits[labels[i]] {
+			values[labels[i+1]] = struct{}{}
+			continue
+		}
+		if !copied {
+			limited, copied = slices.Clone(labels), true
+		}
+		limited[i+1] = OtherValue
+	}
+	return limited
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(p.expose())
+}
+
+func (p *Prometheus) expose() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf := new(bytes.Buffer)
+	for _, name := range sortedKeys(p.families) {
+		f := p.families[name]
+		fmt.Fprintf(buf, "# TYPE %s %s\n", name, f.kind)
+		for _, labels := range sortedKeys(f.series) {
+			s := f.series[labels]
+			if f.kind != histogramKind {
+				fmt.Fprintf(buf, "%s%s %s\n", name, braced(labels), formatValue(s.value))
+				continue
+			}
+			for i, bound := range p.buckets {
+				fmt.Fprintf(buf, "%s_bucket%s %d\n", name, braced(joinLabels(labels, `le="`+formatValue(bound)+`"`)), s.buckets[i])
+			}
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", name, braced(joinLabels(labels, `le="+Inf"`)), s.count)
+			fmt.Fprintf(buf, "%s_sum%s %s\n", name, braced(labels), formatValue(s.value))
+			fmt.Fprintf(buf, "%s_count%s %d\n", name, braced(labels), s.count)
+		}
+	}
+	return buf.Bytes()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats label pairs sorted by name, without braces.
+func formatLabels(labels []string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func braced(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
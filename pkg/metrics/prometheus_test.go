@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrometheusExpose(t *testing.T) {
+	p := NewPrometheus()
+	p.buckets = []float64{1, 10}
+
+	p.Add("gotty_errors_total", 1, "kind", "auth")
+	p.Add("gotty_errors_total", 2, "kind", "auth")
+	p.Add("gotty_errors_total", 1, "kind", `say "hi"`)
+	p.Set("gotty_connections_active", 3)
+	p.Observe("gotty_session_duration_seconds", 0.5)
+	p.Observe("gotty_session_duration_seconds", 5)
+
+	expected := strings.Join([]string{
+		`# TYPE gotty_connections_active gauge`,
+		`gotty_connections_active 3`,
+		`# TYPE gotty_errors_total counter`,
+		`gotty_errors_total{kind="auth"} 3`,
+		`gotty_errors_total{kind="say \"hi\""} 1`,
+		`# TYPE gotty_session_duration_seconds histogram`,
+		`gotty_session_duration_seconds_bucket{le="1"} 1`,
+		`gotty_session_duration_seconds_bucket{le="10"} 2`,
+		`gotty_session_duration_seconds_bucket{le="+Inf"} 2`,
+		`gotty_session_duration_seconds_sum 5.5`,
+		`gotty_session_duration_seconds_count 2`,
+	}, "\n") + "\n"
+	if actual := string(p.expose()); actual != expected {
+		t.Errorf("exposition =\n%s\nexpected\n%s", actual, expected)
+	}
+}
+
+func TestPrometheusLimitLabel(t *testing.T) {
+	p := NewPrometheus()
+	p.LimitLabel("path", 2)
+	tenant := WithLabels(p, "tenant", "acme")
+
+	for _, path := range []string{"/a/", "/b/", "/c/", "/a/"} {
+		p.Add("gotty_sessions_total", 1, "path", path)
+	}
+	tenant.Add("gotty_sessions_total", 1, "path", "/d/")
+
+	expected := strings.Join([]string{
+		`# TYPE gotty_sessions_total counter`,
+		`gotty_sessions_total{path="/a/"} 2`,
+		`gotty_sessions_total{path="/b/"} 1`,
+		`gotty_sessions_total{path="other"} 1`,
+		`gotty_sessions_total{path="other",tenant="acme"} 1`,
+	}, "\n") + "\n"
+	if actual := string(p.expose()); actual != expected {
+		t.Errorf("exposition =\n%s\nexpected\n%s", actual, expected)
+	}
+}
@@ -0,0 +1,321 @@
+// Package oidc authenticates users with the authorization code flow, or the
+// device authorization grant for clients without a browser, of an OpenID
+// Connect provider.
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for ID tokens not issued to the client or
+	// expired.
+	ErrInvalidToken = errors.New("invalid ID token")
+	// ErrAccessDenied is returned by PollDevice once the user denied the
+	// authorization, or did not grant it in time.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrAuthorizationPending is returned by PollDevice until the user has
+	// signed in, and ErrSlowDown when polling too often. Their messages are
+	// the error codes of RFC 8628.
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	ErrSlowDown             = errors.New("slow_down")
+)
+
+// Claims are the claims of an ID token.
+type Claims map[string]interface{}
+
+// String returns the claim name if it is a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns the claim name if it is a string or a list of strings.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Expiry returns when the ID token of claims expires.
+func (c Claims) Expiry() time.Time {
+	exp, _ := c["exp"].(float64)
+	return time.Unix(int64(exp), 0)
+}
+
+// discovery is the part of the configuration of a provider the code flow
+// and the device authorization grant use.
+type discovery struct {
+	Issuer                      string `json:"issuer"`
+	AuthorizationEndpoint       string `json:"authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint,omitempty"`
+}
+
+// DeviceAuthorization is the response of the provider to a device
+// authorization request: users sign in at VerificationURI with UserCode
+// while the client polls for the ID token with DeviceCode.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`         // seconds
+	Interval                int    `json:"interval,omitempty"` // seconds between polls, 5 when missing
+}
+
+// responseError is an error response of the provider.
+type responseError struct {
+	provider *Provider
+	status   string
+	code     string // the error of the JSON response, if any
+}
+
+func (e *responseError) Error() string {
+	if e.code == "" {
+		return fmt.Sprintf("%s: %s", e.provider, e.status)
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.provider, e.status, e.code)
+}
+
+// Provider is an OpenID Connect provider a client is registered at. Its
+// configuration is discovered on first use.
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu     sync.Mutex
+	config *discovery
+}
+
+// New returns the provider of issuer, e.g. https://accounts.example.com,
+// for the client clientID authenticating with clientSecret.
+func New(issuer string, clientID string, clientSecret string) *Provider {
+	return &Provider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *Provider) String() string {
+	return "OpenID Connect provider " + p.issuer
+}
+
+// discover fetches the configuration of the provider, once it succeeds.
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.config != nil {
+		return p.config, nil
+	}
+	var config discovery
+	if err := p.do(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil, &config); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(config.Issuer, "/") != p.issuer || config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" {
+		return nil, fmt.Errorf("%s: invalid configuration", p)
+	}
+	p.config = &config
+	return p.config, nil
+}
+
+// AuthURL returns the URL to send users to for authenticating, which sends
+// them back to redirectURL with a code for Exchange and state. nonce is
+// checked by Exchange.
+func (p *Provider) AuthURL(ctx context.Context, redirectURL string, state string, nonce string) (string, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(config.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%s: invalid authorization endpoint: %w", p, err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("scope", "openid profile email")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems code at the token endpoint and returns the claims of the
+// ID token, which must be issued to the client with nonce and not expired.
+// As the token comes straight from the provider over TLS, its signature is
+// not checked.
+func (p *Provider) Exchange(ctx context.Context, redirectURL string, code string, nonce string) (Claims, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {redirectURL},
+	}
+	var response struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(ctx, http.MethodPost, config.TokenEndpoint, form, &response); err != nil {
+		return nil, err
+	}
+	claims, err := p.verify(response.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.String("nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// AuthorizeDevice starts the device authorization grant of RFC 8628 for a
+// client without a browser, whose user signs in elsewhere.
+func (p *Provider) AuthorizeDevice(ctx context.Context) (*DeviceAuthorization, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if config.DeviceAuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("%s: the device authorization grant is not supported", p)
+	}
+	form := url.Values{
+		"client_id": {p.clientID},
+		"scope":     {"openid profile email"},
+	}
+	var authorization DeviceAuthorization
+	if err := p.do(ctx, http.MethodPost, config.DeviceAuthorizationEndpoint, form, &authorization); err != nil {
+		return nil, err
+	}
+	if authorization.DeviceCode == "" || authorization.UserCode == "" || authorization.VerificationURI == "" {
+		return nil, fmt.Errorf("%s: invalid device authorization", p)
+	}
+	return &authorization, nil
+}
+
+// PollDevice asks the token endpoint once for the ID token of deviceCode,
+// returning its claims once the user has signed in, which are checked as
+// by Exchange but for the nonce. It returns ErrAuthorizationPending until
+// then.
+func (p *Provider) PollDevice(ctx context.Context, deviceCode string) (Claims, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {deviceCode},
+		"client_id":   {p.clientID},
+	}
+	var response struct {
+		IDToken string `json:"id_token"`
+	}
+	err = p.do(ctx, http.MethodPost, config.TokenEndpoint, form, &response)
+	var respErr *responseError
+	if errors.As(err, &respErr) {
+		switch respErr.code {
+		case "authorization_pending":
+			return nil, ErrAuthorizationPending
+		case "slow_down":
+			return nil, ErrSlowDown
+		case "access_denied", "expired_token":
+			return nil, fmt.Errorf("%w: %s", ErrAccessDenied, respErr.code)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.verify(response.IDToken)
+}
+
+// verify returns the claims of the ID token, which must be issued to the
+// client and not expired.
+func (p *Provider) verify(token string) (Claims, error) {
+	claims, err := parseIDToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(claims.String("iss"), "/") != p.issuer {
+		return nil, fmt.Errorf("%w: issued by %s", ErrInvalidToken, claims.String("iss"))
+	}
+	if !slices.Contains(claims.Strings("aud"), p.clientID) {
+		return nil, fmt.Errorf("%w: not issued to the client", ErrInvalidToken)
+	}
+	if exp, ok := claims["exp"].(float64); !ok || time.Now().Unix() >= int64(exp) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func parseIDToken(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// do sends a request with form as its body, authenticating the client,
+// decoding the JSON response into result.
+func (p *Provider) do(ctx context.Context, method string, endpoint string, form url.Values, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var response struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&response)
+		return &responseError{provider: p, status: resp.Status, code: response.Error}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", p, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExchange(t *testing.T) {
+	var claims map[string]interface{}
+	var provider *httptest.Server
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(discovery{Issuer: provider.URL, AuthorizationEndpoint: provider.URL + "/authorize", TokenEndpoint: provider.URL + "/token"})
+		case "/token":
+			payload, _ := json.Marshal(claims)
+			json.NewEncoder(w).Encode(map[string]string{"id_token": "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"})
+		}
+	}))
+	defer provider.Close()
+	p := New(provider.URL+"/", "client", "secret")
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	tests := []struct {
+		claims map[string]interface{}
+		valid  bool
+	}{
+		{map[string]interface{}{"iss": provider.URL, "aud": "client", "exp": exp, "nonce": "n"}, true},
+		{map[string]interface{}{"iss": provider.URL, "aud": []string{"other", "client"}, "exp": exp, "nonce": "n"}, true},
+		{map[string]interface{}{"iss": "https://other", "aud": "client", "exp": exp, "nonce": "n"}, false},
+		{map[string]interface{}{"iss": provider.URL, "aud": "other", "exp": exp, "nonce": "n"}, false},
+		{map[string]interface{}{"iss": provider.URL, "aud": "client", "exp": float64(time.Now().Unix() - 1), "nonce": "n"}, false},
+		{map[string]interface{}{"iss": provider.URL, "aud": "client", "exp": exp, "nonce": "replayed"}, false},
+	}
+	for _, test := range tests {
+		claims = test.claims
+		_, err := p.Exchange(context.Background(), "http://gotty/oidc/callback", "code", "n")
+		if test.valid && err != nil {
+			t.Errorf("Exchange() of %v returned error: %v", test.claims, err)
+		} else if !test.valid && !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Exchange() of %v: error = %v, expected %v", test.claims, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestDevice(t *testing.T) {
+	var polls int
+	var provider *httptest.Server
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(discovery{Issuer: provider.URL, AuthorizationEndpoint: provider.URL + "/authorize", TokenEndpoint: provider.URL + "/token", DeviceAuthorizationEndpoint: provider.URL + "/device"})
+		case "/device":
+			json.NewEncoder(w).Encode(DeviceAuthorization{DeviceCode: "device", UserCode: "ABCD-EFGH", VerificationURI: provider.URL + "/activate", ExpiresIn: 600})
+		case "/token":
+			if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:device_code" || r.FormValue("device_code") != "device" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			polls++
+			codes := []string{"authorization_pending", "slow_down"}
+			if polls <= len(codes) {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": codes[polls-1]})
+				return
+			}
+			payload, _ := json.Marshal(map[string]interface{}{"iss": provider.URL, "aud": "client", "exp": time.Now().Add(time.Hour).Unix(), "sub": "alice"})
+			json.NewEncoder(w).Encode(map[string]string{"id_token": "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"})
+		}
+	}))
+	defer provider.Close()
+	p := New(provider.URL, "client", "secret")
+
+	authorization, err := p.AuthorizeDevice(context.Background())
+	if err != nil {
+		t.Fatalf("AuthorizeDevice() returned error: %v", err)
+	}
+	if authorization.UserCode != "ABCD-EFGH" {
+		t.Errorf("user code = %s, expected ABCD-EFGH", authorization.UserCode)
+	}
+	for _, expected := range []error{ErrAuthorizationPending, ErrSlowDown} {
+		if _, err := p.PollDevice(context.Background(), authorization.DeviceCode); !errors.Is(err, expected) {
+			t.Errorf("PollDevice() error = %v, expected %v", err, expected)
+		}
+	}
+	claims, err := p.PollDevice(context.Background(), authorization.DeviceCode)
+	if err != nil || claims.String("sub") != "alice" {
+		t.Errorf("PollDevice() = %v, %v, expected the claims of alice", claims, err)
+	}
+	if _, err := p.PollDevice(context.Background(), "other"); err == nil || errors.Is(err, ErrAuthorizationPending) {
+		t.Errorf("PollDevice() of another device code returned %v", err)
+	}
+}
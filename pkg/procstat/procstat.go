@@ -0,0 +1,21 @@
+// Package procstat samples the CPU time and memory of a process together
+// with its descendants.
+package procstat
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned by Sample on platforms without an
+// implementation.
+var ErrUnsupported = errors.New("process statistics are not supported on this platform")
+
+// Usage is the resource usage of a process and its descendants.
+type Usage struct {
+	// CPU is the user and system time used so far, including the one of
+	// the descendants that exited and were waited for.
+	CPU time.Duration
+	// Memory is the resident set size in bytes.
+	Memory int64
+}
@@ -0,0 +1,82 @@
+package procstat
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of the times in /proc, fixed by the ABI.
+const clockTicks = 100
+
+type stat struct {
+	ppid   int
+	ticks  int64 // utime, stime, cutime and cstime
+	memory int64
+}
+
+// Sample returns the usage of the process pid and its descendants, read
+// from /proc.
+func Sample(pid int) (Usage, error) {
+	root, err := readStat(pid)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return Usage{}, err
+	}
+	children := map[int][]stat{}
+	pids := map[int][]int{}
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil || child == pid {
+			continue
+		}
+		s, err := readStat(child)
+		if err != nil { // exited meanwhile
+			continue
+		}
+		children[s.ppid] = append(children[s.ppid], s)
+		pids[s.ppid] = append(pids[s.ppid], child)
+	}
+
+	ticks, memory := root.ticks, root.memory
+	for queue := []int{pid}; len(queue) > 0; queue = queue[1:] {
+		for i, s := range children[queue[0]] {
+			ticks += s.ticks
+			memory += s.memory
+			queue = append(queue, pids[queue[0]][i])
+		}
+	}
+	return Usage{CPU: time.Duration(ticks) * time.Second / clockTicks, Memory: memory}, nil
+}
+
+func readStat(pid int) (stat, error) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return stat{}, err
+	}
+	// the command name in parentheses may contain anything
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return stat{}, fmt.Errorf("malformed stat of process %d", pid)
+	}
+	// from the state, the third field
+	fields := bytes.Fields(data[end+1:])
+	if len(fields) < 22 {
+		return stat{}, fmt.Errorf("malformed stat of process %d", pid)
+	}
+	field := func(n int) int64 {
+		value, _ := strconv.ParseInt(string(fields[n-3]), 10, 64)
+		return value
+	}
+	return stat{
+		ppid:   int(field(4)),
+		ticks:  field(14) + field(15) + field(16) + field(17),
+		memory: field(24) * int64(os.Getpagesize()),
+	}, nil
+}
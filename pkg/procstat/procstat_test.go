@@ -0,0 +1,38 @@
+package procstat
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("not supported on", runtime.GOOS)
+	}
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	child, err := Sample(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("Sample() of a child returned error: %v", err)
+	}
+
+	usage, err := Sample(os.Getpid())
+	if err != nil {
+		t.Fatalf("Sample() returned error: %v", err)
+	}
+	if usage.Memory <= 0 || usage.Memory < child.Memory {
+		t.Errorf("memory = %d with a child of %d", usage.Memory, child.Memory)
+	}
+	if usage.CPU < child.CPU {
+		t.Errorf("CPU = %s with a child of %s", usage.CPU, child.CPU)
+	}
+
+	if _, err := Sample(-1); err == nil {
+		t.Error("Sample() of a missing process returned no error")
+	}
+}
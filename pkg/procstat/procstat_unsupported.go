@@ -0,0 +1,8 @@
+//go:build !linux
+
+package procstat
+
+// Sample returns ErrUnsupported.
+func Sample(pid int) (Usage, error) {
+	return Usage{}, ErrUnsupported
+}
@@ -0,0 +1,132 @@
+// Package publish makes local servers reachable from the Internet through
+// the quick tunnels of Cloudflare or ngrok, by running their commands.
+package publish
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Timeout is how long Start waits for the public URL.
+const Timeout = 30 * time.Second
+
+// Provider runs a tunnel command and finds the public URL in its output.
+type Provider struct {
+	// Command is the executable, which must be in PATH.
+	Command string
+	// Args returns the arguments to publish localURL.
+	Args func(localURL string) []string
+	// URL matches the public URL in the output, as the first submatch if any.
+	URL *regexp.Regexp
+}
+
+// Providers are the available providers by name.
+var Providers = map[string]*Provider{
+	"cloudflare": {
+		Command: "cloudflared",
+		Args: func(localURL string) []string {
+			args := []string{"tunnel", "--no-autoupdate", "--url", localURL}
+			if strings.HasPrefix(localURL, "https:") {
+				args = append(args, "--no-tls-verify") // self-signed certificates
+			}
+			return args
+		},
+		URL: regexp.MustCompile(`https://[-a-z0-9]+\.trycloudflare\.com`),
+	},
+	"ngrok": {
+		Command: "ngrok",
+		Args: func(localURL string) []string {
+			return []string{"http", localURL, "--log", "stdout", "--log-format", "logfmt"}
+		},
+		URL: regexp.MustCompile(`url=(https://[^\s"]+)`),
+	},
+}
+
+// Names returns the names of the providers, sorted.
+func Names() []string {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tunnel is a running tunnel.
+type Tunnel struct {
+	// URL is the public URL of the local server.
+	URL string
+
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// Start publishes localURL through the provider name, until ctx is
+// canceled or the tunnel is closed.
+func Start(ctx context.Context, name string, localURL string) (*Tunnel, error) {
+	provider, ok := Providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tunnel provider `%s`, expected one of %s", name, strings.Join(Names(), ", "))
+	}
+
+	cmd := exec.CommandContext(ctx, provider.Command, provider.Args(localURL)...)
+	output, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	cmd.WaitDelay = time.Second // for children keeping the output open
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", provider.Command, err)
+	}
+
+	t := &Tunnel{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		writer.Close()
+		close(t.done)
+	}()
+
+	urls := make(chan string, 1)
+	go func() {
+		found := false
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			match := provider.URL.FindStringSubmatch(scanner.Text())
+			if match != nil && !found {
+				urls <- match[len(match)-1]
+				found = true
+			}
+		}
+		io.Copy(io.Discard, output) // keep the command running
+	}()
+
+	select {
+	case t.URL = <-urls:
+		return t, nil
+	case <-t.done:
+		return nil, fmt.Errorf("%s exited before publishing: %v", provider.Command, cmd.ProcessState)
+	case <-time.After(Timeout):
+		t.Close()
+		return nil, fmt.Errorf("%s did not publish within %s", provider.Command, Timeout)
+	}
+}
+
+// Close stops the tunnel.
+func (t *Tunnel) Close() error {
+	select {
+	case <-t.done:
+		return nil
+	default:
+	}
+	if err := t.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	<-t.done
+	return nil
+}
@@ -0,0 +1,33 @@
+package publish
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	Providers["test"] = &Provider{
+		Command: "/bin/sh",
+		Args: func(localURL string) []string {
+			return []string{"-c", "echo starting; echo url=https://example.test/" + localURL + "; exec sleep 10"}
+		},
+		URL: regexp.MustCompile(`url=(https://\S+)`),
+	}
+	defer delete(Providers, "test")
+
+	tunnel, err := Start(context.Background(), "test", "x")
+	if err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	if tunnel.URL != "https://example.test/x" {
+		t.Errorf("URL = %q, expected %q", tunnel.URL, "https://example.test/x")
+	}
+	if err := tunnel.Close(); err != nil {
+		t.Errorf("Close() returned error: %v", err)
+	}
+
+	if _, err := Start(context.Background(), "unknown", "x"); err == nil {
+		t.Errorf("Start() accepted an unknown provider")
+	}
+}
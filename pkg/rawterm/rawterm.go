@@ -0,0 +1,53 @@
+// Package rawterm switches a terminal into raw mode and back.
+package rawterm
+
+import (
+	"os"
+)
+
+// State is the terminal state before MakeRaw, to be passed to Restore.
+type State struct {
+	termios termios
+}
+
+// IsTerminal reports whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	_, err := getTermios(f)
+	return err == nil
+}
+
+// MakeRaw puts the terminal f into raw mode and returns its previous state.
+func MakeRaw(f *os.File) (*State, error) {
+	old, err := getTermios(f)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := makeRaw(old)
+	if err := setTermios(f, &raw); err != nil {
+		return nil, err
+	}
+	return &State{termios: old}, nil
+}
+
+// Restore puts the terminal f back into the given state.
+func Restore(f *os.File, state *State) error {
+	return setTermios(f, &state.termios)
+}
+
+// MakeSerial puts the serial line f into raw 8N1 mode at the given baud rate,
+// ignoring modem control lines.
+func MakeSerial(f *os.File, baud int) error {
+	t, err := getTermios(f)
+	if err != nil {
+		return err
+	}
+
+	t = makeRaw(t)
+	if err := setSpeed(&t, baud); err != nil {
+		return err
+	}
+	t.Cflag &^= cstopb
+	t.Cflag |= clocal | cread
+	return setTermios(f, &t)
+}
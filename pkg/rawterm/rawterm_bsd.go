@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package rawterm
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
+
+func setSpeed(t *termios, baud int) error {
+	if baud <= 0 {
+		return fmt.Errorf("unsupported baud rate %d", baud)
+	}
+	// the speed fields hold the rate itself, in a type that varies between systems
+	setSpeedField(&t.Ispeed, baud)
+	setSpeedField(&t.Ospeed, baud)
+	return nil
+}
+
+func setSpeedField[T ~int32 | ~uint32 | ~uint64](field *T, baud int) {
+	*field = T(baud)
+}
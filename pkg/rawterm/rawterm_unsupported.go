@@ -0,0 +1,36 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package rawterm
+
+import (
+	"errors"
+	"os"
+)
+
+var errUnsupported = errors.New("raw terminal mode is not supported on this platform")
+
+type termios struct {
+	Cflag uint32
+}
+
+func getTermios(f *os.File) (termios, error) {
+	return termios{}, errUnsupported
+}
+
+func setTermios(f *os.File, t *termios) error {
+	return errUnsupported
+}
+
+func makeRaw(t termios) termios {
+	return t
+}
+
+const (
+	cstopb = 0
+	clocal = 0
+	cread  = 0
+)
+
+func setSpeed(t *termios, baud int) error {
+	return errUnsupported
+}
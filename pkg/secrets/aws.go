@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWS is a secret of AWS Secrets Manager, stored as a JSON object.
+type AWS struct {
+	// Endpoint is the URL of the API, the regional endpoint by default.
+	Endpoint string
+
+	id        string
+	region    string
+	keyID     string
+	secretKey string
+	token     string // of temporary credentials
+	client    *http.Client
+}
+
+// NewAWS returns the secret with the name or ARN id, read with the
+// credentials of the environment: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and AWS_SESSION_TOKEN. The region is the one of the ARN, or AWS_REGION.
+func NewAWS(id string) (*AWS, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	// arn:aws:secretsmanager:<region>:<account>:secret:<name>
+	if arn := strings.Split(id, ":"); len(arn) > 3 && arn[0] == "arn" {
+		region = arn[3]
+	}
+	if region == "" {
+		return nil, errors.New("aws secret: no region, set AWS_REGION or give an ARN")
+	}
+	a := &AWS{
+		Endpoint:  "https://secretsmanager." + region + ".amazonaws.com/",
+		id:        id,
+		region:    region,
+		keyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	if a.keyID == "" || a.secretKey == "" {
+		return nil, errors.New("aws secret: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+	}
+	return a, nil
+}
+
+func (a *AWS) String() string {
+	return "aws secret " + a.id
+}
+
+func (a *AWS) Fetch(ctx context.Context) (map[string]string, error) {
+	body, _ := json.Marshal(map[string]string{"SecretId": a.id})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", a, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, body, "secretsmanager", time.Now().UTC())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", a, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %s: %s", a, resp.Status, bytes.TrimSpace(message))
+	}
+	var value struct {
+		SecretString string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&value); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %w", a, err)
+	}
+	return parseObject(a.String(), value.SecretString)
+}
+
+// sign signs req, with its host and headers, for service with Signature
+// Version 4.
+func (a *AWS) sign(req *http.Request, body []byte, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + a.region + "/" + service + "/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.token != "" {
+		req.Header.Set("X-Amz-Security-Token", a.token)
+	}
+
+	values := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		values[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	headers := make([]string, 0, len(values))
+	for name := range values {
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+	canonicalHeaders := ""
+	for _, name := range headers {
+		canonicalHeaders += name + ":" + values[name] + "\n"
+	}
+	signedHeaders := strings.Join(headers, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders, signedHeaders, hexSHA256(body),
+	}, "\n")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + a.secretKey)
+	for _, part := range []string{now.Format("20060102"), a.region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", a.keyID, scope, signedHeaders, signature))
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
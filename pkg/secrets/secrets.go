@@ -0,0 +1,37 @@
+// Package secrets loads secrets of key-value pairs from HashiCorp Vault and
+// AWS Secrets Manager, so that they need not be given on the command line.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Source is a secret of key-value pairs in a secrets manager.
+type Source interface {
+	// Fetch returns the current values of the secret.
+	Fetch(ctx context.Context) (map[string]string, error)
+	// String names the secret in logs and errors, without credentials.
+	String() string
+}
+
+// stringValues returns the string values of data, a JSON object.
+func stringValues(data map[string]interface{}) map[string]string {
+	values := make(map[string]string, len(data))
+	for key, value := range data {
+		if s, ok := value.(string); ok {
+			values[key] = s
+		}
+	}
+	return values
+}
+
+// parseObject parses a secret stored as a JSON object.
+func parseObject(name string, secret string) (map[string]string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &data); err != nil {
+		return nil, fmt.Errorf("%s: expected a JSON object of key-value pairs: %w", name, err)
+	}
+	return stringValues(data), nil
+}
@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVault(t *testing.T) {
+	data := map[string]interface{}{"credential": "user:pass", "token_secret": "secret", "version": 2.0}
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodPost {
+			var body struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			data = body.Data
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+	}))
+	defer vault.Close()
+
+	ctx := context.Background()
+	v := NewVault(vault.URL+"/v1/secret/data/gotty", "token")
+	values, err := v.Fetch(ctx)
+	if err != nil || len(values) != 2 || values["token_secret"] != "secret" {
+		t.Errorf("Fetch() = %v, %v, expected the string values", values, err)
+	}
+	if err := v.Update(ctx, map[string]string{"credential": "user:new"}); err != nil {
+		t.Fatalf("Update() returned error: %v", err)
+	}
+	if data["credential"] != "user:new" || data["token_secret"] != "secret" {
+		t.Errorf("secret = %v, expected the new credential along the other values", data)
+	}
+
+	if _, err := NewVault(vault.URL, "wrong").Fetch(ctx); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Fetch() = %v with a wrong token, expected 403", err)
+	}
+}
+
+func TestAWS(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || body.SecretId != "gotty" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"credential":"user:pass"}`})
+	}))
+	defer aws.Close()
+
+	a, err := NewAWS("gotty")
+	if err != nil {
+		t.Fatalf("NewAWS() returned error: %v", err)
+	}
+	a.Endpoint = aws.URL
+	if values, err := a.Fetch(context.Background()); err != nil || values["credential"] != "user:pass" {
+		t.Errorf("Fetch() = %v, %v, expected the credential", values, err)
+	}
+
+	if a, err := NewAWS("arn:aws:secretsmanager:eu-west-3:123456789012:secret:gotty"); err != nil || a.region != "eu-west-3" {
+		t.Errorf("NewAWS() did not take the region of the ARN: %v", err)
+	}
+}
+
+// TestSign checks the get-vanilla case of the AWS Signature Version 4 test suite.
+func TestSign(t *testing.T) {
+	a := &AWS{region: "us-east-1", keyID: "AKIDEXAMPLE", secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	a.sign(req, nil, "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if authorization := req.Header.Get("Authorization"); authorization != expected {
+		t.Errorf("Authorization = %s, expected %s", authorization, expected)
+	}
+}
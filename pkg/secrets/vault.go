@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Vault is a secret of the KV version 2 secrets engine of HashiCorp Vault.
+type Vault struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewVault returns the secret at url, e.g.
+// https://vault:8200/v1/secret/data/gotty, read with token.
+func NewVault(url string, token string) *Vault {
+	return &Vault{url: url, token: token, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (v *Vault) String() string {
+	u, err := url.Parse(v.url)
+	if err != nil {
+		return "vault secret"
+	}
+	u.User = nil
+	return "vault secret " + u.String()
+}
+
+func (v *Vault) Fetch(ctx context.Context) (map[string]string, error) {
+	var secret struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, nil, &secret); err != nil {
+		return nil, err
+	}
+	return stringValues(secret.Data.Data), nil
+}
+
+// Update writes a new version of the secret with the values of changes,
+// keeping its other values.
+func (v *Vault) Update(ctx context.Context, changes map[string]string) error {
+	values, err := v.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	for key, value := range changes {
+		values[key] = value
+	}
+	return v.do(ctx, http.MethodPost, map[string]interface{}{"data": values}, nil)
+}
+
+// do sends a request with body as JSON, decoding the response into result.
+func (v *Vault) do(ctx context.Context, method string, body interface{}, result interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.url, &payload)
+	if err != nil {
+		return fmt.Errorf("%s: %w", v, err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", v, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", v, resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", v, err)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+// Package spill provides FIFO byte buffers bounded in memory, per buffer and
+// across buffers sharing a budget, that spill to temporary files once the
+// memory is used up.
+package spill
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrFull is returned by Write when p does not fit in the buffer.
+var ErrFull = errors.New("buffer full")
+
+// Budget is the memory shared by buffers.
+type Budget struct {
+	limit  int64 // unlimited if 0
+	memory atomic.Int64
+	disk   atomic.Int64
+	report func(memory, disk int64)
+	mu     sync.Mutex // serializes reports
+}
+
+// NewBudget returns a budget of limit bytes of memory, unlimited if 0.
+// report, if not nil, is called with the bytes buffered in memory and on disk
+// by all buffers whenever they change.
+func NewBudget(limit int64, report func(memory, disk int64)) *Budget {
+	return &Budget{limit: limit, report: report}
+}
+
+// Memory returns the bytes buffered in memory.
+func (b *Budget) Memory() int64 { return b.memory.Load() }
+
+// Disk returns the bytes buffered on disk.
+func (b *Budget) Disk() int64 { return b.disk.Load() }
+
+// available returns the free memory, up to n.
+func (b *Budget) available(n int64) int64 {
+	if b.limit == 0 {
+		return max(0, n)
+	}
+	return max(0, min(n, b.limit-b.memory.Load()))
+}
+
+// reserve takes up to n bytes of memory, returning how many were taken.
+func (b *Budget) reserve(n int64) int64 {
+	for {
+		used := b.memory.Load()
+		taken := n
+		if b.limit > 0 {
+			taken = max(0, min(n, b.limit-used))
+		}
+		if taken == 0 || b.memory.CompareAndSwap(used, used+taken) {
+			return taken
+		}
+	}
+}
+
+func (b *Budget) add(memory, disk int64) {
+	if memory == 0 && disk == 0 {
+		return
+	}
+	b.memory.Add(memory)
+	b.disk.Add(disk)
+	b.changed()
+}
+
+func (b *Budget) changed() {
+	if b.report != nil {
+		b.mu.Lock()
+		b.report(b.memory.Load(), b.disk.Load())
+		b.mu.Unlock()
+	}
+}
+
+// Buffer is a FIFO of bytes, holding up to a memory limit in memory, then up
+// to a disk limit in a temporary file. A Buffer is not safe for concurrent use.
+type Buffer struct {
+	budget      *Budget
+	memoryLimit int64
+	diskLimit   int64
+	dir         string
+
+	data  []byte
+	start int // of the buffered bytes in data
+
+	file    *os.File // of the bytes written after data filled up
+	readAt  int64
+	writeAt int64
+	fileErr error
+}
+
+// NewBuffer returns a buffer of memoryLimit bytes in memory, taken from
+// budget, and diskLimit bytes in a file created in dir, or the default
+// directory for temporary files if empty, once memory is used up. budget
+// may be nil for no limit across buffers, and diskLimit 0 for no file.
+func NewBuffer(budget *Budget, memoryLimit, diskLimit int64, dir string) *Buffer {
+	if budget == nil {
+		budget = NewBudget(0, nil)
+	}
+	return &Buffer{budget: budget, memoryLimit: memoryLimit, diskLimit: diskLimit, dir: dir}
+}
+
+// Len returns the number of buffered bytes.
+func (b *Buffer) Len() int64 {
+	return int64(len(b.data)-b.start) + b.writeAt - b.readAt
+}
+
+// Free returns the number of bytes that can be written.
+func (b *Buffer) Free() int64 {
+	return b.memoryFree() + b.diskFree()
+}
+
+// memoryFree returns the bytes that can be written to memory, none once
+// bytes are in the file, to keep them in order.
+func (b *Buffer) memoryFree() int64 {
+	if b.writeAt > b.readAt {
+		return 0
+	}
+	return b.budget.available(b.memoryLimit - int64(len(b.data)-b.start))
+}
+
+func (b *Buffer) diskFree() int64 {
+	if b.fileErr != nil {
+		return 0
+	}
+	return max(0, b.diskLimit-(b.writeAt-b.readAt))
+}
+
+// Write buffers p, returning ErrFull without writing anything if it does
+// not fit.
+func (b *Buffer) Write(p []byte) (int, error) {
+	var n int
+	if b.writeAt == b.readAt {
+		n = int(b.budget.reserve(min(int64(len(p)), b.memoryLimit-int64(len(b.data)-b.start))))
+	}
+	if int64(len(p)-n) > b.diskFree() {
+		b.budget.add(-int64(n), 0)
+		return 0, ErrFull
+	}
+	if n > 0 {
+		if b.start > 0 && b.start >= len(b.data)/2 {
+			b.data = b.data[:copy(b.data, b.data[b.start:])]
+			b.start = 0
+		}
+		b.data = append(b.data, p[:n]...)
+		b.budget.changed()
+	}
+	if n == len(p) {
+		return n, nil
+	}
+	if err := b.writeFile(p[n:]); err != nil {
+		return n, err
+	}
+	return len(p), nil
+}
+
+func (b *Buffer) writeFile(p []byte) error {
+	if b.file == nil {
+		file, err := os.CreateTemp(b.dir, "gotty-spill-")
+		if err != nil {
+			b.fileErr = err
+			return err
+		}
+		os.Remove(file.Name()) // removed once closed
+		b.file = file
+	}
+	if _, err := b.file.WriteAt(p, b.writeAt); err != nil {
+		b.fileErr = err
+		return err
+	}
+	b.writeAt += int64(len(p))
+	b.budget.add(0, int64(len(p)))
+	return nil
+}
+
+// Read reads the oldest bytes into p, returning io.EOF if the buffer is
+// empty.
+func (b *Buffer) Read(p []byte) (int, error) {
+	if b.Len() == 0 {
+		return 0, io.EOF
+	}
+	if b.start < len(b.data) {
+		n := copy(p, b.data[b.start:])
+		b.start += n
+		b.budget.add(-int64(n), 0)
+		b.compact()
+		return n, nil
+	}
+	n, err := b.file.ReadAt(p[:min(int64(len(p)), b.writeAt-b.readAt)], b.readAt)
+	b.advanceFile(int64(n))
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Discard drops up to n of the oldest bytes, returning how many were
+// dropped.
+func (b *Buffer) Discard(n int64) int64 {
+	memory := min(n, int64(len(b.data)-b.start))
+	b.start += int(memory)
+	b.budget.add(-memory, 0)
+	b.compact()
+	disk := min(n-memory, b.writeAt-b.readAt)
+	b.advanceFile(disk)
+	return memory + disk
+}
+
+// compact empties data once it is all read, releasing it after bursts.
+func (b *Buffer) compact() {
+	if b.start < len(b.data) {
+		return
+	}
+	if cap(b.data) > 64<<10 {
+		b.data = nil
+	}
+	b.data, b.start = b.data[:0], 0
+}
+
+func (b *Buffer) advanceFile(n int64) {
+	if n == 0 {
+		return
+	}
+	b.readAt += n
+	b.budget.add(0, -n)
+	if b.readAt == b.writeAt && b.file != nil {
+		b.readAt, b.writeAt = 0, 0
+		b.file.Truncate(0)
+	}
+}
+
+// Close releases the memory and removes the file of the buffer.
+func (b *Buffer) Close() error {
+	b.budget.add(-int64(len(b.data)-b.start), -(b.writeAt - b.readAt))
+	b.data, b.start = nil, 0
+	b.readAt, b.writeAt = 0, 0
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
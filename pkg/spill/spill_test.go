@@ -0,0 +1,60 @@
+package spill
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	var reported [2]int64
+	budget := NewBudget(8, func(memory, disk int64) { reported = [2]int64{memory, disk} })
+	dir := t.TempDir()
+	b := NewBuffer(budget, 6, 10, dir)
+	other := NewBuffer(budget, 6, 0, dir)
+
+	for _, s := range []string{"0123", "4567", "89"} {
+		if _, err := b.Write([]byte(s)); err != nil {
+			t.Fatalf("Write(%q) returned error: %v", s, err)
+		}
+	}
+	if b.Len() != 10 || reported != [2]int64{6, 4} {
+		t.Fatalf("unexpected length %d and usage %v", b.Len(), reported)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("the spill file is visible: %v", entries)
+	}
+
+	// the budget leaves 2 bytes of memory to other buffers
+	if _, err := other.Write([]byte("abc")); err != ErrFull {
+		t.Errorf("Write() beyond the budget returned %v", err)
+	}
+	if _, err := b.Write([]byte("abcdefg")); err != ErrFull {
+		t.Errorf("Write() beyond the disk limit returned %v", err)
+	}
+
+	if n := b.Discard(2); n != 2 {
+		t.Errorf("Discard() dropped %d bytes", n)
+	}
+	output, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatalf("ReadAll() returned error: %v", err)
+	}
+	if !bytes.Equal(output, []byte("23456789")) {
+		t.Errorf("unexpected output %q", output)
+	}
+	if reported != [2]int64{0, 0} {
+		t.Errorf("unexpected usage %v once read", reported)
+	}
+
+	// memory is used again once the file is read
+	b.Write([]byte("xy"))
+	if budget.Memory() != 2 || budget.Disk() != 0 {
+		t.Errorf("unexpected usage %d, %d", budget.Memory(), budget.Disk())
+	}
+	b.Close()
+	if budget.Memory() != 0 {
+		t.Errorf("Close() did not release %d bytes", budget.Memory())
+	}
+}
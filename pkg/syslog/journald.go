@@ -0,0 +1,75 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// JournalSocket is the socket of the native protocol of journald.
+var JournalSocket = "/run/systemd/journal/socket"
+
+// DialJournal returns a handler sending records to journald, with tag as
+// SYSLOG_IDENTIFIER and the attributes as fields, e.g. remote_addr as
+// REMOTE_ADDR.
+func DialJournal(tag string, opts *slog.HandlerOptions) (slog.Handler, error) {
+	conn, err := net.Dial("unixgram", JournalSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+	return newHandler(&journal{conn: conn.(*net.UnixConn)}, journalFormat(tag), opts), nil
+}
+
+type journal struct {
+	conn *net.UnixConn
+}
+
+func (j *journal) write(msg []byte) error {
+	_, err := j.conn.Write(msg)
+	return err
+}
+
+func journalFormat(tag string) func(slog.Record, []field) []byte {
+	return func(r slog.Record, attrs []field) []byte {
+		var b bytes.Buffer
+		writeJournalField(&b, "MESSAGE", r.Message)
+		writeJournalField(&b, "PRIORITY", strconv.Itoa(severity(r.Level)))
+		writeJournalField(&b, "SYSLOG_IDENTIFIER", tag)
+		for _, attr := range attrs {
+			writeJournalField(&b, journalName(attr.key), attr.value)
+		}
+		return b.Bytes()
+	}
+}
+
+// writeJournalField writes a field, in the binary form for multiline values.
+func writeJournalField(b *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name + "=" + value + "\n")
+		return
+	}
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// journalName returns key as a valid field name: uppercase letters, digits
+// and underscores, not starting with an underscore, as those are trusted
+// fields set by journald.
+func journalName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+	s := strings.TrimLeft(string(name), "_")
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "F_" + s
+	}
+	return s
+}
@@ -0,0 +1,240 @@
+// Package syslog provides slog handlers sending records to syslog servers
+// in the RFC 5424 format, and to journald, with their attributes as
+// structured fields.
+package syslog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Facility is the facility of the messages sent to syslog servers.
+const Facility = 3 // daemon
+
+// SDID is the ID of the structured data holding the attributes.
+const SDID = "gotty@32473"
+
+// Dial connects to the syslog server at address, given as udp://host:port,
+// tcp://host:port or unix:///path (ex: unix:///dev/log), and returns a
+// handler sending records to it, with tag as the application name.
+func Dial(address string, tag string, opts *slog.HandlerOptions) (slog.Handler, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address `%s`: %w", address, err)
+	}
+
+	var networks []string
+	target := u.Host
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Port() == "" {
+			target = net.JoinHostPort(u.Hostname(), "514")
+		}
+		networks = []string{u.Scheme}
+	case "unix":
+		target = u.Path
+		networks = []string{"unixgram", "unix"}
+	default:
+		return nil, fmt.Errorf("invalid syslog address `%s`, expected udp://, tcp:// or unix://", address)
+	}
+
+	s := &sink{target: target}
+	for _, network := range networks {
+		s.network = network
+		if err = s.dial(); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	f := &rfc5424{hostname: hostname, tag: tag, pid: strconv.Itoa(os.Getpid())}
+	return newHandler(s, f.format, opts), nil
+}
+
+// sink writes messages to a connection, dialing again on failures of
+// stream connections.
+type sink struct {
+	network string
+	target  string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (s *sink) dial() error {
+	conn, err := net.DialTimeout(s.network, s.target, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *sink) write(msg []byte) error {
+	if s.network == "tcp" {
+		// octet counting framing of RFC 6587
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		if _, err := s.conn.Write(msg); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	if err := s.dial(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+type rfc5424 struct {
+	hostname string
+	tag      string
+	pid      string
+}
+
+func (f *rfc5424) format(r slog.Record, attrs []field) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s - ",
+		Facility*8+severity(r.Level),
+		r.Time.Format(time.RFC3339Nano),
+		nilValue(f.hostname), nilValue(f.tag), f.pid,
+	)
+	if len(attrs) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + SDID)
+		for _, attr := range attrs {
+			fmt.Fprintf(&b, ` %s="%s"`, sdName(attr.key), sdEscaper.Replace(attr.value))
+		}
+		b.WriteString("]")
+	}
+	b.WriteString(" " + r.Message)
+	return b.Bytes()
+}
+
+// severity maps levels to the severities of syslog.
+func severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "_")
+}
+
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// sdName returns key as a valid PARAM-NAME: printable ASCII except
+// `=`, ` `, `]` and `"`, up to 32 characters.
+func sdName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if c <= ' ' || c >= 127 || c == '=' || c == ']' || c == '"' {
+			name[i] = '_'
+		}
+	}
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return string(name)
+}
+
+// field is an attribute, with the names of its groups joined by dots.
+type field struct {
+	key   string
+	value string
+}
+
+// handler formats records with their attributes as fields.
+type handler struct {
+	sink   interface{ write([]byte) error }
+	format func(slog.Record, []field) []byte
+	level  slog.Leveler
+	attrs  []field
+	prefix string // of the keys of the current group
+}
+
+func newHandler(sink interface{ write([]byte) error }, format func(slog.Record, []field) []byte, opts *slog.HandlerOptions) *handler {
+	h := &handler{sink: sink, format: format, level: slog.LevelInfo}
+	if opts != nil && opts.Level != nil {
+		h.level = opts.Level
+	}
+	return h
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	attrs := h.attrs
+	r.Attrs(func(attr slog.Attr) bool {
+		attrs = appendFields(attrs, h.prefix, attr)
+		return true
+	})
+	return h.sink.write(h.format(r, attrs))
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]field(nil), h.attrs...)
+	for _, attr := range attrs {
+		h2.attrs = appendFields(h2.attrs, h.prefix, attr)
+	}
+	return &h2
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+func appendFields(fields []field, prefix string, attr slog.Attr) []field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, a := range attr.Value.Group() {
+			fields = appendFields(fields, prefix, a)
+		}
+		return fields
+	}
+	return append(fields, field{prefix + attr.Key, attr.Value.String()})
+}
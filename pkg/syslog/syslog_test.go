@@ -0,0 +1,75 @@
+package syslog
+
+import (
+	"log/slog"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDial(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	handler, err := Dial("udp://"+pc.LocalAddr().String(), "gotty", nil)
+	if err != nil {
+		t.Fatalf("Dial() returned error: %v", err)
+	}
+	logger := slog.New(handler).With("remote_addr", "10.0.0.1").WithGroup("req")
+	logger.Warn("Request", "path", `/a"]`)
+	logger.Debug("Dropped")
+
+	msg := readPacket(t, pc)
+	expected := regexp.MustCompile(`^<28>1 \S+ \S+ gotty \d+ - \[gotty@32473 remote_addr="10.0.0.1" req.path="/a\\"\\]"\] Request$`)
+	if !expected.MatchString(msg) {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, _, err := pc.ReadFrom(make([]byte, 1024)); err == nil {
+		t.Errorf("received a record below the level (%d bytes)", n)
+	}
+
+	if _, err := Dial("http://localhost", "gotty", nil); err == nil {
+		t.Errorf("Dial() accepted an invalid address")
+	}
+}
+
+func TestDialJournal(t *testing.T) {
+	JournalSocket = filepath.Join(t.TempDir(), "socket")
+	pc, err := net.ListenPacket("unixgram", JournalSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	handler, err := DialJournal("gotty", nil)
+	if err != nil {
+		t.Fatalf("DialJournal() returned error: %v", err)
+	}
+	slog.New(handler).Error("Failed", "remote_addr", "10.0.0.1", "error", "a\nb")
+
+	msg := readPacket(t, pc)
+	for _, field := range []string{"MESSAGE=Failed\n", "PRIORITY=3\n", "SYSLOG_IDENTIFIER=gotty\n", "REMOTE_ADDR=10.0.0.1\n", "ERROR\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n"} {
+		if !strings.Contains(msg, field) {
+			t.Errorf("missing field %q in %q", field, msg)
+		}
+	}
+}
+
+func readPacket(t *testing.T, pc net.PacketConn) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no record received: %v", err)
+	}
+	return string(buf[:n])
+}
@@ -0,0 +1,211 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// pingInterval is how often the hub pings agents.
+	pingInterval = 30 * time.Second
+	// pingTimeout is how long agents wait for a ping before reconnecting.
+	pingTimeout = 3 * pingInterval
+
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// openMessage asks an agent to open a connection.
+type openMessage struct {
+	ID string `json:"id"`
+}
+
+// AgentOptions are the options of Listen.
+type AgentOptions struct {
+	// Token authenticates the agent to the hub, if the hub requires one.
+	Token string
+	// Dialer dials the hub, websocket.DefaultDialer when nil.
+	Dialer *websocket.Dialer
+	// Logger logs the state of the tunnel, slog.Default() when nil.
+	Logger *slog.Logger
+}
+
+// Listener accepts the connections relayed by a hub.
+type Listener struct {
+	controlURL string
+	header     http.Header
+	dialer     *websocket.Dialer
+	logger     *slog.Logger
+
+	conns     chan net.Conn
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Listen registers as agent name at the hub at hubURL, e.g.
+// wss://hub.example.com/, and returns a listener accepting the connections
+// the hub relays. It reconnects to the hub until ctx is canceled or the
+// listener is closed, and only fails if the first connection fails.
+func Listen(ctx context.Context, hubURL string, name string, options *AgentOptions) (*Listener, error) {
+	if options == nil {
+		options = &AgentOptions{}
+	}
+	u, err := url.Parse(hubURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hub URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return nil, fmt.Errorf("unsupported hub URL scheme `%s`", u.Scheme)
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid agent name `%s`", name)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/tunnel/" + url.PathEscape(name)
+
+	l := &Listener{
+		controlURL: u.String(),
+		header:     http.Header{},
+		dialer:     options.Dialer,
+		logger:     options.Logger,
+		conns:      make(chan net.Conn),
+		closed:     make(chan struct{}),
+	}
+	if options.Token != "" {
+		l.header.Set("Authorization", "Bearer "+options.Token)
+	}
+	if l.dialer == nil {
+		l.dialer = websocket.DefaultDialer
+	}
+	if l.logger == nil {
+		l.logger = slog.Default()
+	}
+
+	control, err := l.dial(ctx, l.controlURL)
+	if err != nil {
+		return nil, err
+	}
+	l.logger.Info("Registered to the hub", "url", l.controlURL)
+
+	ctx, l.cancel = context.WithCancel(ctx)
+	go l.run(ctx, control)
+	return l, nil
+}
+
+func (l *Listener) dial(ctx context.Context, url string) (*websocket.Conn, error) {
+	ws, resp, err := l.dialer.DialContext(ctx, url, l.header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("failed to connect to the hub: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("failed to connect to the hub: %w", err)
+	}
+	return ws, nil
+}
+
+// run serves the control connection, reconnecting when it fails.
+func (l *Listener) run(ctx context.Context, control *websocket.Conn) {
+	defer l.Close()
+
+	backoff := minBackoff
+	for {
+		stop := context.AfterFunc(ctx, func() { control.Close() })
+		err := l.serveControl(ctx, control)
+		stop()
+		if ctx.Err() != nil {
+			return
+		}
+		l.logger.Warn("Lost the connection to the hub", "error", err)
+
+		for {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			control, err = l.dial(ctx, l.controlURL)
+			if err == nil {
+				break
+			}
+			l.logger.Warn("Failed to reconnect to the hub", "error", err, "retry_in", backoff)
+			backoff = min(2*backoff, maxBackoff)
+		}
+		backoff = minBackoff
+		l.logger.Info("Reconnected to the hub")
+	}
+}
+
+func (l *Listener) serveControl(ctx context.Context, control *websocket.Conn) error {
+	defer control.Close()
+
+	control.SetReadDeadline(time.Now().Add(pingTimeout))
+	control.SetPingHandler(func(data string) error {
+		control.SetReadDeadline(time.Now().Add(pingTimeout))
+		return control.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	for {
+		var open openMessage
+		if err := control.ReadJSON(&open); err != nil {
+			return err
+		}
+		go l.open(ctx, open.ID)
+	}
+}
+
+// open dials the connection id requested by the hub and hands it to Accept.
+func (l *Listener) open(ctx context.Context, id string) {
+	ws, err := l.dial(ctx, l.controlURL+"/connections/"+url.PathEscape(id))
+	if err != nil {
+		l.logger.Warn("Failed to open a connection", "error", err)
+		return
+	}
+	select {
+	case l.conns <- newConn(ws):
+	case <-l.closed:
+		ws.Close()
+	}
+}
+
+// Accept waits for and returns the next connection relayed by the hub.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close unregisters from the hub.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.cancel()
+	})
+	return nil
+}
+
+// Addr returns the address of the control connection.
+func (l *Listener) Addr() net.Addr {
+	return addr(l.controlURL)
+}
+
+type addr string
+
+func (a addr) Network() string { return "tunnel" }
+func (a addr) String() string  { return string(a) }
@@ -0,0 +1,139 @@
+// Package tunnel exposes GoTTY servers behind NAT or firewalls through a
+// hub they dial out to, which also works as a gateway to all of them.
+//
+// An agent keeps a control WebSocket connection to the hub at
+// <hub>/tunnel/<name>. For each client of /agents/<name>/ on the hub, the
+// hub asks the agent to open a connection, which the agent dials to
+// <hub>/tunnel/<name>/connections/<id>, and relays the HTTP requests of the
+// client, WebSocket included, over it to the listener returned by Listen.
+package tunnel
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// conn is a net.Conn over the binary messages of a WebSocket connection.
+// Read deadlines are implemented here, as read errors of WebSocket
+// connections are permanent while net/http expects to recover from them.
+type conn struct {
+	*websocket.Conn
+
+	messages chan []byte // closed after readErr is set
+	readErr  error
+	pending  []byte
+
+	mu              sync.Mutex
+	readDeadline    time.Time
+	deadlineChanged chan struct{} // closed when readDeadline changes
+	writeMu         sync.Mutex
+	closeOnce       sync.Once
+	closed          chan struct{}
+}
+
+func newConn(ws *websocket.Conn) net.Conn {
+	c := &conn{
+		Conn:            ws,
+		messages:        make(chan []byte),
+		deadlineChanged: make(chan struct{}),
+		closed:          make(chan struct{}),
+	}
+	go c.receive()
+	return c
+}
+
+func (c *conn) receive() {
+	defer close(c.messages)
+	for {
+		msgType, data, err := c.ReadMessage()
+		if err != nil {
+			c.readErr = err
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				c.readErr = io.EOF
+			}
+			return
+		}
+		if msgType != websocket.BinaryMessage || len(data) == 0 {
+			continue
+		}
+		select {
+		case c.messages <- data:
+		case <-c.closed:
+			c.readErr = net.ErrClosed
+			return
+		}
+	}
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		c.mu.Lock()
+		deadline, changed := c.readDeadline, c.deadlineChanged
+		c.mu.Unlock()
+
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer := time.NewTimer(d)
+			timeout = timer.C
+			defer timer.Stop()
+		}
+
+		select {
+		case data, ok := <-c.messages:
+			if !ok {
+				return 0, c.readErr
+			}
+			c.pending = data
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-changed:
+			// wait with the new deadline
+		}
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	c.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second),
+	)
+	return c.Conn.Close()
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+	return nil
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
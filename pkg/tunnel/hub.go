@@ -0,0 +1,357 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sorenisanerd/gotty/pkg/randomstring"
+)
+
+// DefaultOpenTimeout bounds how long the hub waits for agents to open connections.
+const DefaultOpenTimeout = 10 * time.Second
+
+var (
+	errAgentNotFound = errors.New("agent not found")
+	errOpenTimeout   = errors.New("agent did not open the connection in time")
+)
+
+// Hub relays clients to the agents registered to it.
+// It is an http.Handler serving agents at /tunnel/, the list of agents at /
+// and /api/agents, and the page of each agent at /agents/<name>/.
+type Hub struct {
+	token    string
+	logger   *slog.Logger
+	users    []User // nil when users are not authenticated
+	upgrader websocket.Upgrader
+	proxy    *httputil.ReverseProxy
+
+	mu      sync.Mutex
+	agents  map[string]*agent
+	pending map[string]chan net.Conn // by connection ID
+}
+
+type agent struct {
+	control *websocket.Conn
+	writeMu sync.Mutex
+}
+
+// HubOption is an option of NewHub().
+type HubOption func(*Hub)
+
+// WithLogger sets the logger of the hub, which is slog.Default() by default.
+func WithLogger(logger *slog.Logger) HubOption {
+	return func(hub *Hub) {
+		hub.logger = logger
+	}
+}
+
+// WithUsers makes the hub authenticate users with Basic Authentication
+// and let them access only the agents they are allowed to. The credentials
+// are not passed to agents, which receive the name of the user in the
+// X-Forwarded-User header instead.
+func WithUsers(users []User) HubOption {
+	return func(hub *Hub) {
+		hub.users = append([]User{}, users...)
+	}
+}
+
+// NewHub creates a hub accepting agents authenticated by token,
+// or any agent when it is empty.
+func NewHub(token string, opts ...HubOption) *Hub {
+	hub := &Hub{
+		token:   token,
+		logger:  slog.Default(),
+		agents:  map[string]*agent{},
+		pending: map[string]chan net.Conn{},
+	}
+	for _, opt := range opts {
+		opt(hub)
+	}
+	hub.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Scheme = "http"
+			r.Out.Host = r.In.Host // for the origin check of WebSocket connections
+			r.SetXForwarded()
+			if hub.users != nil {
+				r.Out.Header.Del("Authorization")
+			}
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+				name, _, _ := net.SplitHostPort(address)
+				return hub.Dial(ctx, name)
+			},
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     time.Minute,
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			status := http.StatusBadGateway
+			if errors.Is(err, errAgentNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, http.StatusText(status), status)
+		},
+	}
+	return hub
+}
+
+// Agents returns the names of the registered agents, sorted.
+func (hub *Hub) Agents() []string {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	names := make([]string, 0, len(hub.agents))
+	for name := range hub.agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dial opens a connection to the listener of the agent name.
+func (hub *Hub) Dial(ctx context.Context, name string) (net.Conn, error) {
+	id := randomstring.Generate(16)
+	conns := make(chan net.Conn, 1)
+
+	hub.mu.Lock()
+	a, ok := hub.agents[name]
+	if ok {
+		hub.pending[id] = conns
+	}
+	hub.mu.Unlock()
+	if !ok {
+		return nil, errAgentNotFound
+	}
+	defer func() {
+		hub.mu.Lock()
+		delete(hub.pending, id)
+		hub.mu.Unlock()
+		select {
+		case conn := <-conns: // opened too late
+			conn.Close()
+		default:
+		}
+	}()
+
+	a.writeMu.Lock()
+	a.control.SetWriteDeadline(time.Now().Add(DefaultOpenTimeout))
+	err := a.control.WriteJSON(openMessage{ID: id})
+	a.writeMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(DefaultOpenTimeout)
+	defer timer.Stop()
+	select {
+	case conn := <-conns:
+		return conn, nil
+	case <-timer.C:
+		return nil, errOpenTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (hub *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/tunnel/"); ok {
+		if !hub.authenticateAgent(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		name, id, isConnection := strings.Cut(rest, "/connections/")
+		if isConnection {
+			hub.handleConnection(w, r, name, id)
+		} else {
+			hub.handleAgent(w, r, name)
+		}
+		return
+	}
+
+	var user *User
+	if hub.users != nil {
+		var ok bool
+		if user, ok = hub.authenticateUser(r); !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	switch {
+	case r.URL.Path == "/":
+		hub.handleIndex(w, r, user)
+	case r.URL.Path == "/api/agents":
+		hub.handleAgents(w, r, user)
+	case strings.HasPrefix(r.URL.Path, "/agents/"):
+		hub.handleProxy(w, r, user)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// allowedAgents returns the registered agents user may access.
+func (hub *Hub) allowedAgents(user *User) []string {
+	var names []string
+	for _, name := range hub.Agents() {
+		if user == nil || user.Allows(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>GoTTY</title></head>
+<body>
+<h1>Agents</h1>
+<ul>
+{{range .}}<li><a href="agents/{{.}}/">{{.}}</a></li>
+{{else}}<li>No agents available</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+func (hub *Hub) handleIndex(w http.ResponseWriter, r *http.Request, user *User) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	indexTemplate.Execute(w, hub.allowedAgents(user))
+}
+
+type agentInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func (hub *Hub) handleAgents(w http.ResponseWriter, r *http.Request, user *User) {
+	agents := []agentInfo{}
+	for _, name := range hub.allowedAgents(user) {
+		agents = append(agents, agentInfo{Name: name, URL: "/agents/" + url.PathEscape(name) + "/"})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agents)
+}
+
+func (hub *Hub) handleProxy(w http.ResponseWriter, r *http.Request, user *User) {
+	name, rest, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/agents/"), "/")
+	if user != nil && !user.Allows(name) {
+		hub.logger.Warn("Access denied", "user", user.Name, "agent", name, "remote_addr", r.RemoteAddr)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !found {
+		http.Redirect(w, r, "/agents/"+name+"/", http.StatusFound)
+		return
+	}
+
+	r = r.Clone(r.Context())
+	r.URL.Host = name
+	r.URL.Path = "/" + rest
+	r.URL.RawPath = ""
+	r.Header.Del("X-Forwarded-User")
+	if user != nil {
+		r.Header.Set("X-Forwarded-User", user.Name)
+	}
+	hub.proxy.ServeHTTP(w, r)
+}
+
+func (hub *Hub) authenticateAgent(r *http.Request) bool {
+	if hub.token == "" {
+		return true
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(hub.token)) == 1
+}
+
+func (hub *Hub) handleAgent(w http.ResponseWriter, r *http.Request, name string) {
+	if name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	hub.mu.Lock()
+	_, exists := hub.agents[name]
+	hub.mu.Unlock()
+	if exists {
+		http.Error(w, "Agent already registered", http.StatusConflict)
+		return
+	}
+
+	control, err := hub.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	a := &agent{control: control}
+
+	hub.mu.Lock()
+	if _, exists := hub.agents[name]; exists {
+		hub.mu.Unlock()
+		control.Close()
+		return
+	}
+	hub.agents[name] = a
+	hub.mu.Unlock()
+	hub.logger.Info("Agent registered", "name", name, "remote_addr", r.RemoteAddr)
+
+	defer func() {
+		hub.mu.Lock()
+		delete(hub.agents, name)
+		hub.mu.Unlock()
+		control.Close()
+		hub.logger.Info("Agent unregistered", "name", name)
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.writeMu.Lock()
+				control.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+				a.writeMu.Unlock()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// agents send nothing, read to process control messages until they leave
+	for {
+		if _, _, err := control.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+func (hub *Hub) handleConnection(w http.ResponseWriter, r *http.Request, name string, id string) {
+	hub.mu.Lock()
+	conns, ok := hub.pending[id]
+	delete(hub.pending, id)
+	hub.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	ws, err := hub.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conns <- newConn(ws)
+}
@@ -0,0 +1,94 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTunnel(t *testing.T) {
+	hub := httptest.NewServer(NewHub("secret"))
+	defer hub.Close()
+
+	if _, err := Listen(context.Background(), hub.URL, "box", &AgentOptions{Token: "wrong"}); err == nil {
+		t.Fatalf("Listen() succeeded with a wrong token")
+	}
+
+	listener, err := Listen(context.Background(), hub.URL, "box", &AgentOptions{Token: "secret"})
+	if err != nil {
+		t.Fatalf("Listen() returned error: %v", err)
+	}
+	defer listener.Close()
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello from "+r.URL.Path)
+	}))
+
+	resp, err := http.Get(hub.URL + "/agents/box/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello from /index.html" {
+		t.Errorf("body = %q, expected the page of the agent", body)
+	}
+
+	resp, err = http.Get(hub.URL + "/agents/other/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d for an unknown agent, expected %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestHubUsers(t *testing.T) {
+	users, err := ParseUsers(strings.NewReader("# users\nalice:pass:db-*\n"))
+	if err != nil {
+		t.Fatalf("ParseUsers() returned error: %v", err)
+	}
+	hub := httptest.NewServer(NewHub("", WithUsers(users)))
+	defer hub.Close()
+
+	for _, name := range []string{"db-01", "web"} {
+		listener, err := Listen(context.Background(), hub.URL, name, nil)
+		if err != nil {
+			t.Fatalf("Listen() returned error: %v", err)
+		}
+		defer listener.Close()
+		go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.Header.Get("X-Forwarded-User")+r.Header.Get("Authorization"))
+		}))
+	}
+
+	get := func(path string, user string, password string) (int, string) {
+		req, _ := http.NewRequest("GET", hub.URL+path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	if status, _ := get("/", "alice", "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("status = %d with a wrong password, expected %d", status, http.StatusUnauthorized)
+	}
+	if status, body := get("/api/agents", "alice", "pass"); status != http.StatusOK || body != `[{"name":"db-01","url":"/agents/db-01/"}]` {
+		t.Errorf("agents = %d %s, expected only db-01", status, body)
+	}
+	if status, _ := get("/agents/web/", "alice", "pass"); status != http.StatusForbidden {
+		t.Errorf("status = %d for a denied agent, expected %d", status, http.StatusForbidden)
+	}
+	if status, body := get("/agents/db-01/", "alice", "pass"); status != http.StatusOK || body != "alice" {
+		t.Errorf("agent received %d %q, expected the user without the credential", status, body)
+	}
+}
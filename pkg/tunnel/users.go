@@ -0,0 +1,95 @@
+package tunnel
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+)
+
+// User is a user of the hub and the agents they may access.
+type User struct {
+	Name     string
+	Password string
+	// Agents are patterns of path.Match() for the names of the agents
+	// the user may access, e.g. "db-*", or "*" for all.
+	Agents []string
+}
+
+// Allows returns whether the user may access agent name.
+func (user *User) Allows(name string) bool {
+	for _, pattern := range user.Agents {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseUsers parses users, one per line as user:password:agents, where
+// agents is a comma-separated list of patterns. Empty lines and lines
+// starting with # are ignored.
+func ParseUsers(r io.Reader) ([]User, error) {
+	var users []User
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || fields[0] == "" {
+			return nil, fmt.Errorf("line %d: expected user:password:agents", lineNum)
+		}
+		user := User{Name: fields[0], Password: fields[1]}
+		for _, pattern := range strings.Split(fields[2], ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("line %d: invalid pattern `%s`", lineNum, pattern)
+			}
+			user.Agents = append(user.Agents, pattern)
+		}
+		users = append(users, user)
+	}
+	return users, scanner.Err()
+}
+
+// LoadUsers parses the users of file with ParseUsers.
+func LoadUsers(file string) ([]User, error) {
+	f, err := os.Open(homedir.Expand(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users, err := ParseUsers(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid users file `%s`: %w", file, err)
+	}
+	return users, nil
+}
+
+// authenticateUser returns the user of the Basic Authentication of r.
+func (hub *Hub) authenticateUser(r *http.Request) (*User, bool) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, false
+	}
+	for i := range hub.users {
+		user := &hub.users[i]
+		if subtle.ConstantTimeCompare([]byte(user.Name), []byte(name)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1 {
+			return user, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/sorenisanerd/gotty/pkg/asciicast"
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+)
+
+func playCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "play",
+		Usage:     "Play a session recording in this terminal",
+		ArgsUsage: "<recording.cast>",
+		Flags: []cli.Flag{
+			&cli.Float64Flag{
+				Name:  "speed",
+				Value: 1,
+				Usage: "Playback speed multiplier",
+			},
+			&cli.Float64Flag{
+				Name:  "idle-time-limit",
+				Value: 0,
+				Usage: "Limit pauses between outputs to this many seconds (0 to disable)",
+			},
+			&cli.BoolFlag{
+				Name:  "markers",
+				Usage: "List the markers of the recording, e.g. dropped with --record-markers, instead of playing it",
+			},
+			&cli.StringFlag{
+				Name:  "from",
+				Usage: "Start playing at the marker with this label, or this many seconds",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				cli.ShowSubcommandHelp(c)
+				exit(fmt.Errorf("Error: No recording given."), 1)
+			}
+			if c.Float64("speed") <= 0 {
+				exit(fmt.Errorf("Error: speed must be positive"), 1)
+			}
+
+			if c.Bool("markers") {
+				if err := listMarkers(c.Args().First(), os.Stdout); err != nil {
+					exit(err, 1)
+				}
+				return nil
+			}
+			from, err := markerTime(c.Args().First(), c.String("from"))
+			if err != nil {
+				exit(err, 1)
+			}
+			if err := play(c.Args().First(), c.Float64("speed"), c.Float64("idle-time-limit"), from, os.Stdout); err != nil {
+				exit(err, 1)
+			}
+			return nil
+		},
+	}
+}
+
+// play writes the output of the recording at path to w as recorded, the
+// output before from seconds at once.
+func play(path string, speed float64, idleTimeLimit float64, from float64, w io.Writer) error {
+	file, err := os.Open(homedir.Expand(path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := asciicast.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	start := time.Now()
+	last, offset := from, from
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+
+		if event.Time < from {
+			if event.Type == asciicast.Output {
+				if _, err := io.WriteString(w, event.Data); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if idleTimeLimit > 0 && event.Time-last > idleTimeLimit {
+			offset += event.Time - last - idleTimeLimit
+		}
+		last = event.Time
+
+		at := time.Duration((event.Time - offset) / speed * float64(time.Second))
+		time.Sleep(time.Until(start.Add(at)))
+
+		if event.Type == asciicast.Output {
+			if _, err := io.WriteString(w, event.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// markers returns the marker events of the recording at path.
+func markers(path string) ([]asciicast.Event, error) {
+	file, err := os.Open(homedir.Expand(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := asciicast.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	var events []asciicast.Event
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if event.Type == asciicast.Marker {
+			events = append(events, *event)
+		}
+	}
+}
+
+// listMarkers writes the time and label of each marker of the recording at
+// path to w.
+func listMarkers(path string, w io.Writer) error {
+	events, err := markers(path)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		at := time.Duration(event.Time * float64(time.Second)).Truncate(time.Second)
+		if _, err := fmt.Fprintf(w, "%8s  %s\n", at, event.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markerTime returns the time in seconds of from, the label of a marker of
+// the recording at path or seconds, 0 if empty.
+func markerTime(path string, from string) (float64, error) {
+	if from == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseFloat(from, 64); err == nil && seconds >= 0 {
+		return seconds, nil
+	}
+	events, err := markers(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		if event.Data == from {
+			return event.Time, nil
+		}
+	}
+	return 0, fmt.Errorf("Error: no marker labelled `%s` in %s", from, path)
+}
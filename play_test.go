@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRecording = `{"version": 2, "width": 80, "height": 24}
+[0.1, "o", "one "]
+[0.2, "i", "ignored"]
+[0.3, "m", "deploy started"]
+[0.4, "o", "two "]
+[60.5, "r", "100x30"]
+[60.6, "o", "three"]
+`
+
+func writeRecording(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.cast")
+	if err := os.WriteFile(path, []byte(testRecording), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPlay(t *testing.T) {
+	path := writeRecording(t)
+	var output strings.Builder
+	// the minute of idle time is cut to 0.1 second
+	if err := play(path, 2, 0.1, 0, &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "one two three" {
+		t.Errorf("played %q, expected the output", output.String())
+	}
+
+	from, err := markerTime(path, "deploy started")
+	if err != nil || from != 0.3 {
+		t.Fatalf("markerTime() = %v, %v, expected 0.3", from, err)
+	}
+	output.Reset()
+	if err := play(path, 1, 0.1, from, &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "one two three" {
+		t.Errorf("played %q from the marker, expected the output", output.String())
+	}
+
+	if err := play(filepath.Join(t.TempDir(), "missing.cast"), 1, 0, 0, &output); err == nil {
+		t.Error("play() of a missing recording returned no error")
+	}
+}
+
+func TestMarkers(t *testing.T) {
+	path := writeRecording(t)
+	var output strings.Builder
+	if err := listMarkers(path, &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "      0s  deploy started\n" {
+		t.Errorf("listed %q", output.String())
+	}
+
+	for _, test := range []struct {
+		from     string
+		expected float64
+		valid    bool
+	}{
+		{"", 0, true},
+		{"1.5", 1.5, true},
+		{"deploy started", 0.3, true},
+		{"deploy finished", 0, false},
+	} {
+		from, err := markerTime(path, test.from)
+		if from != test.expected || (err == nil) != test.valid {
+			t.Errorf("markerTime(%q) = %v, %v, expected %v", test.from, from, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/sorenisanerd/gotty/client"
+	"github.com/sorenisanerd/gotty/pkg/asciicast"
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+	"github.com/sorenisanerd/gotty/utils"
+)
+
+func replayCommand() *cli.Command {
+	clientOptions := &client.Options{}
+	if err := utils.ApplyDefaultValues(clientOptions); err != nil {
+		exit(err, 1)
+	}
+	cliFlags, flagMappings, err := utils.GenerateFlags(clientOptions)
+	if err != nil {
+		exit(err, 3)
+	}
+	cliFlags = append(cliFlags,
+		&cli.Float64Flag{
+			Name:  "speed",
+			Value: 1,
+			Usage: "Replay speed multiplier",
+		},
+		&cli.Float64Flag{
+			Name:  "wait",
+			Value: 5,
+			Usage: "Seconds to wait for the session to end after the last input before disconnecting",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "Save the output of the session as a recording to this file",
+		},
+		&cli.StringFlag{
+			Name:  "expect",
+			Usage: "Recording whose output the session must reproduce, exiting with 1 otherwise",
+		},
+	)
+
+	return &cli.Command{
+		Name:      "replay",
+		Usage:     "Replay the input of a recording into a new session on a GoTTY server",
+		ArgsUsage: "<url> <recording.cast>",
+		Description: "Connects to the server like `gotty client` and types the input events of the\n" +
+			"recording (made with --record-input) at their times, resizing the terminal as\n" +
+			"recorded. The output is printed, saved with --output and compared with --expect,\n" +
+			"e.g. with the output of an earlier replay, for golden tests of interactive commands.",
+		Flags: cliFlags,
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 2 {
+				cli.ShowSubcommandHelp(c)
+				exit(fmt.Errorf("Error: A URL and a recording are required."), 1)
+			}
+			if c.Float64("speed") <= 0 {
+				exit(fmt.Errorf("Error: speed must be positive"), 1)
+			}
+			utils.ApplyFlags(cliFlags, flagMappings, c, clientOptions)
+
+			cl, err := client.New(c.Args().First(), clientOptions)
+			if err != nil {
+				exit(err, 3)
+			}
+			var expected []byte
+			if path := c.String("expect"); path != "" {
+				if expected, err = recordedOutput(path); err != nil {
+					exit(err, 3)
+				}
+			}
+
+			output, err := replay(cl, c.Args().Get(1), c.Float64("speed"), time.Duration(c.Float64("wait")*float64(time.Second)), c.String("output"))
+			if err != nil {
+				exit(err, 8)
+			}
+			if expected != nil && !bytes.Equal(output, expected) {
+				exit(fmt.Errorf("Error: output differs from `%s` at byte %d", c.String("expect"), commonPrefix(output, expected)), 1)
+			}
+			return nil
+		},
+	}
+}
+
+// replay types the input of the recording at path into a new session of cl,
+// returning its output.
+func replay(cl *client.Client, path string, speed float64, wait time.Duration, outputPath string) ([]byte, error) {
+	file, err := os.Open(homedir.Expand(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := asciicast.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	output := &bytes.Buffer{}
+	stdout := io.MultiWriter(os.Stdout, output)
+	if outputPath != "" {
+		outputFile, err := os.Create(homedir.Expand(outputPath))
+		if err != nil {
+			return nil, err
+		}
+		defer outputFile.Close()
+		recorder, err := asciicast.NewWriter(outputFile, asciicast.Header{
+			Width:  reader.Header.Width,
+			Height: reader.Header.Height,
+			Title:  reader.Header.Title,
+			Env:    reader.Header.Env,
+		})
+		if err != nil {
+			return nil, err
+		}
+		stdout = io.MultiWriter(stdout, recordingWriter{recorder})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdin, input := io.Pipe()
+	resize := make(chan client.Size)
+	errs := make(chan error, 1)
+	go func() {
+		err := typeInput(ctx, reader, speed, input, resize)
+		input.Close()
+		if err == nil {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+		}
+		errs <- err
+		cancel()
+	}()
+
+	size := client.Size{Columns: reader.Header.Width, Rows: reader.Header.Height}
+	err = cl.Run(ctx, nil, stdin, stdout, size, resize)
+	if err == context.Canceled {
+		err = nil
+	}
+	// the session may end before the input
+	cancel()
+	stdin.Close()
+	if inputErr := <-errs; inputErr != nil && inputErr != context.Canceled && inputErr != io.ErrClosedPipe {
+		return nil, fmt.Errorf("%s: %s", path, inputErr)
+	}
+	return output.Bytes(), err
+}
+
+// typeInput writes the input events of reader to w and sends its resizes at
+// their times.
+func typeInput(ctx context.Context, reader *asciicast.Reader, speed float64, w io.Writer, resize chan<- client.Size) error {
+	start := time.Now()
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		at := time.Duration(event.Time / speed * float64(time.Second))
+		select {
+		case <-time.After(time.Until(start.Add(at))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		switch event.Type {
+		case asciicast.Input:
+			if _, err := io.WriteString(w, event.Data); err != nil {
+				return err
+			}
+		case asciicast.Resize:
+			var size client.Size
+			if _, err := fmt.Sscanf(event.Data, "%dx%d", &size.Columns, &size.Rows); err != nil {
+				return fmt.Errorf("invalid resize `%s`", event.Data)
+			}
+			select {
+			case resize <- size:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// recordedOutput returns the output of the recording at path.
+func recordedOutput(path string) ([]byte, error) {
+	file, err := os.Open(homedir.Expand(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := asciicast.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	output := []byte{}
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return output, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if event.Type == asciicast.Output {
+			output = append(output, event.Data...)
+		}
+	}
+}
+
+func commonPrefix(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+type recordingWriter struct {
+	recorder *asciicast.Writer
+}
+
+func (w recordingWriter) Write(p []byte) (int, error) {
+	if err := w.recorder.WriteOutput(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
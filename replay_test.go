@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorenisanerd/gotty/client"
+	"github.com/sorenisanerd/gotty/gottytest"
+)
+
+func TestReplay(t *testing.T) {
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	t.Cleanup(func() {
+		os.Stdout.Close()
+		os.Stdout = stdout
+	})
+
+	factory := gottytest.NewFactory(func() *gottytest.Slave {
+		return gottytest.NewEchoSlave().Expect("exit\r", "bye")
+	})
+	srv := gottytest.NewServer(t, factory, nil)
+	dir := t.TempDir()
+	recording := filepath.Join(dir, "input.cast")
+	os.WriteFile(recording, []byte(`{"version": 2, "width": 80, "height": 24}
+[0.01, "i", "hi"]
+[0.02, "r", "100x30"]
+[0.03, "i", "exit\r"]
+`), 0o600)
+
+	cl, err := client.New(srv.URL, &client.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputPath := filepath.Join(dir, "output.cast")
+	output, err := replay(cl, recording, 2, 100*time.Millisecond, outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(output), "hiexit\rbye") {
+		t.Errorf("output = %q, expected the input echoed", output)
+	}
+	slave := factory.Slaves()[0]
+	if columns, rows := slave.Size(); columns != 100 || rows != 30 || slave.Input() != "hiexit\r" {
+		t.Errorf("size = %dx%d and input = %q, expected the recorded ones", columns, rows, slave.Input())
+	}
+
+	// the saved output is that of an expected replay
+	saved, err := recordedOutput(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, output) {
+		t.Errorf("saved output %q, expected %q", saved, output)
+	}
+	if n := commonPrefix([]byte("hiexit\rbye"), []byte("hiexit\rBYE")); n != 7 {
+		t.Errorf("commonPrefix() = %d, expected the output to differ at byte 7", n)
+	}
+}
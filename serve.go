@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/sorenisanerd/gotty/backend/docker"
+	"github.com/sorenisanerd/gotty/notify"
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+func serveCommand(cfg *config) *cli.Command {
+	cliFlags, flagMappings := commandFlags(cfg)
+
+	return &cli.Command{
+		Name:      "serve",
+		Usage:     "Share a command as a web application (default)",
+		ArgsUsage: "<command> [<arguments...>]",
+		Flags:     cliFlags,
+		Action: func(c *cli.Context) error {
+			return serve(c, cliFlags, flagMappings, cfg)
+		},
+	}
+}
+
+func recordCommand(cfg *config) *cli.Command {
+	cliFlags, flagMappings := commandFlags(cfg)
+
+	return &cli.Command{
+		Name:      "record",
+		Usage:     "Share a command and record every session (to the current directory unless --record-dir is given)",
+		ArgsUsage: "<command> [<arguments...>]",
+		Flags:     cliFlags,
+		Action: func(c *cli.Context) error {
+			if cfg.app.RecordDir == "" {
+				cfg.app.RecordDir = "."
+			}
+			return serve(c, cliFlags, flagMappings, cfg)
+		},
+	}
+}
+
+// commandArgv returns the command given on the command line, or else the
+// one of the config file.
+func commandArgv(args []string, cfg *config) []string {
+	if len(args) == 0 {
+		return cfg.backend.Command
+	}
+	return args
+}
+
+func serve(c *cli.Context, cliFlags []cli.Flag, flagMappings map[string]string, cfg *config) error {
+	loadOptions(c, cliFlags, flagMappings, cfg)
+
+	argv := commandArgv(c.Args().Slice(), cfg)
+	if len(argv) == 0 && cfg.backend.Backend == "command" {
+		msg := "Error: No command given."
+		cli.ShowSubcommandHelp(c)
+		exit(fmt.Errorf(msg), 1)
+	}
+	appOptions := cfg.app
+
+	if err := daemonize(cfg.daemon); err != nil {
+		exit(err, 3)
+	}
+
+	factory, err := newFactory(cfg, argv)
+	if err != nil {
+		exit(err, 3)
+	}
+	appOptions.TitleVariables = titleVariables(argv, factory)
+
+	opts := []server.ServerOption{server.WithFactory(factory)}
+	listener, err := listenAgent(cfg.agent, appOptions.EnableTLS)
+	if err != nil {
+		exit(err, 3)
+	}
+	if listener != nil {
+		opts = append(opts, server.WithListener(listener))
+	}
+	hostname, _ := os.Hostname()
+	notifier, err := notify.New(cfg.notify, strings.Join(argv, " "), hostname)
+	if err != nil {
+		exit(err, 3)
+	}
+	if notifier != nil {
+		opts = append(opts, server.WithEvents(notifier))
+	}
+	discovery, _ := factory.(*docker.Discovery)
+	if discovery != nil {
+		opts = append(opts, server.WithOuterMiddleware(discovery.Middleware))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if len(cfg.tenant.Tenants) > 0 {
+		m := server.NewMetrics(appOptions) // labeled by tenant
+		tenants, err := newTenants(ctx, c.String("config"), cfg.tenant.Tenants, tenantsPath(appOptions), appOptions, m, slog.Default())
+		if err != nil {
+			exit(err, 3)
+		}
+		opts = append(opts, server.WithMetrics(m), server.WithOuterMiddleware(tenants.Middleware))
+	}
+	srv, err := server.New(appOptions, opts...)
+	if err != nil {
+		exit(err, 3)
+	}
+
+	if cfg.daemon.PidFile != "" {
+		if err := writePidFile(cfg.daemon.PidFile); err != nil {
+			exit(err, 3)
+		}
+		defer removePidFile(cfg.daemon.PidFile)
+	}
+
+	gCtx, gCancel := context.WithCancel(context.Background())
+	if discovery != nil {
+		go discovery.Run(ctx)
+	}
+
+	slog.Info("GoTTY is starting", "backend", factory.Name(), "command", strings.Join(argv, " "))
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Run(ctx, server.WithGracefullContext(gCtx))
+	}()
+	var drain time.Duration
+	if appOptions.Pod {
+		drain = time.Duration(appOptions.PodDrainTimeout) * time.Second
+	}
+	err = waitSignals(errs, cancel, gCancel, drain, func() { reloadLimits(c, cliFlags, flagMappings, srv) })
+
+	var exitErr *webtty.ExitError
+	if errors.As(err, &exitErr) {
+		slog.Info("GoTTY is exiting with the exit status of the command", "status", exitErr.Code)
+		if cfg.daemon.PidFile != "" {
+			removePidFile(cfg.daemon.PidFile)
+		}
+		os.Exit(exitErr.Code)
+	}
+	if err != nil && err != context.Canceled {
+		fmt.Printf("Error: %s\n", err)
+		if cfg.daemon.PidFile != "" {
+			removePidFile(cfg.daemon.PidFile)
+		}
+		exit(err, 8)
+	}
+
+	return nil
+}
+
+// titleVariables returns the variables of the window title of a server
+// running argv with factory.
+func titleVariables(argv []string, factory server.Factory) map[string]interface{} {
+	command := factory.Name()
+	if len(argv) > 0 {
+		command = argv[0]
+	}
+	hostname, _ := os.Hostname()
+	return map[string]interface{}{
+		"command":      command,
+		"command_name": filepath.Base(command),
+		"argv":         argv[min(len(argv), 1):],
+		"hostname":     hostname,
+	}
+}
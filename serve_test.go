@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sorenisanerd/gotty/gottytest"
+)
+
+func TestTitleVariables(t *testing.T) {
+	factory := gottytest.NewFactory(nil)
+	for _, test := range []struct {
+		argv    []string
+		command string
+		name    string
+		args    []string
+	}{
+		{[]string{"/usr/bin/top", "-d", "1"}, "/usr/bin/top", "top", []string{"-d", "1"}},
+		{nil, "gottytest", "gottytest", nil},
+	} {
+		vars := titleVariables(test.argv, factory)
+		if vars["command"] != test.command || vars["command_name"] != test.name || !reflect.DeepEqual(vars["argv"], test.args) {
+			t.Errorf("titleVariables(%v) = %v, expected %s, %s and %v", test.argv, vars, test.command, test.name, test.args)
+		}
+	}
+}
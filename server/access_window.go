@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// accessWindow is a weekly time window new sessions may start in, such as
+// Mon-Fri 09:00-17:00.
+type accessWindow struct {
+	days  [7]bool       // by time.Weekday, of the start of the window
+	start time.Duration // since midnight
+	end   time.Duration // since midnight, before start for windows spanning midnight
+}
+
+// parseAccessWindow parses a window of optional days, e.g. Mon-Fri or
+// Sat,Sun (every day when omitted), and times, e.g. 09:00-17:00.
+func parseAccessWindow(s string) (accessWindow, error) {
+	var window accessWindow
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return window, fmt.Errorf("invalid access window `%s`, expected e.g. Mon-Fri 09:00-17:00", s)
+	}
+	if len(fields) == 1 {
+		window.days = [7]bool{true, true, true, true, true, true, true}
+	} else {
+		for _, days := range strings.Split(fields[0], ",") {
+			first, last, isRange := strings.Cut(strings.ToLower(days), "-")
+			if !isRange {
+				last = first
+			}
+			from, okFrom := weekdays[first]
+			to, okTo := weekdays[last]
+			if !okFrom || !okTo {
+				return window, fmt.Errorf("invalid days `%s` of access window `%s`, expected e.g. Mon-Fri or Sat,Sun", days, s)
+			}
+			for day := from; ; day = (day + 1) % 7 {
+				window.days[day] = true
+				if day == to {
+					break
+				}
+			}
+		}
+	}
+
+	start, end, ok := strings.Cut(fields[len(fields)-1], "-")
+	var err error
+	if window.start, err = parseTimeOfDay(start); ok && err == nil {
+		window.end, err = parseTimeOfDay(end)
+	}
+	if !ok || err != nil || window.start == window.end {
+		return window, fmt.Errorf("invalid times of access window `%s`, expected e.g. 09:00-17:00", s)
+	}
+	return window, nil
+}
+
+// parseTimeOfDay parses HH:MM, up to 24:00.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	var hours, minutes int
+	if n, err := fmt.Sscanf(s, "%d:%d", &hours, &minutes); err != nil || n != 2 || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time `%s`", s)
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("invalid time `%s`", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// contains tells whether t, in the time zone of the window, is in it.
+func (window accessWindow) contains(t time.Time) bool {
+	hour, minute, sec := t.Clock()
+	since := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(sec)*time.Second
+	if window.start < window.end {
+		return window.days[t.Weekday()] && since >= window.start && since < window.end
+	}
+	// from the evening of a day to the morning of the next one
+	return window.days[t.Weekday()] && since >= window.start ||
+		window.days[(t.Weekday()+6)%7] && since < window.end
+}
+
+// accessWindows returns the windows of Options.AccessWindows and their
+// time zone.
+func (options *Options) accessWindows() ([]accessWindow, *time.Location, error) {
+	location := time.Local
+	if options.AccessTimezone != "" {
+		var err error
+		if location, err = time.LoadLocation(options.AccessTimezone); err != nil {
+			return nil, nil, fmt.Errorf("invalid access time zone `%s`: %w", options.AccessTimezone, err)
+		}
+	}
+	windows := make([]accessWindow, 0, len(options.AccessWindows))
+	for _, s := range options.AccessWindows {
+		window, err := parseAccessWindow(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, location, nil
+}
+
+// checkAccessWindow returns ErrOutsideAccessWindow when a session of a
+// client presenting authToken may not start now.
+func (server *Server) checkAccessWindow(authToken string, session *SessionInfo) error {
+	if len(server.accessWindows) == 0 {
+		return nil
+	}
+	now := time.Now().In(server.accessLocation)
+	for _, window := range server.accessWindows {
+		if window.contains(now) {
+			return nil
+		}
+	}
+	if server.options.AccessOverride != "" && authToken == server.options.AccessOverride {
+		server.logger.Warn("Starting session outside of the access windows with the override credential",
+			"session_id", session.ID, "remote_addr", session.RemoteAddr, "user", session.User)
+		return nil
+	}
+	return ErrOutsideAccessWindow
+}
+
+// overrideAuthenticator also accepts the credential of
+// Options.AccessOverride with Basic Authentication.
+type overrideAuthenticator struct {
+	Authenticator
+	credential string
+}
+
+func (auth overrideAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if user, password, ok := r.BasicAuth(); ok && user+":"+password == auth.credential {
+		return auth.credential, true
+	}
+	return auth.Authenticator.Authenticate(w, r)
+}
+
+func (auth overrideAuthenticator) Verify(token string) error {
+	if token == auth.credential {
+		return nil
+	}
+	return auth.Authenticator.Verify(token)
+}
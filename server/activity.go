@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/procstat"
+)
+
+// ErrSessionIdle ends sessions without activity for Limits.IdleTimeout.
+var ErrSessionIdle = errors.New("session idle for too long")
+
+// activity keeps the times of the last input and output of a session,
+// in Unix nanoseconds, their bytes, its redactions and the resources of its
+// command.
+type activity struct {
+	input      atomic.Int64
+	output     atomic.Int64
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+	redactions atomic.Int64 // of Options.Redact
+	cpu        atomic.Int64 // nanoseconds
+	memory     atomic.Int64
+	peakMemory atomic.Int64
+}
+
+func newActivity(start time.Time) *activity {
+	a := &activity{}
+	a.input.Store(start.UnixNano())
+	a.output.Store(start.UnixNano())
+	return a
+}
+
+func (a *activity) lastInput() time.Time  { return time.Unix(0, a.input.Load()) }
+func (a *activity) lastOutput() time.Time { return time.Unix(0, a.output.Load()) }
+
+// usage sets the resource usage of info.
+func (a *activity) usage(info *SessionInfo) {
+	info.CPUTime = time.Duration(a.cpu.Load())
+	info.Memory = a.memory.Load()
+	info.PeakMemory = a.peakMemory.Load()
+}
+
+// watchIdle cancels a session with ErrSessionIdle once it has had no input,
+// or no activity at all with Options.IdleOutput, for timeout.
+func (server *Server) watchIdle(ctx context.Context, timeout time.Duration, activity *activity, cancel context.CancelCauseFunc) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		last := activity.lastInput()
+		if output := activity.lastOutput(); server.options.IdleOutput && output.After(last) {
+			last = output
+		}
+		if idle := time.Since(last); idle < timeout {
+			timer.Reset(timeout - idle)
+			continue
+		}
+		cancel(ErrSessionIdle)
+		return
+	}
+}
+
+// watchUsage samples the CPU and memory of the process pid and its children
+// every Options.UsageInterval until the session ends.
+func (server *Server) watchUsage(ctx context.Context, pid int, activity *activity) {
+	var memory int64 // counted in the total
+	defer func() {
+		server.metrics.Set(metricBackendMemory, float64(server.backendMemory.Add(-memory)))
+	}()
+
+	ticker := time.NewTicker(time.Duration(server.options.UsageInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		usage, err := procstat.Sample(pid)
+		if errors.Is(err, procstat.ErrUnsupported) {
+			return
+		}
+		if err == nil {
+			// children waited for move their time to their parent
+			if delta := int64(usage.CPU) - activity.cpu.Load(); delta > 0 {
+				activity.cpu.Add(delta)
+				server.metrics.Add(metricBackendCPU, time.Duration(delta).Seconds())
+			}
+			activity.memory.Store(usage.Memory)
+			if usage.Memory > activity.peakMemory.Load() {
+				activity.peakMemory.Store(usage.Memory)
+			}
+			server.metrics.Set(metricBackendMemory, float64(server.backendMemory.Add(usage.Memory-memory)))
+			memory = usage.Memory
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/sorenisanerd/gotty/pkg/cluster"
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+)
+
+// maxBroadcast is the longest message broadcast to the clients, in bytes.
+const maxBroadcast = 1024
+
+// adminEnabled tells whether the admin API is served, only with its own
+// authentication.
+func (options *Options) adminEnabled() bool {
+	return options.AdminCredential != "" || options.AdminCACrtFile != ""
+}
+
+// adminSeparate tells whether the admin API is served on its own listeners.
+func (server *Server) adminSeparate() bool {
+	return server.options.AdminPort != "" || len(server.adminListeners) > 0
+}
+
+// adminAddress returns the address to serve the admin API at with
+// Options.AdminPort.
+func (server *Server) adminAddress() string {
+	if server.options.AdminAddress != "" {
+		return server.options.AdminAddress
+	}
+	return server.options.Address
+}
+
+// adminHandler serves the admin API at <path>admin/.
+func (server *Server) adminHandler(pathPrefix string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+pathPrefix+"admin/sessions", server.handleAdminSessions)
+	mux.HandleFunc("DELETE "+pathPrefix+"admin/sessions/{id}", server.handleAdminTerminate)
+	mux.HandleFunc("POST "+pathPrefix+"admin/drain", server.handleAdminDrain)
+	mux.HandleFunc("POST "+pathPrefix+"admin/rearm", server.handleAdminRearm)
+	mux.HandleFunc("POST "+pathPrefix+"admin/broadcast", server.handleAdminBroadcast)
+	mux.HandleFunc("GET "+pathPrefix+"admin/limits", server.handleAdminLimits)
+	mux.HandleFunc("PUT "+pathPrefix+"admin/limits", server.handleAdminLimits)
+	mux.HandleFunc("GET "+pathPrefix+"admin/usage", server.handleAdminUsage)
+	return server.wrapAdminAuth(mux)
+}
+
+// wrapAdminAuth requires Options.AdminCredential and a client certificate of
+// Options.AdminCACrtFile, those given, apart from the authentication of the
+// clients.
+func (server *Server) wrapAdminAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.options.AdminCACrtFile != "" && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			server.authFailed(r.RemoteAddr, fmt.Errorf("%w: admin API without a client certificate", ErrAuthFailed))
+			writeError(w, ErrAuthFailed)
+			return
+		}
+		if credential := server.options.AdminCredential; credential != "" {
+			user, password, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(user+":"+password), []byte(credential)) != 1 {
+				server.authFailed(r.RemoteAddr, fmt.Errorf("%w: admin API", ErrAuthFailed))
+				w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY admin"`)
+				writeError(w, ErrAuthFailed)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// adminTLSConfig requires the client certificates of Options.AdminCACrtFile
+// on the listeners of the admin API.
+func (server *Server) adminTLSConfig() (*tls.Config, error) {
+	caFile := homedir.Expand(server.options.AdminCACrtFile)
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open admin CA crt file `%s`: %w", caFile, err)
+	}
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("could not parse admin CA crt file `%s`", caFile)
+	}
+	tlsConfig := &tls.Config{
+		ClientCAs:  caCertPool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+	if server.tlsFromSecrets() {
+		tlsConfig.GetCertificate = server.secrets.getCertificate
+	}
+	return tlsConfig, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (server *Server) handleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, server.sessions.List())
+}
+
+func (server *Server) handleAdminTerminate(w http.ResponseWriter, r *http.Request) {
+	if err := server.sessions.Terminate(r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	server.logger.Info("Session terminated by the admin API", "session_id", r.PathValue("id"), "remote_addr", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	server.Drain()
+	server.logger.Info("Draining by the admin API", "remote_addr", r.RemoteAddr)
+	writeJSON(w, server.health())
+}
+
+func (server *Server) handleAdminRearm(w http.ResponseWriter, r *http.Request) {
+	if err := server.Rearm(r.Context()); err != nil {
+		writeError(w, err)
+		return
+	}
+	server.logger.Info("Rearmed by the admin API", "remote_addr", r.RemoteAddr)
+	writeJSON(w, server.health())
+}
+
+// broadcastRequest is the JSON body of admin/broadcast.
+type broadcastRequest struct {
+	Message string `json:"message"`
+}
+
+func (server *Server) handleAdminBroadcast(w http.ResponseWriter, r *http.Request) {
+	var request broadcastRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*maxBroadcast)).Decode(&request); err != nil || request.Message == "" || len(request.Message) > maxBroadcast {
+		http.Error(w, fmt.Sprintf("Malformed request: expected a message of at most %d bytes", maxBroadcast), http.StatusBadRequest)
+		return
+	}
+	sent := server.Broadcast(request.Message)
+	server.logger.Info("Message broadcast by the admin API", "sessions", sent, "remote_addr", r.RemoteAddr)
+	writeJSON(w, map[string]int{"sessions": sent})
+}
+
+// Drain stops accepting new sessions, letting the running ones finish, as
+// on a graceful shutdown.
+func (server *Server) Drain() {
+	server.startDraining()
+}
+
+// Rearm accepts new sessions again after Drain or the decommission of the
+// server after its session, in the whole cluster if clustered.
+func (server *Server) Rearm(ctx context.Context) error {
+	if server.store != nil {
+		ctx, cancel := context.WithTimeout(ctx, cluster.DefaultRedisTimeout)
+		defer cancel()
+		if err := server.store.Delete(ctx, server.clusterKey("decommissioned")); err != nil {
+			return fmt.Errorf("%w: %w", ErrStoreFailed, err)
+		}
+	}
+	server.sessionMu.Lock()
+	defer server.sessionMu.Unlock()
+	server.decommissioned = false
+	server.decommissioning = false
+	server.closing = false
+	atomic.StoreInt32(&server.unhealthy, 0)
+	atomic.StoreInt32(&server.terminating, 0)
+	atomic.StoreInt32(&server.draining, 0)
+	return nil
+}
+
+// Broadcast shows message over the terminals of the clients of all the
+// running sessions, returning their number.
+func (server *Server) Broadcast(message string) int {
+	sent := 0
+	for _, info := range server.sessions.List() {
+		session, err := server.sessions.get(info.ID)
+		if errors.Is(err, ErrSessionNotFound) {
+			continue // ended meanwhile
+		}
+		if err := session.tty.Load().SendNotice(message); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
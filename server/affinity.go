@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// affinityCookieName is the cookie naming the node of the client, which
+// load balancers can route by so reconnects reach the node of the session.
+const affinityCookieName = "gotty.node"
+
+// setAffinityCookie issues the affinity cookie in clustered deployments.
+func (server *Server) setAffinityCookie(header http.Header) {
+	if server.store == nil {
+		return
+	}
+	cookie := &http.Cookie{
+		Name:     affinityCookieName,
+		Value:    server.node,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	header.Add("Set-Cookie", cookie.String())
+}
+
+type whereisResponse struct {
+	Session string `json:"session"`
+	Node    string `json:"node"`
+}
+
+// handleWhereis reports the node running the session whose ID is the path,
+// also in the X-Gotty-Node header for reverse proxies.
+func (server *Server) handleWhereis(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Path
+	session, err := server.sessions.Get(id)
+	if errors.Is(err, ErrSessionNotFound) && server.store != nil {
+		var data string
+		data, err = server.store.Get(r.Context(), server.clusterKey("sessions:"+id))
+		if err != nil {
+			err = fmt.Errorf("%w: %w", ErrStoreFailed, err)
+		} else if data == "" {
+			err = ErrSessionNotFound
+		} else {
+			err = json.Unmarshal([]byte(data), &session)
+		}
+	}
+	if err != nil {
+		status, _ := ErrorStatus(err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Gotty-Node", session.Node)
+	json.NewEncoder(w).Encode(whereisResponse{Session: id, Node: session.Node})
+}
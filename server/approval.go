@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sorenisanerd/gotty/pkg/randomstring"
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// approvalNotice is printed in the terminal of clients waiting for approval.
+const approvalNotice = "Waiting for the approval of this session...\r\n"
+
+var errApprovalNotFound = errors.New("no such approval request")
+
+// ApprovalRequest is a session waiting for approval, see Options.Approval.
+type ApprovalRequest struct {
+	ID          string    `json:"id"`
+	SessionID   string    `json:"session_id"`
+	RemoteAddr  string    `json:"remote_addr"`
+	User        string    `json:"user,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	// URL is where approvers approve or deny the request, with a secret
+	// token, empty in the listings of Server.PendingApprovals.
+	URL string `json:"url,omitempty"`
+}
+
+// ApprovalEvents are the Events of servers holding sessions for approval.
+// Events implementing it are called when a session waits for approval.
+type ApprovalEvents interface {
+	OnApprovalRequest(request ApprovalRequest)
+}
+
+type pendingApproval struct {
+	request  ApprovalRequest
+	token    string
+	decision chan bool // buffered, receives the first decision
+}
+
+// approvals are the sessions waiting for approval.
+type approvals struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+}
+
+func newApprovals() *approvals {
+	return &approvals{pending: map[string]*pendingApproval{}}
+}
+
+// PendingApprovals returns the sessions waiting for approval, the oldest first.
+func (server *Server) PendingApprovals() []ApprovalRequest {
+	server.approvals.mu.Lock()
+	defer server.approvals.mu.Unlock()
+	requests := make([]ApprovalRequest, 0, len(server.approvals.pending))
+	for _, pending := range server.approvals.pending {
+		request := pending.request
+		request.URL = ""
+		requests = append(requests, request)
+	}
+	slices.SortFunc(requests, func(a, b ApprovalRequest) int { return a.RequestedAt.Compare(b.RequestedAt) })
+	return requests
+}
+
+// Approve approves or denies the session waiting for approval with id.
+func (server *Server) Approve(id string, approved bool) error {
+	server.approvals.mu.Lock()
+	pending, ok := server.approvals.pending[id]
+	if ok {
+		delete(server.approvals.pending, id)
+	}
+	server.approvals.mu.Unlock()
+	if !ok {
+		return errApprovalNotFound
+	}
+	pending.decision <- approved
+	server.logger.Info("Session approval decided", "session_id", pending.request.SessionID, "approved", approved)
+	return nil
+}
+
+// awaitApproval holds session until it is approved, returning
+// ErrApprovalDenied or ErrApprovalTimeout otherwise.
+func (server *Server) awaitApproval(ctx context.Context, conn *websocket.Conn, session *SessionInfo, pageURL string) error {
+	timeout := time.Duration(server.options.ApprovalTimeout) * time.Second
+	pending := &pendingApproval{
+		request: ApprovalRequest{
+			ID:          randomstring.Generate(16),
+			SessionID:   session.ID,
+			RemoteAddr:  session.RemoteAddr,
+			User:        session.User,
+			Country:     session.Country,
+			RequestedAt: time.Now(),
+			ExpiresAt:   time.Now().Add(timeout),
+		},
+		token:    randomstring.Generate(32),
+		decision: make(chan bool, 1),
+	}
+	if pageURL != "" {
+		pending.request.URL = pageURL + "api/approvals/" + pending.request.ID + "?" + url.Values{"token": {pending.token}}.Encode()
+	}
+	server.approvals.mu.Lock()
+	server.approvals.pending[pending.request.ID] = pending
+	server.approvals.mu.Unlock()
+	defer func() {
+		server.approvals.mu.Lock()
+		delete(server.approvals.pending, pending.request.ID)
+		server.approvals.mu.Unlock()
+	}()
+
+	server.logger.Info("Session waiting for approval", "session_id", session.ID, "remote_addr", session.RemoteAddr, "user", session.User)
+	notice := append([]byte{webtty.Output}, base64.StdEncoding.EncodeToString([]byte(approvalNotice))...)
+	conn.WriteMessage(websocket.TextMessage, notice)
+	if events, ok := server.events.(ApprovalEvents); ok {
+		events.OnApprovalRequest(pending.request)
+	}
+	if server.options.ApprovalWebhook != "" {
+		go func() {
+			if err := postJSON(server.options.ApprovalWebhook, pending.request); err != nil {
+				server.logger.Warn("Failed to post the approval webhook", "error", err)
+			}
+		}()
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case approved := <-pending.decision:
+		if !approved {
+			return ErrApprovalDenied
+		}
+		return nil
+	case <-timer.C:
+		return ErrApprovalTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// approvalPage lets approvers following the link of a chat message decide,
+// as link previews must not.
+var approvalPage = template.Must(template.New("approval").Parse(`<!doctype html>
+<title>Approve the session</title>
+<p>Session {{ .SessionID }} of {{ if .User }}{{ .User }} from {{ end }}{{ .RemoteAddr }}{{ if .Country }} ({{ .Country }}){{ end }} is waiting for approval until {{ .ExpiresAt.Format "15:04:05 MST" }}.</p>
+<form method="post"><button name="approved" value="true">Approve</button> <button name="approved" value="false">Deny</button></form>
+`))
+
+// handleApproval shows a session waiting for approval on GET, and approves
+// or denies it on POST with approved=true or false, for callers presenting
+// the token of its URL.
+func (server *Server) handleApproval(w http.ResponseWriter, r *http.Request) {
+	server.approvals.mu.Lock()
+	pending, ok := server.approvals.pending[r.PathValue("id")]
+	server.approvals.mu.Unlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(pending.token)) != 1 {
+		writeError(w, errApprovalNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		approvalPage.Execute(w, pending.request)
+	case http.MethodPost:
+		approved, err := strconv.ParseBool(r.FormValue("approved"))
+		if err != nil {
+			http.Error(w, "Malformed request: approved must be true or false", http.StatusBadRequest)
+			return
+		}
+		if err := server.Approve(pending.request.ID, approved); err != nil {
+			writeError(w, err)
+			return
+		}
+		if approved {
+			fmt.Fprintln(w, "Session approved")
+		} else {
+			fmt.Fprintln(w, "Session denied")
+		}
+	default:
+		writeError(w, errMethodNotAllowed)
+	}
+}
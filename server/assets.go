@@ -0,0 +1,77 @@
+package server
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sorenisanerd/gotty/bindata"
+)
+
+// The bundle of the index page, loaded from --assets-url when set.
+var (
+	assetStylesheets = []string{"css/index.css", "css/xterm.css", "css/xterm_customize.css"}
+	assetScript      = "js/gotty.js"
+)
+
+// asset is a file of the bundle on the index page.
+type asset struct {
+	URL       string
+	Integrity string // Subresource Integrity of URL, when it is on a CDN
+	Fallback  string // the embedded copy, when it is on a CDN
+}
+
+// assets are the index template variable of the bundle.
+type assets struct {
+	Stylesheets []asset
+	Script      asset
+}
+
+// newAssets returns the bundle served by gotty, or by the CDN at base with
+// the integrity hashes generated at build time.
+func newAssets(base string) (*assets, error) {
+	if base == "" {
+		a := &assets{Script: asset{URL: "./" + assetScript}}
+		for _, path := range assetStylesheets {
+			a.Stylesheets = append(a.Stylesheets, asset{URL: "./" + path})
+		}
+		return a, nil
+	}
+
+	integrity := map[string]string{}
+	if data, err := bindata.Fs.ReadFile("static/integrity.json"); err == nil {
+		if err := json.Unmarshal(data, &integrity); err != nil {
+			return nil, fmt.Errorf("invalid integrity.json: %w", err)
+		}
+	}
+	cdn := func(path string) (asset, error) {
+		hash, ok := integrity[path]
+		if !ok {
+			// not built with make, e.g. in dev mode
+			data, err := bindata.Fs.ReadFile("static/" + path)
+			if err != nil {
+				return asset{}, fmt.Errorf("asset %s not found: %w", path, err)
+			}
+			sum := sha512.Sum384(data)
+			hash = "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+		}
+		return asset{URL: strings.TrimSuffix(base, "/") + "/" + path, Integrity: hash, Fallback: "./" + path}, nil
+	}
+
+	a := &assets{}
+	for _, path := range assetStylesheets {
+		stylesheet, err := cdn(path)
+		if err != nil {
+			return nil, err
+		}
+		a.Stylesheets = append(a.Stylesheets, stylesheet)
+	}
+	script, err := cdn(assetScript)
+	if err != nil {
+		return nil, err
+	}
+	a.Script = script
+	return a, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sorenisanerd/gotty/pkg/credentials"
+)
+
+// Authenticator authenticates the clients of a Server.
+type Authenticator interface {
+	// Authenticate checks an HTTP request and returns the token the client
+	// presents when opening its WebSocket connection.
+	// When the request is rejected, it writes the response and returns false.
+	Authenticate(w http.ResponseWriter, r *http.Request) (token string, ok bool)
+	// Verify checks the token presented on a WebSocket connection.
+	Verify(token string) error
+}
+
+// basicAuthenticator is the default Authenticator,
+// which uses Basic Authentication with the current credential of a store.
+type basicAuthenticator struct {
+	credentials credentials.Store
+}
+
+func (auth *basicAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	credential, err := auth.credentials.Get(r.Context())
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %w", ErrCredentialStoreFailed, err))
+		return "", false
+	}
+	token := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+
+	if len(token) != 2 || strings.ToLower(token[0]) != "basic" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
+		writeError(w, ErrAuthFailed)
+		return "", false
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(token[1])
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
+		writeError(w, ErrAuthFailed)
+		return "", false
+	}
+
+	if credential != string(payload) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
+		writeError(w, ErrAuthFailed)
+		return "", false
+	}
+	return credential, true
+}
+
+func (auth *basicAuthenticator) Verify(token string) error {
+	credential, err := auth.credentials.Get(context.Background())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCredentialStoreFailed, err)
+	}
+	if token != credential {
+		return errors.New("invalid credential")
+	}
+	return nil
+}
+
+func (server *Server) wrapAuthenticator(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := server.authenticator.Authenticate(w, r)
+		if !ok {
+			server.authFailed(r.RemoteAddr, ErrAuthFailed)
+			return
+		}
+
+		server.logger.Debug("Authentication succeeded", "remote_addr", r.RemoteAddr)
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authTokenKey, token)))
+	})
+}
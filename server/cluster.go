@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/cluster"
+	"github.com/sorenisanerd/gotty/pkg/randomstring"
+)
+
+// clusterTTL is how long keys of a crashed instance outlive it.
+// Live instances refresh their keys every third of it.
+const clusterTTL = 30 * time.Second
+
+func (server *Server) clusterKey(name string) string {
+	return server.options.ClusterPrefix + ":" + name
+}
+
+// keepAlive calls refresh periodically until the returned function is called.
+// Refreshes share a ticker, run while any is registered.
+func (server *Server) keepAlive(refresh func(ctx context.Context) error) (stop func()) {
+	ka := &server.keepAlives
+	key := new(int) // unique
+	ka.mu.Lock()
+	defer ka.mu.Unlock()
+	if ka.refreshes == nil {
+		ka.refreshes = make(map[*int]func(ctx context.Context) error)
+	}
+	ka.refreshes[key] = refresh
+	if len(ka.refreshes) == 1 {
+		ctx, cancel := context.WithCancel(context.Background())
+		ka.cancel = cancel
+		go server.runKeepAlives(ctx)
+	}
+	return func() {
+		ka.mu.Lock()
+		defer ka.mu.Unlock()
+		if _, ok := ka.refreshes[key]; !ok {
+			return
+		}
+		delete(ka.refreshes, key)
+		if len(ka.refreshes) == 0 {
+			ka.cancel()
+		}
+	}
+}
+
+// keepAlives are the refreshes of keepAlive.
+type keepAlives struct {
+	mu        sync.Mutex
+	refreshes map[*int]func(ctx context.Context) error
+	cancel    context.CancelFunc // of runKeepAlives
+}
+
+func (server *Server) runKeepAlives(ctx context.Context) {
+	ticker := time.NewTicker(clusterTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		server.keepAlives.mu.Lock()
+		refreshes := make([]func(ctx context.Context) error, 0, len(server.keepAlives.refreshes))
+		for _, refresh := range server.keepAlives.refreshes {
+			refreshes = append(refreshes, refresh)
+		}
+		server.keepAlives.mu.Unlock()
+		for _, refresh := range refreshes {
+			if err := refresh(ctx); err != nil && ctx.Err() == nil {
+				server.logger.Warn("Failed to refresh cluster state", "error", err)
+			}
+		}
+	}
+}
+
+// clusterDecommissioned returns whether any instance has been decommissioned.
+func (server *Server) clusterDecommissioned(ctx context.Context) (bool, error) {
+	value, err := server.store.Get(ctx, server.clusterKey("decommissioned"))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrStoreFailed, err)
+	}
+	return value != "", nil
+}
+
+// acquireClusterSession claims one of the maxSessions sessions of the
+// cluster, 0 for no limit, and returns a function to release it, or
+// errSessionActive.
+func (server *Server) acquireClusterSession(ctx context.Context, maxSessions int) (release func(decommission bool), err error) {
+	owner := randomstring.Generate(16)
+	var key string
+	for slot := 0; slot < maxSessions && key == ""; slot++ {
+		candidate := server.clusterKey("session")
+		if slot > 0 {
+			candidate += ":" + strconv.Itoa(slot)
+		}
+		acquired, err := server.store.Acquire(ctx, candidate, owner, clusterTTL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrStoreFailed, err)
+		}
+		if acquired {
+			key = candidate
+		}
+	}
+	if maxSessions > 0 && key == "" {
+		return nil, errSessionActive
+	}
+
+	stop := func() {}
+	if key != "" {
+		stop = server.keepAlive(func(ctx context.Context) error {
+			_, err := server.store.Acquire(ctx, key, owner, clusterTTL)
+			return err
+		})
+	}
+	return func(decommission bool) {
+		stop()
+		ctx, cancel := context.WithTimeout(context.Background(), cluster.DefaultRedisTimeout)
+		defer cancel()
+		if decommission {
+			if err := server.store.Set(ctx, server.clusterKey("decommissioned"), "1", 0); err != nil {
+				server.logger.Warn("Failed to decommission the cluster", "error", err)
+			}
+		}
+		if key == "" {
+			return
+		}
+		if err := server.store.Release(ctx, key, owner); err != nil {
+			server.logger.Warn("Failed to release the cluster session", "error", err)
+		}
+	}, nil
+}
+
+// addClusterConnections adds delta to the connections of path in the cluster
+// and returns their number.
+func (server *Server) addClusterConnections(ctx context.Context, path string, delta int) (int, error) {
+	num, err := server.store.Add(ctx, server.clusterKey("connections:"+path), int64(delta))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrStoreFailed, err)
+	}
+	return int(num), nil
+}
+
+// publishSession stores the metadata of session under <prefix>:sessions:<id>
+// as JSON until the returned function is called.
+func (server *Server) publishSession(session SessionInfo) (unpublish func()) {
+	key := server.clusterKey("sessions:" + session.ID)
+	data, _ := json.Marshal(session)
+	publish := func(ctx context.Context) error {
+		return server.store.Set(ctx, key, string(data), clusterTTL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cluster.DefaultRedisTimeout)
+	defer cancel()
+	if err := publish(ctx); err != nil {
+		server.logger.Warn("Failed to publish the session", "session_id", session.ID, "error", err)
+	}
+	stop := server.keepAlive(publish)
+	return func() {
+		stop()
+		ctx, cancel := context.WithTimeout(context.Background(), cluster.DefaultRedisTimeout)
+		defer cancel()
+		server.store.Delete(ctx, key)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// decommissionHookTimeout bounds the webhook and the hook command run when
+// the server is decommissioned.
+const decommissionHookTimeout = 30 * time.Second
+
+// decommissionEvent is posted to Options.DecommissionWebhook.
+type decommissionEvent struct {
+	Event      string    `json:"event"`
+	Node       string    `json:"node"`
+	Reason     string    `json:"reason"`
+	RemoteAddr string    `json:"remote_addr"`
+	Time       time.Time `json:"time"`
+}
+
+// announceDecommission tells the events, the webhook and the hook command that
+// the server stopped accepting clients after the session of remoteAddr,
+// closed by reason, so orchestrators can recycle it without polling.
+func (server *Server) announceDecommission(reason string, remoteAddr string) {
+	server.logger.Info("Server decommissioned after connection", "remote_addr", remoteAddr)
+	server.events.OnDecommission()
+
+	event := decommissionEvent{
+		Event:      "decommissioned",
+		Node:       server.node,
+		Reason:     reason,
+		RemoteAddr: remoteAddr,
+		Time:       time.Now(),
+	}
+	if server.options.DecommissionWebhook != "" {
+		server.hooks.Add(1)
+		go func() {
+			defer server.hooks.Done()
+			if err := postJSON(server.options.DecommissionWebhook, event); err != nil {
+				server.logger.Warn("Failed to post the decommission webhook", "error", err)
+			}
+		}()
+	}
+	if server.options.DecommissionHook != "" {
+		server.hooks.Add(1)
+		go func() {
+			defer server.hooks.Done()
+			if err := server.runDecommissionHook(event); err != nil {
+				server.logger.Warn("Decommission hook failed", "error", err)
+			}
+		}()
+	}
+}
+
+// postJSON posts v as JSON to the webhook at url.
+func postJSON(url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), decommissionHookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", req.URL.Redacted(), resp.Status)
+	}
+	return nil
+}
+
+// runDecommissionHook runs the hook command with sh, with the event in
+// GOTTY_EVENT, GOTTY_NODE, GOTTY_REASON and GOTTY_REMOTE_ADDR.
+func (server *Server) runDecommissionHook(event decommissionEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), decommissionHookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", server.options.DecommissionHook)
+	cmd.Env = append(os.Environ(),
+		"GOTTY_EVENT="+event.Event,
+		"GOTTY_NODE="+event.Node,
+		"GOTTY_REASON="+event.Reason,
+		"GOTTY_REMOTE_ADDR="+event.RemoteAddr,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"net/http"
 	"strings"
+	"sync/atomic"
 )
 
 const (
@@ -18,23 +20,40 @@ func (e sessionError) Error() string { return string(e) }
 
 var (
 	errSessionActive   sessionError = "Another session is active"
-	errServerDestroyed sessionError = "Server has been destroyed"
+	errServerDestroyed sessionError = "Server has been decommissioned"
 )
 
+// sessionGuard holds the slot of an admitted session until it finishes.
 type sessionGuard struct {
-	server *Server
-	env    string
+	server   *Server
+	env      string
+	admitted *AdmittedSession
+	release  func(decommission bool) // of the cluster session, if any
 }
 
+// resolveEnvFromRequest returns the mode of r, dev or prod, from the query
+// parameter of Options.EnvParam, remembered in the cookie of
+// Options.EnvCookie. It is always prod with Options.DisableEnvOverride.
 func (server *Server) resolveEnvFromRequest(w http.ResponseWriter, r *http.Request) string {
-	envValue := strings.TrimSpace(r.URL.Query().Get(envQueryParam))
+	if server.options.DisableEnvOverride {
+		return envValueProd
+	}
+	param, cookieName := server.options.EnvParam, server.options.EnvCookie
+	if param == "" {
+		param = envQueryParam
+	}
+	if cookieName == "" {
+		cookieName = envCookieName
+	}
+
+	envValue := strings.TrimSpace(r.URL.Query().Get(param))
 	if envValue != "" {
 		http.SetCookie(w, &http.Cookie{
-			Name:  envCookieName,
+			Name:  cookieName,
 			Value: envValue,
 			Path:  "/",
 		})
-	} else if cookie, err := r.Cookie(envCookieName); err == nil {
+	} else if cookie, err := r.Cookie(cookieName); err == nil {
 		envValue = cookie.Value
 	}
 
@@ -45,41 +64,72 @@ func (server *Server) resolveEnvFromRequest(w http.ResponseWriter, r *http.Reque
 	return strings.ToLower(envValue)
 }
 
-func (server *Server) beginManagedSession(env string) (*sessionGuard, error) {
+// beginManagedSession admits a session of owner in env, refused once the
+// server is decommissioned or closing, or when Limits.MaxSessions sessions
+// run already, here or in the cluster, dev mode or not.
+func (server *Server) beginManagedSession(ctx context.Context, env string, owner string) (*sessionGuard, error) {
 	server.sessionMu.Lock()
 	defer server.sessionMu.Unlock()
 
-	if server.decommissioned {
+	if server.decommissioned || server.closing {
 		return nil, errServerDestroyed
 	}
-
-	if env == envValueDev {
-		return &sessionGuard{server: server, env: env}, nil
+	if server.store != nil {
+		decommissioned, err := server.clusterDecommissioned(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if decommissioned {
+			return nil, errServerDestroyed
+		}
 	}
 
-	if server.activeSession {
-		return nil, errSessionActive
+	maxSessions := server.Limits().MaxSessions
+	admitted, err := server.sessions.admit(owner, env == envValueDev, maxSessions)
+	if err != nil {
+		return nil, err
 	}
-
-	server.activeSession = true
-	return &sessionGuard{server: server, env: env}, nil
+	guard := &sessionGuard{server: server, env: env, admitted: admitted}
+	if server.store != nil {
+		release, err := server.acquireClusterSession(ctx, maxSessions)
+		if err != nil {
+			server.sessions.release(admitted.ID)
+			return nil, err
+		}
+		guard.release = release
+	}
+	return guard, nil
 }
 
-func (guard *sessionGuard) finish(decommission bool) bool {
-	if guard.env == envValueDev {
+// finish gives back the slot of the session. Once last, when the server is
+// to serve no more sessions, e.g. single-session or exiting after this one,
+// the server stops admitting sessions, and
+// terminates, and is decommissioned with decommission, as soon as the other
+// sessions have ended too. It returns true when it is decommissioned then.
+func (guard *sessionGuard) finish(decommission bool, last bool) bool {
+	server := guard.server
+	server.sessionMu.Lock()
+	defer server.sessionMu.Unlock()
+
+	remaining := server.sessions.release(guard.admitted.ID)
+	if guard.release != nil {
+		guard.release(decommission)
+	}
+	server.decommissioning = server.decommissioning || decommission
+	server.closing = server.closing || last
+	if remaining > 0 {
 		return false
 	}
-
-	guard.server.sessionMu.Lock()
-	defer guard.server.sessionMu.Unlock()
-
-	guard.server.activeSession = false
-	if decommission && !guard.server.decommissioned {
-		guard.server.decommissioned = true
-		guard.server.markUnhealthy()
+	if server.closing {
+		// Flag server as terminating so middleware responds with 503s.
+		server.logger.Info("WebSocket disconnected, marking server as terminating")
+		atomic.StoreInt32(&server.terminating, 1)
+	}
+	if server.decommissioning && !server.decommissioned {
+		server.decommissioned = true
+		server.markUnhealthy()
 		return true
 	}
-
 	return false
 }
 
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// Errors that sessions fail with, possibly wrapped.
+// Use errors.Is() to compare them and ErrorStatus() to report them.
+var (
+	// ErrAuthFailed is returned when a client fails to authenticate.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrMaxConnections is returned when a client exceeds Options.MaxConnection.
+	ErrMaxConnections = errors.New("exceeding max number of connections")
+	// ErrSlaveStartFailed is returned when the factory fails to start a backend.
+	ErrSlaveStartFailed = errors.New("failed to start backend")
+	// ErrProtocol is returned when a client breaks the protocol.
+	ErrProtocol = webtty.ErrProtocol
+	// ErrStoreFailed is returned when the cluster store is unavailable.
+	ErrStoreFailed = errors.New("cluster store failed")
+	// ErrCredentialStoreFailed is returned when the credential of Basic
+	// Authentication cannot be read.
+	ErrCredentialStoreFailed = errors.New("credential store failed")
+	// ErrOIDCFailed is returned when the OpenID Connect provider of
+	// Options.OIDCIssuer cannot be reached.
+	ErrOIDCFailed = errors.New("OpenID Connect provider failed")
+	// ErrInvalidInit is returned when a client sends an invalid init message.
+	// It wraps ErrProtocol.
+	ErrInvalidInit = fmt.Errorf("invalid init message: %w", ErrProtocol)
+	// ErrUnsupportedProtocol is returned when a client offers none of the
+	// WebSocket subprotocols of webtty.Protocols.
+	ErrUnsupportedProtocol = errors.New("unsupported protocol version")
+	// ErrCountryDenied is returned when a client connects from a country
+	// refused by Options.AllowCountries or Options.DenyCountries.
+	ErrCountryDenied = errors.New("access from this country is denied")
+	// ErrOutsideAccessWindow is returned when a client starts a session
+	// outside of Options.AccessWindows without Options.AccessOverride.
+	ErrOutsideAccessWindow = errors.New("outside of the access windows")
+	// ErrApprovalDenied is returned when the session of a client is denied
+	// by an approver, see Options.Approval.
+	ErrApprovalDenied = errors.New("session was denied")
+	// ErrApprovalTimeout is returned when nobody approves the session of a
+	// client within Options.ApprovalTimeout.
+	ErrApprovalTimeout = errors.New("session was not approved in time")
+	// ErrShuttingDown is returned when a client connects to a server that
+	// stopped accepting sessions, e.g. after --once.
+	ErrShuttingDown = errors.New("server is shutting down")
+
+	errMethodNotAllowed = errors.New("method not allowed")
+)
+
+// closeSessionActive is the WebSocket close code for clients rejected
+// because of another session, which the frontend reloads the page for.
+const closeSessionActive = 4000
+
+// closeSlowClient is the WebSocket close code for clients disconnected
+// because they could not keep up with the output.
+const closeSlowClient = 4001
+
+// closeDecommissioned is the WebSocket close code for clients of a server
+// decommissioned after its session.
+const closeDecommissioned = 4002
+
+// closeShuttingDown is the WebSocket close code for clients of a server
+// that stopped accepting sessions.
+const closeShuttingDown = 4003
+
+// closeInvalidInit is the WebSocket close code for clients sending an
+// invalid init message or parameters.
+const closeInvalidInit = 4004
+
+// closeIdle is the WebSocket close code for clients whose session ended
+// after Options.IdleTimeout.
+const closeIdle = 4005
+
+// closeUnsupportedProtocol is the WebSocket close code for clients offering
+// no version of the protocol the server supports.
+const closeUnsupportedProtocol = 4006
+
+// closeQuotaExceeded is the WebSocket close code for clients whose session
+// used up its bandwidth quota.
+const closeQuotaExceeded = 4007
+
+// CloseSlaveExited is the WebSocket close code for clients whose session
+// ended because the command exited, with its exit status as the reason
+// when known, so that they tell it from a lost connection and do not
+// reconnect.
+const CloseSlaveExited = 4008
+
+var errorStatuses = []struct {
+	err       error
+	status    int
+	closeCode int
+}{
+	{ErrSessionTerminated, http.StatusOK, websocket.CloseNormalClosure},
+	{ErrSessionIdle, http.StatusRequestTimeout, closeIdle},
+	{ErrOutputTrigger, http.StatusForbidden, websocket.ClosePolicyViolation},
+	{ErrQuotaExceeded, http.StatusTooManyRequests, closeQuotaExceeded},
+	{webtty.ErrMasterClosed, http.StatusOK, websocket.CloseNormalClosure},
+	{webtty.ErrSlaveClosed, http.StatusOK, CloseSlaveExited},
+	{context.Canceled, http.StatusOK, websocket.CloseGoingAway},
+	{ErrAuthFailed, http.StatusUnauthorized, websocket.ClosePolicyViolation},
+	{ErrCountryDenied, http.StatusForbidden, websocket.ClosePolicyViolation},
+	{ErrOutsideAccessWindow, http.StatusForbidden, websocket.ClosePolicyViolation},
+	{ErrApprovalDenied, http.StatusForbidden, websocket.ClosePolicyViolation},
+	{ErrApprovalTimeout, http.StatusRequestTimeout, websocket.ClosePolicyViolation},
+	{errApprovalNotFound, http.StatusNotFound, websocket.CloseInternalServerErr},
+	{ErrMaxConnections, http.StatusServiceUnavailable, closeSessionActive},
+	{errSessionActive, http.StatusServiceUnavailable, closeSessionActive},
+	{errServerDestroyed, http.StatusServiceUnavailable, closeDecommissioned},
+	{ErrShuttingDown, http.StatusServiceUnavailable, closeShuttingDown},
+	{ErrInvalidInit, http.StatusBadRequest, closeInvalidInit},
+	{ErrInvalidParams, http.StatusBadRequest, closeInvalidInit},
+	{ErrUnsupportedProtocol, http.StatusBadRequest, closeUnsupportedProtocol},
+	{ErrProtocol, http.StatusBadRequest, websocket.CloseProtocolError},
+	{errMethodNotAllowed, http.StatusMethodNotAllowed, websocket.CloseProtocolError},
+	{webtty.ErrSlowMaster, http.StatusServiceUnavailable, closeSlowClient},
+	{ErrSessionNotFound, http.StatusNotFound, websocket.CloseInternalServerErr},
+	{ErrSlaveStartFailed, http.StatusInternalServerError, websocket.CloseInternalServerErr},
+	{ErrStoreFailed, http.StatusServiceUnavailable, websocket.CloseTryAgainLater},
+	{ErrCredentialStoreFailed, http.StatusServiceUnavailable, websocket.CloseTryAgainLater},
+	{ErrOIDCFailed, http.StatusBadGateway, websocket.CloseTryAgainLater},
+}
+
+// ErrorStatus returns the HTTP status and the WebSocket close code
+// that report err to clients.
+func ErrorStatus(err error) (status int, closeCode int) {
+	status, closeCode, _ = errorStatus(err)
+	return status, closeCode
+}
+
+// errorStatus also returns the reason to tell clients, the message of the
+// matching error, which does not leak details such as paths or credentials.
+func errorStatus(err error) (int, int, string) {
+	if err == nil {
+		return http.StatusOK, websocket.CloseNormalClosure, ""
+	}
+	var initErr *initError
+	if errors.As(err, &initErr) {
+		return http.StatusBadRequest, closeInvalidInit, initErr.Error()
+	}
+	var paramErr *paramError
+	if errors.As(err, &paramErr) {
+		return http.StatusBadRequest, closeInvalidInit, paramErr.Error()
+	}
+	for _, s := range errorStatuses {
+		if errors.Is(err, s.err) {
+			var exitErr *webtty.ExitError
+			if s.closeCode == CloseSlaveExited && errors.As(err, &exitErr) {
+				return s.status, s.closeCode, fmt.Sprintf("exit status %d", exitErr.Code)
+			}
+			if s.status == http.StatusOK {
+				return s.status, s.closeCode, ""
+			}
+			return s.status, s.closeCode, s.err.Error()
+		}
+	}
+	return http.StatusInternalServerError, websocket.CloseInternalServerErr, "internal server error"
+}
+
+// errorResponse is the JSON body of the HTTP errors reported by writeError.
+type errorResponse struct {
+	Error     string `json:"error"`
+	CloseCode int    `json:"close_code"` // that reports the same error on WebSocket connections
+	// RetryAfter is the estimated wait in seconds before connecting again,
+	// for connections rejected while the server is busy.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// writeError responds to a request, before any WebSocket upgrade, with the
+// status and reason of err as JSON.
+func writeError(w http.ResponseWriter, err error) {
+	writeErrorResponse(w, err, 0)
+}
+
+func writeErrorResponse(w http.ResponseWriter, err error, retryAfter int) {
+	status, code, reason := errorStatus(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: reason, CloseCode: code, RetryAfter: retryAfter})
+}
+
+// closeWithError closes conn with the close code of err, which it returns.
+// The WebTTY serving conn, if any, must have returned from Run or Watch, as
+// conn allows a single writer.
+func closeWithError(conn *websocket.Conn, err error) int {
+	_, code, reason := errorStatus(err)
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+	return code
+}
+
+// checkSubprotocol checks that a client offering WebSocket subprotocols,
+// as browsers do, offers one of webtty.Protocols.
+func checkSubprotocol(r *http.Request) error {
+	offered := websocket.Subprotocols(r)
+	if len(offered) == 0 {
+		return nil
+	}
+	for _, protocol := range offered {
+		if slices.Contains(webtty.Protocols, protocol) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w, offered %s, expected one of %s", ErrUnsupportedProtocol, strings.Join(offered, ", "), strings.Join(webtty.Protocols, ", "))
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"time"
+)
+
+// SessionInfo describes the session of a client.
+type SessionInfo struct {
+	ID         string
+	RemoteAddr string
+	User       string   // user name of Basic Authentication or a trusted proxy, if any
+	Groups     []string // of User, given by a trusted proxy
+	Name       string   // requested by the client with InitMessage.SessionName
+	Backend    string
+	Command    string              // with its arguments, as in the usage reports
+	Node       string              // Options.ClusterNode of the instance running it
+	Params     map[string][]string // parameters passed to the factory
+	StartedAt  time.Time
+	// Country, ASN and ASOrganization locate RemoteAddr in the databases
+	// of Options.GeoIPDatabases, empty without them.
+	Country        string
+	ASN            uint
+	ASOrganization string
+	// LastInput and LastOutput are the times of the last input of the
+	// client and output of the backend, kept by SessionManager.
+	LastInput  time.Time
+	LastOutput time.Time
+	// PermitWrite tells whether the client may write input, at least in
+	// part, see SessionManager.SetPermitWrite.
+	PermitWrite bool
+	// BytesIn and BytesOut are the bytes of input written to the backend
+	// and of its output so far.
+	BytesIn  int64
+	BytesOut int64
+	// Redactions is how many matches of Options.Redact were redacted from
+	// the output sent to the client with Options.RedactLive, or else from
+	// the recording.
+	Redactions int64
+	// CPUTime, Memory and PeakMemory are the resource usage of the command
+	// and its children, sampled every Options.UsageInterval; zero for
+	// backends without a local process.
+	CPUTime    time.Duration
+	Memory     int64 // resident, in bytes
+	PeakMemory int64
+	// Recording is the name of the file of the recording of the session in
+	// Options.RecordDir, if recorded.
+	Recording string
+}
+
+// Events receives the lifecycle events of a Server.
+// Methods are called synchronously and must not block.
+type Events interface {
+	// OnSessionStart is called when a backend has been started for a client.
+	OnSessionStart(session SessionInfo)
+	// OnSessionEnd is called when a started session ends, with the error
+	// that ended it (webtty.ErrMasterClosed when the client left).
+	OnSessionEnd(session SessionInfo, err error)
+	// OnAuthFailure is called when a client fails to authenticate.
+	OnAuthFailure(remoteAddr string, err error)
+	// OnDecommission is called when the server stops accepting clients
+	// after its session ended.
+	OnDecommission()
+}
+
+// NopEvents ignores all events. Embed it to implement only some of Events.
+type NopEvents struct{}
+
+func (NopEvents) OnSessionStart(session SessionInfo)          {}
+func (NopEvents) OnSessionEnd(session SessionInfo, err error) {}
+func (NopEvents) OnAuthFailure(remoteAddr string, err error)  {}
+func (NopEvents) OnDecommission()                             {}
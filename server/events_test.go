@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// lifecycleEvents passes the events on, described.
+type lifecycleEvents chan string
+
+func (e lifecycleEvents) OnSessionStart(session SessionInfo) {
+	e <- "start " + session.User
+}
+
+func (e lifecycleEvents) OnSessionEnd(session SessionInfo, err error) {
+	e <- fmt.Sprintf("end %s: %v", session.User, err)
+}
+
+func (e lifecycleEvents) OnAuthFailure(remoteAddr string, err error) {
+	if _, _, splitErr := net.SplitHostPort(remoteAddr); splitErr != nil {
+		e <- "auth failure of " + remoteAddr
+		return
+	}
+	e <- "auth failure"
+}
+
+func (e lifecycleEvents) OnDecommission() {
+	e <- "decommission"
+}
+
+func TestEvents(t *testing.T) {
+	events := make(lifecycleEvents, 10)
+
+	next := func(expected ...string) {
+		t.Helper()
+		for _, event := range expected {
+			select {
+			case got := <-events:
+				if got != event {
+					t.Errorf("event = %s, expected %s", got, event)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("no event, expected %s", event)
+			}
+		}
+	}
+
+	header := http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("alice:pass"))}}
+	// a server per connection, as the first one ends the server
+	url := runServer(t, &Options{EnableBasicAuth: true, Credential: "alice:pass", MaxSessions: 1}, WithEvents(events))
+	conn := dialSession(t, url, InitMessage{AuthToken: "alice:wrong"}, header)
+	conn.ReadMessage()
+	conn.Close()
+	next("auth failure")
+
+	url = runServer(t, &Options{EnableBasicAuth: true, Credential: "alice:pass", MaxSessions: 1}, WithEvents(events))
+	conn = dialSession(t, url, InitMessage{AuthToken: "alice:pass"}, header)
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	next("start alice", "end alice: "+webtty.ErrMasterClosed.Error(), "decommission")
+}
@@ -0,0 +1,35 @@
+package server_test
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/sorenisanerd/gotty/backend/localcommand"
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/utils"
+)
+
+func ExampleServer_Handler() {
+	options := &server.Options{}
+	if err := utils.ApplyDefaultValues(options); err != nil {
+		log.Fatal(err)
+	}
+	options.Path = "/tty/"
+	options.PermitWrite = true
+
+	factory, err := localcommand.NewFactory("top", nil, &localcommand.Options{CloseSignal: 1, CloseTimeout: -1})
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv, err := server.New(options, server.WithFactory(factory))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/tty/", srv.Handler())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("the terminal is at /tty/"))
+	})
+	log.Fatal(http.ListenAndServe(":8080", mux))
+}
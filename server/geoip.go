@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/sorenisanerd/gotty/pkg/geoip"
+)
+
+// locate returns the record of the host of remoteAddr in the GeoIP
+// databases, the zero record without them.
+func (server *Server) locate(remoteAddr string) geoip.Record {
+	if len(server.geoip) == 0 {
+		return geoip.Record{}
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return geoip.Record{}
+	}
+	record, err := server.geoip.Lookup(addr)
+	if err != nil {
+		server.logger.Warn("Failed to look up the location of client", "remote_addr", remoteAddr, "error", err)
+	}
+	return record
+}
+
+// countryAllowed tells whether clients of remoteAddr pass
+// Options.AllowCountries and Options.DenyCountries. Addresses of no country,
+// e.g. private ones, pass the allowlist only when they are local.
+func (server *Server) countryAllowed(remoteAddr string) (bool, string) {
+	country := server.locate(remoteAddr).Country
+	if slices.ContainsFunc(server.options.DenyCountries, func(denied string) bool { return strings.EqualFold(denied, country) }) {
+		return false, country
+	}
+	if len(server.options.AllowCountries) == 0 {
+		return true, country
+	}
+	if country == "" {
+		host, _, _ := net.SplitHostPort(remoteAddr)
+		addr, err := netip.ParseAddr(host)
+		return err == nil && (addr.IsLoopback() || addr.IsPrivate()), country
+	}
+	return slices.ContainsFunc(server.options.AllowCountries, func(allowed string) bool { return strings.EqualFold(allowed, country) }), country
+}
+
+// wrapCountries refuses clients from the countries refused by the options.
+func (server *Server) wrapCountries(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, country := server.countryAllowed(r.RemoteAddr); !ok {
+			server.metrics.Add(metricErrors, 1, "kind", "country")
+			server.logger.Info("Refused client by country", "remote_addr", r.RemoteAddr, "country", country)
+			writeError(w, ErrCountryDenied)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"sync"
+	noesctmpl "text/template"
 	"time"
 )
 
@@ -68,3 +69,27 @@ func (counter *counter) wait() {
 func (counter *counter) timer() *time.Timer {
 	return counter.zeroTimer
 }
+
+// route is a path serving terminals, whose connections, timeout, Once,
+// ExitAfterSessions and MaxConnection are counted apart from other routes, such as the handlers of
+// other servers mounted on the same mux.
+type route struct {
+	path    string
+	counter *counter
+	once    int64 // set by the first connection when single use
+
+	sessions  int64 // started or starting, up to ExitAfterSessions
+	completed int64 // started sessions that ended
+
+	title          *noesctmpl.Template    // of the window
+	titleVariables map[string]interface{} // over Options.TitleVariables
+}
+
+func (server *Server) newRoute(path string) *route {
+	route := &route{
+		path:    path,
+		counter: newCounter(time.Duration(server.options.Timeout) * time.Second),
+	}
+	server.routeTitle(route)
+	return route
+}
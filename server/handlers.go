@@ -4,25 +4,29 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"html/template"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
-	pkgerrors "github.com/pkg/errors"
 
+	"github.com/sorenisanerd/gotty/pkg/cluster"
+	"github.com/sorenisanerd/gotty/pkg/randomstring"
 	"github.com/sorenisanerd/gotty/webtty"
 )
 
-func (server *Server) generateHandleWS(ctx context.Context, cancel context.CancelFunc, counter *counter) http.HandlerFunc {
-	once := new(int64)
-
+func (server *Server) generateHandleWS(ctx context.Context, cancel context.CancelFunc, route *route) http.HandlerFunc {
 	go func() {
 		select {
-		case <-counter.timer().C:
+		case <-route.counter.timer().C:
 			cancel()
 		case <-ctx.Done():
 		}
@@ -31,222 +35,602 @@ func (server *Server) generateHandleWS(ctx context.Context, cancel context.Cance
 	return func(w http.ResponseWriter, r *http.Request) {
 		env := server.resolveEnvFromRequest(w, r)
 
-		if server.options.Once {
-			success := atomic.CompareAndSwapInt64(once, 0, 1)
+		if server.isDraining() {
+			writeError(w, ErrShuttingDown)
+			return
+		}
+
+		responseHeader := http.Header{}
+		server.setAffinityCookie(responseHeader)
+
+		// the connection of a client, accepted before its admission when it
+		// may resume a session waiting for it
+		var accepted *acceptedConn
+		if server.resumes.waiting() {
+			if accepted = server.acceptResume(w, r, route, responseHeader); accepted == nil {
+				return
+			}
+			defer accepted.conn.Close()
+		}
+		// refuse turns the client away with err, in a close message once its
+		// connection is accepted
+		refuse := func(err error) {
+			if accepted == nil {
+				server.reject(w, route.path, err)
+				return
+			}
+			server.rejected(nil, route.path, err)
+			closeWithError(accepted.conn, err)
+		}
+
+		if server.singleUse() {
+			success := atomic.CompareAndSwapInt64(&route.once, 0, 1)
 			if !success {
-				http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+				refuse(ErrShuttingDown)
 				return
 			}
 		}
 
-		guard, err := server.beginManagedSession(env)
-		if err != nil {
-			status := http.StatusServiceUnavailable
-			message := err.Error()
-			if err == errServerDestroyed {
-				message = "Server is unavailable"
+		// a session slot, given back unless a session starts in it
+		limit := int64(server.options.ExitAfterSessions)
+		if limit > 0 {
+			if atomic.AddInt64(&route.sessions, 1) > limit {
+				atomic.AddInt64(&route.sessions, -1)
+				refuse(ErrShuttingDown)
+				return
 			}
-			http.Error(w, message, status)
+		}
+
+		owner := requestUser(r)
+		if owner == "" {
+			owner = r.RemoteAddr
+		}
+		guard, err := server.beginManagedSession(r.Context(), env, owner)
+		if err != nil {
+			refuse(err)
 			return
 		}
 
 		var (
 			counterIncremented        bool
 			sessionShouldDecommission bool
-			wsSlotAcquired            bool
+			sessionStarted            bool
+			exitServer                bool
 		)
+		// more sessions to serve, so the server keeps accepting them
+		keepServing := limit > 0 || server.reusable || server.multiSession()
 
 		closeReason := "unknown reason"
+		closeKind := "rejected" // of closeReason in Stats.CloseReasons
+		closeCode := 0          // none without a WebSocket
+		exitStatus := -1        // unknown
+		var session SessionInfo
+		connectedAt := time.Now()
 
 		defer func() {
-			if guard != nil {
-				destroyed := guard.finish(sessionShouldDecommission)
-				if destroyed {
-					log.Printf("Server decommissioned after connection from %s", r.RemoteAddr)
-				}
+			// last, so that Run waits for the decommission hooks
+			if counterIncremented && server.singleUse() || exitServer {
+				cancel()
 			}
 		}()
 
 		defer func() {
-			if !counterIncremented {
-				return
+			if limit > 0 && !sessionStarted {
+				atomic.AddInt64(&route.sessions, -1)
 			}
-			num := counter.done()
-			log.Printf(
-				"Connection closed by %s: %s, connections: %d/%d",
-				closeReason, r.RemoteAddr, num, server.options.MaxConnection,
-			)
+		}()
 
-			if server.options.Once {
-				cancel()
+		defer func() {
+			decommissioned := guard.finish(sessionShouldDecommission, counterIncremented && !keepServing)
+			if counterIncremented {
+				// once the state of the server reflects the end of the connection
+				server.sessionMu.Lock()
+				server.lastCloseReason = closeReason
+				server.sessionMu.Unlock()
+			}
+			if decommissioned {
+				server.announceDecommission(closeReason, r.RemoteAddr)
 			}
-
-			// Flag server as terminating so middleware responds with 503s.
-			log.Printf("WebSocket disconnected; marking server as terminating")
-			atomic.StoreInt32(&server.terminating, 1)
 		}()
 
 		defer func() {
-			if wsSlotAcquired {
-				server.releaseWebsocket()
+			if !counterIncremented {
+				return
+			}
+			num := route.counter.done()
+			server.connectionsChanged(route.path, num)
+			server.connectionClosed(route.path, closeKind)
+			// the whole story of the connection in one line
+			attrs := []any{
+				"session_id", session.ID, "remote_addr", r.RemoteAddr, "user", requestUser(r), "path", route.path,
+				"duration", time.Since(connectedAt).Round(time.Millisecond), "bytes_in", session.BytesIn, "bytes_out", session.BytesOut,
+			}
+			if exitStatus >= 0 {
+				attrs = append(attrs, "exit_status", exitStatus)
+			}
+			if closeCode != 0 {
+				attrs = append(attrs, "close_code", closeCode)
+			}
+			if len(session.Groups) > 0 {
+				attrs = append(attrs, "groups", session.Groups)
 			}
+			if session.Redactions > 0 {
+				attrs = append(attrs, "redactions", session.Redactions)
+			}
+			if session.PeakMemory > 0 {
+				attrs = append(attrs, "cpu_time", session.CPUTime.Round(time.Millisecond), "peak_memory", session.PeakMemory)
+			}
+			attrs = append(attrs, "close_reason", closeReason, "connections", num, "max_connection", server.Limits().MaxConnection)
+			server.logger.Info("session_closed", attrs...)
 		}()
 
-		if r.Method != "GET" {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		if accepted == nil && r.Method != "GET" {
+			writeError(w, errMethodNotAllowed)
 			return
 		}
 
-		num := counter.add(1)
+		num := route.counter.add(1)
 		counterIncremented = true
-		log.Printf("New client connected: %s, connections: %d/%d", r.RemoteAddr, num, server.options.MaxConnection)
-
-		conn, err := server.upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			closeReason = err.Error()
+		server.stats.connected(time.Now())
+		server.connectionsChanged(route.path, num)
+		if server.store != nil {
+			clusterNum, err := server.addClusterConnections(r.Context(), route.path, 1)
+			if err != nil {
+				server.logger.Warn("Failed to count connections of the cluster", "error", err)
+			} else {
+				num = clusterNum
+				defer func() {
+					ctx, cancel := context.WithTimeout(context.Background(), cluster.DefaultRedisTimeout)
+					defer cancel()
+					if _, err := server.addClusterConnections(ctx, route.path, -1); err != nil {
+						server.logger.Warn("Failed to count connections of the cluster", "error", err)
+					}
+				}()
+			}
+		}
+		server.logger.Info("New client connected", "remote_addr", r.RemoteAddr, "path", route.path, "connections", num, "max_connection", server.Limits().MaxConnection)
+
+		if limit := server.Limits().MaxConnection; limit != 0 && num > limit {
+			// rejected after the upgrade, so that clients get a proper close
+			// message, with Retry-After in the response to it
+			closeReason = ErrMaxConnections.Error()
+			server.rejected(responseHeader, route.path, ErrMaxConnections)
+			var conn *websocket.Conn
+			if accepted != nil {
+				conn = accepted.conn
+			} else {
+				conn, err = server.upgrader.Upgrade(w, r, responseHeader)
+				if err != nil {
+					closeReason = err.Error()
+					return
+				}
+				defer conn.Close()
+			}
+			closeCode = closeWithError(conn, ErrMaxConnections)
 			return
 		}
-		defer conn.Close()
 
-		if !server.tryLockWebsocket() {
-			closeReason = "another websocket session is already active"
-			conn.WriteMessage(websocket.CloseMessage,
-				websocket.FormatCloseMessage(4000, "Another session is active"))
-			return
+		headers := server.passHeaders(r)
+
+		// Extract query parameters from the HTTP request
+		queryParams := r.URL.Query()
+		server.logger.Debug("HTTP query params", "params", queryParams)
+
+		location := server.locate(r.RemoteAddr)
+		session = SessionInfo{
+			ID:             guard.admitted.ID,
+			RemoteAddr:     r.RemoteAddr,
+			User:           requestUser(r),
+			Groups:         requestGroups(r),
+			Backend:        server.factory.Name(),
+			Node:           server.node,
+			Country:        location.Country,
+			ASN:            location.ASN,
+			ASOrganization: location.Organization,
+		}
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
 		}
-		wsSlotAcquired = true
+		pageURL := scheme + "://" + r.Host + route.path
 
-		// Check if max connections exceeded after upgrade so we can send a proper close message
-		if int64(server.options.MaxConnection) != 0 {
-			if num > server.options.MaxConnection {
-				closeReason = "exceeding max number of connections"
-				// Send close frame with custom code 4000 and reason
-				conn.WriteMessage(websocket.CloseMessage,
-					websocket.FormatCloseMessage(4000, "Another session is active"))
+		var (
+			conn *websocket.Conn
+			init InitMessage
+		)
+		if accepted != nil {
+			conn, init = accepted.conn, accepted.init
+		} else {
+			conn, init, err = server.acceptInit(w, r, responseHeader)
+			if conn == nil {
+				closeReason = err.Error()
 				return
 			}
+			defer conn.Close()
 		}
-
-		var headers map[string][]string
-		if server.options.PassHeaders {
-			headers = r.Header
+		var exitErr *webtty.ExitError
+		if err != nil {
+			// closed by acceptInit
+			_, closeCode, _ = errorStatus(err)
+		} else {
+			err = server.processWSConn(ctx, conn, route, headers, init, queryParams, pageURL, &session)
+			if errors.As(err, &exitErr) {
+				exitStatus = exitErr.Code
+			}
+			if server.options.SessionSummary && !session.StartedAt.IsZero() {
+				server.sendSummary(conn, &session, exitStatus)
+			}
+			closeCode = closeWithError(conn, err)
+		}
+		if !session.StartedAt.IsZero() {
+			sessionStarted = true
+			server.sessionEnded(route.path, session, err)
+			if limit > 0 && atomic.AddInt64(&route.completed, 1) >= limit {
+				exitServer = true
+			}
+			if server.options.ExitOnSlaveExit && errors.Is(err, webtty.ErrSlaveClosed) {
+				exitServer = true
+			}
+			if exitServer {
+				keepServing = false
+				if errors.As(err, &exitErr) {
+					server.exitStatus.Store(exitErr)
+				} else {
+					server.exitStatus.Store(nil)
+				}
+			}
 		}
 
-		// Extract query parameters from the HTTP request
-		queryParams := r.URL.Query()
-		log.Printf("HTTP Query Params: %v", queryParams)
-
-		err = server.processWSConn(ctx, conn, headers, queryParams)
-
-		if env != envValueDev {
+		if env != envValueDev && !keepServing {
 			sessionShouldDecommission = shouldDecommission(err)
 		}
 
-		switch err {
-		case ctx.Err():
-			closeReason = "cancelation"
-		case webtty.ErrSlaveClosed:
-			closeReason = server.factory.Name()
-		case webtty.ErrMasterClosed:
-			closeReason = "client"
+		switch {
+		case err == ctx.Err():
+			closeReason, closeKind = "cancelation", "cancelation"
+		case errors.As(err, &exitErr):
+			closeReason, closeKind = fmt.Sprintf("%s (exit status %d)", server.factory.Name(), exitErr.Code), "exit"
+		case errors.Is(err, webtty.ErrSlaveClosed):
+			closeReason, closeKind = server.factory.Name(), "backend"
+		case errors.Is(err, webtty.ErrMasterClosed):
+			closeReason, closeKind = "client", "client"
+		case errors.Is(err, ErrSessionTerminated):
+			closeReason, closeKind = "termination", "termination"
+		case errors.Is(err, ErrSessionIdle):
+			closeReason, closeKind = "idle timeout", "idle"
+		case errors.Is(err, ErrOutputTrigger):
+			closeReason, closeKind = "output trigger", "trigger"
+		case errors.Is(err, ErrQuotaExceeded):
+			closeReason, closeKind = "bandwidth quota", "quota"
+		case errors.Is(err, webtty.ErrSlowMaster):
+			closeReason, closeKind = "slow client", "slow client"
+		case errors.Is(err, ErrOutsideAccessWindow):
+			closeReason, closeKind = "outside of the access windows", "access window"
+		case errors.Is(err, ErrApprovalDenied), errors.Is(err, ErrApprovalTimeout):
+			closeReason, closeKind = err.Error(), "approval"
 		default:
-			closeReason = fmt.Sprintf("an error: %s", err)
+			closeReason, closeKind = fmt.Sprintf("an error: %s", err), "error"
+			server.metrics.Add(metricErrors, 1, "kind", "session")
 		}
 	}
 }
 
-func (server *Server) processWSConn(ctx context.Context, conn *websocket.Conn, headers map[string][]string, httpQueryParams url.Values) error {
-	typ, initLine, err := conn.ReadMessage()
-	if err != nil {
-		return pkgerrors.Wrapf(err, "failed to authenticate websocket connection")
+// processWSConn runs the session of a WebSocket connection of route, whose
+// page is at pageURL, opened with init. session is completed and its
+// StartedAt set once the backend is started.
+func (server *Server) processWSConn(ctx context.Context, conn *websocket.Conn, route *route, headers map[string][]string, init InitMessage, httpQueryParams url.Values, pageURL string, session *SessionInfo) error {
+	if init.user != "" {
+		session.User = init.user
 	}
-	if typ != websocket.TextMessage {
-		return pkgerrors.New("failed to authenticate websocket connection: invalid message type")
+	if err := init.validate(); err != nil {
+		return err
 	}
-
-	var init InitMessage
-	err = json.Unmarshal(initLine, &init)
-	if err != nil {
-		return pkgerrors.Wrapf(err, "failed to authenticate websocket connection")
+	if err := server.checkAccessWindow(init.AuthToken, session); err != nil {
+		return err
 	}
-	if init.AuthToken != server.options.Credential {
-		return pkgerrors.New("failed to authenticate websocket connection")
+	if err := server.checkQuota(session); err != nil {
+		return err
 	}
-
-	queryPath := "?"
-	if server.options.PermitArguments && init.Arguments != "" {
-		queryPath = init.Arguments
+	if server.options.Approval {
+		if err := server.awaitApproval(ctx, conn, session, pageURL); err != nil {
+			return err
+		}
 	}
 
-	query, err := url.Parse(queryPath)
-	if err != nil {
-		return pkgerrors.Wrapf(err, "failed to parse arguments")
+	var err error
+	params := url.Values{}
+	if server.options.PermitArguments {
+		if params, err = init.params(); err != nil {
+			return err
+		}
 	}
-	params := query.Query()
 
 	// Merge HTTP query parameters with WebSocket init arguments
 	// HTTP query parameters take precedence
 	for key, values := range httpQueryParams {
 		params[key] = values
 	}
-	log.Printf("Final params being passed to factory: %v", params)
+	delete(params, tokenQueryParam)
+	if init.claims != nil && init.claims.Args != nil {
+		params["arg"] = init.claims.Args
+	}
+	if err := server.checkParams(params); err != nil {
+		return err
+	}
+	session.Command = server.sessionCommand(route, params)
+	server.logger.Debug("Final params being passed to factory", "params", params)
 
 	var slave Slave
-	slave, err = server.factory.New(params, headers)
+	if factory, ok := server.factory.(ClientFactory); ok {
+		slave, err = factory.NewForClient(params, headers, init.client())
+	} else {
+		slave, err = server.factory.New(params, headers)
+	}
 	if err != nil {
-		return pkgerrors.Wrapf(err, "failed to create backend")
+		server.metrics.Add(metricErrors, 1, "kind", "backend")
+		return fmt.Errorf("%w: %w", ErrSlaveStartFailed, err)
 	}
-	defer slave.Close()
+	defer func() { slave.Close() }()
+	process, isProcess := slave.(ProcessSlave) // before wrapping it
+	session.Params = params
+	session.Name = init.SessionName
+	session.StartedAt = time.Now()
+	server.sessionStarted(route.path, *session)
 
 	titleVars := server.titleVariables(
 		[]string{"server", "master", "slave"},
 		map[string]map[string]interface{}{
-			"server": server.options.TitleVariables,
+			"server": server.serverVariables(route),
 			"master": map[string]interface{}{
 				"remote_addr": conn.RemoteAddr(),
+				"session_id":  session.ID,
+				"user":        session.User,
+				"groups":      session.Groups,
+				"started_at":  session.StartedAt,
 			},
 			"slave": slave.WindowTitleVariables(),
 		},
 	)
 
 	titleBuf := new(bytes.Buffer)
-	err = server.titleTemplate.Execute(titleBuf, titleVars)
+	err = route.title.Execute(titleBuf, titleVars)
+	if err != nil {
+		return fmt.Errorf("failed to fill window title template: %w", err)
+	}
+
+	activity := newActivity(session.StartedAt)
+	var recording *recordingSlave
+	defer func() {
+		if recording != nil {
+			recording.flush() // counting the redactions of the output kept back
+		}
+		session.BytesIn, session.BytesOut = activity.bytesIn.Load(), activity.bytesOut.Load()
+		session.Redactions = activity.redactions.Load()
+		activity.usage(session)
+	}()
+	if server.options.RecordDir != "" {
+		if recording, err = server.newRecordingSlave(slave, titleBuf.String(), activity); err != nil {
+			return err
+		}
+		slave = recording
+		session.Recording = recording.name
+	}
+	if server.options.RedactLive {
+		slave = &redactingSlave{slaveWrapper: slaveWrapper{slave}, patterns: server.redactPatterns, redactions: &activity.redactions}
+	}
+	if len(server.triggers) > 0 {
+		slave = &triggerSlave{slaveWrapper: slaveWrapper{slave}, server: server, session: session}
+	}
+	slave = &meteredSlave{slaveWrapper: slaveWrapper{slave}, metrics: server.metrics, labels: []string{"path", route.path}, activity: activity}
+	if limits := server.Limits(); limits.SessionQuota > 0 || limits.UserQuota > 0 {
+		slave = &quotaSlave{slaveWrapper: slaveWrapper{slave}, server: server, session: session, limits: limits}
+	}
+	var mirror *mirror
+	if server.options.EnablePresent {
+		mirror = server.newMirror(slave, titleBuf.Bytes(), recording)
+		slave = mirror
+	}
+	motd, err := server.renderMOTD(server.motdVariables(titleVars, init.claims))
 	if err != nil {
-		return pkgerrors.Wrapf(err, "failed to fill window title template")
+		return err
+	}
+	if motd != nil {
+		slave = &motdSlave{slaveWrapper: slaveWrapper{slave}, motd: motd}
 	}
 
 	opts := []webtty.Option{
 		webtty.WithWindowTitle(titleBuf.Bytes()),
+		webtty.WithLogger(server.logger.With("session_id", session.ID)),
 	}
-	if server.options.PermitWrite {
+	if server.inputFilter != nil {
+		opts = append(opts, webtty.WithInputFilter(server.inputFilter))
+	} else if server.options.inputPolicy() == inputWrite {
 		opts = append(opts, webtty.WithPermitWrite())
 	}
 	if server.options.EnableReconnect {
 		opts = append(opts, webtty.WithReconnect(server.options.ReconnectTime))
 	}
-	if server.options.Width > 0 {
-		opts = append(opts, webtty.WithFixedColumns(server.options.Width))
+	if recording != nil && server.options.RecordMarkers {
+		opts = append(opts, webtty.WithMarkerHandler(recording.mark))
+	}
+	fixedColumns, fixedRows := server.options.fixedSize()
+	if fixedColumns > 0 {
+		opts = append(opts, webtty.WithFixedColumns(fixedColumns))
+	}
+	if fixedRows > 0 {
+		opts = append(opts, webtty.WithFixedRows(fixedRows))
 	}
-	if server.options.Height > 0 {
-		opts = append(opts, webtty.WithFixedRows(server.options.Height))
+	if mirror != nil {
+		opts = append(opts, webtty.WithArbitratedSize())
 	}
-	tty, err := webtty.New(&wsWrapper{conn}, slave, opts...)
+	if server.options.WSTimeout > 0 {
+		opts = append(opts, webtty.WithMasterTimeout(time.Duration(server.options.WSTimeout)*time.Second))
+	}
+	if server.options.SlowClientBuffer > 0 {
+		policy := webtty.OutputDrop
+		if server.options.SlowClientPolicy == "disconnect" {
+			policy = webtty.OutputDisconnect
+		}
+		opts = append(opts, webtty.WithOutputBuffer(server.options.SlowClientBuffer<<20, policy))
+		opts = append(opts, webtty.WithOutputSpill(server.outputBudget, int64(server.options.SlowClientSpill)<<20, server.options.SlowClientSpillDir))
+	}
+	var presenter *participant
+	if mirror != nil && (server.options.ShareSelections || server.options.EnableChat) {
+		presenter = mirror.join(session.User)
+		defer presenter.leave()
+		opts = append(opts, server.participantOptions(presenter)...)
+	}
+	// clients with the resume capability may reconnect to the same slave
+	var detachable *detachableSlave
+	var resumeToken string
+	if server.options.EnableReconnect && server.options.ReconnectGrace > 0 && slices.Contains(init.Capabilities, capabilityResume) {
+		detachable = newDetachableSlave(slave)
+		slave = detachable
+		resumeToken = randomstring.Generate(32)
+		opts = append(opts, webtty.WithResumeToken(resumeToken))
+	}
+	newTTY := func(conn *websocket.Conn, init InitMessage) (*webtty.WebTTY, error) {
+		opts := slices.Clip(opts)
+		if init.Columns > 0 && init.Rows > 0 {
+			opts = append(opts, webtty.WithInitialSize(init.Columns, init.Rows))
+		}
+		var ttySlave webtty.Slave = slave
+		if detachable != nil {
+			ttySlave = detachable.attach()
+		}
+		tty, err := webtty.New(&wsWrapper{conn}, ttySlave, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webtty: %w", err)
+		}
+		if mirror != nil {
+			mirror.attach(tty)
+		}
+		if presenter != nil {
+			presenter.attach(tty)
+		}
+		return tty, nil
+	}
+	tty, err := newTTY(conn, init)
 	if err != nil {
-		return pkgerrors.Wrapf(err, "failed to create webtty")
+		return err
+	}
+
+	sessionCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	server.sessions.add(*session, slave, tty, activity, mirror, cancel)
+	defer server.sessions.remove(session.ID)
+	if server.store != nil {
+		defer server.publishSession(*session)()
+	}
+	if timeout := server.Limits().IdleTimeout; timeout > 0 {
+		go server.watchIdle(sessionCtx, time.Duration(timeout)*time.Second, activity, cancel)
+	}
+	if isProcess && server.options.UsageInterval > 0 {
+		go server.watchUsage(sessionCtx, process.Pid(), activity)
 	}
 
-	err = tty.Run(ctx)
+	run := func(tty *webtty.WebTTY) error {
+		err := tty.Run(sessionCtx)
+		if cause := context.Cause(sessionCtx); cause == ErrSessionTerminated || cause == ErrSessionIdle || cause == ErrOutputTrigger || cause == ErrQuotaExceeded {
+			err = cause
+		}
+		return err
+	}
+	err = run(tty)
+	for detachable != nil && errors.Is(err, webtty.ErrMasterClosed) {
+		detachable.detach()
+		server.logger.Info("Client left, keeping its session to resume", "session_id", session.ID, "grace", server.options.ReconnectGrace)
+		request := server.resumes.await(sessionCtx, resumeToken, time.Duration(server.options.ReconnectGrace)*time.Second, detachable.exited)
+		if request == nil {
+			break
+		}
+		permit := tty.PermitWrite()
+		if tty, err = newTTY(request.conn, request.init); err != nil {
+			request.done <- err
+			break
+		}
+		if tty.PermitWrite() != permit { // changed by SessionManager.SetPermitWrite
+			tty.SetPermitWrite(permit)
+		}
+		server.sessions.attach(session.ID, tty)
+		err = run(tty)
+		request.done <- err
+	}
 
 	return err
 }
 
+// acceptInit upgrades the connection of r, with responseHeader if not nil,
+// then reads its InitMessage and authenticates it. Unless the upgrade failed,
+// the connection is returned to be closed by the caller, after sending it the
+// close message of the error, if any.
+func (server *Server) acceptInit(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*websocket.Conn, InitMessage, error) {
+	var init InitMessage
+	conn, err := server.upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, init, err
+	}
+
+	err = checkSubprotocol(r)
+	if err == nil {
+		init, err = readInit(conn)
+	}
+	if err == nil {
+		init.claims, init.user, err = server.authenticateInit(r.Context(), init.AuthToken, server.bearerToken(r))
+		if err != nil {
+			server.authFailed(r.RemoteAddr, err)
+		}
+	}
+	if err != nil {
+		closeWithError(conn, err)
+	}
+	return conn, init, err
+}
+
+// readInit reads the InitMessage opening a connection, whose version must
+// not exceed the one of the negotiated protocol.
+func readInit(conn *websocket.Conn) (InitMessage, error) {
+	var init InitMessage
+	typ, initLine, err := conn.ReadMessage()
+	if err != nil {
+		return init, fmt.Errorf("failed to read init message: %w", err)
+	}
+	if typ != websocket.TextMessage {
+		return init, fmt.Errorf("failed to read init message: invalid message type: %w", ErrInvalidInit)
+	}
+	if err := json.Unmarshal(initLine, &init); err != nil {
+		return init, fmt.Errorf("failed to parse init message: %w: %w", ErrInvalidInit, err)
+	}
+	// later versions are rejected by validate
+	if version := webtty.ProtocolVersion(conn.Subprotocol()); version > 0 && init.Version > version && init.Version <= initMessageVersion {
+		return init, &initError{"Version", fmt.Sprintf("%d is not supported by %s", init.Version, conn.Subprotocol())}
+	}
+	return init, nil
+}
+
 func (server *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
-	indexVars, err := server.indexVariables(r)
+	nonce := server.injections.nonce()
+	indexVars, err := server.indexPageVariables(r, nonce)
 	if err != nil {
 		http.Error(w, "Internal Server Error", 500)
 		return
 	}
 
+	policy, err := server.injections.policy(nonce)
+	if err != nil {
+		http.Error(w, "Internal Server Error", 500)
+		return
+	}
+	if policy != "" {
+		w.Header().Set("Content-Security-Policy", policy)
+	}
+	server.setAffinityCookie(w.Header())
+
+	if landing, err := server.landingWanted(r); landing {
+		server.handleLanding(w, r, indexVars, err)
+		return
+	}
+
 	indexBuf := new(bytes.Buffer)
 	err = server.indexTemplate.Execute(indexBuf, indexVars)
 	if err != nil {
@@ -262,13 +646,12 @@ func shouldDecommission(err error) bool {
 		return true
 	}
 
-	cause := pkgerrors.Cause(err)
-	switch cause {
-	case context.Canceled, context.DeadlineExceeded, webtty.ErrMasterClosed, webtty.ErrSlaveClosed:
-		return true
-	default:
-		return false
+	for _, target := range []error{context.Canceled, context.DeadlineExceeded, webtty.ErrMasterClosed, webtty.ErrSlaveClosed, ErrSessionTerminated, ErrSessionIdle, ErrOutputTrigger, ErrQuotaExceeded} {
+		if errors.Is(err, target) {
+			return true
+		}
 	}
+	return false
 }
 
 func (server *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
@@ -288,45 +671,141 @@ func (server *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
 	w.Write(indexBuf.Bytes())
 }
 
+// indexPageVariables returns the variables of the index page, including the
+// injections with nonce and the assets.
+func (server *Server) indexPageVariables(r *http.Request, nonce string) (map[string]interface{}, error) {
+	indexVars, err := server.indexVariables(r)
+	if err != nil {
+		return nil, err
+	}
+	injectVars, err := server.injections.variables(nonce)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range injectVars {
+		indexVars[key] = val
+	}
+	indexVars["assets"] = server.assets
+	return indexVars, nil
+}
+
+// indexVariables returns the variables of the title format, available to
+// the index page too, and the title.
 func (server *Server) indexVariables(r *http.Request) (map[string]interface{}, error) {
+	route := server.requestRoute(r)
 	titleVars := server.titleVariables(
 		[]string{"server", "master"},
 		map[string]map[string]interface{}{
-			"server": server.options.TitleVariables,
+			"server": server.serverVariables(route),
 			"master": map[string]interface{}{
 				"remote_addr": r.RemoteAddr,
+				"session_id":  "", // not started yet
+				"user":        requestUser(r),
+				"groups":      requestGroups(r),
+				"started_at":  time.Now(),
 			},
 		},
 	)
 
 	titleBuf := new(bytes.Buffer)
-	err := server.titleTemplate.Execute(titleBuf, titleVars)
+	err := route.title.Execute(titleBuf, titleVars)
 	if err != nil {
 		return nil, err
 	}
 
-	indexVars := map[string]interface{}{
-		"title": titleBuf.String(),
-	}
-	return indexVars, err
+	indexVars := titleVars
+	indexVars["title"] = titleBuf.String()
+	indexVars["query"] = template.URL(r.URL.RawQuery) // passed on to config.js for ws_query_args
+	return indexVars, nil
 }
 
 func (server *Server) handleAuthToken(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/javascript")
 	// @TODO hashing?
-	w.Write([]byte("var gotty_auth_token = '" + server.options.Credential + "';"))
+	authToken, _ := r.Context().Value(authTokenKey).(string)
+	if token, ok := r.Context().Value(accessTokenKey).(string); ok {
+		authToken = token
+	}
+	w.Write([]byte("var gotty_auth_token = '" + authToken + "';"))
 }
 
 func (server *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/javascript")
+	queryArgs, err := server.wsQueryArgs(r)
+	if err != nil {
+		server.logger.Warn("Failed to render websocket query arguments", "error", err, "remote_addr", r.RemoteAddr)
+	}
+	quoted, _ := json.Marshal(queryArgs)
+	present, playback, watch := server.presentConfig(r), server.playbackConfig(r), server.watchConfig(r)
+	endpoint := server.wsURL(r)
+	if present != "null" || playback != "null" || watch != "null" {
+		endpoint = "" // presentation, playback and watch views connect next to their page
+	}
+	if watch != "null" {
+		present = watch // shown as presented, without participating
+	}
+	wsURL, _ := json.Marshal(endpoint)
 	lines := []string{
 		"var gotty_term = 'xterm';",
-		"var gotty_ws_query_args = '" + server.options.WSQueryArgs + "';",
+		"var gotty_ws_query_args = " + string(quoted) + ";",
+		"var gotty_ws_url = " + string(wsURL) + ";",
+		"var gotty_present = " + present + ";",
+		"var gotty_playback = " + playback + ";",
+		"var gotty_share_selections = " + strconv.FormatBool(server.options.ShareSelections && playback == "null" && watch == "null") + ";",
+		"var gotty_chat = " + strconv.FormatBool(server.options.EnableChat && playback == "null" && watch == "null") + ";",
+		"var gotty_markers = " + strconv.FormatBool(server.options.RecordMarkers && server.options.RecordDir != "" && present == "null" && playback == "null") + ";",
 	}
 
 	w.Write([]byte(strings.Join(lines, "\n")))
 }
 
+// wsURL returns the URL of the WebSocket endpoint for r, a request of
+// config.js, or "" when it is next to the page.
+func (server *Server) wsURL(r *http.Request) string {
+	if server.options.WSURL != "" {
+		return server.options.WSURL
+	}
+	port := server.wsPort
+	if port == "" {
+		port = server.options.WSPort
+	}
+	if port == "" {
+		return ""
+	}
+	scheme := "ws"
+	if server.options.EnableTLS {
+		scheme = "wss"
+	}
+	return scheme + "://" + net.JoinHostPort(requestHostname(r), port) + strings.TrimSuffix(r.URL.Path, "config.js") + "ws"
+}
+
+// requestHostname returns the host of r without its port.
+func requestHostname(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.Trim(host, "[]")
+}
+
+// wsQueryArgs renders WSQueryArgs for r, a request of config.js with the
+// query of the index page, returning "" unless it renders a valid query.
+func (server *Server) wsQueryArgs(r *http.Request) (string, error) {
+	vars := map[string]interface{}{
+		"path":  strings.TrimSuffix(r.URL.Path, "config.js"),
+		"query": r.URL.Query(),
+		"user":  requestUser(r),
+	}
+	buf := new(bytes.Buffer)
+	if err := server.wsQueryTemplate.Execute(buf, vars); err != nil {
+		return "", err
+	}
+	if _, err := url.ParseQuery(buf.String()); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
 // titleVariables merges maps in a specified order.
 // varUnits are name-keyed maps, whose names will be iterated using order.
 func (server *Server) titleVariables(order []string, varUnits map[string]map[string]interface{}) map[string]interface{} {
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// passedHeader is a request header passed to the factory under name.
+type passedHeader struct {
+	header string
+	name   string
+}
+
+// parsePassHeaders parses specs of PassHeaders, NAME or NAME=RENAMED.
+func parsePassHeaders(specs []string) ([]passedHeader, error) {
+	passed := make([]passedHeader, 0, len(specs))
+	for _, spec := range specs {
+		header, name, renamed := strings.Cut(strings.TrimSpace(spec), "=")
+		if !renamed {
+			name = header
+		}
+		if !validHeaderName(header) || !validHeaderName(name) {
+			return nil, fmt.Errorf("invalid header to pass `%s`, expected NAME or NAME=RENAMED", spec)
+		}
+		passed = append(passed, passedHeader{header: http.CanonicalHeaderKey(header), name: name})
+	}
+	return passed, nil
+}
+
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// passHeaders returns the headers of r to pass to the factory, leaving out
+// those longer than PassHeaderSize and, in order, those exceeding
+// PassHeadersSize in total, and the user and groups given by a trusted proxy
+// or, with Options.OIDCPassUser, the OpenID Connect provider as User and
+// Groups.
+func (server *Server) passHeaders(r *http.Request) map[string][]string {
+	id, identified := r.Context().Value(identityKey).(*identity)
+	identified = identified && id.pass
+	if len(server.passedHeaders) == 0 && !identified {
+		return nil
+	}
+	headers := make(map[string][]string, len(server.passedHeaders)+2)
+	total := 0
+	for _, passed := range server.passedHeaders {
+		values := r.Header.Values(passed.header)
+		if len(values) == 0 {
+			continue
+		}
+		size := len(passed.name)
+		for _, value := range values {
+			size += len(value)
+		}
+		if limit := server.options.PassHeaderSize; limit > 0 && size > limit {
+			server.logger.Warn("Header too large to be passed", "header", passed.header, "size", size, "remote_addr", r.RemoteAddr)
+			continue
+		}
+		if limit := server.options.PassHeadersSize; limit > 0 && total+size > limit {
+			server.logger.Warn("Headers too large to be passed", "header", passed.header, "size", total+size, "remote_addr", r.RemoteAddr)
+			continue
+		}
+		total += size
+		headers[passed.name] = append(headers[passed.name], values...)
+	}
+	if identified {
+		headers["User"] = []string{id.user}
+		if len(id.groups) > 0 {
+			headers["Groups"] = []string{strings.Join(id.groups, ",")}
+		}
+	}
+	return headers
+}
@@ -1,8 +1,14 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 )
 
 func (server *Server) markUnhealthy() {
@@ -13,12 +19,127 @@ func (server *Server) isUnhealthy() bool {
 	return atomic.LoadInt32(&server.unhealthy) == 1
 }
 
-func (server *Server) wrapUnhealthy(handler http.Handler) http.Handler {
+// singleUse returns whether the server exits after its first client.
+func (server *Server) singleUse() bool {
+	return server.options.Once || server.options.Pod
+}
+
+// multiSession returns whether the server runs several sessions at a time,
+// serving new ones as others end, rather than ending with its session.
+func (server *Server) multiSession() bool {
+	return server.Limits().MaxSessions != 1 && !server.singleUse()
+}
+
+// isReady returns whether the server accepts a new session.
+func (server *Server) isReady() bool {
+	if server.isUnhealthy() || server.isDraining() || atomic.LoadInt32(&server.terminating) == 1 {
+		return false
+	}
+	server.sessionMu.Lock()
+	defer server.sessionMu.Unlock()
+	maxSessions := server.Limits().MaxSessions
+	if server.singleUse() {
+		maxSessions = 1
+	}
+	return !server.closing && !server.decommissioned && (maxSessions == 0 || len(server.sessions.Admitted()) < maxSessions)
+}
+
+// healthStates are the states reported by /healthz, by precedence.
+var healthStates = []string{"decommissioned", "draining", "busy", "ok"}
+
+// health is the JSON of /healthz.
+type health struct {
+	Status          string  `json:"status"` // one of healthStates
+	Decommissioned  bool    `json:"decommissioned"`
+	Draining        bool    `json:"draining"`
+	Sessions        int     `json:"sessions"`
+	UptimeSeconds   float64 `json:"uptime_seconds"`
+	LastCloseReason string  `json:"last_close_reason,omitempty"`
+}
+
+func (server *Server) health() health {
+	server.sessionMu.Lock()
+	h := health{
+		Decommissioned:  server.decommissioned || server.isUnhealthy() || atomic.LoadInt32(&server.terminating) == 1,
+		Draining:        server.isDraining(),
+		Sessions:        len(server.sessions.List()),
+		UptimeSeconds:   time.Since(server.started).Seconds(),
+		LastCloseReason: server.lastCloseReason,
+	}
+	active := len(server.sessions.Admitted()) > 0
+	server.sessionMu.Unlock()
+
+	switch {
+	case h.Decommissioned:
+		h.Status = "decommissioned"
+	case h.Draining:
+		h.Status = "draining"
+	case active || h.Sessions > 0:
+		h.Status = "busy"
+	default:
+		h.Status = "ok"
+	}
+	return h
+}
+
+// healthStatus returns the HTTP status of state, set by
+// Options.HealthStatuses.
+func (server *Server) healthStatus(state string) int {
+	if status, ok := server.healthStatuses[state]; ok {
+		return status
+	}
+	return http.StatusOK
+}
+
+// parseHealthStatuses parses state=status pairs separated by commas, e.g.
+// "decommissioned=503,draining=503".
+func parseHealthStatuses(s string) (map[string]int, error) {
+	statuses := map[string]int{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		state, value, _ := strings.Cut(pair, "=")
+		if !slices.Contains(healthStates, state) {
+			return nil, fmt.Errorf("unknown health state `%s`, expected one of %s", state, strings.Join(healthStates, ", "))
+		}
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 100 || status > 599 {
+			return nil, fmt.Errorf("invalid HTTP status `%s` of health state %s", value, state)
+		}
+		statuses[state] = status
+	}
+	return statuses, nil
+}
+
+func (server *Server) startDraining() {
+	atomic.StoreInt32(&server.draining, 1)
+}
+
+func (server *Server) isDraining() bool {
+	return atomic.LoadInt32(&server.draining) == 1
+}
+
+// wrapProbes serves the state of the server as JSON at /healthz, with the
+// status of Options.HealthStatuses, and the readiness probe of Kubernetes
+// at /readyz, without authentication.
+func (server *Server) wrapProbes(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if server.isUnhealthy() {
-			http.Error(w, "session closed", http.StatusInternalServerError)
-			return
+		switch r.URL.Path {
+		case "/healthz":
+			h := server.health()
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(server.healthStatus(h.Status))
+			json.NewEncoder(w).Encode(h)
+		case "/readyz":
+			if !server.isReady() {
+				http.Error(w, "not ready", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok\n"))
+		default:
+			handler.ServeHTTP(w, r)
 		}
-		handler.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+)
+
+// hostCertificates loads the certificates of Options.TLSHosts by hostname.
+func (options *Options) hostCertificates() (map[string]*tls.Certificate, error) {
+	certificates := map[string]*tls.Certificate{}
+	for _, s := range options.TLSHosts {
+		host, files, ok := strings.Cut(s, "=")
+		crtFile, keyFile, ok2 := strings.Cut(files, ",")
+		if !ok || !ok2 || host == "" {
+			return nil, fmt.Errorf("invalid TLS host `%s`, expected HOST=CRT_FILE,KEY_FILE", s)
+		}
+		crtFile, keyFile = homedir.Expand(crtFile), homedir.Expand(keyFile)
+		pair, err := tls.LoadX509KeyPair(crtFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS crt file `%s` and key file `%s` of %s: %w", crtFile, keyFile, host, err)
+		}
+		certificates[strings.ToLower(host)] = &pair
+	}
+	return certificates, nil
+}
+
+// lookupHost returns the value of hostname in values, by its name or else
+// a wildcard of its parent domain, e.g. *.example.com.
+func lookupHost[T any](values map[string]T, hostname string) (T, bool) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if value, ok := values[hostname]; ok {
+		return value, true
+	}
+	if _, parent, ok := strings.Cut(hostname, "."); ok {
+		if value, ok := values["*."+parent]; ok {
+			return value, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// getCertificate returns the certificate of the hostname given by SNI, or
+// that of the secrets or else of Options.TLSCrtFile.
+func (server *Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if certificate, ok := lookupHost(server.hostCertificates, hello.ServerName); ok {
+		return certificate, nil
+	}
+	if server.tlsFromSecrets() {
+		return server.secrets.getCertificate(hello)
+	}
+	return nil, nil // of the files given to ServeTLS
+}
+
+// wrapHosts passes the requests of the hostnames of WithHostHandler to
+// their handlers, by the hostname given by SNI, and the others to handler.
+// A request for another host than its SNI is misdirected, so that it cannot
+// reach a host under the certificate and policy of another.
+func (server *Server) wrapHosts(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hostname := requestHostname(r)
+		if r.TLS != nil && r.TLS.ServerName != "" {
+			if !strings.EqualFold(strings.TrimSuffix(hostname, "."), strings.TrimSuffix(r.TLS.ServerName, ".")) {
+				http.Error(w, http.StatusText(http.StatusMisdirectedRequest), http.StatusMisdirectedRequest)
+				return
+			}
+			hostname = r.TLS.ServerName
+		}
+		if hostHandler, ok := lookupHost(server.hostHandlers, hostname); ok {
+			hostHandler.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// identity is a client identified by the headers of a trusted proxy, see
+// Options.TrustedProxies, or signed in with Options.OIDCIssuer.
+type identity struct {
+	user   string
+	groups []string
+	pass   bool // to the factory as headers
+}
+
+// trustedProxies returns the addresses of Options.TrustedProxies.
+func (options *Options) trustedProxies() ([]netip.Prefix, error) {
+	proxies := make([]netip.Prefix, 0, len(options.TrustedProxies))
+	for _, s := range options.TrustedProxies {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy `%s`, expected an IP address or CIDR", s)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// trustedProxy tells whether remoteAddr is one of the trusted proxies.
+func (server *Server) trustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return slices.ContainsFunc(server.trustedProxies, func(prefix netip.Prefix) bool { return prefix.Contains(addr) })
+}
+
+// wrapTrustedProxies identifies clients by the headers of the trusted
+// proxies, refusing the requests of other addresses, without a user or not
+// in Options.AllowGroups.
+func (server *Server) wrapTrustedProxies(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !server.trustedProxy(r.RemoteAddr) {
+			server.authFailed(r.RemoteAddr, fmt.Errorf("%w: not a trusted proxy", ErrAuthFailed))
+			writeError(w, ErrAuthFailed)
+			return
+		}
+		id := &identity{user: r.Header.Get(server.options.TrustedUserHeader), pass: true}
+		if id.user == "" {
+			server.authFailed(r.RemoteAddr, fmt.Errorf("%w: no %s header", ErrAuthFailed, server.options.TrustedUserHeader))
+			writeError(w, ErrAuthFailed)
+			return
+		}
+		for _, value := range r.Header.Values(server.options.TrustedGroupsHeader) {
+			for _, group := range strings.Split(value, ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					id.groups = append(id.groups, group)
+				}
+			}
+		}
+		if !server.allowedGroups(id.groups) {
+			server.authFailed(r.RemoteAddr, fmt.Errorf("%w: user %s in none of the allowed groups", ErrAuthFailed, id.user))
+			writeError(w, ErrAuthFailed)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, id)))
+	})
+}
+
+// allowedGroups tells whether a user of groups is let in by
+// Options.AllowGroups.
+func (server *Server) allowedGroups(groups []string) bool {
+	return len(server.options.AllowGroups) == 0 || slices.ContainsFunc(groups, func(group string) bool { return slices.Contains(server.options.AllowGroups, group) })
+}
+
+// requestGroups returns the groups of the user of r, given by a trusted
+// proxy or the OpenID Connect provider.
+func requestGroups(r *http.Request) []string {
+	if id, ok := r.Context().Value(identityKey).(*identity); ok {
+		return id.groups
+	}
+	return nil
+}
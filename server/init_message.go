@@ -1,6 +1,164 @@
 package server
 
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"unicode"
+
+	"github.com/sorenisanerd/gotty/pkg/accesstoken"
+)
+
+// InitMessage is the first message of clients on their WebSocket connection.
+// Clients set Version to 2 to send the typed fields; Arguments is still
+// accepted from older clients.
 type InitMessage struct {
+	// Arguments is the query of the page, e.g. "?arg=ls", parsed into
+	// parameters with Options.PermitArguments.
+	//
+	// Deprecated: set Args and Params instead.
 	Arguments string `json:"Arguments,omitempty"`
 	AuthToken string `json:"AuthToken,omitempty"`
+
+	Version int `json:"Version,omitempty"`
+	// Args are arguments of the command and Params parameters for the
+	// factory, both ignored unless Options.PermitArguments.
+	Args   []string            `json:"Args,omitempty"`
+	Params map[string][]string `json:"Params,omitempty"`
+	// Columns and Rows are the initial size of the terminal, 0 if unknown.
+	Columns int `json:"Columns,omitempty"`
+	Rows    int `json:"Rows,omitempty"`
+	// Timezone is an IANA time zone, e.g. Europe/Paris.
+	Timezone string `json:"Timezone,omitempty"`
+	// Locale is a BCP 47 language tag, e.g. en-US.
+	Locale string `json:"Locale,omitempty"`
+	// SessionName is a name for the session, shown in session listings.
+	SessionName string `json:"SessionName,omitempty"`
+	// Capabilities are protocol features supported by the client.
+	Capabilities []string `json:"Capabilities,omitempty"`
+	// ResumeToken resumes the session the client lost its connection to,
+	// given to clients with the resume capability.
+	ResumeToken string `json:"ResumeToken,omitempty"`
+
+	// claims and user authenticate the message, see acceptInit.
+	claims *accesstoken.Claims
+	user   string
+}
+
+// ClientInfo is what a client tells about itself in its InitMessage.
+type ClientInfo struct {
+	Columns      int
+	Rows         int
+	Timezone     string
+	Locale       string
+	SessionName  string
+	Capabilities []string
+}
+
+// ClientFactory is a Factory that also receives the ClientInfo of clients.
+type ClientFactory interface {
+	Factory
+	NewForClient(params map[string][]string, headers map[string][]string, client ClientInfo) (Slave, error)
+}
+
+// initMessageVersion is the latest version of InitMessage.
+const initMessageVersion = 2
+
+const (
+	maxTerminalSize   = 10000
+	maxSessionName    = 64
+	maxCapabilities   = 32
+	maxInitFieldBytes = 64
+)
+
+var (
+	timezonePattern   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_+\-]*(/[A-Za-z0-9_+\-]+)*$`)
+	localePattern     = regexp.MustCompile(`^[A-Za-z]{2,8}([-_][A-Za-z0-9]{1,8})*$`)
+	capabilityPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+// initError is an invalid field of an InitMessage, reported to the client.
+type initError struct {
+	field  string
+	reason string
+}
+
+func (e *initError) Error() string {
+	return fmt.Sprintf("invalid init message: %s %s", e.field, e.reason)
+}
+
+func (e *initError) Unwrap() error { return ErrInvalidInit }
+
+// validate checks the fields of init.
+func (init *InitMessage) validate() error {
+	if init.Version < 0 || init.Version > initMessageVersion {
+		return &initError{"Version", fmt.Sprintf("%d is not supported, expected up to %d", init.Version, initMessageVersion)}
+	}
+	if init.Columns < 0 || init.Columns > maxTerminalSize || init.Rows < 0 || init.Rows > maxTerminalSize {
+		return &initError{"Columns and Rows", fmt.Sprintf("must be between 1 and %d", maxTerminalSize)}
+	}
+	if (init.Columns == 0) != (init.Rows == 0) {
+		return &initError{"Columns and Rows", "must be given together"}
+	}
+	if init.Timezone != "" && (len(init.Timezone) > maxInitFieldBytes || !timezonePattern.MatchString(init.Timezone)) {
+		return &initError{"Timezone", "is not an IANA time zone"}
+	}
+	if init.Locale != "" && (len(init.Locale) > maxInitFieldBytes || !localePattern.MatchString(init.Locale)) {
+		return &initError{"Locale", "is not a language tag"}
+	}
+	if len([]rune(init.SessionName)) > maxSessionName {
+		return &initError{"SessionName", fmt.Sprintf("is longer than %d characters", maxSessionName)}
+	}
+	for _, c := range init.SessionName {
+		if !unicode.IsPrint(c) {
+			return &initError{"SessionName", "has non printable characters"}
+		}
+	}
+	if len(init.Capabilities) > maxCapabilities {
+		return &initError{"Capabilities", fmt.Sprintf("has more than %d entries", maxCapabilities)}
+	}
+	for _, capability := range init.Capabilities {
+		if len(capability) > maxInitFieldBytes || !capabilityPattern.MatchString(capability) {
+			return &initError{"Capabilities", fmt.Sprintf("has an invalid entry `%.32s`", capability)}
+		}
+	}
+	if len(init.ResumeToken) > maxInitFieldBytes {
+		return &initError{"ResumeToken", fmt.Sprintf("is longer than %d bytes", maxInitFieldBytes)}
+	}
+	return nil
+}
+
+// params returns the parameters sent by the client, from Args and Params,
+// or from Arguments for older clients.
+func (init *InitMessage) params() (url.Values, error) {
+	if init.Args == nil && init.Params == nil {
+		if init.Arguments == "" {
+			return url.Values{}, nil
+		}
+		query, err := url.Parse(init.Arguments)
+		if err != nil {
+			return nil, &initError{"Arguments", "is not a query"}
+		}
+		return query.Query(), nil
+	}
+	params := url.Values{}
+	for key, values := range init.Params {
+		params[key] = values
+	}
+	if init.Args != nil {
+		params["arg"] = init.Args
+	}
+	return params, nil
+}
+
+// client returns the ClientInfo of init.
+func (init *InitMessage) client() ClientInfo {
+	return ClientInfo{
+		Columns:      init.Columns,
+		Rows:         init.Rows,
+		Timezone:     init.Timezone,
+		Locale:       init.Locale,
+		SessionName:  init.SessionName,
+		Capabilities: init.Capabilities,
+	}
 }
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	noesctmpl "text/template"
+
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+	"github.com/sorenisanerd/gotty/pkg/randomstring"
+)
+
+const nonceLength = 24
+
+// injections holds the operator supplied assets added to the index page.
+// Snippets and the CSP header are templates so they can refer to {{ .nonce }}.
+type injections struct {
+	scripts     []string
+	stylesheets []string
+	head        *noesctmpl.Template
+	body        *noesctmpl.Template
+	csp         *noesctmpl.Template
+}
+
+func newInjections(options *Options) (*injections, error) {
+	inj := &injections{
+		scripts:     options.InjectScripts,
+		stylesheets: options.InjectStylesheets,
+	}
+
+	var err error
+	if inj.head, err = loadSnippet("head", options.InjectHeadFile); err != nil {
+		return nil, err
+	}
+	if inj.body, err = loadSnippet("body", options.InjectBodyFile); err != nil {
+		return nil, err
+	}
+
+	if options.ContentSecurityPolicy != "" {
+		inj.csp, err = noesctmpl.New("csp").Parse(options.ContentSecurityPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse content security policy `%s`: %w", options.ContentSecurityPolicy, err)
+		}
+	}
+
+	return inj, nil
+}
+
+func loadSnippet(name string, file string) (*noesctmpl.Template, error) {
+	if file == "" {
+		return nil, nil
+	}
+	path := homedir.Expand(file)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s snippet at `%s`: %w", name, path, err)
+	}
+	tmpl, err := noesctmpl.New(name).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s snippet at `%s`: %w", name, path, err)
+	}
+	return tmpl, nil
+}
+
+// nonce returns a fresh nonce when a CSP is configured, and "" otherwise.
+func (inj *injections) nonce() string {
+	if inj.csp == nil {
+		return ""
+	}
+	return randomstring.Generate(nonceLength)
+}
+
+// variables returns the index template variables for the injected assets.
+func (inj *injections) variables(nonce string) (map[string]interface{}, error) {
+	vars := map[string]interface{}{
+		"nonce":       nonce,
+		"scripts":     inj.scripts,
+		"stylesheets": inj.stylesheets,
+	}
+
+	for key, tmpl := range map[string]*noesctmpl.Template{"head": inj.head, "body": inj.body} {
+		if tmpl == nil {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, map[string]interface{}{"nonce": nonce}); err != nil {
+			return nil, fmt.Errorf("failed to fill %s snippet: %w", key, err)
+		}
+		// Snippets come from the operator, not from clients, so they are trusted.
+		vars[key] = template.HTML(buf.String())
+	}
+
+	return vars, nil
+}
+
+// policy returns the Content-Security-Policy header value for the given nonce.
+func (inj *injections) policy(nonce string) (string, error) {
+	if inj.csp == nil {
+		return "", nil
+	}
+	buf := new(bytes.Buffer)
+	if err := inj.csp.Execute(buf, map[string]interface{}{"nonce": nonce}); err != nil {
+		return "", fmt.Errorf("failed to fill content security policy: %w", err)
+	}
+	return buf.String(), nil
+}
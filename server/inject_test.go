@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestInjections(t *testing.T) {
+	head := filepath.Join(t.TempDir(), "head.html")
+	os.WriteFile(head, []byte(`<style nonce="{{ .nonce }}">body { color: red; }</style>`), 0o600)
+
+	for _, csp := range []string{"", "script-src 'nonce-{{ .nonce }}'; style-src 'nonce-{{ .nonce }}'"} {
+		options := &Options{
+			TitleFormat:           "gotty",
+			InjectScripts:         []string{"https://example.com/analytics.js"},
+			InjectStylesheets:     []string{"https://example.com/brand.css"},
+			InjectHeadFile:        head,
+			ContentSecurityPolicy: csp,
+		}
+		server, err := New(options, WithFactory(echoFactory{}))
+		if err != nil {
+			t.Fatalf("New() returned error: %v", err)
+		}
+		get := func() *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			server.handleIndex(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("index returned status %d", recorder.Code)
+			}
+			return recorder
+		}
+
+		resp := get()
+		index := resp.Body.String()
+		for _, injected := range []string{`<script src="https://example.com/analytics.js"`, `<link rel="stylesheet" href="https://example.com/brand.css"`, `body { color: red; }`} {
+			if !strings.Contains(index, injected) {
+				t.Errorf("index = %s, expected `%s` to be injected", index, injected)
+			}
+		}
+
+		policy := resp.Header().Get("Content-Security-Policy")
+		if csp == "" {
+			if policy != "" || regexp.MustCompile(`nonce="[^"]`).MatchString(index) {
+				t.Errorf("Content-Security-Policy = %q, index = %s, expected neither policy nor nonce", policy, index)
+			}
+			continue
+		}
+		match := regexp.MustCompile(`^script-src 'nonce-([^']+)'; `).FindStringSubmatch(policy)
+		if match == nil || policy != "script-src 'nonce-"+match[1]+"'; style-src 'nonce-"+match[1]+"'" {
+			t.Fatalf("Content-Security-Policy = %q, expected the nonce", policy)
+		}
+		nonce := match[1]
+		// every script and stylesheet, those of GoTTY included, has the nonce
+		for _, tag := range regexp.MustCompile(`<script[^>]*>|<style[^>]*>|<link rel="stylesheet"[^>]*>`).FindAllString(index, -1) {
+			if !strings.Contains(tag, `nonce="`+nonce+`"`) {
+				t.Errorf("%s has no nonce %s", tag, nonce)
+			}
+		}
+
+		if get().Header().Get("Content-Security-Policy") == policy {
+			t.Error("the nonce is the same for two requests")
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// Policies of Options.InputPolicy.
+const (
+	inputWrite    = "write"
+	inputReadOnly = "read-only"
+	inputScroll   = "scroll"
+	inputAllow    = "allow"
+)
+
+// inputPolicy returns Options.InputPolicy, or the one of Options.PermitWrite
+// when empty.
+func (options *Options) inputPolicy() string {
+	if options.InputPolicy != "" {
+		return options.InputPolicy
+	}
+	if options.PermitWrite {
+		return inputWrite
+	}
+	return inputReadOnly
+}
+
+// inputFilter returns the filter of the input policy, nil when the policy
+// passes all or none of the input.
+func (options *Options) inputFilter() (webtty.InputFilter, error) {
+	keys := make([]string, 0, len(options.InputAllow))
+	for _, spec := range options.InputAllow {
+		key, err := parseInputKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	switch policy := options.inputPolicy(); policy {
+	case inputWrite, inputReadOnly:
+		if len(keys) > 0 {
+			return nil, fmt.Errorf("--input-allow requires --input-policy allow or scroll, not %s", policy)
+		}
+		return nil, nil
+	case inputScroll:
+		return webtty.AllowInput(append(keys, webtty.ScrollKeys...)...), nil
+	case inputAllow:
+		if len(keys) == 0 {
+			return nil, errors.New("--input-policy allow requires keys to allow with --input-allow")
+		}
+		return webtty.AllowInput(keys...), nil
+	default:
+		return nil, fmt.Errorf("invalid input policy `%s`, expected write, read-only, scroll or allow", policy)
+	}
+}
+
+// parseInputKey parses a key of Options.InputAllow: ^X for Ctrl+X, or
+// a string with Go escapes and \e for the escape character.
+func parseInputKey(spec string) (string, error) {
+	if utf8.RuneCountInString(spec) == 1 {
+		return spec, nil
+	}
+	if len(spec) == 2 && spec[0] == '^' {
+		switch c := spec[1]; {
+		case c == '?':
+			return "\x7f", nil
+		case c >= '@' && c <= '_':
+			return string(rune(c - '@')), nil
+		case c >= 'a' && c <= 'z':
+			return string(rune(c - 'a' + 1)), nil
+		}
+	}
+	key, err := strconv.Unquote(`"` + strings.ReplaceAll(spec, `\e`, `\x1b`) + `"`)
+	if err != nil || key == "" {
+		return "", fmt.Errorf("invalid key to allow `%s`, expected a character, ^X or an escape sequence", spec)
+	}
+	return key, nil
+}
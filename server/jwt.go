@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+	"github.com/sorenisanerd/gotty/pkg/jwt"
+)
+
+// jwtVerifier returns the verifier of the JWTs of Options.JWTSecret,
+// Options.JWTPublicKeyFile and Options.JWTJWKSURL, nil without them.
+func (options *Options) jwtVerifier() (*jwt.Verifier, error) {
+	if options.JWTSecret == "" && options.JWTPublicKeyFile == "" && options.JWTJWKSURL == "" {
+		return nil, nil
+	}
+	if options.JWTUserClaim == "" {
+		return nil, errors.New("--jwt-user-claim cannot be empty")
+	}
+	config := jwt.Config{
+		Secret:   []byte(options.JWTSecret),
+		JWKSURL:  options.JWTJWKSURL,
+		Issuer:   options.JWTIssuer,
+		Audience: options.JWTAudience,
+	}
+	if options.JWTPublicKeyFile != "" {
+		path := homedir.Expand(options.JWTPublicKeyFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not open JWT public key file `%s`: %w", path, err)
+		}
+		key, err := jwt.ParsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse JWT public key file `%s`: %w", path, err)
+		}
+		config.PublicKeys = append(config.PublicKeys, key)
+	}
+	return jwt.New(config), nil
+}
+
+// bearerToken returns the token of the Authorization header of r with JWTs,
+// if any.
+func (server *Server) bearerToken(r *http.Request) string {
+	if server.jwt == nil {
+		return ""
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// verifyJWT verifies token and returns its user, in Options.JWTUserClaim.
+func (server *Server) verifyJWT(ctx context.Context, token string) (string, error) {
+	claims, err := server.jwt.Verify(ctx, token, time.Now())
+	if err != nil {
+		return "", err
+	}
+	user := claims.String(server.options.JWTUserClaim)
+	if user == "" {
+		return "", fmt.Errorf("%w: no %s claim", jwt.ErrInvalid, server.options.JWTUserClaim)
+	}
+	return user, nil
+}
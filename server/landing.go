@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// landingParam is a field of the landing page.
+type landingParam struct {
+	Param
+	Value string // given, or the default
+	Error string // of the server
+}
+
+// hiddenParam is a query parameter the landing page passes on.
+type hiddenParam struct {
+	Name, Value string
+}
+
+// landingWanted tells whether the index page shows the landing page for r,
+// with Options.ParamForm when none of the parameters are given or one fails
+// its check, returning the failure.
+func (server *Server) landingWanted(r *http.Request) (bool, error) {
+	if !server.options.ParamForm || len(server.params) == 0 {
+		return false, nil
+	}
+	query := r.URL.Query()
+	if !slices.ContainsFunc(server.params, func(p param) bool { return query.Has(p.Name) }) {
+		return true, nil
+	}
+	if err := server.checkParams(query); err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
+// handleLanding serves the landing page collecting the parameters, which
+// opens the terminal with them, showing err, the failed check of the
+// parameters of r, if any.
+func (server *Server) handleLanding(w http.ResponseWriter, r *http.Request, indexVars map[string]interface{}, err error) {
+	query := r.URL.Query()
+	var paramErr *paramError
+	errors.As(err, &paramErr)
+	params := make([]landingParam, 0, len(server.params))
+	for _, p := range server.params {
+		field := landingParam{Param: p.Param, Value: p.Default}
+		if query.Has(p.Name) {
+			field.Value = query.Get(p.Name)
+		}
+		if paramErr != nil && paramErr.name == p.Name {
+			field.Error = paramErr.reason
+		}
+		params = append(params, field)
+		query.Del(p.Name)
+	}
+	var hidden []hiddenParam
+	for _, name := range slices.Sorted(maps.Keys(query)) {
+		for _, value := range query[name] {
+			hidden = append(hidden, hiddenParam{name, value})
+		}
+	}
+	indexVars["params"] = params
+	indexVars["hidden"] = hidden
+
+	buf := new(bytes.Buffer)
+	if err := server.landingTemplate.Execute(buf, indexVars); err != nil {
+		http.Error(w, "Internal Server Error", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
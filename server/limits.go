@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Limits are the limits of a Server that can be changed while it runs,
+// applying to the sessions started after the change.
+type Limits struct {
+	MaxConnection int `json:"max_connection"` // 0 for no limit
+	MaxSessions   int `json:"max_sessions"`   // running at the same time, 0 for no limit
+	IdleTimeout   int `json:"idle_timeout"`   // in seconds, 0 to disable
+	SessionQuota  int `json:"session_quota"`  // in megabytes, 0 for no limit
+	UserQuota     int `json:"user_quota"`     // in megabytes, 0 for no limit
+}
+
+// Limits returns the limits given by the options.
+func (options *Options) Limits() Limits {
+	return Limits{
+		MaxConnection: options.MaxConnection,
+		MaxSessions:   options.MaxSessions,
+		IdleTimeout:   options.IdleTimeout,
+		SessionQuota:  options.SessionQuota,
+		UserQuota:     options.UserQuota,
+	}
+}
+
+func (limits Limits) validate() error {
+	if limits.MaxConnection < 0 || limits.MaxSessions < 0 || limits.IdleTimeout < 0 || limits.SessionQuota < 0 || limits.UserQuota < 0 {
+		return errors.New("limits must not be negative")
+	}
+	return nil
+}
+
+// Limits returns the current limits of the server.
+func (server *Server) Limits() Limits {
+	return *server.limits.Load()
+}
+
+// SetLimits changes the limits of the server for the sessions started
+// from now on.
+func (server *Server) SetLimits(limits Limits) error {
+	if err := limits.validate(); err != nil {
+		return err
+	}
+	if previous := server.limits.Swap(&limits); previous != nil && *previous != limits {
+		server.logger.Info("Limits changed", "max_connection", limits.MaxConnection, "max_sessions", limits.MaxSessions, "idle_timeout", limits.IdleTimeout,
+			"session_quota", limits.SessionQuota, "user_quota", limits.UserQuota)
+	}
+	server.metrics.Set(metricLimit, float64(limits.MaxConnection), "limit", "max_connection")
+	server.metrics.Set(metricLimit, float64(limits.MaxSessions), "limit", "max_sessions")
+	server.metrics.Set(metricLimit, float64(limits.IdleTimeout), "limit", "idle_timeout")
+	server.metrics.Set(metricLimit, float64(limits.SessionQuota), "limit", "session_quota")
+	server.metrics.Set(metricLimit, float64(limits.UserQuota), "limit", "user_quota")
+	return nil
+}
+
+// handleAdminLimits reports the limits, changing those given first on PUT.
+func (server *Server) handleAdminLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		limits := server.Limits() // those not given are kept
+		if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+			http.Error(w, "Malformed request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := server.SetLimits(limits); err != nil {
+			http.Error(w, "Malformed request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		server.logger.Info("Limits changed by the admin API", "remote_addr", r.RemoteAddr)
+	}
+	writeJSON(w, server.Limits())
+}
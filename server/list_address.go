@@ -15,11 +15,8 @@ func listAddresses() (addresses []string) {
 	for _, iface := range ifaces {
 		ifAddrs, _ := iface.Addrs()
 		for _, ifAddr := range ifAddrs {
-			switch v := ifAddr.(type) {
-			case *net.IPNet:
-				addresses = append(addresses, v.IP.String())
-			case *net.IPAddr:
-				addresses = append(addresses, v.IP.String())
+			if ip := interfaceIP(ifAddr); ip != nil {
+				addresses = append(addresses, zonedIP(ip, iface.Name))
 			}
 		}
 	}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// wsAddress returns the address to serve the WebSocket endpoint at with
+// Options.WSPort.
+func (server *Server) wsAddress() string {
+	if server.options.WSAddress != "" {
+		return server.options.WSAddress
+	}
+	return server.options.Address
+}
+
+// listenAddress is a network and host pair to listen at.
+type listenAddress struct {
+	network string
+	host    string
+}
+
+// listenAddresses resolves an address option.
+// Besides IP addresses, which may be IPv6 literals with a zone ID,
+// the name of a network interface stands for all of its addresses.
+func (server *Server) listenAddresses(address string) ([]listenAddress, error) {
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+
+	switch address {
+	case "", "0.0.0.0", "::":
+		if server.options.DualStack {
+			// Go listens at both IPv4 and IPv6 on wildcard addresses
+			return []listenAddress{{"tcp", address}}, nil
+		}
+		switch address {
+		case "0.0.0.0":
+			return []listenAddress{{"tcp4", address}}, nil
+		case "::":
+			return []listenAddress{{"tcp6", address}}, nil
+		}
+		return []listenAddress{{"tcp4", "0.0.0.0"}, {"tcp6", "::"}}, nil
+	}
+
+	ip, _, _ := strings.Cut(address, "%")
+	if net.ParseIP(ip) != nil {
+		return []listenAddress{{"tcp", address}}, nil
+	}
+
+	iface, err := net.InterfaceByName(address)
+	if err != nil {
+		// leave host names to the resolver
+		return []listenAddress{{"tcp", address}}, nil
+	}
+	ifAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get addresses of interface `%s`: %w", address, err)
+	}
+	var addresses []listenAddress
+	for _, ifAddr := range ifAddrs {
+		if ip := interfaceIP(ifAddr); ip != nil {
+			addresses = append(addresses, listenAddress{"tcp", zonedIP(ip, iface.Name)})
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("interface `%s` has no addresses", address)
+	}
+	return addresses, nil
+}
+
+// listen opens a listener on port for every address of the address option.
+// When the port is 0, all of them share the port chosen for the first one.
+func (server *Server) listen(address string, port string) ([]net.Listener, error) {
+	addresses, err := server.listenAddresses(address)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		hostPort := net.JoinHostPort(address.host, port)
+		listener, err := net.Listen(address.network, hostPort)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen at `%s`: %w", hostPort, err)
+		}
+		_, port, _ = net.SplitHostPort(listener.Addr().String())
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+func interfaceIP(ifAddr net.Addr) net.IP {
+	switch v := ifAddr.(type) {
+	case *net.IPNet:
+		return v.IP
+	case *net.IPAddr:
+		return v.IP
+	}
+	return nil
+}
+
+// zonedIP adds the zone to link-local IPv6 addresses, which are ambiguous without it.
+func zonedIP(ip net.IP, zone string) string {
+	if ip.To4() == nil && ip.IsLinkLocalUnicast() {
+		return ip.String() + "%" + zone
+	}
+	return ip.String()
+}
+
+// serverURL builds the URL of the server at host, escaping the zone of IPv6 addresses.
+func serverURL(scheme string, host string, port string, path string) string {
+	return scheme + "://" + net.JoinHostPort(strings.Replace(host, "%", "%25", 1), port) + path
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListenAddresses(t *testing.T) {
+	for _, test := range []struct {
+		address   string
+		dualStack bool
+		expected  []listenAddress
+	}{
+		{"", false, []listenAddress{{"tcp4", "0.0.0.0"}, {"tcp6", "::"}}},
+		{"0.0.0.0", false, []listenAddress{{"tcp4", "0.0.0.0"}}},
+		{"[::]", false, []listenAddress{{"tcp6", "::"}}},
+		{"::", true, []listenAddress{{"tcp", "::"}}},
+		{"fe80::1%eth0", false, []listenAddress{{"tcp", "fe80::1%eth0"}}},
+		{"example.com", false, []listenAddress{{"tcp", "example.com"}}},
+	} {
+		server := &Server{options: &Options{DualStack: test.dualStack}}
+		addresses, err := server.listenAddresses(test.address)
+		if err != nil || !reflect.DeepEqual(addresses, test.expected) {
+			t.Errorf("listenAddresses() of `%s` = %v, %v, expected %v", test.address, addresses, err, test.expected)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loopback *net.Interface
+	var linkLocal string
+	for _, iface := range ifaces {
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ip := addr.(*net.IPNet).IP
+			if iface.Flags&net.FlagLoopback != 0 && loopback == nil {
+				loopback = &iface
+			}
+			if ip.To4() == nil && ip.IsLinkLocalUnicast() && linkLocal == "" {
+				linkLocal = ip.String() + "%" + iface.Name
+			}
+		}
+	}
+
+	t.Run("interface", func(t *testing.T) {
+		if loopback == nil {
+			t.Skip("no loopback interface")
+		}
+		server := &Server{options: &Options{}}
+		listeners, err := server.listen(loopback.Name, "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, _ := loopback.Addrs()
+		if len(listeners) != len(addrs) {
+			t.Fatalf("listening at %d addresses, expected the %d of %s", len(listeners), len(addrs), loopback.Name)
+		}
+		var port string
+		for i, listener := range listeners {
+			defer listener.Close()
+			host, listenerPort, _ := net.SplitHostPort(listener.Addr().String())
+			if host != addrs[i].(*net.IPNet).IP.String() {
+				t.Errorf("listening at %s, expected the address %s of %s", host, addrs[i], loopback.Name)
+			}
+			if port == "" {
+				port = listenerPort
+			} else if listenerPort != port {
+				t.Errorf("listening at port %s and %s, expected a single port", port, listenerPort)
+			}
+		}
+	})
+
+	t.Run("zoned IPv6", func(t *testing.T) {
+		if linkLocal == "" {
+			t.Skip("no link-local IPv6 address")
+		}
+		server := &Server{options: &Options{}}
+		listeners, err := server.listen("["+linkLocal+"]", "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listeners[0].Close()
+		_, port, _ := net.SplitHostPort(listeners[0].Addr().String())
+		if url := serverURL("http", linkLocal, port, "/"); !strings.HasPrefix(url, "http://["+strings.Replace(linkLocal, "%", "%25", 1)+"]:") {
+			t.Errorf("serverURL() = %s, expected %s with its zone escaped", url, linkLocal)
+		}
+	})
+}
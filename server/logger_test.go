@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// logLines passes each line logged on.
+type logLines chan []byte
+
+func (l logLines) Write(p []byte) (int, error) {
+	l <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+// startedSessions passes the sessions started on.
+type startedSessions struct {
+	NopEvents
+	sessions chan SessionInfo
+}
+
+func (s startedSessions) OnSessionStart(session SessionInfo) {
+	s.sessions <- session
+}
+
+func TestSessionLogger(t *testing.T) {
+	lines := make(logLines, 100)
+	logger := slog.New(slog.NewJSONHandler(lines, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	events := startedSessions{sessions: make(chan SessionInfo, 1)}
+	url := runServer(t, &Options{PermitWrite: true}, WithLogger(logger), WithEvents(events))
+
+	conn := dialSession(t, url, InitMessage{}, nil)
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte{webtty.Input, 'a'})
+	session := <-events.sessions
+
+	// the WebTTY of the session logs to the logger of the server
+	timeout := time.After(time.Second)
+	for {
+		var event map[string]any
+		select {
+		case line := <-lines:
+			if err := json.Unmarshal(line, &event); err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatal("no message from master logged")
+		}
+		if event["msg"] != "Message from master" || event["type"] != string(webtty.Input) {
+			continue
+		}
+		if event["session_id"] != session.ID {
+			t.Errorf("event = %v, expected the session %s", event, session.ID)
+		}
+		return
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/metrics"
+)
+
+const (
+	metricSessions        = "gotty_sessions_total"
+	metricConnections     = "gotty_connections_active"
+	metricSessionDuration = "gotty_session_duration_seconds"
+	metricBytesReceived   = "gotty_bytes_received_total" // from clients to backends
+	metricBytesSent       = "gotty_bytes_sent_total"     // from backends to clients
+	metricErrors          = "gotty_errors_total"
+	metricOutputBuffered  = "gotty_output_buffered_bytes" // for slow clients
+	metricSessionsPeak    = "gotty_sessions_peak"
+	metricClosed          = "gotty_connections_closed_total"
+	metricRejected        = "gotty_connections_rejected_total" // while busy, by reason
+	metricBackendCPU      = "gotty_backend_cpu_seconds_total"  // of the commands of sessions
+	metricBackendMemory   = "gotty_backend_memory_bytes"
+	metricTriggers        = "gotty_triggers_total" // fired, by action
+	metricLimit           = "gotty_limit"          // of Limits, by name
+)
+
+// meteredSlave counts the bytes going through a slave and keeps its activity.
+type meteredSlave struct {
+	slaveWrapper
+
+	metrics  metrics.Metrics
+	labels   []string
+	activity *activity
+}
+
+func (ms *meteredSlave) Read(p []byte) (n int, err error) {
+	n, err = ms.Slave.Read(p)
+	if n > 0 {
+		ms.metrics.Add(metricBytesSent, float64(n), ms.labels...)
+		ms.activity.output.Store(time.Now().UnixNano())
+		ms.activity.bytesOut.Add(int64(n))
+	}
+	return n, err
+}
+
+func (ms *meteredSlave) Write(p []byte) (n int, err error) {
+	n, err = ms.Slave.Write(p)
+	if n > 0 {
+		ms.metrics.Add(metricBytesReceived, float64(n), ms.labels...)
+		ms.activity.input.Store(time.Now().UnixNano())
+		ms.activity.bytesIn.Add(int64(n))
+	}
+	return n, err
+}
+
+// Metrics returns the metrics of the server, e.g. to share them with other
+// servers by WithMetrics and metrics.WithLabels.
+func (server *Server) Metrics() metrics.Metrics {
+	return server.metrics
+}
+
+// NewMetrics returns the metrics a server with options keeps by default,
+// to share with others with WithMetrics.
+func NewMetrics(options *Options) metrics.Metrics {
+	if !options.EnableMetrics {
+		return metrics.Nop{}
+	}
+	prometheus := metrics.NewPrometheus()
+	if options.MetricsMaxRoutes > 0 {
+		prometheus.LimitLabel("path", options.MetricsMaxRoutes)
+		prometheus.LimitLabel("tenant", options.MetricsMaxRoutes)
+	}
+	return prometheus
+}
+
+func (server *Server) sessionStarted(path string, session SessionInfo) {
+	server.metrics.Add(metricSessions, 1, "path", path)
+	if peak, ok := server.stats.started(session.StartedAt); ok {
+		server.metrics.Set(metricSessionsPeak, float64(peak))
+	}
+	attrs := []any{"session_id", session.ID, "remote_addr", session.RemoteAddr, "user", session.User, "backend", session.Backend}
+	if len(session.Groups) > 0 {
+		attrs = append(attrs, "groups", session.Groups)
+	}
+	if session.Country != "" {
+		attrs = append(attrs, "country", session.Country)
+	}
+	if session.ASN != 0 {
+		attrs = append(attrs, "asn", session.ASN, "as_organization", session.ASOrganization)
+	}
+	server.logger.Info("Session started", attrs...)
+	server.events.OnSessionStart(session)
+}
+
+func (server *Server) sessionEnded(path string, session SessionInfo, err error) {
+	duration := time.Since(session.StartedAt)
+	server.metrics.Observe(metricSessionDuration, duration.Seconds(), "path", path)
+	server.stats.ended(duration)
+	server.reports.record(session, time.Now())
+	server.events.OnSessionEnd(session, err)
+}
+
+func (server *Server) authFailed(remoteAddr string, err error) {
+	server.metrics.Add(metricErrors, 1, "kind", "auth")
+	server.logger.Info("Authentication failed", "remote_addr", remoteAddr, "error", err)
+	server.events.OnAuthFailure(remoteAddr, err)
+}
+
+func (server *Server) connectionClosed(path string, reason string) {
+	server.metrics.Add(metricClosed, 1, "path", path, "reason", reason)
+	server.stats.closed(reason)
+}
+
+func (server *Server) connectionsChanged(path string, connections int) {
+	server.metrics.Set(metricConnections, float64(connections), "path", path)
+}
+
+func (server *Server) outputBuffered(memory, disk int64) {
+	server.metrics.Set(metricOutputBuffered, float64(memory), "storage", "memory")
+	server.metrics.Set(metricOutputBuffered, float64(disk), "storage", "disk")
+}
@@ -1,18 +1,31 @@
 package server
 
 import (
-	"encoding/base64"
-	"log"
 	"net/http"
-	"os"
-	"strings"
 )
 
+// Middleware wraps a handler of the server.
+type Middleware func(http.Handler) http.Handler
+
+type middlewares struct {
+	outer     []Middleware
+	inner     []Middleware
+	websocket []Middleware
+}
+
+// wrapMiddleware wraps handler so that the first middleware runs first.
+func wrapMiddleware(handler http.Handler, middleware []Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
 func (server *Server) wrapLogger(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rw := &logResponseWriter{w, 200}
 		handler.ServeHTTP(rw, r)
-		log.Printf("%s %d %s %s", r.RemoteAddr, rw.status, r.Method, r.URL.Path)
+		server.logger.Info("Request", "remote_addr", r.RemoteAddr, "status", rw.status, "method", r.Method, "path", r.URL.Path)
 	})
 }
 
@@ -23,56 +36,3 @@ func (server *Server) wrapHeaders(handler http.Handler) http.Handler {
 		handler.ServeHTTP(w, r)
 	})
 }
-
-func (server *Server) wrapBasicAuth(handler http.Handler, credential string) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
-
-		if len(token) != 2 || strings.ToLower(token[0]) != "basic" {
-			w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
-			http.Error(w, "Bad Request", http.StatusUnauthorized)
-			return
-		}
-
-		payload, err := base64.StdEncoding.DecodeString(token[1])
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		if credential != string(payload) {
-			w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
-			http.Error(w, "authorization failed", http.StatusUnauthorized)
-			return
-		}
-
-		log.Printf("Basic Authentication Succeeded: %s", r.RemoteAddr)
-		handler.ServeHTTP(w, r)
-	})
-}
-
-func (server *Server) wrapQueryParamsToEnv(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get all query parameters
-		queryParams := r.URL.Query()
-
-		// Convert each query parameter to an environment variable
-		for key, values := range queryParams {
-			if len(values) > 0 {
-				// Use the first value if multiple values exist for the same key
-				envValue := values[0]
-				// Set the environment variable
-				// Note: Environment variable names are typically uppercase
-				envKey := strings.ToUpper(key)
-				err := os.Setenv(envKey, envValue)
-				if err != nil {
-					log.Printf("Failed to set env var %s: %v", envKey, err)
-				} else {
-					log.Printf("Set env var from query param: %s=%s", envKey, envValue)
-				}
-			}
-		}
-
-		handler.ServeHTTP(w, r)
-	})
-}
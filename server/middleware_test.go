@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var mutex sync.Mutex
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				calls = append(calls, name+" "+r.URL.Path)
+				mutex.Unlock()
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	url := runServer(t, &Options{EnableBasicAuth: true, Credential: "user:pass"},
+		WithOuterMiddleware(record("outer1"), record("outer2")),
+		WithInnerMiddleware(record("inner")),
+		WithWebSocketMiddleware(record("websocket")),
+	)
+
+	for _, credential := range []string{"", "user:pass"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		if user, password, ok := strings.Cut(credential, ":"); ok {
+			req.SetBasicAuth(user, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	header := http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))}}
+	conn := dialSession(t, url, InitMessage{AuthToken: "user:pass"}, header)
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	// the inner middleware runs for authenticated requests only
+	expected := []string{
+		"outer1 /", "outer2 /",
+		"outer1 /", "outer2 /", "inner /",
+		"outer1 /ws", "outer2 /ws", "websocket /ws",
+	}
+	if !slices.Equal(calls, expected) {
+		t.Errorf("middleware calls = %q, expected %q", calls, expected)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/accesstoken"
+)
+
+// motdVariables returns the variables of the message of the day: those of
+// the title and the policies in effect for the session.
+func (server *Server) motdVariables(titleVars map[string]interface{}, claims *accesstoken.Claims) map[string]interface{} {
+	policy := server.options.inputPolicy()
+	vars := map[string]interface{}{
+		"recording":    server.options.RecordDir != "",
+		"read_only":    policy == inputReadOnly,
+		"input_policy": policy,
+		"idle_timeout": time.Duration(server.Limits().IdleTimeout) * time.Second,
+		"expires_at":   time.Time{},
+		"expires_in":   time.Duration(0),
+	}
+	if claims != nil {
+		expiresAt := time.Unix(claims.ExpiresAt, 0)
+		vars["expires_at"] = expiresAt
+		vars["expires_in"] = time.Until(expiresAt).Round(time.Second)
+	}
+	for key, val := range titleVars {
+		vars[key] = val
+	}
+	return vars
+}
+
+// renderMOTD renders the message of the day as terminal output, or returns
+// nil without one.
+func (server *Server) renderMOTD(vars map[string]interface{}) ([]byte, error) {
+	if server.motdTemplate == nil {
+		return nil, nil
+	}
+	buf := new(bytes.Buffer)
+	if err := server.motdTemplate.Execute(buf, vars); err != nil {
+		return nil, fmt.Errorf("failed to fill message of the day: %w", err)
+	}
+	motd := strings.TrimRight(buf.String(), "\r\n")
+	if motd == "" {
+		return nil, nil
+	}
+	motd = strings.ReplaceAll(strings.ReplaceAll(motd, "\r\n", "\n"), "\n", "\r\n")
+	return []byte(motd + "\r\n"), nil
+}
+
+// motdSlave outputs the message of the day before the output of its slave.
+type motdSlave struct {
+	slaveWrapper
+
+	motd []byte // not read yet
+}
+
+func (ms *motdSlave) Read(p []byte) (int, error) {
+	if len(ms.motd) > 0 {
+		n := copy(p, ms.motd)
+		ms.motd = ms.motd[n:]
+		return n, nil
+	}
+	return ms.Slave.Read(p)
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sorenisanerd/gotty/pkg/oidc"
+	"github.com/sorenisanerd/gotty/pkg/randomstring"
+)
+
+const (
+	oidcCookieName      = "gotty.oidc"
+	oidcStateCookieName = "gotty.oidc_state"
+	// oidcStateTTL is how long users have to sign in at the provider.
+	oidcStateTTL = 10 * time.Minute
+	// oidcTimeout bounds the requests to the provider.
+	oidcTimeout = 10 * time.Second
+)
+
+// oidcSession is a user signed in with Options.OIDCIssuer, kept in a
+// cookie until the ID token expires.
+type oidcSession struct {
+	User      string   `json:"user"`
+	Groups    []string `json:"groups,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// oidcSignIn is a sign in in progress, kept in a cookie until the provider
+// sends the user back.
+type oidcSignIn struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Return    string `json:"return"` // URI of the request signed in for
+	ExpiresAt int64  `json:"exp"`
+}
+
+// wrapOIDC identifies clients by the session cookie set once they signed in
+// at the provider, which the pages redirect to when it is missing or has
+// expired, refusing other requests and the users not in
+// Options.AllowGroups. Clients without a browser, e.g. gotty client, get
+// the cookie with the device authorization grant instead.
+func (server *Server) wrapOIDC(handler http.Handler, pathPrefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case pathPrefix + "oidc/callback":
+			server.handleOIDCCallback(w, r, pathPrefix)
+			return
+		case pathPrefix + "oidc/device":
+			server.handleOIDCDevice(w, r)
+			return
+		case pathPrefix + "oidc/device/token":
+			server.handleOIDCDeviceToken(w, r, pathPrefix)
+			return
+		}
+		var session oidcSession
+		if server.readOIDCCookie(r, oidcCookieName, &session) && time.Now().Unix() < session.ExpiresAt {
+			id := &identity{user: session.User, groups: session.Groups, pass: server.options.OIDCPassUser}
+			handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, id)))
+			return
+		}
+		if r.Method != http.MethodGet || websocket.IsWebSocketUpgrade(r) {
+			server.authFailed(r.RemoteAddr, fmt.Errorf("%w: not signed in", ErrAuthFailed))
+			writeError(w, ErrAuthFailed)
+			return
+		}
+
+		signIn := oidcSignIn{
+			State:     randomstring.Generate(32),
+			Nonce:     randomstring.Generate(32),
+			Return:    r.URL.RequestURI(),
+			ExpiresAt: time.Now().Add(oidcStateTTL).Unix(),
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), oidcTimeout)
+		defer cancel()
+		authURL, err := server.oidc.AuthURL(ctx, server.oidcRedirectURL(r, pathPrefix), signIn.State, signIn.Nonce)
+		if err != nil {
+			server.logger.Error("Failed to reach the OpenID Connect provider", "error", err)
+			writeError(w, fmt.Errorf("%w: %w", ErrOIDCFailed, err))
+			return
+		}
+		server.setOIDCCookie(w, oidcStateCookieName, pathPrefix+"oidc/", signIn, signIn.ExpiresAt)
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// handleOIDCCallback signs in the users the provider sends back with a
+// code, and sends them back to the page they came from.
+func (server *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request, pathPrefix string) {
+	query := r.URL.Query()
+	var signIn oidcSignIn
+	if !server.readOIDCCookie(r, oidcStateCookieName, &signIn) || time.Now().Unix() >= signIn.ExpiresAt || query.Get("state") != signIn.State {
+		server.authFailed(r.RemoteAddr, fmt.Errorf("%w: invalid OpenID Connect state", ErrAuthFailed))
+		writeError(w, ErrAuthFailed)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookieName, Path: pathPrefix + "oidc/", MaxAge: -1})
+	if reason := query.Get("error"); reason != "" {
+		server.authFailed(r.RemoteAddr, fmt.Errorf("%w: OpenID Connect provider: %s", ErrAuthFailed, reason))
+		writeError(w, ErrAuthFailed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), oidcTimeout)
+	defer cancel()
+	claims, err := server.oidc.Exchange(ctx, server.oidcRedirectURL(r, pathPrefix), query.Get("code"), signIn.Nonce)
+	if errors.Is(err, oidc.ErrInvalidToken) {
+		server.authFailed(r.RemoteAddr, fmt.Errorf("%w: %w", ErrAuthFailed, err))
+		writeError(w, ErrAuthFailed)
+		return
+	} else if err != nil {
+		server.logger.Error("Failed to reach the OpenID Connect provider", "error", err)
+		writeError(w, fmt.Errorf("%w: %w", ErrOIDCFailed, err))
+		return
+	}
+
+	session, ok := server.signInOIDC(w, r, pathPrefix, claims)
+	if !ok {
+		return
+	}
+	server.logger.Info("Signed in with OpenID Connect", "user", session.User, "remote_addr", r.RemoteAddr)
+
+	target := signIn.Return
+	if !strings.HasPrefix(target, pathPrefix) || strings.HasPrefix(target, "//") {
+		target = pathPrefix
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// signInOIDC sets the session cookie of the user of claims, telling whether
+// it is allowed in, or else responds with an error.
+func (server *Server) signInOIDC(w http.ResponseWriter, r *http.Request, pathPrefix string, claims oidc.Claims) (oidcSession, bool) {
+	session := oidcSession{
+		User:      claims.String(server.options.OIDCUserClaim),
+		Groups:    claims.Strings(server.options.OIDCGroupsClaim),
+		ExpiresAt: claims.Expiry().Unix(),
+	}
+	if session.User == "" {
+		session.User = claims.String("sub")
+	}
+	if session.User == "" {
+		server.authFailed(r.RemoteAddr, fmt.Errorf("%w: ID token without a user", ErrAuthFailed))
+		writeError(w, ErrAuthFailed)
+		return session, false
+	}
+	if !server.allowedGroups(session.Groups) {
+		server.authFailed(r.RemoteAddr, fmt.Errorf("%w: user %s in none of the allowed groups", ErrAuthFailed, session.User))
+		writeError(w, ErrAuthFailed)
+		return session, false
+	}
+	server.setOIDCCookie(w, oidcCookieName, pathPrefix, session, session.ExpiresAt)
+	return session, true
+}
+
+// handleOIDCDevice starts the device authorization grant for a client
+// without a browser, responding with the device authorization of the
+// provider: the client shows its user where to sign in, and polls
+// oidc/device/token with the device code meanwhile.
+func (server *Server) handleOIDCDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), oidcTimeout)
+	defer cancel()
+	authorization, err := server.oidc.AuthorizeDevice(ctx)
+	if err != nil {
+		server.logger.Error("Failed to reach the OpenID Connect provider", "error", err)
+		writeError(w, fmt.Errorf("%w: %w", ErrOIDCFailed, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authorization)
+}
+
+// handleOIDCDeviceToken polls the provider once for the device code of the
+// form, and signs its user in as handleOIDCCallback does once the user has
+// signed in. Until then, it responds with the error of the provider,
+// authorization_pending or slow_down, as the token endpoint of RFC 8628.
+func (server *Server) handleOIDCDeviceToken(w http.ResponseWriter, r *http.Request, pathPrefix string) {
+	if r.Method != http.MethodPost {
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), oidcTimeout)
+	defer cancel()
+	claims, err := server.oidc.PollDevice(ctx, r.FormValue("device_code"))
+	switch {
+	case errors.Is(err, oidc.ErrAuthorizationPending), errors.Is(err, oidc.ErrSlowDown):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, oidc.ErrInvalidToken), errors.Is(err, oidc.ErrAccessDenied):
+		server.authFailed(r.RemoteAddr, fmt.Errorf("%w: %w", ErrAuthFailed, err))
+		writeError(w, ErrAuthFailed)
+		return
+	case err != nil:
+		server.logger.Error("Failed to reach the OpenID Connect provider", "error", err)
+		writeError(w, fmt.Errorf("%w: %w", ErrOIDCFailed, err))
+		return
+	}
+
+	session, ok := server.signInOIDC(w, r, pathPrefix, claims)
+	if !ok {
+		return
+	}
+	server.logger.Info("Signed in with OpenID Connect", "user", session.User, "remote_addr", r.RemoteAddr, "grant", "device")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// oidcRedirectURL returns the URL of the callback, Options.OIDCRedirectURL
+// or else the one of the host of r.
+func (server *Server) oidcRedirectURL(r *http.Request, pathPrefix string) string {
+	if server.options.OIDCRedirectURL != "" {
+		return server.options.OIDCRedirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + pathPrefix + "oidc/callback"
+}
+
+// setOIDCCookie sets the cookie name to v, signed, until expiresAt.
+func (server *Server) setOIDCCookie(w http.ResponseWriter, name string, path string, v any, expiresAt int64) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    encoded + "." + base64.RawURLEncoding.EncodeToString(server.oidcSignature(encoded)),
+		Path:     path,
+		Expires:  time.Unix(expiresAt, 0),
+		HttpOnly: true,
+		Secure:   server.options.EnableTLS,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// readOIDCCookie decodes the cookie name of r into v, telling whether it
+// has a valid signature.
+func (server *Server) readOIDCCookie(r *http.Request, name string, v any) bool {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return false
+	}
+	encoded, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	decodedSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(decodedSig, server.oidcSignature(encoded)) {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	return err == nil && json.Unmarshal(payload, v) == nil
+}
+
+func (server *Server) oidcSignature(encoded string) []byte {
+	mac := hmac.New(sha256.New, server.oidcKey)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
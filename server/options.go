@@ -1,45 +1,350 @@
 package server
 
 import (
-	"github.com/pkg/errors"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/sorenisanerd/gotty/pkg/credentials"
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+	"github.com/sorenisanerd/gotty/pkg/publish"
+	"github.com/sorenisanerd/gotty/pkg/secrets"
 )
 
 type Options struct {
-	Address             string `hcl:"address" flagName:"address" flagSName:"a" flagDescribe:"IP address to listen" default:"0.0.0.0"`
-	Port                string `hcl:"port" flagName:"port" flagSName:"p" flagDescribe:"Port number to liten" default:"8080"`
-	Path                string `hcl:"path" flagName:"path" flagSName:"m" flagDescribe:"Base path" default:"/"`
-	PermitWrite         bool   `hcl:"permit_write" flagName:"permit-write" flagSName:"w" flagDescribe:"Permit clients to write to the TTY (BE CAREFUL)" default:"false"`
-	EnableBasicAuth     bool   `hcl:"enable_basic_auth" default:"false"`
-	Credential          string `hcl:"credential" flagName:"credential" flagSName:"c" flagDescribe:"Credential for Basic Authentication (ex: user:pass, default disabled)" default:""`
-	EnableRandomUrl     bool   `hcl:"enable_random_url" flagName:"random-url" flagSName:"r" flagDescribe:"Add a random string to the URL" default:"false"`
-	RandomUrlLength     int    `hcl:"random_url_length" flagName:"random-url-length" flagDescribe:"Random URL length" default:"8"`
-	EnableTLS           bool   `hcl:"enable_tls" flagName:"tls" flagSName:"t" flagDescribe:"Enable TLS/SSL" default:"false"`
-	TLSCrtFile          string `hcl:"tls_crt_file" flagName:"tls-crt" flagDescribe:"TLS/SSL certificate file path" default:"~/.gotty.crt"`
-	TLSKeyFile          string `hcl:"tls_key_file" flagName:"tls-key" flagDescribe:"TLS/SSL key file path" default:"~/.gotty.key"`
-	EnableTLSClientAuth bool   `hcl:"enable_tls_client_auth" default:"false"`
-	TLSCACrtFile        string `hcl:"tls_ca_crt_file" flagName:"tls-ca-crt" flagDescribe:"TLS/SSL CA certificate file for client certifications" default:"~/.gotty.ca.crt"`
-	IndexFile           string `hcl:"index_file" flagName:"index" flagDescribe:"Custom index.html file" default:""`
-	TitleFormat         string `hcl:"title_format" flagName:"title-format" flagSName:"" flagDescribe:"Title format of browser window" default:"{{ .command }}@{{ .hostname }}"`
-	EnableReconnect     bool   `hcl:"enable_reconnect" flagName:"reconnect" flagDescribe:"Enable reconnection" default:"false"`
-	ReconnectTime       int    `hcl:"reconnect_time" flagName:"reconnect-time" flagDescribe:"Time to reconnect" default:"10"`
-	MaxConnection       int    `hcl:"max_connection" flagName:"max-connection" flagDescribe:"Maximum connection to gotty" default:"0"`
-	Once                bool   `hcl:"once" flagName:"once" flagDescribe:"Accept only one client and exit on disconnection" default:"false"`
-	Timeout             int    `hcl:"timeout" flagName:"timeout" flagDescribe:"Timeout seconds for waiting a client(0 to disable)" default:"0"`
-	PermitArguments     bool   `hcl:"permit_arguments" flagName:"permit-arguments" flagDescribe:"Permit clients to send command line arguments in URL (e.g. http://example.com:8080/?arg=AAA&arg=BBB)" default:"false"`
-	PassHeaders         bool   `hcl:"pass_headers" flagName:"pass-headers" flagDescribe:"Pass HTTP request headers as environment variables (e.g. Cookie becomes HTTP_COOKIE)" default:"false"`
-	Width               int    `hcl:"width" flagName:"width" flagDescribe:"Static width of the screen, 0(default) means dynamically resize" default:"0"`
-	Height              int    `hcl:"height" flagName:"height" flagDescribe:"Static height of the screen, 0(default) means dynamically resize" default:"0"`
-	WSOrigin            string `hcl:"ws_origin" flagName:"ws-origin" flagDescribe:"A regular expression that matches origin URLs to be accepted by WebSocket. No cross origin requests are acceptable by default" default:""`
-	WSQueryArgs         string `hcl:"ws_query_args" flagName:"ws-query-args" flagDescribe:"Querystring arguments to append to the websocket instantiation" default:""`
-	EnableWebGL         bool   `hcl:"enable_webgl" flagName:"enable-webgl" flagDescribe:"Enable WebGL renderer" default:"true"`
-	Quiet               bool   `hcl:"quiet" flagName:"quiet" flagDescribe:"Don't log" default:"false"`
+	Address               string   `hcl:"address" flagName:"address" flagSName:"a" flagDescribe:"IP address (IPv6 with an optional %zone) or network interface name to listen" default:"0.0.0.0"`
+	DualStack             bool     `hcl:"dual_stack" flagName:"dual-stack" flagDescribe:"Accept both IPv4 and IPv6 on wildcard addresses, when disabled 0.0.0.0 is IPv4 only and :: is IPv6 only" default:"true"`
+	Port                  string   `hcl:"port" flagName:"port" flagSName:"p" flagDescribe:"Port number to liten" default:"8080"`
+	Path                  string   `hcl:"path" flagName:"path" flagSName:"m" flagDescribe:"Base path" default:"/"`
+	PermitWrite           bool     `hcl:"permit_write" flagName:"permit-write" flagSName:"w" flagDescribe:"Permit clients to write to the TTY (BE CAREFUL)" default:"false"`
+	InputPolicy           string   `hcl:"input_policy" flagName:"input-policy" flagDescribe:"Input of clients to write to the TTY: write (all of it), read-only, scroll (keys scrolling, e.g. arrows and PgUp, and --input-allow) or allow (--input-allow only), write with --permit-write and read-only otherwise when empty" default:""`
+	InputAllow            []string `hcl:"input_allow" flagName:"input-allow" flagDescribe:"Key to pass with --input-policy allow or scroll, a character, ^C for Ctrl+C or an escape sequence such as \\e[5~ (can be repeated)"`
+	EnableBasicAuth       bool     `hcl:"enable_basic_auth" default:"false"`
+	Credential            string   `hcl:"credential" flagName:"credential" flagSName:"c" flagDescribe:"Credential for Basic Authentication (ex: user:pass, default disabled)" default:"" secret:"true"`
+	CredentialFile        string   `hcl:"credential_file" flagName:"credential-file" flagDescribe:"File holding the credential for Basic Authentication, read again when it changes and rewritten on rotation" default:""`
+	CredentialVault       string   `hcl:"credential_vault" flagName:"credential-vault" flagDescribe:"URL of a Vault KV v2 secret holding the credential for Basic Authentication under the key credential, read with $VAULT_TOKEN (ex: https://vault:8200/v1/secret/data/gotty)" default:""`
+	JWTSecret             string   `hcl:"jwt_secret" flagName:"jwt-secret" flagDescribe:"Secret of the JSON Web Tokens signed with HS256 that authenticate WebSocket connections, in the Authorization header or the init message" default:"" secret:"true"`
+	JWTPublicKeyFile      string   `hcl:"jwt_public_key_file" flagName:"jwt-public-key" flagDescribe:"PEM file of the RSA public key or certificate of the JSON Web Tokens signed with RS256 that authenticate WebSocket connections" default:""`
+	JWTJWKSURL            string   `hcl:"jwt_jwks_url" flagName:"jwt-jwks-url" flagDescribe:"URL of the JWKS of the RSA keys of the JSON Web Tokens signed with RS256 that authenticate WebSocket connections" default:""`
+	JWTIssuer             string   `hcl:"jwt_issuer" flagName:"jwt-issuer" flagDescribe:"Issuer the JSON Web Tokens must have (not checked when empty)" default:""`
+	JWTAudience           string   `hcl:"jwt_audience" flagName:"jwt-audience" flagDescribe:"Audience the JSON Web Tokens must have (not checked when empty)" default:""`
+	JWTUserClaim          string   `hcl:"jwt_user_claim" flagName:"jwt-user-claim" flagDescribe:"Claim of the JSON Web Tokens holding the user" default:"sub"`
+	TokenSecret           string   `hcl:"token_secret" flagName:"token-secret" flagDescribe:"Secret to sign and verify access tokens with (see gotty token), a valid token is then required unless the credential is given" default:"" secret:"true"`
+	SecretsVault          string   `hcl:"secrets_vault" flagName:"secrets-vault" flagDescribe:"URL of a Vault KV v2 secret to load credential, token_secret, tls_crt and tls_key from, read with $VAULT_TOKEN" default:""`
+	SecretsAWS            string   `hcl:"secrets_aws" flagName:"secrets-aws" flagDescribe:"Name or ARN of an AWS Secrets Manager secret, a JSON object, to load credential, token_secret, tls_crt and tls_key from, read with the AWS credentials of the environment" default:""`
+	SecretsRefresh        int      `hcl:"secrets_refresh" flagName:"secrets-refresh" flagDescribe:"Seconds between reloads of the secrets of --secrets-vault or --secrets-aws (0 to load them once)" default:"300"`
+	EnableRandomUrl       bool     `hcl:"enable_random_url" flagName:"random-url" flagSName:"r" flagDescribe:"Add a random string to the URL" default:"false"`
+	RandomUrlLength       int      `hcl:"random_url_length" flagName:"random-url-length" flagDescribe:"Random URL length" default:"8"`
+	EnableTLS             bool     `hcl:"enable_tls" flagName:"tls" flagSName:"t" flagDescribe:"Enable TLS/SSL" default:"false"`
+	TLSCrtFile            string   `hcl:"tls_crt_file" flagName:"tls-crt" flagDescribe:"TLS/SSL certificate file path" default:"~/.gotty.crt"`
+	TLSKeyFile            string   `hcl:"tls_key_file" flagName:"tls-key" flagDescribe:"TLS/SSL key file path" default:"~/.gotty.key"`
+	TLSHosts              []string `hcl:"tls_hosts" flagName:"tls-host" flagDescribe:"TLS/SSL certificate and key files of a hostname requested by SNI instead of --tls-crt and --tls-key, HOST=CRT_FILE,KEY_FILE, e.g. *.prod.example=prod.crt,prod.key (can be repeated)"`
+	EnableTLSClientAuth   bool     `hcl:"enable_tls_client_auth" default:"false"`
+	TLSCACrtFile          string   `hcl:"tls_ca_crt_file" flagName:"tls-ca-crt" flagDescribe:"TLS/SSL CA certificate file for client certifications" default:"~/.gotty.ca.crt"`
+	Approval              bool     `hcl:"approval" flagName:"approval" flagDescribe:"Hold new sessions until an approver approves them at the URL sent with --approval-webhook or the notifications" default:"false"`
+	ApprovalTimeout       int      `hcl:"approval_timeout" flagName:"approval-timeout" flagDescribe:"Seconds to wait for the approval of a session before refusing it" default:"300"`
+	ApprovalWebhook       string   `hcl:"approval_webhook" flagName:"approval-webhook" flagDescribe:"URL to post sessions waiting for approval to as JSON, with the URL to approve or deny them at" default:"" secret:"true"`
+	TrustedProxies        []string `hcl:"trusted_proxies" flagName:"trusted-proxy" flagDescribe:"IP address or CIDR of an authenticating reverse proxy whose identity headers to trust instead of the authentication of GoTTY, refusing other clients (can be repeated)"`
+	TrustedUserHeader     string   `hcl:"trusted_user_header" flagName:"trusted-user-header" flagDescribe:"Header of the user given by the trusted proxies" default:"X-Forwarded-User"`
+	TrustedGroupsHeader   string   `hcl:"trusted_groups_header" flagName:"trusted-groups-header" flagDescribe:"Header of the comma-separated groups of the user given by the trusted proxies" default:"X-Forwarded-Groups"`
+	AllowGroups           []string `hcl:"allow_groups" flagName:"allow-group" flagDescribe:"Group of users given by the trusted proxies or --oidc-issuer to let in, refusing the others (can be repeated)"`
+	OIDCIssuer            string   `hcl:"oidc_issuer" flagName:"oidc-issuer" flagDescribe:"URL of an OpenID Connect provider to sign users in with instead of the authentication of GoTTY (ex: https://accounts.example.com)" default:""`
+	OIDCClientID          string   `hcl:"oidc_client_id" flagName:"oidc-client-id" flagDescribe:"ID of the client registered at --oidc-issuer" default:""`
+	OIDCClientSecret      string   `hcl:"oidc_client_secret" flagName:"oidc-client-secret" flagDescribe:"Secret of the client registered at --oidc-issuer" default:"" secret:"true"`
+	OIDCRedirectURL       string   `hcl:"oidc_redirect_url" flagName:"oidc-redirect-url" flagDescribe:"URL of <path>oidc/callback registered at --oidc-issuer (default from the requests)" default:""`
+	OIDCUserClaim         string   `hcl:"oidc_user_claim" flagName:"oidc-user-claim" flagDescribe:"Claim of the ID token holding the user, sub when missing" default:"preferred_username"`
+	OIDCGroupsClaim       string   `hcl:"oidc_groups_claim" flagName:"oidc-groups-claim" flagDescribe:"Claim of the ID token holding the groups of the user" default:"groups"`
+	OIDCPassUser          bool     `hcl:"oidc_pass_user" flagName:"oidc-pass-user" flagDescribe:"Pass the user and groups signed in with --oidc-issuer to the command as HTTP_USER and HTTP_GROUPS" default:"false"`
+	AccessWindows         []string `hcl:"access_windows" flagName:"access-window" flagDescribe:"Weekly time window new sessions may start in, e.g. Mon-Fri 09:00-17:00, or 22:00-06:00 for every night, in --access-timezone (can be repeated)"`
+	AccessTimezone        string   `hcl:"access_timezone" flagName:"access-timezone" flagDescribe:"Time zone of --access-window, e.g. Europe/Berlin (the local one when empty)" default:""`
+	AccessOverride        string   `hcl:"access_override" flagName:"access-override" flagDescribe:"Credential of Basic Authentication, user:password, that also starts sessions outside of --access-window" default:"" secret:"true"`
+	GeoIPDatabases        []string `hcl:"geoip_databases" flagName:"geoip-db" flagDescribe:"MaxMind DB file, e.g. GeoLite2-Country.mmdb or GeoLite2-ASN.mmdb, to look up the country and autonomous system of clients in for the logs and events (can be repeated)"`
+	AllowCountries        []string `hcl:"allow_countries" flagName:"allow-country" flagDescribe:"ISO code of a country clients may connect from, refusing the others but private addresses (with --geoip-db, can be repeated)"`
+	DenyCountries         []string `hcl:"deny_countries" flagName:"deny-country" flagDescribe:"ISO code of a country to refuse clients of (with --geoip-db, can be repeated)"`
+	IndexFile             string   `hcl:"index_file" flagName:"index" flagDescribe:"Custom index.html file" default:""`
+	AssetsURL             string   `hcl:"assets_url" flagName:"assets-url" flagDescribe:"Base URL of a copy of js/ and css/ of the bundle, e.g. on a CDN, for the index page to load them from with Subresource Integrity, falling back to the embedded copy" default:""`
+	InjectScripts         []string `hcl:"inject_scripts" flagName:"inject-script" flagDescribe:"URL of an additional script to load on the index page (can be repeated)"`
+	InjectStylesheets     []string `hcl:"inject_stylesheets" flagName:"inject-css" flagDescribe:"URL of an additional stylesheet to load on the index page (can be repeated)"`
+	InjectHeadFile        string   `hcl:"inject_head_file" flagName:"inject-head" flagDescribe:"File containing an HTML snippet to insert at the end of <head> on the index page" default:""`
+	InjectBodyFile        string   `hcl:"inject_body_file" flagName:"inject-body" flagDescribe:"File containing an HTML snippet to insert at the end of <body> on the index page" default:""`
+	ContentSecurityPolicy string   `hcl:"content_security_policy" flagName:"csp" flagDescribe:"Content-Security-Policy header sent with the index page, {{ .nonce }} is replaced with a per-request nonce" default:""`
+	TitleFormat           string   `hcl:"title_format" flagName:"title-format" flagSName:"" flagDescribe:"Title format of browser window" default:"{{ .command }}@{{ .hostname }}"`
+	RouteTitles           []string `hcl:"route_titles" flagName:"route-title" flagDescribe:"Title format of the terminals served at a path instead of --title-format, PATH=FORMAT, e.g. /containers/db/={{ .command }} database (can be repeated)"`
+	MOTD                  string   `hcl:"motd" flagName:"motd" flagDescribe:"Message of the day printed in the terminal of clients when they connect, a template of the variables of --title-format and .recording, .read_only, .input_policy, .idle_timeout, .expires_at and .expires_in" default:""`
+	EnableReconnect       bool     `hcl:"enable_reconnect" flagName:"reconnect" flagDescribe:"Enable reconnection" default:"false"`
+	ReconnectTime         int      `hcl:"reconnect_time" flagName:"reconnect-time" flagDescribe:"Time to reconnect" default:"10"`
+	ReconnectGrace        int      `hcl:"reconnect_grace" flagName:"reconnect-grace" flagDescribe:"Seconds to keep the command of a client that lost its connection running, for the client to resume its session (with --reconnect, 0 to start a new command)" default:"30"`
+	MaxConnection         int      `hcl:"max_connection" flagName:"max-connection" flagDescribe:"Maximum connection to gotty" default:"0"`
+	MaxSessions           int      `hcl:"max_sessions" flagName:"max-sessions" flagDescribe:"Maximum number of sessions running at the same time, each with its own command, serving new ones as others end unless 1 (0 for no limit)" default:"1"`
+	Once                  bool     `hcl:"once" flagName:"once" flagDescribe:"Accept only one client and exit on disconnection" default:"false"`
+	ExitAfterSessions     int      `hcl:"exit_after_sessions" flagName:"exit-after-sessions" flagDescribe:"Serve this many sessions one after the other, then exit with the exit status of the last command (0 to disable)" default:"0"`
+	ExitOnSlaveExit       bool     `hcl:"exit_on_slave_exit" flagName:"exit-on-slave-exit" flagDescribe:"Exit with the exit status of the command when it exits" default:"false"`
+	Timeout               int      `hcl:"timeout" flagName:"timeout" flagDescribe:"Timeout seconds for waiting a client(0 to disable)" default:"0"`
+	PermitArguments       bool     `hcl:"permit_arguments" flagName:"permit-arguments" flagDescribe:"Permit clients to send command line arguments in URL (e.g. http://example.com:8080/?arg=AAA&arg=BBB)" default:"false"`
+	ParamForm             bool     `hcl:"param_form" flagName:"param-form" flagDescribe:"Show a landing page collecting the parameters declared by the backend before the terminal, when none are given or they are invalid" default:"false"`
+	LandingFile           string   `hcl:"landing_file" flagName:"landing" flagDescribe:"Custom landing.html file of --param-form" default:""`
+	PassHeaders           []string `hcl:"pass_headers" flagName:"pass-header" flagDescribe:"Request header to pass to the command as an environment variable, NAME or NAME=RENAMED (e.g. X-Forwarded-User=User becomes HTTP_USER) (can be repeated)"`
+	PassHeaderSize        int      `hcl:"pass_header_size" flagName:"pass-header-size" flagDescribe:"Maximum bytes of a passed header, larger ones are not passed (0 for no limit)" default:"4096"`
+	PassHeadersSize       int      `hcl:"pass_headers_size" flagName:"pass-headers-size" flagDescribe:"Maximum bytes of all passed headers, those exceeding it are not passed (0 for no limit)" default:"16384"`
+	Width                 int      `hcl:"width" flagName:"width" flagDescribe:"Static width of the screen, 0(default) means dynamically resize" default:"0"`
+	Height                int      `hcl:"height" flagName:"height" flagDescribe:"Static height of the screen, 0(default) means dynamically resize" default:"0"`
+	SizePolicy            string   `hcl:"size_policy" flagName:"size-policy" flagDescribe:"Size of the terminal of a session shown by several terminals: owner (that of its client), smallest (fitting all of them) or fixed (--width and --height, 80x24 by default)" default:"owner"`
+	WSPort                string   `hcl:"ws_port" flagName:"ws-port" flagDescribe:"Port to serve the WebSocket endpoint on apart from the page, e.g. for a CDN fronting the page (the port of the page when empty)" default:""`
+	WSAddress             string   `hcl:"ws_address" flagName:"ws-address" flagDescribe:"IP address or network interface name to serve the WebSocket endpoint on with --ws-port (the one of --address when empty)" default:""`
+	WSURL                 string   `hcl:"ws_url" flagName:"ws-url" flagDescribe:"URL of the WebSocket endpoint for the frontend, e.g. wss://ws.example.com/ws (next to the page, on --ws-port if any, when empty)" default:""`
+	WSOrigin              string   `hcl:"ws_origin" flagName:"ws-origin" flagDescribe:"A regular expression that matches origin URLs to be accepted by WebSocket. No cross origin requests are acceptable by default" default:""`
+	WSQueryArgs           string   `hcl:"ws_query_args" flagName:"ws-query-args" flagDescribe:"Querystring arguments to append to the websocket URL, after the query of the page, a template of .path, .query and .user (e.g. room={{ .query.Get \"room\" | urlquery }})" default:""`
+	IdleTimeout           int      `hcl:"idle_timeout" flagName:"idle-timeout" flagDescribe:"Seconds without input from a client, even while the command outputs, before ending its session (0 to disable)" default:"0"`
+	UsageInterval         int      `hcl:"usage_interval" flagName:"usage-interval" flagDescribe:"Seconds between samples of the CPU and memory of the commands of sessions, with their children (0 to disable)" default:"10"`
+	UsageRetention        int      `hcl:"usage_retention" flagName:"usage-retention" flagDescribe:"Days to keep the usage of the sessions by user and command for the reports of the admin API at <path>admin/usage (0 to disable)" default:"90"`
+	IdleOutput            bool     `hcl:"idle_output" flagName:"idle-output" flagDescribe:"Count the output of the command as activity for --idle-timeout" default:"false"`
+	SessionQuota          int      `hcl:"session_quota" flagName:"session-quota" flagDescribe:"Megabytes of output a session may send, warning its client at 80% and ending it at 100% (0 for no limit)" default:"0"`
+	UserQuota             int      `hcl:"user_quota" flagName:"user-quota" flagDescribe:"Megabytes of output the sessions of a user may send since the server started, warning at 80%, ending them at 100% and refusing new ones (0 for no limit)" default:"0"`
+	WSTimeout             int      `hcl:"ws_timeout" flagName:"ws-timeout" flagDescribe:"Seconds without messages from a client, which pings every 30 seconds, before closing its connection, disabled when 0" default:"0"`
+	EnableWebGL           bool     `hcl:"enable_webgl" flagName:"enable-webgl" flagDescribe:"Enable WebGL renderer" default:"true"`
+	SlowClientBuffer      int      `hcl:"slow_client_buffer" flagName:"slow-client-buffer" flagDescribe:"Megabytes of output to buffer for clients that can't keep up, instead of pausing the command (0)" default:"0"`
+	SlowClientPolicy      string   `hcl:"slow_client_policy" flagName:"slow-client-policy" flagDescribe:"What to do once the buffer of a slow client is full: drop (the oldest output) or disconnect" default:"drop"`
+	SlowClientMemory      int      `hcl:"slow_client_memory" flagName:"slow-client-memory" flagDescribe:"Megabytes of memory for the buffers of all slow clients, unlimited when 0" default:"0"`
+	SlowClientSpill       int      `hcl:"slow_client_spill" flagName:"slow-client-spill" flagDescribe:"Megabytes of output to spill to a temporary file per slow client once its memory is used up (0)" default:"0"`
+	SlowClientSpillDir    string   `hcl:"slow_client_spill_dir" flagName:"slow-client-spill-dir" flagDescribe:"Directory of the spilled output, the default temporary directory when empty" default:""`
+	RecordDir             string   `hcl:"record_dir" flagName:"record-dir" flagDescribe:"Directory to save session recordings to in asciicast v2 format, recording is disabled when empty" default:""`
+	RecordInput           bool     `hcl:"record_input" flagName:"record-input" flagDescribe:"Also record the input of clients, to replay it with gotty replay (BE CAREFUL, this records passwords typed)" default:"false"`
+	SessionSummary        bool     `hcl:"session_summary" flagName:"session-summary" flagDescribe:"Show a summary of the session, its duration, exit status and bytes transferred, instead of the terminal when it ends" default:"false"`
+	RecordingURL          string   `hcl:"recording_url" flagName:"recording-url" flagDescribe:"Link to the recording on the summary of --session-summary, a template of .name, the file in --record-dir, and .session_id (ex: https://recordings.example.com/{{ .name }})" default:""`
+	EnablePlayback        bool     `hcl:"enable_playback" flagName:"playback" flagDescribe:"Replay the recordings of --record-dir with their original timing at <path>playback/<name>/, pausing, seeking and changing speed" default:"false"`
+	RecordMarkers         bool     `hcl:"record_markers" flagName:"record-markers" flagDescribe:"Let clients drop labelled markers, e.g. deploy started, into recordings with Ctrl+Shift+M, shown as chapters in playback" default:"false"`
+	Redact                []string `hcl:"redact" flagName:"redact" flagDescribe:"Sensitive output to redact from recordings, a regular expression or aws-keys or private-keys (can be repeated)"`
+	RedactLive            bool     `hcl:"redact_live" flagName:"redact-live" flagDescribe:"Also redact the output sent to clients, read by read" default:"false"`
+	Triggers              []string `hcl:"triggers" flagName:"trigger" flagDescribe:"Action on output of sessions matching a regular expression, ACTION:REGEXP with ACTION log, webhook, notify (the client) or terminate, e.g. terminate:rm -rf / (can be repeated)"`
+	TriggerWebhook        string   `hcl:"trigger_webhook" flagName:"trigger-webhook" flagDescribe:"URL to POST the webhook triggers fired to, as JSON" default:"" secret:"true"`
+	AdminCredential       string   `hcl:"admin_credential" flagName:"admin-credential" flagDescribe:"Credential of Basic Authentication for the admin API at <path>admin/, apart from the one of clients (ex: ops:pass), which is served only with it or --admin-ca-crt" default:"" secret:"true"`
+	AdminCACrtFile        string   `hcl:"admin_ca_crt_file" flagName:"admin-ca-crt" flagDescribe:"CA certificate file of the client certificates the admin API requires (with --tls and --admin-port)" default:""`
+	AdminPort             string   `hcl:"admin_port" flagName:"admin-port" flagDescribe:"Port to serve the admin API on apart from the page, e.g. to keep it internal (the port of the page when empty)" default:""`
+	AdminAddress          string   `hcl:"admin_address" flagName:"admin-address" flagDescribe:"IP address or network interface name to serve the admin API on with --admin-port (the one of --address when empty)" default:""`
+	EnableMetrics         bool     `hcl:"enable_metrics" flagName:"metrics" flagDescribe:"Serve Prometheus metrics at <path>metrics" default:"false"`
+	MetricsMaxRoutes      int      `hcl:"metrics_max_routes" flagName:"metrics-max-routes" flagDescribe:"Most paths and tenants labeling metrics apart, beyond which they are labeled other (0 for no limit)" default:"100"`
+	EnableWatch           bool     `hcl:"enable_watch" flagName:"watch" flagDescribe:"Let more clients watch each session read-only at <path>s/<session ID>/watch/, with writes rejected" default:"false"`
+	EnablePresent         bool     `hcl:"enable_present" flagName:"present" flagDescribe:"Serve a read-only presentation view of each session at <path>present/<session ID>/, e.g. for projectors" default:"false"`
+	ShareSelections       bool     `hcl:"share_selections" flagName:"share-selections" flagDescribe:"Show the text selections of the client and the presentation views of a session to each other, highlighted by participant" default:"false"`
+	EnableChat            bool     `hcl:"enable_chat" flagName:"chat" flagDescribe:"Let the client and the presentation views of a session chat beside the terminal, recording the messages as markers" default:"false"`
+	ClusterRedis          string   `hcl:"cluster_redis" flagName:"cluster-redis" flagDescribe:"Redis server (host:port or redis://[:password@]host:port/db) to share sessions with other instances, for a global session and max connection" default:""`
+	ClusterPrefix         string   `hcl:"cluster_prefix" flagName:"cluster-prefix" flagDescribe:"Prefix of the keys of this cluster in Redis" default:"gotty"`
+	ClusterNode           string   `hcl:"cluster_node" flagName:"cluster-node" flagDescribe:"Name of this instance in the gotty.node affinity cookie and <path>whereis/<session>, the host name when empty" default:""`
+	Pod                   bool     `hcl:"pod" flagName:"pod" flagDescribe:"Run as a single-use Kubernetes pod: serve /healthz and /readyz, be unready during the session and exit after it" default:"false"`
+	EnableHealth          bool     `hcl:"enable_health" flagName:"health" flagDescribe:"Serve the state of the server as JSON at /healthz and readiness at /readyz, without authentication" default:"false"`
+	HealthStatuses        string   `hcl:"health_statuses" flagName:"health-statuses" flagDescribe:"HTTP statuses of /healthz by state among ok, busy, draining and decommissioned, e.g. decommissioned=503,draining=503 (200 by default)" default:""`
+	PodDrainTimeout       int      `hcl:"pod_drain_timeout" flagName:"pod-drain-timeout" flagDescribe:"Seconds to let the session finish after SIGTERM in pod mode, to keep below terminationGracePeriodSeconds" default:"25"`
+	EnvParam              string   `hcl:"env_param" flagName:"env-param" flagDescribe:"Query parameter selecting the session mode, dev or prod, remembered in the cookie of --env-cookie" default:"ENV"`
+	EnvCookie             string   `hcl:"env_cookie" flagName:"env-cookie" flagDescribe:"Cookie remembering the session mode" default:"gotty.env"`
+	DisableEnvOverride    bool     `hcl:"disable_env_override" flagName:"disable-env-override" flagDescribe:"Ignore the session mode of requests, always running in prod mode" default:"false"`
+	DecommissionWebhook   string   `hcl:"decommission_webhook" flagName:"decommission-webhook" flagDescribe:"URL to post a JSON event to when the server is decommissioned" default:""`
+	DecommissionHook      string   `hcl:"decommission_hook" flagName:"decommission-hook" flagDescribe:"Shell command to run when the server is decommissioned, with GOTTY_NODE, GOTTY_REASON and GOTTY_REMOTE_ADDR set" default:""`
+	Publish               string   `hcl:"publish" flagName:"publish" flagDescribe:"Publish the server on the Internet through a quick tunnel of cloudflare or ngrok, whose command must be installed" default:""`
+	Quiet                 bool     `hcl:"quiet" flagName:"quiet" flagDescribe:"Don't log" default:"false"`
 
 	TitleVariables map[string]interface{}
+	// RouteTitleVariables are added to TitleVariables for the terminals
+	// served at their path, e.g. /tools/htop/.
+	RouteTitleVariables map[string]map[string]interface{}
 }
 
 func (options *Options) Validate() error {
 	if options.EnableTLSClientAuth && !options.EnableTLS {
 		return errors.New("TLS client authentication is enabled, but TLS is not enabled")
 	}
+	if len(options.TLSHosts) > 0 && !options.EnableTLS {
+		return errors.New("TLS hosts are given, but TLS is not enabled")
+	}
+	if p := options.SlowClientPolicy; p != "" && p != "drop" && p != "disconnect" {
+		return fmt.Errorf("invalid slow client policy `%s`, expected drop or disconnect", options.SlowClientPolicy)
+	}
+	if p := options.SizePolicy; p != "" && p != sizeOwner && p != sizeSmallest && p != sizeFixed {
+		return fmt.Errorf("invalid size policy `%s`, expected owner, smallest or fixed", options.SizePolicy)
+	}
+	if options.credentialSources() > 1 {
+		return errors.New("only one of --credential, --credential-file and --credential-vault can be given")
+	}
+	if options.SecretsVault != "" && options.SecretsAWS != "" {
+		return errors.New("only one of --secrets-vault and --secrets-aws can be given")
+	}
+	if options.SecretsRefresh < 0 {
+		return errors.New("--secrets-refresh must not be negative")
+	}
+	if options.IdleTimeout < 0 {
+		return errors.New("--idle-timeout must not be negative")
+	}
+	if options.MaxSessions < 0 {
+		return errors.New("--max-sessions must not be negative")
+	}
+	if options.MetricsMaxRoutes < 0 {
+		return errors.New("--metrics-max-routes must not be negative")
+	}
+	if options.UsageInterval < 0 {
+		return errors.New("--usage-interval must not be negative")
+	}
+	if options.UsageRetention < 0 {
+		return errors.New("--usage-retention must not be negative")
+	}
+	if options.SessionQuota < 0 || options.UserQuota < 0 {
+		return errors.New("--session-quota and --user-quota must not be negative")
+	}
+	if options.WSURL != "" {
+		if u, err := url.Parse(options.WSURL); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return fmt.Errorf("invalid WebSocket URL `%s`, expected ws://host/path or wss://host/path", options.WSURL)
+		}
+	}
+	if (len(options.AllowCountries) > 0 || len(options.DenyCountries) > 0) && len(options.GeoIPDatabases) == 0 {
+		return errors.New("--allow-country and --deny-country require --geoip-db")
+	}
+	if options.LandingFile != "" && !options.ParamForm {
+		return errors.New("--landing requires --param-form")
+	}
+	if (options.ShareSelections || options.EnableChat) && !options.EnablePresent {
+		return errors.New("--share-selections and --chat require --present")
+	}
+	if _, err := options.redactPatterns(); err != nil {
+		return err
+	}
+	if _, err := options.routeTitles(); err != nil {
+		return err
+	}
+	if _, err := options.jwtVerifier(); err != nil {
+		return err
+	}
+	if options.RedactLive && len(options.Redact) == 0 {
+		return errors.New("--redact-live requires --redact")
+	}
+	if options.EnablePlayback && options.RecordDir == "" {
+		return errors.New("--playback requires --record-dir")
+	}
+	if options.RecordingURL != "" && (!options.SessionSummary || options.RecordDir == "") {
+		return errors.New("--recording-url requires --session-summary and --record-dir")
+	}
+	if triggers, err := options.triggers(); err != nil {
+		return err
+	} else if options.TriggerWebhook == "" && slices.ContainsFunc(triggers, func(t trigger) bool { return t.action == triggerWebhook }) {
+		return errors.New("webhook triggers require --trigger-webhook")
+	}
+	if options.Approval && options.ApprovalTimeout <= 0 {
+		return errors.New("--approval-timeout must be positive")
+	}
+	if _, _, err := options.accessWindows(); err != nil {
+		return err
+	}
+	if _, err := options.trustedProxies(); err != nil {
+		return err
+	}
+	if len(options.TrustedProxies) > 0 && (options.credentialSources() > 0 || options.TokenSecret != "") {
+		return errors.New("--trusted-proxy cannot be used with the credential or --token-secret, the proxy authenticates clients")
+	}
+	if len(options.TrustedProxies) > 0 && (!validHeaderName(options.TrustedUserHeader) || !validHeaderName(options.TrustedGroupsHeader)) {
+		return errors.New("invalid --trusted-user-header or --trusted-groups-header")
+	}
+	if options.OIDCIssuer != "" {
+		if options.OIDCClientID == "" || options.OIDCClientSecret == "" {
+			return errors.New("--oidc-issuer requires --oidc-client-id and --oidc-client-secret")
+		}
+		if options.credentialSources() > 0 || options.TokenSecret != "" || len(options.TrustedProxies) > 0 {
+			return errors.New("--oidc-issuer cannot be used with the credential, --token-secret or --trusted-proxy, the provider authenticates clients")
+		}
+		if options.OIDCUserClaim == "" || options.OIDCGroupsClaim == "" {
+			return errors.New("--oidc-user-claim and --oidc-groups-claim cannot be empty")
+		}
+	}
+	if len(options.AllowGroups) > 0 && len(options.TrustedProxies) == 0 && options.OIDCIssuer == "" {
+		return errors.New("--allow-group requires --trusted-proxy or --oidc-issuer")
+	}
+	if options.AccessOverride != "" {
+		if len(options.AccessWindows) == 0 {
+			return errors.New("--access-override requires --access-window")
+		}
+		if err := credentials.Validate(options.AccessOverride); err != nil {
+			return fmt.Errorf("invalid --access-override: %w", err)
+		}
+	}
+	if options.AdminCredential != "" {
+		if err := credentials.Validate(options.AdminCredential); err != nil {
+			return fmt.Errorf("invalid --admin-credential: %w", err)
+		}
+	}
+	if options.AdminPort != "" && !options.adminEnabled() {
+		return errors.New("--admin-port requires --admin-credential or --admin-ca-crt")
+	}
+	if options.AdminCACrtFile != "" && (!options.EnableTLS || options.AdminPort == "") {
+		return errors.New("--admin-ca-crt requires --tls and --admin-port")
+	}
+	if options.AssetsURL != "" {
+		if u, err := url.Parse(options.AssetsURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid assets URL `%s`, expected http://host/path or https://host/path", options.AssetsURL)
+		}
+	}
+	if options.ReconnectGrace < 0 {
+		return errors.New("--reconnect-grace must not be negative")
+	}
+	if options.ExitAfterSessions < 0 {
+		return errors.New("--exit-after-sessions must not be negative")
+	}
+	if options.ExitAfterSessions > 0 && (options.Once || options.Pod) {
+		return errors.New("--exit-after-sessions cannot be used with --once or --pod")
+	}
+	if _, err := options.inputFilter(); err != nil {
+		return err
+	}
+	if _, err := parsePassHeaders(options.PassHeaders); err != nil {
+		return err
+	}
+	if _, err := parseHealthStatuses(options.HealthStatuses); err != nil {
+		return err
+	}
+	if _, ok := publish.Providers[options.Publish]; options.Publish != "" && !ok {
+		return fmt.Errorf("unknown tunnel provider `%s`, expected one of %s", options.Publish, strings.Join(publish.Names(), ", "))
+	}
+	// anybody with the public URL reaches the page, and the terminal with it
+	if options.Publish != "" && !options.Authenticates() && !options.EnableRandomUrl {
+		return errors.New("--publish requires authenticating the clients, e.g. with --credential, or a --random-url")
+	}
 	return nil
 }
+
+// Authenticates returns whether the clients are authenticated, with a
+// credential, tokens, trusted proxies or OpenID Connect.
+func (options *Options) Authenticates() bool {
+	return options.EnableBasicAuth && options.credentialSources() > 0 || options.JWTSecret != "" || options.JWTPublicKeyFile != "" || options.JWTJWKSURL != "" ||
+		options.TokenSecret != "" || len(options.TrustedProxies) > 0 || options.OIDCIssuer != ""
+}
+
+// credentialSources counts the options giving the credential.
+func (options *Options) credentialSources() int {
+	n := 0
+	for _, source := range []string{options.Credential, options.CredentialFile, options.CredentialVault} {
+		if source != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// credentialStore returns the store of the credential given by the options.
+func (options *Options) credentialStore() (credentials.Store, error) {
+	switch {
+	case options.CredentialFile != "":
+		return credentials.NewFile(homedir.Expand(options.CredentialFile))
+	case options.CredentialVault != "":
+		return credentials.NewVault(options.CredentialVault, os.Getenv("VAULT_TOKEN")), nil
+	}
+	return credentials.NewStatic(options.Credential), nil
+}
+
+// Secrets returns the source of the secrets given by the options, or nil.
+func (options *Options) Secrets() (secrets.Source, error) {
+	switch {
+	case options.SecretsVault != "":
+		return secrets.NewVault(options.SecretsVault, os.Getenv("VAULT_TOKEN")), nil
+	case options.SecretsAWS != "":
+		return secrets.NewAWS(options.SecretsAWS)
+	}
+	return nil, nil
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidParams is returned when a client gives parameters that do not
+// match the schema of the factory, see ParamFactory.
+var ErrInvalidParams = errors.New("invalid parameters")
+
+// Types of parameters
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+)
+
+// maxParamName is the longest name of a parameter.
+const maxParamName = 32
+
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Param is a parameter accepted by a factory, see ParamFactory.
+type Param struct {
+	Name string `json:"name"`
+	// Type is ParamString, ParamInt or ParamBool, ParamString if empty.
+	Type    string `json:"type"`
+	Default string `json:"default,omitempty"`
+	// Pattern is a regular expression the whole value must match.
+	Pattern     string `json:"pattern,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ParamFactory is a Factory declaring the parameters it accepts. The server
+// validates them before creating slaves, filling in their defaults, and
+// passes other parameters on unchecked.
+type ParamFactory interface {
+	Factory
+	Params() []Param
+}
+
+// ParseParam parses NAME[=DEFAULT]:TYPE[:REGEXP], a parameter required
+// unless it has a default, e.g. port=22:int or host:string:[a-z0-9.-]+.
+func ParseParam(s string) (Param, error) {
+	head, pattern, _ := strings.Cut(s, ":")
+	name, def, hasDefault := strings.Cut(head, "=")
+	typ, pattern, _ := strings.Cut(pattern, ":")
+	param := Param{Name: name, Type: typ, Default: def, Pattern: pattern, Required: !hasDefault}
+	if _, err := compileParam(param); err != nil {
+		return Param{}, fmt.Errorf("invalid parameter `%s`, expected NAME[=DEFAULT]:TYPE[:REGEXP]: %w", s, err)
+	}
+	return param, nil
+}
+
+// param is a Param with its pattern compiled.
+type param struct {
+	Param
+	pattern *regexp.Regexp
+}
+
+func compileParam(p Param) (param, error) {
+	compiled := param{Param: p}
+	if len(p.Name) > maxParamName || !paramNamePattern.MatchString(p.Name) || p.Name == "arg" {
+		return compiled, fmt.Errorf("invalid name `%s`", p.Name)
+	}
+	switch p.Type {
+	case "", ParamString, ParamInt, ParamBool:
+	default:
+		return compiled, fmt.Errorf("unknown type `%s` of %s, expected string, int or bool", p.Type, p.Name)
+	}
+	if p.Pattern != "" {
+		pattern, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+		if err != nil {
+			return compiled, fmt.Errorf("invalid pattern of %s: %w", p.Name, err)
+		}
+		compiled.pattern = pattern
+	}
+	if p.Default != "" {
+		if err := compiled.check(p.Default); err != nil {
+			return compiled, fmt.Errorf("invalid default: %w", err)
+		}
+	}
+	return compiled, nil
+}
+
+// paramError is a parameter of a client not matching its Param.
+type paramError struct {
+	name   string
+	reason string
+}
+
+func (e *paramError) Error() string {
+	return fmt.Sprintf("invalid parameter %s: %s", e.name, e.reason)
+}
+
+func (e *paramError) Unwrap() error { return ErrInvalidParams }
+
+// check checks value against the type and pattern of p.
+func (p *param) check(value string) error {
+	switch p.Type {
+	case ParamInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return &paramError{p.Name, "must be an integer"}
+		}
+	case ParamBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return &paramError{p.Name, "must be true or false"}
+		}
+	}
+	if p.pattern != nil && !p.pattern.MatchString(value) {
+		return &paramError{p.Name, "does not have the expected format"}
+	}
+	return nil
+}
+
+// factoryParams returns the parameters declared by the factory, if any.
+func factoryParams(factory Factory) ([]param, error) {
+	declaring, ok := factory.(ParamFactory)
+	if !ok {
+		return nil, nil
+	}
+	var params []param
+	for _, p := range declaring.Params() {
+		compiled, err := compileParam(p)
+		if err != nil {
+			return nil, fmt.Errorf("parameter of the %s backend: %w", factory.Name(), err)
+		}
+		params = append(params, compiled)
+	}
+	return params, nil
+}
+
+// checkParams validates the declared parameters of values, setting the
+// defaults of those not given.
+func (server *Server) checkParams(values url.Values) error {
+	for i := range server.params {
+		p := &server.params[i]
+		given := values[p.Name]
+		switch {
+		case len(given) > 1:
+			return &paramError{p.Name, "is given more than once"}
+		case len(given) == 0 || given[0] == "":
+			if p.Default != "" {
+				values[p.Name] = []string{p.Default}
+			} else if p.Required {
+				return &paramError{p.Name, "is required"}
+			}
+		default:
+			if err := p.check(given[0]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleParams reports the parameters declared by the factory as JSON.
+func (server *Server) handleParams(w http.ResponseWriter, r *http.Request) {
+	params := make([]Param, 0, len(server.params))
+	for _, p := range server.params {
+		params = append(params, p.Param)
+	}
+	writeJSON(w, params)
+}
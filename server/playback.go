@@ -0,0 +1,394 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/asciicast"
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// Speeds of playback.
+const (
+	minPlaybackSpeed = 0.25
+	maxPlaybackSpeed = 16
+)
+
+// resetTerminal clears the terminal of a playback before it seeks.
+const resetTerminal = "\x1bc"
+
+// playbackState is the state of a playback sent to the master.
+type playbackState struct {
+	Time     float64 `json:"time"` // the position, in seconds
+	Duration float64 `json:"duration"`
+	Paused   bool    `json:"paused"`
+	Speed    float64 `json:"speed"`
+}
+
+// playbackControl is a control of a playback sent by the master, whose
+// fields are optional.
+type playbackControl struct {
+	Paused *bool    `json:"paused"`
+	Time   *float64 `json:"time"`
+	Speed  *float64 `json:"speed"`
+}
+
+// player is the output of a recording as read by a playback view, with its
+// original timing.
+type player struct {
+	path     string
+	header   asciicast.Header
+	duration float64
+
+	mu       sync.Mutex
+	file     *os.File
+	reader   *asciicast.Reader
+	next     *asciicast.Event // to show once due, nil if not read yet
+	state    playbackState    // whose Time is kept while paused
+	seek     *float64         // to seek to on next Read
+	resumed  time.Time        // when the playback went on from resumeAt
+	resumeAt float64
+	changed  bool          // the state is to be sent
+	controls chan struct{} // wakes Read up on controls
+	closed   chan struct{}
+	pending  []byte
+	tty      *webtty.WebTTY // nil until attached
+}
+
+// recordingPath returns the path of the recording name in Options.RecordDir,
+// a file name, e.g. gotty-20060102-150405-xxxxxxxx.cast.
+func (server *Server) recordingPath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".cast") {
+		return "", ErrSessionNotFound
+	}
+	path := filepath.Join(homedir.Expand(server.options.RecordDir), name)
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return "", ErrSessionNotFound
+	}
+	return path, nil
+}
+
+// newPlayer opens the recording at path, starting to play it.
+func newPlayer(path string) (*player, error) {
+	p := &player{path: path, controls: make(chan struct{}, 1), closed: make(chan struct{})}
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+	p.header = p.reader.Header
+	for {
+		event, err := p.reader.Next()
+		if err != nil {
+			break // the rest of a recording in progress or damaged is left out
+		}
+		p.duration = event.Time
+	}
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+	p.state = playbackState{Duration: p.duration, Speed: 1}
+	p.resumed, p.changed = time.Now(), true
+	return p, nil
+}
+
+// open reads the recording from the start.
+func (p *player) open() error {
+	if p.file != nil {
+		p.file.Close()
+	}
+	file, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	reader, err := asciicast.NewReader(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	p.file, p.reader, p.next = file, reader, nil
+	return nil
+}
+
+// attach makes tty the connection to show the state of the playback to.
+func (p *player) attach(tty *webtty.WebTTY) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tty = tty
+}
+
+// control applies a control of the master, ignoring invalid ones.
+func (p *player) control(data []byte) {
+	var control playbackControl
+	if err := json.Unmarshal(data, &control); err != nil {
+		return
+	}
+	p.mu.Lock()
+	now := time.Now()
+	if control.Time != nil && *control.Time >= 0 {
+		t := min(*control.Time, p.duration)
+		p.seek = &t
+	}
+	if control.Speed != nil && *control.Speed >= minPlaybackSpeed && *control.Speed <= maxPlaybackSpeed {
+		p.resumeAt, p.resumed = p.position(now), now
+		p.state.Speed = *control.Speed
+	}
+	if control.Paused != nil && *control.Paused != p.state.Paused {
+		if *control.Paused {
+			p.state.Time = p.position(now)
+		} else if p.state.Time >= p.duration && p.seek == nil {
+			start := 0.0 // again from the start
+			p.seek = &start
+		} else {
+			p.resumeAt, p.resumed = p.state.Time, now
+		}
+		p.state.Paused = *control.Paused
+	}
+	p.changed = true
+	p.mu.Unlock()
+
+	select {
+	case p.controls <- struct{}{}:
+	default:
+	}
+}
+
+// position returns the time of the recording playing at now, with p locked.
+func (p *player) position(now time.Time) float64 {
+	if p.state.Paused {
+		return p.state.Time
+	}
+	return p.resumeAt + now.Sub(p.resumed).Seconds()*p.state.Speed
+}
+
+func (p *player) Read(b []byte) (int, error) {
+	for len(p.pending) == 0 {
+		wait, err := p.advance()
+		if err != nil {
+			return 0, err
+		}
+		if len(p.pending) > 0 {
+			break
+		}
+		if err := p.wait(wait); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// wait waits for a control, or for d unless 0, returning io.EOF once p is
+// closed.
+func (p *player) wait(d time.Duration) error {
+	var timeout <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-timeout:
+	case <-p.controls:
+	case <-p.closed:
+		return io.EOF
+	}
+	return nil
+}
+
+// advance makes the output due pending, returning how long to wait for
+// the next one otherwise, or 0 to wait for a control.
+func (p *player) advance() (time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.seek != nil {
+		if err := p.seekTo(*p.seek, now); err != nil {
+			return 0, err
+		}
+		p.seek = nil
+	}
+	defer func() {
+		if p.changed && p.tty != nil {
+			p.changed = false
+			state := p.state
+			state.Time = min(p.position(now), p.duration)
+			message, _ := json.Marshal(state)
+			p.tty.SendPlayback(message)
+		}
+	}()
+
+	for len(p.pending) == 0 {
+		if p.next == nil {
+			event, err := p.reader.Next()
+			if err != nil { // the end, until seeking back
+				if !p.state.Paused {
+					p.state.Time, p.state.Paused, p.changed = p.duration, true, true
+				}
+				return 0, nil
+			}
+			p.next = event
+		}
+		if p.state.Paused {
+			return 0, nil
+		}
+		if wait := time.Duration((p.next.Time - p.position(now)) / p.state.Speed * float64(time.Second)); wait > 0 {
+			return wait, nil
+		}
+		p.show(p.next)
+		p.next = nil
+	}
+	return 0, nil
+}
+
+// show makes event pending, with p locked.
+func (p *player) show(event *asciicast.Event) {
+	switch event.Type {
+	case asciicast.Output:
+		p.pending = append(p.pending, event.Data...)
+	case asciicast.Marker:
+		if p.tty != nil {
+			p.tty.SendNotice(event.Data)
+		}
+	}
+}
+
+// seekTo shows the output of the recording up to t at once, with p locked.
+func (p *player) seekTo(t float64, now time.Time) error {
+	if err := p.open(); err != nil {
+		return err
+	}
+	output := bytes.NewBufferString(resetTerminal)
+	for {
+		event, err := p.reader.Next()
+		if err != nil {
+			break
+		}
+		if event.Time > t {
+			p.next = event
+			break
+		}
+		if event.Type == asciicast.Output {
+			output.WriteString(event.Data)
+		}
+	}
+	p.pending = output.Bytes()
+	p.state.Time, p.resumeAt, p.resumed = t, t, now
+	return nil
+}
+
+func (p *player) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (p *player) WindowTitleVariables() map[string]interface{} {
+	return map[string]interface{}{"command": filepath.Base(p.path)}
+}
+
+func (p *player) ResizeTerminal(columns int, rows int) error {
+	return nil
+}
+
+func (p *player) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+		p.file.Close()
+	}
+	return nil
+}
+
+// handlePlayback serves the playback view of a recording at <name>/, the
+// index page loading the rest from the path of the server.
+func (server *Server) handlePlayback(w http.ResponseWriter, r *http.Request) {
+	name, rest, _ := strings.Cut(r.URL.Path, "/")
+	if _, err := server.recordingPath(name); err != nil || rest != "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, name+"/", http.StatusFound)
+		return
+	}
+	server.serveView(w, r, "playback="+url.QueryEscape(name))
+}
+
+// playbackConfig returns the size of the recording played by a page
+// loading config.js with the query r, as JavaScript, or "null".
+func (server *Server) playbackConfig(r *http.Request) string {
+	name := r.URL.Query().Get("playback")
+	if name == "" || !server.options.EnablePlayback {
+		return "null"
+	}
+	path, err := server.recordingPath(name)
+	if err != nil {
+		return "null"
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "null"
+	}
+	defer file.Close()
+	reader, err := asciicast.NewReader(file)
+	if err != nil {
+		return "null"
+	}
+	config, _ := json.Marshal(map[string]int{"columns": reader.Header.Width, "rows": reader.Header.Height})
+	return string(config)
+}
+
+// handlePlaybackWS plays a recording to a playback view, under its
+// controls, until it leaves.
+func (server *Server) handlePlaybackWS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+	path, err := server.recordingPath(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	conn, _, err := server.acceptInit(w, r, nil)
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+	if err != nil {
+		return
+	}
+	player, err := newPlayer(path)
+	if err != nil {
+		closeWithError(conn, err)
+		return
+	}
+	defer player.Close()
+
+	title := player.header.Title
+	if title == "" {
+		title = filepath.Base(path)
+	}
+	tty, err := webtty.New(&wsWrapper{conn}, player,
+		webtty.WithWindowTitle([]byte(title)),
+		webtty.WithPlaybackHandler(player.control),
+		webtty.WithLogger(server.logger.With("remote_addr", r.RemoteAddr)),
+	)
+	if err != nil {
+		closeWithError(conn, err)
+		return
+	}
+	player.attach(tty)
+	server.logger.Info("Playing recording", "path", path, "remote_addr", r.RemoteAddr)
+	closeWithError(conn, tty.Run(r.Context()))
+}
@@ -0,0 +1,503 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// presentBacklog is how many chunks of output a presentation view may lag
+// behind before it is disconnected.
+const presentBacklog = 256
+
+// maxChat is the size of the longest chat message, in bytes.
+const maxChat = 1024
+
+// maxSelection is the size of the largest text selection a participant may
+// share, in bytes of JSON.
+const maxSelection = 256
+
+// selectionColors are the colors of the selections of the participants of a
+// session, by order of arrival.
+var selectionColors = []string{"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4", "#f032e6", "#bfef45"}
+
+// mirror copies the output of a session to its presentation views and keeps
+// the size of its terminal, as arbitrated by Options.SizePolicy, to show it
+// at the same size.
+type mirror struct {
+	slaveWrapper
+
+	mu           sync.Mutex
+	title        []byte
+	viewers      map[*viewerSlave]struct{}
+	policy       string
+	owner        *webtty.WebTTY // of the client, nil until attached
+	ownerColumns int            // asked by the client
+	ownerRows    int
+	columns      int // of the terminal
+	rows         int
+	closed       bool
+
+	participants map[*participant]struct{} // with Options.ShareSelections or Options.EnableChat
+	joined       int
+	recording    *recordingSlave // of the session, annotated with the chat, nil if not recorded
+}
+
+func (server *Server) newMirror(slave Slave, title []byte, recording *recordingSlave) *mirror {
+	m := &mirror{slaveWrapper: slaveWrapper{slave}, title: title, recording: recording, viewers: map[*viewerSlave]struct{}{}, participants: map[*participant]struct{}{}, policy: server.options.SizePolicy, columns: 80, rows: 24}
+	columns, rows := server.options.fixedSize()
+	if columns > 0 {
+		m.columns = columns
+	}
+	if rows > 0 {
+		m.rows = rows
+	}
+	m.ownerColumns, m.ownerRows = m.columns, m.rows
+	return m
+}
+
+func (m *mirror) Read(p []byte) (int, error) {
+	n, err := m.Slave.Read(p)
+	if n > 0 {
+		m.mu.Lock()
+		for viewer := range m.viewers {
+			select {
+			case viewer.chunks <- bytes.Clone(p[:n]):
+			default: // lagging, leaves the output to the others
+				delete(m.viewers, viewer)
+				close(viewer.chunks)
+			}
+		}
+		m.mu.Unlock()
+	}
+	return n, err
+}
+
+// ResizeTerminal resizes the terminal as the client asks, within the size
+// policy.
+func (m *mirror) ResizeTerminal(columns int, rows int) error {
+	m.mu.Lock()
+	m.ownerColumns, m.ownerRows = columns, rows
+	m.mu.Unlock()
+	return m.arbitrate(true)
+}
+
+// arbitrate resizes the terminal to the size of the policy, also when it is
+// unchanged with resize, and shows it to the client and the views.
+func (m *mirror) arbitrate(resize bool) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	columns, rows := m.ownerColumns, m.ownerRows
+	if m.policy == sizeSmallest {
+		for viewer := range m.viewers {
+			if viewer.columns > 0 && viewer.rows > 0 {
+				columns, rows = min(columns, viewer.columns), min(rows, viewer.rows)
+			}
+		}
+	}
+	changed := columns != m.columns || rows != m.rows
+	m.columns, m.rows = columns, rows
+	var err error
+	if changed || resize {
+		err = m.Slave.ResizeTerminal(columns, rows)
+	}
+	owner := m.owner
+	var views []*webtty.WebTTY
+	if changed {
+		for viewer := range m.viewers {
+			if viewer.tty != nil {
+				views = append(views, viewer.tty)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if owner != nil {
+		owner.Resized(columns, rows)
+	}
+	for _, tty := range views {
+		tty.SendTerminalSize(columns, rows)
+	}
+	return err
+}
+
+// attach makes tty the connection of the client of the session, e.g. once
+// resumed.
+func (m *mirror) attach(tty *webtty.WebTTY) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.owner = tty
+}
+
+func (m *mirror) Close() error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		for viewer := range m.viewers {
+			close(viewer.chunks)
+		}
+		m.viewers = nil
+	}
+	m.mu.Unlock()
+	return m.Slave.Close()
+}
+
+func (m *mirror) size() (columns int, rows int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.columns, m.rows
+}
+
+// watch returns the slave of a new presentation view, or nil once the
+// session ended.
+func (m *mirror) watch() *viewerSlave {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	viewer := &viewerSlave{mirror: m, chunks: make(chan []byte, presentBacklog)}
+	m.viewers[viewer] = struct{}{}
+	return viewer
+}
+
+// viewerSlave is the output of a session as read by a presentation view,
+// which neither writes to the session nor resizes it but with the size
+// policy smallest.
+type viewerSlave struct {
+	mirror  *mirror
+	chunks  chan []byte
+	pending []byte
+	tty     *webtty.WebTTY // of the view, nil until attached
+	columns int            // fitting the view, 0 until known
+	rows    int
+}
+
+func (v *viewerSlave) Read(p []byte) (int, error) {
+	if len(v.pending) == 0 {
+		chunk, ok := <-v.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		v.pending = chunk
+	}
+	n := copy(p, v.pending)
+	v.pending = v.pending[n:]
+	return n, nil
+}
+
+func (v *viewerSlave) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (v *viewerSlave) WindowTitleVariables() map[string]interface{} {
+	return v.mirror.WindowTitleVariables()
+}
+
+// ResizeTerminal takes the size fitting the view into account with the size
+// policy smallest.
+func (v *viewerSlave) ResizeTerminal(columns int, rows int) error {
+	if v.mirror.policy != sizeSmallest || columns <= 0 || rows <= 0 {
+		return nil
+	}
+	v.mirror.mu.Lock()
+	v.columns, v.rows = columns, rows
+	v.mirror.mu.Unlock()
+	return v.mirror.arbitrate(false)
+}
+
+// attach makes tty the connection of the view, showing it the size of the
+// session.
+func (v *viewerSlave) attach(tty *webtty.WebTTY) {
+	v.mirror.mu.Lock()
+	v.tty = tty
+	columns, rows := v.mirror.columns, v.mirror.rows
+	v.mirror.mu.Unlock()
+	tty.SendTerminalSize(columns, rows)
+}
+
+func (v *viewerSlave) Close() error {
+	v.mirror.mu.Lock()
+	if _, ok := v.mirror.viewers[v]; ok {
+		delete(v.mirror.viewers, v)
+		close(v.chunks)
+	}
+	v.mirror.mu.Unlock()
+	if v.mirror.policy == sizeSmallest {
+		// the session may grow back
+		return v.mirror.arbitrate(false)
+	}
+	return nil
+}
+
+// participant is the client or a presentation view of a session, sharing
+// its text selection and chatting with the others, see
+// Options.ShareSelections and Options.EnableChat.
+type participant struct {
+	mirror    *mirror
+	id        int
+	name      string
+	color     string
+	tty       *webtty.WebTTY  // nil until attached
+	selection json.RawMessage // the last shared one, nil if none
+}
+
+// join adds a participant named name, e.g. after its user, to the sharing of
+// selections and the chat, until it leaves.
+func (m *mirror) join(name string) *participant {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := &participant{mirror: m, id: m.joined, name: name, color: selectionColors[m.joined%len(selectionColors)]}
+	m.joined++
+	m.participants[p] = struct{}{}
+	return p
+}
+
+// ttys returns the connections of the participants but except, with the
+// mirror locked.
+func (m *mirror) ttys(except *participant) []*webtty.WebTTY {
+	var ttys []*webtty.WebTTY
+	for p := range m.participants {
+		if p != except && p.tty != nil {
+			ttys = append(ttys, p.tty)
+		}
+	}
+	return ttys
+}
+
+// attach makes tty the connection of p, e.g. once resumed, and shows it the
+// selections of the others.
+func (p *participant) attach(tty *webtty.WebTTY) {
+	p.mirror.mu.Lock()
+	p.tty = tty
+	var messages [][]byte
+	for other := range p.mirror.participants {
+		if other != p && other.selection != nil {
+			messages = append(messages, other.message())
+		}
+	}
+	p.mirror.mu.Unlock()
+	for _, message := range messages {
+		tty.SendSelection(message)
+	}
+}
+
+// share shows selection, JSON or empty to clear it, to the others.
+func (p *participant) share(selection []byte) {
+	if len(selection) > maxSelection || len(selection) > 0 && !json.Valid(selection) {
+		return
+	}
+	if len(selection) == 0 || string(selection) == "null" {
+		selection = nil
+	}
+	p.mirror.mu.Lock()
+	p.selection = selection
+	message, ttys := p.message(), p.mirror.ttys(p)
+	p.mirror.mu.Unlock()
+	for _, tty := range ttys {
+		tty.SendSelection(message)
+	}
+}
+
+// chat sends text to all the participants, p included, and records it as a
+// marker of the recording of the session.
+func (p *participant) chat(text []byte) {
+	text = bytes.TrimSpace(text)
+	if len(text) == 0 || len(text) > maxChat || !utf8.Valid(text) {
+		return
+	}
+	message, _ := json.Marshal(struct {
+		Participant int       `json:"participant"`
+		Name        string    `json:"name,omitempty"`
+		Color       string    `json:"color"`
+		Text        string    `json:"text"`
+		Time        time.Time `json:"time"`
+	}{p.id, p.name, p.color, string(text), time.Now()})
+	if p.mirror.recording != nil {
+		name := p.name
+		if name == "" {
+			name = fmt.Sprintf("#%d", p.id)
+		}
+		p.mirror.recording.annotate(name + ": " + string(text))
+	}
+	p.mirror.mu.Lock()
+	ttys := p.mirror.ttys(nil)
+	p.mirror.mu.Unlock()
+	for _, tty := range ttys {
+		tty.SendChat(message)
+	}
+}
+
+// leave clears the selection of p for the others.
+func (p *participant) leave() {
+	p.mirror.mu.Lock()
+	delete(p.mirror.participants, p)
+	if p.selection == nil {
+		p.mirror.mu.Unlock()
+		return
+	}
+	p.selection = nil
+	message, ttys := p.message(), p.mirror.ttys(p)
+	p.mirror.mu.Unlock()
+	for _, tty := range ttys {
+		tty.SendSelection(message)
+	}
+}
+
+func (p *participant) message() []byte {
+	message, _ := json.Marshal(struct {
+		Participant int             `json:"participant"`
+		Name        string          `json:"name,omitempty"`
+		Color       string          `json:"color"`
+		Selection   json.RawMessage `json:"selection"`
+	}{p.id, p.name, p.color, p.selection})
+	return message
+}
+
+// participantOptions returns the options of the connection of p.
+func (server *Server) participantOptions(p *participant) []webtty.Option {
+	var opts []webtty.Option
+	if server.options.ShareSelections {
+		opts = append(opts, webtty.WithSelectionHandler(p.share))
+	}
+	if server.options.EnableChat {
+		opts = append(opts, webtty.WithChatHandler(p.chat))
+	}
+	return opts
+}
+
+// presented returns the mirror of the session with id.
+func (server *Server) presented(id string) (*mirror, error) {
+	session, err := server.sessions.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.mirror == nil {
+		return nil, ErrSessionNotFound
+	}
+	return session.mirror, nil
+}
+
+// handlePresent serves the presentation view of a session at <id>/,
+// the index page loading the rest from the path of the server.
+func (server *Server) handlePresent(w http.ResponseWriter, r *http.Request) {
+	id, rest, _ := strings.Cut(r.URL.Path, "/")
+	if _, err := server.presented(id); err != nil || rest != "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, id+"/", http.StatusFound)
+		return
+	}
+	server.serveView(w, r, "present="+id)
+}
+
+// serveView serves the index page of a view at <path><view>/<id>/, or
+// deeper, e.g. <path>s/<id>/watch/, loading config.js with query.
+func (server *Server) serveView(w http.ResponseWriter, r *http.Request, query string) {
+	nonce := server.injections.nonce()
+	indexVars, err := server.indexPageVariables(r, nonce)
+	if err != nil {
+		http.Error(w, "Internal Server Error", 500)
+		return
+	}
+	head, _ := indexVars["head"].(template.HTML)
+	base := strings.Repeat("../", strings.Count(r.URL.Path, "/")+1) // of the stripped path
+	indexVars["head"] = template.HTML(`<base href="`+base+`">`) + head
+	indexVars["query"] = template.URL(query)
+
+	policy, err := server.injections.policy(nonce)
+	if err != nil {
+		http.Error(w, "Internal Server Error", 500)
+		return
+	}
+	if policy != "" {
+		w.Header().Set("Content-Security-Policy", policy)
+	}
+	indexBuf := new(bytes.Buffer)
+	if err := server.indexTemplate.Execute(indexBuf, indexVars); err != nil {
+		http.Error(w, "Internal Server Error", 500)
+		return
+	}
+	w.Write(indexBuf.Bytes())
+}
+
+// presentConfig returns the size of the session presented by a page
+// loading config.js with the query r, as JavaScript, or "null".
+func (server *Server) presentConfig(r *http.Request) string {
+	id := r.URL.Query().Get("present")
+	if id == "" || !server.options.EnablePresent {
+		return "null"
+	}
+	mirror, err := server.presented(id)
+	if err != nil {
+		return "null"
+	}
+	columns, rows := mirror.size()
+	config, _ := json.Marshal(map[string]int{"columns": columns, "rows": rows})
+	return string(config)
+}
+
+// handlePresentWS mirrors the output of a session to a presentation view
+// until either ends.
+func (server *Server) handlePresentWS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+	mirror, err := server.presented(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	conn, _, err := server.acceptInit(w, r, nil)
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+	if err != nil {
+		return
+	}
+	viewer := mirror.watch()
+	if viewer == nil {
+		closeWithError(conn, webtty.ErrSlaveClosed)
+		return
+	}
+	defer viewer.Close()
+
+	opts := []webtty.Option{
+		webtty.WithWindowTitle(mirror.title),
+		webtty.WithArbitratedSize(),
+		webtty.WithLogger(server.logger.With("remote_addr", r.RemoteAddr)),
+	}
+	var viewing *participant
+	if server.options.ShareSelections || server.options.EnableChat {
+		viewing = mirror.join(requestUser(r))
+		defer viewing.leave()
+		opts = append(opts, server.participantOptions(viewing)...)
+	}
+	tty, err := webtty.New(&wsWrapper{conn}, viewer, opts...)
+	if err != nil {
+		closeWithError(conn, err)
+		return
+	}
+	viewer.attach(tty)
+	if viewing != nil {
+		viewing.attach(tty)
+	}
+	server.logger.Info("Presenting session", "session_id", r.PathValue("id"), "remote_addr", r.RemoteAddr)
+	closeWithError(conn, tty.Run(r.Context()))
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrQuotaExceeded ends sessions whose output used up Limits.SessionQuota
+// or the Limits.UserQuota of their user, and refuses the sessions of users
+// whose quota is used up.
+var ErrQuotaExceeded = errors.New("bandwidth quota exceeded")
+
+// quotaWarning is the percentage of a quota a session is warned at.
+const quotaWarning = 80
+
+// userQuotas counts the output of the sessions of each user, see
+// Limits.UserQuota.
+type userQuotas struct {
+	mu   sync.Mutex
+	used map[string]int64
+}
+
+// add counts n bytes of output of user, returning the bytes used so far.
+func (q *userQuotas) add(user string, n int64) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.used == nil {
+		q.used = map[string]int64{}
+	}
+	q.used[user] += n
+	return q.used[user]
+}
+
+// checkQuota refuses the sessions of users whose quota is used up.
+func (server *Server) checkQuota(session *SessionInfo) error {
+	quota := server.Limits().UserQuota
+	if quota == 0 || session.User == "" {
+		return nil
+	}
+	if server.userQuotas.add(session.User, 0) >= megabytes(quota) {
+		return fmt.Errorf("%w for user %s", ErrQuotaExceeded, session.User)
+	}
+	return nil
+}
+
+func megabytes(n int) int64 { return int64(n) << 20 }
+
+// quotaSlave enforces the bandwidth quotas on the output of a session.
+type quotaSlave struct {
+	slaveWrapper
+
+	server  *Server
+	session *SessionInfo
+	limits  Limits // when the session started
+	used    int64  // by the session
+	warned  bool
+}
+
+func (qs *quotaSlave) Read(p []byte) (int, error) {
+	n, err := qs.Slave.Read(p)
+	if n > 0 {
+		qs.used += int64(n)
+		percent := quotaPercent(qs.used, qs.limits.SessionQuota)
+		if qs.limits.UserQuota > 0 && qs.session.User != "" {
+			used := qs.server.userQuotas.add(qs.session.User, int64(n))
+			percent = max(percent, quotaPercent(used, qs.limits.UserQuota))
+		}
+		if percent >= quotaWarning && !qs.warned {
+			qs.warned = true
+			qs.server.quotaNotice(qs.session, percent)
+		}
+		if percent >= 100 {
+			if managed, err := qs.server.sessions.get(qs.session.ID); err == nil {
+				managed.cancel(ErrQuotaExceeded)
+			}
+		}
+	}
+	return n, err
+}
+
+// quotaPercent returns the percentage of a quota of megabytes used, 0 for
+// no quota.
+func quotaPercent(used int64, quota int) int64 {
+	if quota == 0 {
+		return 0
+	}
+	return used * 100 / megabytes(quota)
+}
+
+// quotaNotice warns the client of session about its bandwidth quota.
+func (server *Server) quotaNotice(session *SessionInfo, percent int64) {
+	server.logger.Info("Bandwidth quota nearly used up", "session_id", session.ID, "user", session.User, "percent", percent)
+	if managed, err := server.sessions.get(session.ID); err == nil {
+		managed.tty.Load().SendNotice(fmt.Sprintf("%d%% of the bandwidth quota used, the session ends at 100%%", min(percent, 100)))
+	}
+}
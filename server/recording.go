@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sorenisanerd/gotty/pkg/asciicast"
+	"github.com/sorenisanerd/gotty/pkg/homedir"
+	"github.com/sorenisanerd/gotty/pkg/randomstring"
+)
+
+// maxMarker is the size of the longest label of a marker, in bytes.
+const maxMarker = 200
+
+// recordingSlave writes everything the slave outputs to an asciicast file.
+type recordingSlave struct {
+	slaveWrapper
+
+	file       *os.File
+	name       string // of file in Options.RecordDir
+	recorder   *asciicast.Writer
+	input      bool          // records the input too
+	redactor   *redactor     // of the output, nil without Options.Redact
+	redactions *atomic.Int64 // counted by the live redaction instead, if nil
+	logger     *slog.Logger
+}
+
+func (server *Server) newRecordingSlave(slave Slave, title string, activity *activity) (*recordingSlave, error) {
+	dir := homedir.Expand(server.options.RecordDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory `%s`: %w", dir, err)
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("gotty-%s-%s.cast", now.Format("20060102-150405"), randomstring.Generate(8))
+	path := filepath.Join(dir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording `%s`: %w", path, err)
+	}
+
+	width, height := server.options.Width, server.options.Height
+	if width == 0 {
+		width = 80
+	}
+	if height == 0 {
+		height = 24
+	}
+	recorder, err := asciicast.NewWriter(file, asciicast.Header{
+		Width:     width,
+		Height:    height,
+		Timestamp: now.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write recording header to `%s`: %w", path, err)
+	}
+
+	server.logger.Info("Recording session", "path", path)
+	rs := &recordingSlave{slaveWrapper: slaveWrapper{slave}, file: file, name: name, recorder: recorder, input: server.options.RecordInput, logger: server.logger}
+	if len(server.redactPatterns) > 0 {
+		rs.redactor = &redactor{patterns: server.redactPatterns}
+	}
+	if !server.options.RedactLive {
+		rs.redactions = &activity.redactions
+	}
+	return rs, nil
+}
+
+func (rs *recordingSlave) Read(p []byte) (n int, err error) {
+	n, err = rs.Slave.Read(p)
+	if n > 0 {
+		rs.writeOutput(p[:n], false)
+	}
+	return n, err
+}
+
+// writeOutput records output, redacted, the output kept back too if flush.
+func (rs *recordingSlave) writeOutput(output []byte, flush bool) {
+	if rs.redactor != nil {
+		var count int
+		output, count = rs.redactor.write(output, flush)
+		if rs.redactions != nil {
+			rs.redactions.Add(int64(count))
+		}
+	}
+	if err := rs.recorder.WriteOutput(output); err != nil {
+		rs.logger.Warn("Failed to write recording", "error", err)
+	}
+}
+
+func (rs *recordingSlave) Write(p []byte) (n int, err error) {
+	if rs.input && len(p) > 0 {
+		if err := rs.recorder.WriteEvent(asciicast.Input, string(p)); err != nil {
+			rs.logger.Warn("Failed to write recording", "error", err)
+		}
+	}
+	return rs.Slave.Write(p)
+}
+
+func (rs *recordingSlave) ResizeTerminal(columns int, rows int) error {
+	if err := rs.recorder.WriteResize(columns, rows); err != nil {
+		rs.logger.Warn("Failed to write recording", "error", err)
+	}
+	return rs.Slave.ResizeTerminal(columns, rows)
+}
+
+// annotate records a marker labelled label, e.g. a chat message.
+func (rs *recordingSlave) annotate(label string) {
+	if err := rs.recorder.WriteEvent(asciicast.Marker, label); err != nil {
+		rs.logger.Warn("Failed to write recording", "error", err)
+	}
+}
+
+// mark records a marker dropped by the client, e.g. "deploy started",
+// ignoring labels of control characters, which players would print.
+func (rs *recordingSlave) mark(label []byte) {
+	label = bytes.TrimSpace(label)
+	if len(label) == 0 || len(label) > maxMarker || !utf8.Valid(label) || bytes.ContainsFunc(label, unicode.IsControl) {
+		return
+	}
+	rs.annotate(string(label))
+}
+
+// flush records the output kept back by the redaction.
+func (rs *recordingSlave) flush() {
+	if rs.redactor != nil {
+		rs.writeOutput(nil, true)
+	}
+}
+
+func (rs *recordingSlave) Close() error {
+	err := rs.Slave.Close()
+	rs.flush()
+	rs.file.Close()
+	return err
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sorenisanerd/gotty/pkg/asciicast"
+)
+
+// echoSlave outputs what is written to it.
+type echoSlave struct {
+	output chan []byte
+}
+
+func newEchoSlave() *echoSlave {
+	return &echoSlave{output: make(chan []byte, 16)}
+}
+
+func (s *echoSlave) Read(p []byte) (int, error) {
+	data, ok := <-s.output
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(p, data), nil
+}
+
+func (s *echoSlave) Write(p []byte) (int, error) {
+	s.output <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func (s *echoSlave) WindowTitleVariables() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func (s *echoSlave) ResizeTerminal(columns int, rows int) error {
+	return nil
+}
+
+func (s *echoSlave) Close() error {
+	close(s.output)
+	return nil
+}
+
+func TestRecording(t *testing.T) {
+	server, err := New(&Options{RecordDir: t.TempDir()}, WithFactory(echoFactory{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slave, err := server.newRecordingSlave(newEchoSlave(), "gotty@localhost", &activity{})
+	if err != nil {
+		t.Fatalf("newRecordingSlave() returned error: %v", err)
+	}
+	slave.ResizeTerminal(100, 30)
+	slave.Write([]byte("hi"))
+	buf := make([]byte, 16)
+	if n, err := slave.Read(buf); err != nil || string(buf[:n]) != "hi" {
+		t.Fatalf("Read() = %q, %v, expected the input echoed", buf[:n], err)
+	}
+	slave.Close()
+
+	recordings, _ := filepath.Glob(filepath.Join(server.options.RecordDir, "*.cast"))
+	if len(recordings) != 1 {
+		t.Fatalf("recordings = %v, expected one", recordings)
+	}
+	file, err := os.Open(recordings[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := asciicast.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Header.Title != "gotty@localhost" || reader.Header.Width != 80 || reader.Header.Height != 24 {
+		t.Errorf("header = %+v, expected the title and the default size", reader.Header)
+	}
+	recorded := map[string]string{}
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded[event.Type] += event.Data
+	}
+	expected := map[string]string{asciicast.Output: "hi", asciicast.Resize: "100x30"}
+	if !maps.Equal(recorded, expected) {
+		t.Errorf("recorded %v, expected %v", recorded, expected)
+	}
+}
+
+// echoFactory creates echoSlaves.
+type echoFactory struct{}
+
+func (echoFactory) Name() string {
+	return "echo"
+}
+
+func (echoFactory) New(params map[string][]string, headers map[string][]string) (Slave, error) {
+	return newEchoSlave(), nil
+}
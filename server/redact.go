@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// redactedText replaces the sensitive output.
+const redactedText = "[REDACTED]"
+
+// redactWindow is how many bytes at the end of the output recorded last are
+// kept back, to redact secrets split across reads.
+const redactWindow = 1024
+
+// maxRedactPending is how many bytes of output are kept back at most, e.g.
+// of a private key missing its end line.
+const maxRedactPending = 64 << 10
+
+// redactPresets are the patterns named by Options.Redact.
+var redactPresets = map[string]string{
+	"aws-keys":     `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b|(?i)aws_secret_access_key\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}`,
+	"private-keys": `-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?(?:-----END [A-Z0-9 ]*PRIVATE KEY-----|\z)`,
+}
+
+// redactPatterns returns the patterns of Options.Redact.
+func (options *Options) redactPatterns() ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(options.Redact))
+	for _, s := range options.Redact {
+		expr, ok := redactPresets[s]
+		if !ok {
+			expr = s
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern `%s`: %w", s, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// redact replaces the matches of patterns in p, returning their count.
+func redact(patterns []*regexp.Regexp, p []byte) ([]byte, int) {
+	count := 0
+	for _, pattern := range patterns {
+		p = pattern.ReplaceAllFunc(p, func([]byte) []byte {
+			count++
+			return []byte(redactedText)
+		})
+	}
+	return p, count
+}
+
+// redactor redacts a stream, keeping back its last bytes to redact secrets
+// split across writes.
+type redactor struct {
+	patterns []*regexp.Regexp
+
+	mu      sync.Mutex
+	pending []byte
+}
+
+// write returns the redacted output no match may span beyond with p, the
+// rest too if flush, and the number of redactions.
+func (r *redactor) write(p []byte, flush bool) ([]byte, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	output := append(r.pending, p...)
+	cut := len(output)
+	if !flush && len(output) <= maxRedactPending {
+		cut = max(len(output)-redactWindow, 0)
+		for moved := true; moved; {
+			moved = false
+			for _, pattern := range r.patterns {
+				for _, match := range pattern.FindAllIndex(output, -1) {
+					if match[0] < cut && match[1] > cut {
+						cut, moved = match[0], true
+					}
+				}
+			}
+		}
+	}
+	r.pending = append([]byte(nil), output[cut:]...)
+	return redact(r.patterns, output[:cut])
+}
+
+// redactingSlave redacts the output of a slave read by read, see
+// Options.RedactLive.
+type redactingSlave struct {
+	slaveWrapper
+
+	patterns   []*regexp.Regexp
+	redactions *atomic.Int64
+	pending    []byte // of the redacted output, longer than the read
+	err        error  // of the read of pending
+}
+
+func (rs *redactingSlave) Read(p []byte) (int, error) {
+	if len(rs.pending) == 0 {
+		if rs.err != nil {
+			return 0, rs.err
+		}
+		n, err := rs.Slave.Read(p)
+		output, count := redact(rs.patterns, p[:n])
+		if count == 0 {
+			return n, err
+		}
+		rs.redactions.Add(int64(count))
+		rs.pending, rs.err = output, err
+	}
+	n := copy(p, rs.pending)
+	rs.pending = rs.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// retryAfterMin is the least wait estimated for rejected connections.
+	retryAfterMin = time.Second
+	// retryAfterUnknown is the wait estimated before any session ended.
+	retryAfterUnknown = 10 * time.Second
+)
+
+// rejectReason returns the reason counted in the metrics for connections
+// rejected with err while the server is busy, or "" for other errors.
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, errSessionActive):
+		return "session_active"
+	case errors.Is(err, ErrMaxConnections):
+		return "max_connections"
+	}
+	return ""
+}
+
+// retryAfter estimates how long until a session ends to make room for
+// another: the average duration of sessions less the time the oldest
+// running one has taken.
+func (server *Server) retryAfter() time.Duration {
+	average := server.stats.average()
+	if average == 0 {
+		return retryAfterUnknown
+	}
+	wait := average
+	for _, session := range server.sessions.List() {
+		if remaining := average - time.Since(session.StartedAt); remaining < wait {
+			wait = remaining
+		}
+	}
+	return max(wait, retryAfterMin)
+}
+
+// rejected counts a connection to path rejected with err and sets the Retry-After
+// header of its response, if any, returning the wait in seconds, or 0 when
+// err does not reject it for being busy.
+func (server *Server) rejected(header http.Header, path string, err error) int {
+	reason := rejectReason(err)
+	if reason == "" {
+		return 0
+	}
+	server.metrics.Add(metricRejected, 1, "path", path, "reason", reason)
+	seconds := int(math.Ceil(server.retryAfter().Seconds()))
+	if header != nil {
+		header.Set("Retry-After", strconv.Itoa(seconds))
+	}
+	return seconds
+}
+
+// reject responds to a request to path, before any WebSocket upgrade, with err
+// and the estimated wait before connecting again.
+func (server *Server) reject(w http.ResponseWriter, path string, err error) {
+	writeErrorResponse(w, err, server.rejected(w.Header(), path, err))
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Periods of usage reports.
+const (
+	ReportDay   = "day"
+	ReportWeek  = "week" // starting on Monday
+	ReportMonth = "month"
+)
+
+// UsageRecord is the usage of a command by a user over a period, in the
+// sessions that ended in it.
+type UsageRecord struct {
+	Period   string  `json:"period"` // first day, as 2006-01-02 in UTC
+	User     string  `json:"user"`
+	Command  string  `json:"command"`
+	Sessions int64   `json:"sessions"`
+	Duration float64 `json:"duration"` // wall-clock time of the sessions, in seconds
+	CPUTime  float64 `json:"cpu_time"` // of the commands where sampled, in seconds
+}
+
+type usageKey struct {
+	day     int64 // since the epoch, in UTC
+	user    string
+	command string
+}
+
+// usageReports keeps the usage of the sessions that ended by day, for
+// retention days.
+type usageReports struct {
+	mu        sync.Mutex
+	retention int
+	days      map[usageKey]*UsageRecord
+}
+
+func newUsageReports(retention int) *usageReports {
+	return &usageReports{retention: retention, days: map[usageKey]*UsageRecord{}}
+}
+
+// record adds the usage of session, which ended at end.
+func (u *usageReports) record(session SessionInfo, end time.Time) {
+	if u.retention == 0 {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	day := end.Unix() / 86400
+	key := usageKey{day: day, user: session.User, command: session.Command}
+	record, ok := u.days[key]
+	if !ok {
+		record = &UsageRecord{User: session.User, Command: session.Command}
+		u.days[key] = record
+	}
+	record.Sessions++
+	record.Duration += end.Sub(session.StartedAt).Seconds()
+	record.CPUTime += session.CPUTime.Seconds()
+
+	for key := range u.days {
+		if key.day <= day-int64(u.retention) {
+			delete(u.days, key)
+		}
+	}
+}
+
+// report returns the usage of the days from from to to, in UTC, summed up
+// by period, user and command.
+func (u *usageReports) report(period string, from time.Time, to time.Time) []UsageRecord {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	first, last := from.Unix()/86400, to.Unix()/86400
+	records := map[usageKey]*UsageRecord{}
+	for key, day := range u.days {
+		if key.day < first || key.day > last {
+			continue
+		}
+		start := periodStart(period, time.Unix(key.day*86400, 0).UTC())
+		periodKey := usageKey{day: start.Unix() / 86400, user: key.user, command: key.command}
+		record, ok := records[periodKey]
+		if !ok {
+			record = &UsageRecord{Period: start.Format(time.DateOnly), User: key.user, Command: key.command}
+			records[periodKey] = record
+		}
+		record.Sessions += day.Sessions
+		record.Duration += day.Duration
+		record.CPUTime += day.CPUTime
+	}
+
+	list := make([]UsageRecord, 0, len(records))
+	for _, record := range records {
+		list = append(list, *record)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Period != list[j].Period {
+			return list[i].Period < list[j].Period
+		}
+		if list[i].User != list[j].User {
+			return list[i].User < list[j].User
+		}
+		return list[i].Command < list[j].Command
+	})
+	return list
+}
+
+// periodStart returns the first day of the period of day.
+func periodStart(period string, day time.Time) time.Time {
+	switch period {
+	case ReportWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case ReportMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// UsageReport returns the usage of the sessions that ended from the day of
+// from to the one of to, in UTC, by period, one of ReportDay, ReportWeek and
+// ReportMonth, user and command. Only the last Options.UsageRetention days
+// are kept.
+func (server *Server) UsageReport(period string, from time.Time, to time.Time) ([]UsageRecord, error) {
+	if period != ReportDay && period != ReportWeek && period != ReportMonth {
+		return nil, errors.New("period must be day, week or month")
+	}
+	return server.reports.report(period, from, to), nil
+}
+
+// sessionCommand returns the command of the sessions of route run with
+// params, with its arguments, for the usage reports.
+func (server *Server) sessionCommand(route *route, params url.Values) string {
+	vars := server.serverVariables(route)
+	command, _ := vars["command"].(string)
+	if command == "" {
+		command = server.factory.Name()
+	}
+	argv, _ := vars["argv"].([]string)
+	return strings.Join(append(append([]string{command}, argv...), params["arg"]...), " ")
+}
+
+// handleAdminUsage reports the usage of the sessions from the from to the
+// to dates by period, the last 30 days by day by default, as JSON or, with
+// format=csv, CSV.
+func (server *Server) handleAdminUsage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -29)
+	var err error
+	if value := query.Get("from"); value != "" {
+		if from, err = time.Parse(time.DateOnly, value); err != nil {
+			http.Error(w, "Malformed request: invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = time.Parse(time.DateOnly, value); err != nil {
+			http.Error(w, "Malformed request: invalid to date", http.StatusBadRequest)
+			return
+		}
+	}
+	period := query.Get("period")
+	if period == "" {
+		period = ReportDay
+	}
+	records, err := server.UsageReport(period, from, to)
+	if err != nil {
+		http.Error(w, "Malformed request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "json":
+		writeJSON(w, records)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="gotty-usage.csv"`)
+		w.Header().Set("Cache-Control", "no-store")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"period", "user", "command", "sessions", "duration", "cpu_time"})
+		for _, record := range records {
+			cw.Write([]string{
+				record.Period, record.User, record.Command, strconv.FormatInt(record.Sessions, 10),
+				strconv.FormatFloat(record.Duration, 'f', 3, 64), strconv.FormatFloat(record.CPUTime, 'f', 3, 64),
+			})
+		}
+		cw.Flush()
+	default:
+		http.Error(w, "Malformed request: format must be json or csv", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// capabilityResume is the capability of clients resuming their session with
+// InitMessage.ResumeToken once their connection is lost.
+const capabilityResume = "resume"
+
+// resumeRequest hands the connection of a client resuming its session over
+// to the handler still running the session.
+type resumeRequest struct {
+	conn *websocket.Conn
+	init InitMessage
+	done chan error // the error ending the session on conn
+}
+
+// resumes are the sessions waiting for their client, by resume token.
+type resumes struct {
+	mu       sync.Mutex
+	requests map[string]chan *resumeRequest
+}
+
+func newResumes() *resumes {
+	return &resumes{requests: map[string]chan *resumeRequest{}}
+}
+
+// waiting returns whether a session waits for its client.
+func (r *resumes) waiting() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests) > 0
+}
+
+// await waits up to grace for the client of token to resume its session,
+// returning nil when it does not or the slave exits meanwhile.
+func (r *resumes) await(ctx context.Context, token string, grace time.Duration, exited <-chan struct{}) *resumeRequest {
+	requests := make(chan *resumeRequest, 1)
+	r.mu.Lock()
+	r.requests[token] = requests
+	r.mu.Unlock()
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case request := <-requests:
+		return request
+	case <-timer.C:
+	case <-ctx.Done():
+	case <-exited:
+	}
+
+	r.mu.Lock()
+	delete(r.requests, token)
+	r.mu.Unlock()
+	select {
+	case request := <-requests: // sent meanwhile
+		return request
+	default:
+		return nil
+	}
+}
+
+// resume passes request to the session of token, returning false if none waits.
+func (r *resumes) resume(token string, request *resumeRequest) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	requests, ok := r.requests[token]
+	if !ok {
+		return false
+	}
+	delete(r.requests, token)
+	requests <- request
+	return true
+}
+
+// acceptedConn is the connection of a client accepted before the admission
+// of its session, with its init message.
+type acceptedConn struct {
+	conn *websocket.Conn
+	init InitMessage
+}
+
+// acceptResume accepts the connection of a client while a session waits for
+// its client, and hands it over to the session when its init message
+// carries the resume token of the session. It returns the connection of
+// other clients, to be admitted as new sessions, or nil once done with it.
+func (server *Server) acceptResume(w http.ResponseWriter, r *http.Request, route *route, responseHeader http.Header) *acceptedConn {
+	if r.Method != "GET" {
+		writeError(w, errMethodNotAllowed)
+		return nil
+	}
+	conn, init, err := server.acceptInit(w, r, responseHeader)
+	if err != nil {
+		// closed by acceptInit
+		if conn != nil {
+			conn.Close()
+		}
+		return nil
+	}
+	if init.ResumeToken != "" {
+		if err := init.validate(); err != nil {
+			closeWithError(conn, err)
+			conn.Close()
+			return nil
+		}
+		request := &resumeRequest{conn: conn, init: init, done: make(chan error, 1)}
+		if server.resumes.resume(init.ResumeToken, request) {
+			server.logger.Info("Session resumed", "remote_addr", r.RemoteAddr, "path", route.path)
+			closeWithError(conn, <-request.done)
+			conn.Close()
+			return nil
+		}
+	}
+	return &acceptedConn{conn: conn, init: init}
+}
+
+// detachableSlave reads its slave in its own goroutine, so that the WebTTY
+// of a resumed session takes over the output once the one of the lost
+// connection returned, without losing any to the read it left pending.
+type detachableSlave struct {
+	slaveWrapper
+
+	chunks    chan []byte
+	exited    chan struct{} // once the slave cannot be read anymore
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	pending  []byte // read, not taken yet
+	err      error  // of the slave, once read
+	attached *attachment
+}
+
+func newDetachableSlave(slave Slave) *detachableSlave {
+	ds := &detachableSlave{
+		slaveWrapper: slaveWrapper{slave},
+		chunks:       make(chan []byte),
+		exited:       make(chan struct{}),
+		closed:       make(chan struct{}),
+	}
+	go ds.pump()
+	return ds
+}
+
+// pump reads the slave one chunk ahead of the attached WebTTY, which keeps
+// the slave waiting for slow clients as without detaching.
+func (ds *detachableSlave) pump() {
+	for {
+		buffer := make([]byte, 32*1024)
+		n, err := ds.Slave.Read(buffer)
+		if err != nil {
+			ds.mu.Lock()
+			ds.pending = append(ds.pending, buffer[:n]...)
+			ds.err = err
+			ds.mu.Unlock()
+			close(ds.exited)
+			return
+		}
+		select {
+		case ds.chunks <- buffer[:n]:
+		case <-ds.closed:
+			return
+		}
+	}
+}
+
+// attach returns the slave of a new WebTTY, detaching the previous one.
+func (ds *detachableSlave) attach() *attachment {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.attached != nil {
+		close(ds.attached.detached)
+	}
+	ds.attached = &attachment{detachableSlave: ds, detached: make(chan struct{})}
+	return ds.attached
+}
+
+// detach ends the reads of the attached WebTTY, keeping the output for the
+// next one.
+func (ds *detachableSlave) detach() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.attached != nil {
+		close(ds.attached.detached)
+		ds.attached = nil
+	}
+}
+
+func (ds *detachableSlave) Close() error {
+	ds.closeOnce.Do(func() { close(ds.closed) })
+	return ds.Slave.Close()
+}
+
+// attachment is a detachableSlave as seen by one WebTTY. It leaves the
+// slave running when stopped, as the session may be resumed; the server
+// closes it once the session ends.
+type attachment struct {
+	*detachableSlave
+
+	detached chan struct{}
+}
+
+func (a *attachment) Read(p []byte) (int, error) {
+	for {
+		a.mu.Lock()
+		select {
+		case <-a.detached:
+			a.mu.Unlock()
+			return 0, io.EOF
+		default:
+		}
+		if len(a.pending) > 0 {
+			n := copy(p, a.pending)
+			a.pending = a.pending[n:]
+			a.mu.Unlock()
+			return n, nil
+		}
+		err := a.err
+		a.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+
+		select {
+		case <-a.detached:
+			return 0, io.EOF
+		case <-a.exited:
+		case data := <-a.chunks:
+			a.mu.Lock()
+			a.pending = append(a.pending, data...)
+			a.mu.Unlock()
+		}
+	}
+}
+
+func (a *attachment) Stop(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sorenisanerd/gotty/pkg/credentials"
+)
+
+var errNoCredential = errors.New("basic authentication is disabled")
+
+type credentialRequest struct {
+	Credential string `json:"credential"`
+}
+
+// RotateCredential replaces the credential of Basic Authentication in its
+// store. Running sessions continue, while new connections require the new
+// credential.
+func (server *Server) RotateCredential(ctx context.Context, credential string) error {
+	if server.credentials == nil {
+		return errNoCredential
+	}
+	if err := server.credentials.Rotate(ctx, credential); err != nil {
+		return err
+	}
+	server.logger.Info("Credential rotated")
+	return nil
+}
+
+// handleCredential rotates the credential for callers authenticated with it.
+func (server *Server) handleCredential(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Context().Value(accessTokenKey) != nil {
+		http.Error(w, "Rotating the credential requires the credential", http.StatusForbidden)
+		return
+	}
+
+	var request credentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Malformed request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := server.RotateCredential(r.Context(), request.Credential); err != nil {
+		if errors.Is(err, credentials.ErrInvalid) {
+			http.Error(w, "Malformed request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, errCredentialManaged) {
+			http.Error(w, "The credential is managed by the secrets source", http.StatusConflict)
+			return
+		}
+		server.logger.Warn("Failed to rotate the credential", "error", err, "remote_addr", r.RemoteAddr)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/credentials"
+	"github.com/sorenisanerd/gotty/pkg/secrets"
+)
+
+// The keys of the secrets loaded from a secrets.Source.
+const (
+	secretCredential  = "credential"
+	secretTokenSecret = "token_secret"
+	secretTLSCrt      = "tls_crt" // PEM
+	secretTLSKey      = "tls_key" // PEM
+)
+
+// secretsTimeout bounds the loading of secrets.
+const secretsTimeout = 30 * time.Second
+
+var errCredentialManaged = errors.New("the credential is managed by the secrets source")
+
+// secretValues are the secrets of a source, reloaded while the server runs.
+type secretValues struct {
+	source secrets.Source
+
+	mu          sync.RWMutex
+	values      map[string]string
+	certificate *tls.Certificate // of tls_crt and tls_key, if any
+}
+
+// load fetches the secrets, keeping the previous ones when they are invalid.
+func (s *secretValues) load(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, secretsTimeout)
+	defer cancel()
+	values, err := s.source.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	if credential, ok := values[secretCredential]; ok {
+		if err := credentials.Validate(credential); err != nil {
+			return fmt.Errorf("%s: %w", s.source, err)
+		}
+	}
+	var certificate *tls.Certificate
+	if values[secretTLSCrt] != "" || values[secretTLSKey] != "" {
+		pair, err := tls.X509KeyPair([]byte(values[secretTLSCrt]), []byte(values[secretTLSKey]))
+		if err != nil {
+			return fmt.Errorf("%s: invalid %s and %s: %w", s.source, secretTLSCrt, secretTLSKey, err)
+		}
+		certificate = &pair
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values, s.certificate = values, certificate
+	return nil
+}
+
+// get returns the secret of key, or "".
+func (s *secretValues) get(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[key]
+}
+
+func (s *secretValues) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.certificate == nil {
+		return nil, fmt.Errorf("%s has no %s", s.source, secretTLSCrt)
+	}
+	return s.certificate, nil
+}
+
+// refreshSecrets reloads the secrets every interval until ctx is canceled.
+func (server *Server) refreshSecrets(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := server.secrets.load(ctx); err != nil {
+				server.logger.Warn("Failed to reload secrets, keeping the previous ones", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// tokenSecret returns the secret of access tokens, from the secrets if
+// they hold one.
+func (server *Server) tokenSecret() string {
+	if server.secrets != nil {
+		if secret := server.secrets.get(secretTokenSecret); secret != "" {
+			return secret
+		}
+	}
+	return server.options.TokenSecret
+}
+
+// managedCredential is the credentials.Store of a credential loaded from
+// the secrets, which are rotated in the secrets manager.
+type managedCredential struct {
+	secrets *secretValues
+}
+
+func (mc managedCredential) Get(ctx context.Context) (string, error) {
+	return mc.secrets.get(secretCredential), nil
+}
+
+func (mc managedCredential) Rotate(ctx context.Context, credential string) error {
+	return errCredentialManaged
+}
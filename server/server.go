@@ -4,11 +4,16 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
@@ -19,36 +24,202 @@ import (
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/gorilla/websocket"
-	"github.com/pkg/errors"
 
 	"github.com/sorenisanerd/gotty/bindata"
+	"github.com/sorenisanerd/gotty/pkg/cluster"
+	"github.com/sorenisanerd/gotty/pkg/credentials"
+	"github.com/sorenisanerd/gotty/pkg/geoip"
 	"github.com/sorenisanerd/gotty/pkg/homedir"
+	"github.com/sorenisanerd/gotty/pkg/jwt"
+	"github.com/sorenisanerd/gotty/pkg/metrics"
+	"github.com/sorenisanerd/gotty/pkg/oidc"
+	"github.com/sorenisanerd/gotty/pkg/publish"
 	"github.com/sorenisanerd/gotty/pkg/randomstring"
+	"github.com/sorenisanerd/gotty/pkg/spill"
 	"github.com/sorenisanerd/gotty/webtty"
 )
 
 // Server provides a webtty HTTP endpoint.
 type Server struct {
-	factory Factory
-	options *Options
+	factory        Factory
+	options        *Options
+	logger         *slog.Logger
+	authenticator  Authenticator
+	listeners      []net.Listener
+	wsListeners    []net.Listener // of the WebSocket endpoint, apart from the page
+	wsPort         string         // of wsListeners
+	adminListeners []net.Listener // of the admin API, apart from the page
+	middleware     middlewares
+	events         Events
+	metrics        metrics.Metrics
+	store          cluster.Store     // nil unless clustered
+	credentials    credentials.Store // of Basic Authentication, nil without it
+	secrets        *secretValues     // nil without a secrets source
+	node           string
+	reusable       bool // serving sessions after each other, see WithReuse
 
 	upgrader         *websocket.Upgrader
 	indexTemplate    *template.Template
+	landingTemplate  *template.Template // of Options.ParamForm
 	titleTemplate    *noesctmpl.Template
+	routeTitles      map[string]*noesctmpl.Template // of Options.RouteTitles, by path
+	hostCertificates map[string]*tls.Certificate    // of Options.TLSHosts, by hostname
+	hostHandlers     map[string]http.Handler        // of WithHostHandler, by hostname
+	wsQueryTemplate  *noesctmpl.Template
+	motdTemplate     *noesctmpl.Template // nil without Options.MOTD
+	recordingURL     *noesctmpl.Template // nil without Options.RecordingURL
 	manifestTemplate *template.Template
-
-	terminating     int32 // atomic flag for termination state
-	activeWebsocket int32 // atomic flag to ensure only one websocket is active at a time
-
-	sessionMu      sync.Mutex
-	activeSession  bool
-	decommissioned bool
-	unhealthy      int32
+	injections       *injections
+	assets           *assets
+	geoip            geoip.Databases // of Options.GeoIPDatabases, if any
+	accessWindows    []accessWindow
+	accessLocation   *time.Location // of accessWindows
+	trustedProxies   []netip.Prefix // of Options.TrustedProxies
+	oidc             *oidc.Provider // of Options.OIDCIssuer
+	oidcKey          []byte         // signing the cookies of oidc
+	jwt              *jwt.Verifier  // of Options.JWTSecret and the RS256 keys, if any
+	triggers         []trigger
+	params           []param          // declared by the factory
+	redactPatterns   []*regexp.Regexp // of Options.Redact
+	userQuotas       userQuotas
+	limits           atomic.Pointer[Limits]
+	approvals        *approvals
+	tokens           *tokenStore
+	sessions         *SessionManager
+	resumes          *resumes
+	stats            *stats
+	reports          *usageReports
+	outputBudget     *spill.Budget // of the buffers of slow clients
+	backendMemory    atomic.Int64  // of the commands of all sessions, as last sampled
+
+	terminating int32 // atomic flag for termination state
+
+	sessionMu       sync.Mutex
+	closing         bool // admitting no more sessions, terminating once the last one ends
+	decommissioning bool // to be decommissioned once the last session ends
+	decommissioned  bool
+	unhealthy       int32
+	draining        int32 // atomic flag set once Run stops accepting sessions
+	started         time.Time
+	lastCloseReason string // of the last connection
+	healthStatuses  map[string]int
+	passedHeaders   []passedHeader
+	inputFilter     webtty.InputFilter               // of Options.InputPolicy, if any
+	hooks           sync.WaitGroup                   // running decommission hooks
+	exitStatus      atomic.Pointer[webtty.ExitError] // returned by Run when exiting on a command exit
+	keepAlives      keepAlives
 }
 
 // New creates a new instance of Server.
-// Server will use the New() of the factory provided to handle each request.
-func New(factory Factory, options *Options) (*Server, error) {
+// Server will use the New() of the factory given with WithFactory() to handle each request.
+func New(options *Options, opts ...ServerOption) (*Server, error) {
+	server := &Server{options: options}
+	for _, opt := range opts {
+		opt(server)
+	}
+	if server.factory == nil {
+		return nil, errors.New("no factory given")
+	}
+	if server.logger == nil {
+		server.logger = slog.Default()
+	}
+	if server.events == nil {
+		server.events = NopEvents{}
+	}
+	if server.metrics == nil {
+		server.metrics = NewMetrics(options)
+	}
+	if options.SlowClientBuffer > 0 {
+		server.outputBudget = spill.NewBudget(int64(options.SlowClientMemory)<<20, server.outputBuffered)
+	}
+	healthStatuses, err := parseHealthStatuses(options.HealthStatuses)
+	if err != nil {
+		return nil, err
+	}
+	server.healthStatuses = healthStatuses
+	server.passedHeaders, err = parsePassHeaders(options.PassHeaders)
+	if err != nil {
+		return nil, err
+	}
+	server.inputFilter, err = options.inputFilter()
+	if err != nil {
+		return nil, err
+	}
+	server.started = time.Now()
+	server.node = options.ClusterNode
+	if server.node == "" {
+		server.node, _ = os.Hostname()
+	}
+	if server.store == nil && options.ClusterRedis != "" {
+		store, err := cluster.NewRedis(options.ClusterRedis)
+		if err != nil {
+			return nil, err
+		}
+		server.store = store
+	}
+	if server.secrets == nil {
+		source, err := options.Secrets()
+		if err != nil {
+			return nil, err
+		}
+		if source != nil {
+			server.secrets = &secretValues{source: source}
+		}
+	}
+	if server.secrets != nil {
+		if err := server.secrets.load(context.Background()); err != nil {
+			return nil, fmt.Errorf("failed to load secrets: %w", err)
+		}
+		if server.credentials == nil && server.secrets.get(secretCredential) != "" {
+			server.credentials = managedCredential{server.secrets}
+		}
+	}
+	if server.authenticator == nil && server.credentials == nil && options.EnableBasicAuth {
+		if server.credentials, err = options.credentialStore(); err != nil {
+			return nil, err
+		}
+	}
+	if server.authenticator == nil && server.credentials != nil {
+		server.authenticator = &basicAuthenticator{credentials: server.credentials}
+	}
+	if options.AccessOverride != "" {
+		if server.authenticator == nil {
+			return nil, errors.New("--access-override requires Basic Authentication")
+		}
+		server.authenticator = overrideAuthenticator{server.authenticator, options.AccessOverride}
+	}
+	if server.accessWindows, server.accessLocation, err = options.accessWindows(); err != nil {
+		return nil, err
+	}
+	if len(server.adminListeners) > 0 && !options.adminEnabled() {
+		return nil, errors.New("the admin API requires --admin-credential or --admin-ca-crt")
+	}
+	if server.trustedProxies, err = options.trustedProxies(); err != nil {
+		return nil, err
+	}
+	if len(server.trustedProxies) > 0 && server.authenticator != nil {
+		return nil, errors.New("--trusted-proxy replaces the authentication of GoTTY, which cannot be used with it")
+	}
+	if options.OIDCIssuer != "" {
+		if server.authenticator != nil {
+			return nil, errors.New("--oidc-issuer replaces the authentication of GoTTY, which cannot be used with it")
+		}
+		server.oidc = oidc.New(options.OIDCIssuer, options.OIDCClientID, options.OIDCClientSecret)
+		server.oidcKey = []byte(randomstring.Generate(32))
+	}
+	if server.jwt, err = options.jwtVerifier(); err != nil {
+		return nil, err
+	}
+	if server.triggers, err = options.triggers(); err != nil {
+		return nil, err
+	}
+	if server.redactPatterns, err = options.redactPatterns(); err != nil {
+		return nil, err
+	}
+	if server.params, err = factoryParams(server.factory); err != nil {
+		return nil, err
+	}
+
 	indexData, err := bindata.Fs.ReadFile("static/index.html")
 	if err != nil {
 		panic("index not found") // must be in bindata
@@ -57,14 +228,36 @@ func New(factory Factory, options *Options) (*Server, error) {
 		path := homedir.Expand(options.IndexFile)
 		indexData, err = os.ReadFile(path)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to read custom index file at `%s`", path)
+			return nil, fmt.Errorf("failed to read custom index file at `%s`: %w", path, err)
 		}
 	}
 	indexTemplate, err := template.New("index").Parse(string(indexData))
 	if err != nil {
+		if options.IndexFile != "" {
+			return nil, fmt.Errorf("failed to parse custom index file: %w", err)
+		}
 		panic("index template parse failed") // must be valid
 	}
 
+	landingData, err := bindata.Fs.ReadFile("static/landing.html")
+	if err != nil {
+		panic("landing page not found") // must be in bindata
+	}
+	if options.LandingFile != "" {
+		path := homedir.Expand(options.LandingFile)
+		landingData, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read custom landing file at `%s`: %w", path, err)
+		}
+	}
+	landingTemplate, err := template.New("landing").Parse(string(landingData))
+	if err != nil {
+		if options.LandingFile != "" {
+			return nil, fmt.Errorf("failed to parse custom landing file: %w", err)
+		}
+		panic("landing template parse failed") // must be valid
+	}
+
 	manifestData, err := bindata.Fs.ReadFile("static/manifest.json")
 	if err != nil {
 		panic("manifest not found") // must be in bindata
@@ -74,41 +267,143 @@ func New(factory Factory, options *Options) (*Server, error) {
 		panic("manifest template parse failed") // must be valid
 	}
 
-	titleTemplate, err := noesctmpl.New("title").Parse(options.TitleFormat)
+	titleTemplate, err := noesctmpl.New("title").Funcs(titleFuncs).Parse(options.TitleFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse window title format `%s`: %w", options.TitleFormat, err)
+	}
+
+	routeTitles, err := options.routeTitles()
+	if err != nil {
+		return nil, err
+	}
+	hostCertificates, err := options.hostCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	wsQueryTemplate, err := noesctmpl.New("ws_query_args").Parse(options.WSQueryArgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse websocket query arguments `%s`: %w", options.WSQueryArgs, err)
+	}
+
+	var recordingURL *noesctmpl.Template
+	if options.RecordingURL != "" {
+		if recordingURL, err = noesctmpl.New("recording_url").Parse(options.RecordingURL); err != nil {
+			return nil, fmt.Errorf("failed to parse recording URL `%s`: %w", options.RecordingURL, err)
+		}
+	}
+
+	var motdTemplate *noesctmpl.Template
+	if options.MOTD != "" {
+		if motdTemplate, err = noesctmpl.New("motd").Funcs(titleFuncs).Parse(options.MOTD); err != nil {
+			return nil, fmt.Errorf("failed to parse message of the day `%s`: %w", options.MOTD, err)
+		}
+	}
+
+	injections, err := newInjections(options)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := newAssets(options.AssetsURL)
+	if err != nil {
+		return nil, err
+	}
+	geoipDatabases, err := geoip.OpenAll(options.GeoIPDatabases)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to parse window title format `%s`", options.TitleFormat)
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
 	}
 
 	var originChekcer func(r *http.Request) bool
 	if options.WSOrigin != "" {
 		matcher, err := regexp.Compile(options.WSOrigin)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to compile regular expression of Websocket Origin: %s", options.WSOrigin)
+			return nil, fmt.Errorf("failed to compile regular expression of Websocket Origin: %s: %w", options.WSOrigin, err)
 		}
 		originChekcer = func(r *http.Request) bool {
 			return matcher.MatchString(r.Header.Get("Origin"))
 		}
+	} else if options.WSPort != "" || len(server.wsListeners) > 0 {
+		// the page is on another port of the same host
+		originChekcer = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Hostname(), requestHostname(r))
+		}
 	}
 
-	return &Server{
-		factory: factory,
-		options: options,
+	server.upgrader = &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    webtty.Protocols,
+		CheckOrigin:     originChekcer,
+	}
+	server.indexTemplate = indexTemplate
+	server.landingTemplate = landingTemplate
+	server.titleTemplate = titleTemplate
+	server.routeTitles = routeTitles
+	server.hostCertificates = hostCertificates
+	server.wsQueryTemplate = wsQueryTemplate
+	server.motdTemplate = motdTemplate
+	server.recordingURL = recordingURL
+	server.manifestTemplate = manifestTemplate
+	server.injections = injections
+	server.assets = assets
+	server.geoip = geoipDatabases
+	server.tokens = newTokenStore()
+	server.sessions = newSessionManager()
+	server.resumes = newResumes()
+	server.approvals = newApprovals()
+	server.stats = newStats()
+	server.reports = newUsageReports(options.UsageRetention)
+	if err := server.SetLimits(options.Limits()); err != nil {
+		return nil, err
+	}
+	if err := server.checkTemplates(); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
 
-		upgrader: &websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			Subprotocols:    webtty.Protocols,
-			CheckOrigin:     originChekcer,
-		},
-		indexTemplate:    indexTemplate,
-		titleTemplate:    titleTemplate,
-		manifestTemplate: manifestTemplate,
-	}, nil
+// checkTemplates renders the templates once, so that errors in the title
+// format or a custom index file stop the server instead of failing requests.
+func (server *Server) checkTemplates() error {
+	r := &http.Request{RemoteAddr: "127.0.0.1:1", Header: http.Header{}, URL: &url.URL{}}
+	indexVars, err := server.indexPageVariables(r, server.injections.nonce())
+	if err != nil {
+		return fmt.Errorf("failed to render window title format `%s`: %w", server.options.TitleFormat, err)
+	}
+	if err := server.indexTemplate.Execute(io.Discard, indexVars); err != nil {
+		return fmt.Errorf("failed to render index page: %w", err)
+	}
+	if err := server.manifestTemplate.Execute(io.Discard, indexVars); err != nil {
+		return err
+	}
+	if _, err := server.wsQueryArgs(r); err != nil {
+		return fmt.Errorf("failed to render websocket query arguments `%s`: %w", server.options.WSQueryArgs, err)
+	}
+	if server.recordingURL != nil {
+		if err := server.recordingURL.Execute(io.Discard, map[string]interface{}{"name": "", "session_id": ""}); err != nil {
+			return fmt.Errorf("failed to render recording URL `%s`: %w", server.options.RecordingURL, err)
+		}
+	}
+	for path := range server.routeTitles {
+		route := &route{path: path}
+		server.routeTitle(route)
+		if _, err := server.indexVariables(r.WithContext(context.WithValue(context.Background(), routeKey, route))); err != nil {
+			return fmt.Errorf("failed to render window title format of %s: %w", path, err)
+		}
+	}
+	return nil
 }
 
 // Run starts the main process of the Server.
 // The cancelation of ctx will shutdown the server immediately with aborting
 // existing connections. Use WithGracefullContext() to support gracefull shutdown.
+// When exiting after the sessions of ExitAfterSessions or on ExitOnSlaveExit,
+// Run returns the *webtty.ExitError of the last command, if it exited so.
 func (server *Server) Run(ctx context.Context, options ...RunOption) error {
 	cctx, cancel := context.WithCancel(ctx)
 	opts := &RunOptions{gracefullCtx: context.Background()}
@@ -116,60 +411,142 @@ func (server *Server) Run(ctx context.Context, options ...RunOption) error {
 		opt(opts)
 	}
 
-	counter := newCounter(time.Duration(server.options.Timeout) * time.Second)
+	path := server.pathPrefix()
+	route := server.newRoute(path)
+	handlers := server.setupHandlers(cctx, cancel, route)
+	var err error
 
-	path := server.options.Path
-	if server.options.EnableRandomUrl {
-		path = "/" + randomstring.Generate(server.options.RandomUrlLength) + "/"
+	switch policy := server.options.inputPolicy(); policy {
+	case inputWrite:
+		server.logger.Info("Permitting clients to write input to the PTY")
+	case inputScroll, inputAllow:
+		server.logger.Info("Permitting clients to write some keys to the PTY", "input_policy", policy)
 	}
-	if !strings.HasPrefix(path, "/") {
-		path = "/" + path
+	if server.options.Pod {
+		server.logger.Info("Pod mode, serving a single session with probes at /healthz and /readyz")
+	} else if server.options.Once {
+		server.logger.Info("Once option is provided, accepting only one client")
 	}
-	if !strings.HasSuffix(path, "/") {
-		path = path + "/"
+
+	listeners := server.listeners
+	if len(listeners) == 0 {
+		if server.options.Port == "0" {
+			server.logger.Info("Port number configured to `0`, choosing a random port")
+		}
+		listeners, err = server.listen(server.options.Address, server.options.Port)
+		if err != nil {
+			return err
+		}
 	}
-	handlers := server.setupHandlers(cctx, cancel, path, counter)
-	srv, err := server.setupHTTPServer(handlers)
-	if err != nil {
-		return errors.Wrapf(err, "failed to setup an HTTP server")
+	wsListeners := server.wsListeners
+	if len(wsListeners) == 0 && server.options.WSPort != "" {
+		wsListeners, err = server.listen(server.wsAddress(), server.options.WSPort)
+		if err != nil {
+			if len(server.listeners) == 0 {
+				for _, listener := range listeners {
+					listener.Close()
+				}
+			}
+			return err
+		}
 	}
 
-	if server.options.PermitWrite {
-		log.Printf("Permitting clients to write input to the PTY.")
-	}
-	if server.options.Once {
-		log.Printf("Once option is provided, accepting only one client")
+	adminListeners := server.adminListeners
+	if len(adminListeners) == 0 && server.options.adminEnabled() && server.options.AdminPort != "" {
+		adminListeners, err = server.listen(server.adminAddress(), server.options.AdminPort)
+		if err != nil {
+			if len(server.listeners) == 0 {
+				for _, listener := range listeners {
+					listener.Close()
+				}
+			}
+			if len(server.wsListeners) == 0 {
+				for _, listener := range wsListeners {
+					listener.Close()
+				}
+			}
+			return err
+		}
 	}
 
-	if server.options.Port == "0" {
-		log.Printf("Port number configured to `0`, choosing a random port")
+	if len(server.hostCertificates) > 0 || len(server.hostHandlers) > 0 {
+		handlers = server.wrapHosts(handlers)
 	}
-	hostPort := net.JoinHostPort(server.options.Address, server.options.Port)
-	listener, err := net.Listen("tcp", hostPort)
+	srv, err := server.setupHTTPServer(handlers)
 	if err != nil {
-		return errors.Wrapf(err, "failed to listen at `%s`", hostPort)
+		return fmt.Errorf("failed to setup an HTTP server: %w", err)
+	}
+	// the admin API on its own listeners, e.g. kept internal
+	adminSrv := &http.Server{}
+	if len(adminListeners) > 0 {
+		adminSrv.Handler = wrapMiddleware(server.adminHandler(path), server.middleware.outer)
+		if server.options.AdminCACrtFile != "" {
+			if adminSrv.TLSConfig, err = server.adminTLSConfig(); err != nil {
+				return fmt.Errorf("failed to setup TLS configuration of the admin API: %w", err)
+			}
+		} else if server.tlsFromSecrets() {
+			adminSrv.TLSConfig = &tls.Config{GetCertificate: server.secrets.getCertificate}
+		}
+	}
+	// the WebSocket endpoint on its own listeners, e.g. behind a CDN serving the page
+	wsSrv := &http.Server{}
+	if len(wsListeners) > 0 {
+		wsPath := path + "ws"
+		if wsSrv, err = server.setupHTTPServer(onlyPath(handlers, wsPath, true)); err != nil {
+			return fmt.Errorf("failed to setup an HTTP server: %w", err)
+		}
+		srv.Handler = onlyPath(handlers, wsPath, false)
+		if _, port, err := net.SplitHostPort(wsListeners[0].Addr().String()); err == nil {
+			server.wsPort = port
+		}
 	}
 
 	scheme := "http"
 	if server.options.EnableTLS {
 		scheme = "https"
 	}
-	host, port, _ := net.SplitHostPort(listener.Addr().String())
-	log.Printf("HTTP server is listening at: %s", scheme+"://"+net.JoinHostPort(host, port)+path)
-	if server.options.Address == "0.0.0.0" {
+	var localHost, port string
+	for _, listener := range listeners {
+		host, p, err := net.SplitHostPort(listener.Addr().String())
+		if err != nil { // e.g. tunnels
+			server.logger.Info("HTTP server is listening", "address", listener.Addr().String())
+			continue
+		}
+		localHost, port = host, p
+		if net.ParseIP(host).IsUnspecified() {
+			localHost = "localhost"
+		}
+		server.logger.Info("HTTP server is listening", "url", serverURL(scheme, host, port, path))
+	}
+	for _, listener := range wsListeners {
+		server.logger.Info("WebSocket endpoint is listening", "address", listener.Addr().String())
+	}
+	for _, listener := range adminListeners {
+		server.logger.Info("Admin API is listening", "address", listener.Addr().String())
+	}
+	if addresses, _ := server.listenAddresses(server.options.Address); len(server.listeners) == 0 && len(addresses) == 1 && net.ParseIP(addresses[0].host).IsUnspecified() {
 		for _, address := range listAddresses() {
-			log.Printf("Alternative URL: %s", scheme+"://"+net.JoinHostPort(address, port)+path)
+			server.logger.Info("Alternative URL", "url", serverURL(scheme, address, port, path))
 		}
 	}
 
-	srvErr := make(chan error, 1)
-	go func() {
+	crtFile, keyFile := homedir.Expand(server.options.TLSCrtFile), homedir.Expand(server.options.TLSKeyFile)
+	if server.tlsFromSecrets() {
+		crtFile, keyFile = "", "" // served by the GetCertificate of the TLS config
+		if server.options.EnableTLS {
+			server.logger.Info("Using TLS", "secrets", server.secrets.source.String())
+		}
+	} else if server.options.EnableTLS {
+		server.logger.Info("Using TLS", "crt_file", crtFile, "key_file", keyFile)
+	}
+	for _, host := range server.options.TLSHosts {
+		name, files, _ := strings.Cut(host, "=")
+		server.logger.Info("Using TLS for a hostname", "host", name, "files", files)
+	}
+	srvErr := make(chan error, len(listeners)+len(wsListeners)+len(adminListeners))
+	serve := func(srv *http.Server, listener net.Listener) {
+		var err error
 		if server.options.EnableTLS {
-			crtFile := homedir.Expand(server.options.TLSCrtFile)
-			keyFile := homedir.Expand(server.options.TLSKeyFile)
-			log.Printf("TLS crt file: " + crtFile)
-			log.Printf("TLS key file: " + keyFile)
-
 			err = srv.ServeTLS(listener, crtFile, keyFile)
 		} else {
 			err = srv.Serve(listener)
@@ -177,16 +554,46 @@ func (server *Server) Run(ctx context.Context, options ...RunOption) error {
 		if err != nil {
 			srvErr <- err
 		}
-	}()
+	}
+	for _, listener := range listeners {
+		go serve(srv, listener)
+	}
+	for _, listener := range wsListeners {
+		go serve(wsSrv, listener)
+	}
+	for _, listener := range adminListeners {
+		go serve(adminSrv, listener)
+	}
 
 	go func() {
 		select {
 		case <-opts.gracefullCtx.Done():
+			// keep answering probes until the sessions end
+			server.startDraining()
+			for route.counter.count() > 0 && cctx.Err() == nil {
+				time.Sleep(100 * time.Millisecond)
+			}
+			wsSrv.Shutdown(context.Background())
+			adminSrv.Shutdown(context.Background())
 			srv.Shutdown(context.Background())
 		case <-cctx.Done():
 		}
 	}()
 
+	if server.options.Publish != "" && port != "" {
+		server.logger.Info("Publishing through a tunnel", "provider", server.options.Publish)
+		tunnel, err := publish.Start(cctx, server.options.Publish, serverURL(scheme, localHost, port, ""))
+		if err != nil {
+			cancel()
+			srv.Close()
+			wsSrv.Close()
+			adminSrv.Close()
+			return err
+		}
+		defer tunnel.Close()
+		server.logger.Info("Public URL", "url", strings.TrimSuffix(tunnel.URL, "/")+path)
+	}
+
 	select {
 	case err = <-srvErr:
 		if err == http.ErrServerClosed { // by gracefull ctx
@@ -196,24 +603,72 @@ func (server *Server) Run(ctx context.Context, options ...RunOption) error {
 		}
 	case <-cctx.Done():
 		srv.Close()
+		wsSrv.Close()
+		adminSrv.Close()
 		err = cctx.Err()
 	}
 
-	conn := counter.count()
+	conn := route.counter.count()
 	if conn > 0 {
-		log.Printf("Waiting for %d connections to be closed", conn)
+		server.logger.Info("Waiting for connections to be closed", "connections", conn)
 	}
-	counter.wait()
+	route.counter.wait()
+	server.hooks.Wait()
 
+	if status := server.exitStatus.Load(); status != nil && err == context.Canceled {
+		err = status
+	}
 	return err
 }
 
-func (server *Server) setupHandlers(ctx context.Context, cancel context.CancelFunc, pathPrefix string, counter *counter) http.Handler {
+// Handler returns the handlers of the server, to be mounted on the mux of
+// another application, which owns the listener then. Requests must keep their
+// full path, which has to start with Options.Path.
+// The handler stops serving terminals when the server times out or, with
+// Options.Once, after the first client.
+func (server *Server) Handler() http.Handler {
+	return server.HandlerContext(context.Background())
+}
+
+// HandlerContext is Handler whose sessions are closed when ctx is canceled.
+func (server *Server) HandlerContext(ctx context.Context) http.Handler {
+	ctx, cancel := context.WithCancel(ctx)
+	path := server.pathPrefix()
+	if server.options.EnableRandomUrl {
+		server.logger.Info("Serving at a random path", "path", path)
+	}
+	return server.setupHandlers(ctx, cancel, server.newRoute(path))
+}
+
+func (server *Server) pathPrefix() string {
+	path := server.options.Path
+	if server.options.EnableRandomUrl {
+		path = "/" + randomstring.Generate(server.options.RandomUrlLength) + "/"
+	}
+	return routePath(path)
+}
+
+// routePath returns path with leading and trailing slashes.
+func routePath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if !strings.HasSuffix(path, "/") {
+		path = path + "/"
+	}
+	return path
+}
+
+func (server *Server) setupHandlers(ctx context.Context, cancel context.CancelFunc, route *route) http.Handler {
+	pathPrefix := route.path
 	fs, err := fs.Sub(bindata.Fs, "static")
 	if err != nil {
-		log.Fatalf("failed to open static/ subdirectory of embedded filesystem: %v", err)
+		panic("static/ not found") // must be in bindata
+	}
+	staticFileHandler := newStaticHandler(fs)
+	if server.secrets != nil && server.options.SecretsRefresh > 0 {
+		go server.refreshSecrets(ctx, time.Duration(server.options.SecretsRefresh)*time.Second)
 	}
-	staticFileHandler := http.FileServer(http.FS(fs))
 
 	var siteMux = http.NewServeMux()
 	siteMux.HandleFunc(pathPrefix, server.handleIndex)
@@ -226,12 +681,42 @@ func (server *Server) setupHandlers(ctx context.Context, cancel context.CancelFu
 	siteMux.HandleFunc(pathPrefix+"manifest.json", server.handleManifest)
 	siteMux.HandleFunc(pathPrefix+"auth_token.js", server.handleAuthToken)
 	siteMux.HandleFunc(pathPrefix+"config.js", server.handleConfig)
+	if server.tokenSecret() != "" {
+		siteMux.HandleFunc(pathPrefix+"api/tokens", server.handleTokens)
+	}
+	if server.credentials != nil {
+		siteMux.HandleFunc(pathPrefix+"api/credential", server.handleCredential)
+	}
+	siteMux.HandleFunc(pathPrefix+"api/session/self", server.handleSessionSelf)
+	siteMux.HandleFunc(pathPrefix+"api/params", server.handleParams)
+	siteMux.Handle(pathPrefix+"whereis/", http.StripPrefix(pathPrefix+"whereis/", http.HandlerFunc(server.handleWhereis)))
+	if handler, ok := server.metrics.(http.Handler); ok && server.options.EnableMetrics {
+		siteMux.Handle(pathPrefix+"metrics", handler)
+	}
+	if server.options.EnableWatch {
+		siteMux.Handle(pathPrefix+"s/", http.StripPrefix(pathPrefix+"s/", http.HandlerFunc(server.handleWatch)))
+	}
+	if server.options.EnablePresent {
+		siteMux.Handle(pathPrefix+"present/", http.StripPrefix(pathPrefix+"present/", http.HandlerFunc(server.handlePresent)))
+	}
+	if server.options.EnablePlayback {
+		siteMux.Handle(pathPrefix+"playback/", http.StripPrefix(pathPrefix+"playback/", http.HandlerFunc(server.handlePlayback)))
+	}
 
-	siteHandler := http.Handler(siteMux)
+	siteHandler := wrapMiddleware(siteMux, server.middleware.inner)
 
-	if server.options.EnableBasicAuth {
-		log.Printf("Using Basic Authentication")
-		siteHandler = server.wrapBasicAuth(siteHandler, server.options.Credential)
+	var authHandler http.Handler
+	if server.authenticator != nil {
+		if server.credentials != nil {
+			server.logger.Info("Using Basic Authentication")
+		}
+		authHandler = server.wrapAuthenticator(siteHandler)
+	}
+	if server.tokenSecret() != "" {
+		server.logger.Info("Accepting access tokens")
+		siteHandler = server.wrapAccessToken(siteHandler, authHandler)
+	} else if authHandler != nil {
+		siteHandler = authHandler
 	}
 
 	siteHandler = server.wrapEnvProtection(siteHandler)
@@ -241,19 +726,66 @@ func (server *Server) setupHandlers(ctx context.Context, cancel context.CancelFu
 
 	wsMux := http.NewServeMux()
 	wsMux.Handle("/", siteHandler)
-	wsMux.HandleFunc(pathPrefix+"ws", server.generateHandleWS(ctx, cancel, counter))
-	siteHandler = http.Handler(wsMux)
+	wsMux.Handle(pathPrefix+"ws", wrapMiddleware(server.generateHandleWS(ctx, cancel, route), server.middleware.websocket))
+	if server.options.Approval {
+		// approvers authenticate with the token of the request
+		wsMux.HandleFunc(pathPrefix+"api/approvals/{id}", server.handleApproval)
+	}
+	if server.options.EnableWatch {
+		wsMux.Handle(pathPrefix+"s/{id}/watch/ws", wrapMiddleware(http.HandlerFunc(server.handleWatchWS), server.middleware.websocket))
+	}
+	if server.options.EnablePresent {
+		wsMux.Handle(pathPrefix+"present/{id}/ws", wrapMiddleware(http.HandlerFunc(server.handlePresentWS), server.middleware.websocket))
+	}
+	if server.options.EnablePlayback {
+		wsMux.Handle(pathPrefix+"playback/{name}/ws", wrapMiddleware(http.HandlerFunc(server.handlePlaybackWS), server.middleware.websocket))
+	}
+	siteHandler = server.wrapRoute(wsMux, route)
+
+	if len(server.options.AllowCountries) > 0 || len(server.options.DenyCountries) > 0 {
+		siteHandler = server.wrapCountries(siteHandler)
+	}
+	if len(server.trustedProxies) > 0 {
+		server.logger.Info("Identifying clients by the headers of trusted proxies")
+		siteHandler = server.wrapTrustedProxies(siteHandler)
+	}
+	if server.oidc != nil {
+		server.logger.Info("Signing users in with OpenID Connect", "issuer", server.options.OIDCIssuer)
+		siteHandler = server.wrapOIDC(siteHandler, pathPrefix)
+	}
 
 	// Wrap with termination middleware
 	siteHandler = server.wrapTerminationMiddleware(siteHandler)
+	if server.options.Pod || server.options.EnableHealth {
+		siteHandler = server.wrapProbes(siteHandler)
+	}
+	if server.options.adminEnabled() && !server.adminSeparate() {
+		// with its own authentication, also while terminating
+		mux := http.NewServeMux()
+		mux.Handle("/", siteHandler)
+		mux.Handle(pathPrefix+"admin/", server.adminHandler(pathPrefix))
+		siteHandler = mux
+	}
 
-	return siteHandler
+	return wrapMiddleware(siteHandler, server.middleware.outer)
+}
+
+// onlyPath passes handler the requests of path when only is true, and the
+// others otherwise, answering 404 to the rest.
+func onlyPath(handler http.Handler, path string, only bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.URL.Path == path) != only {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
 }
 
 func (server *Server) wrapTerminationMiddleware(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if atomic.LoadInt32(&server.terminating) == 1 {
-			http.Error(w, "Service unavailable - terminal session disconnected", http.StatusServiceUnavailable)
+			writeError(w, errServerDestroyed)
 			return
 		}
 		handler.ServeHTTP(w, r)
@@ -264,7 +796,7 @@ func (server *Server) wrapEnvProtection(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		env := server.resolveEnvFromRequest(w, r)
 		if !server.shouldServeHTTP(env) {
-			http.Error(w, "Server is unavailable", http.StatusServiceUnavailable)
+			writeError(w, errServerDestroyed)
 			return
 		}
 
@@ -280,20 +812,24 @@ func (server *Server) setupHTTPServer(handler http.Handler) (*http.Server, error
 	if server.options.EnableTLSClientAuth {
 		tlsConfig, err := server.tlsConfig()
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to setup TLS configuration")
+			return nil, fmt.Errorf("failed to setup TLS configuration: %w", err)
 		}
 		srv.TLSConfig = tlsConfig
 	}
+	if server.tlsFromSecrets() || len(server.hostCertificates) > 0 {
+		if srv.TLSConfig == nil {
+			srv.TLSConfig = &tls.Config{}
+		}
+		srv.TLSConfig.GetCertificate = server.getCertificate
+	}
 
 	return srv, nil
 }
 
-func (server *Server) tryLockWebsocket() bool {
-	return atomic.CompareAndSwapInt32(&server.activeWebsocket, 0, 1)
-}
-
-func (server *Server) releaseWebsocket() {
-	atomic.StoreInt32(&server.activeWebsocket, 0)
+// tlsFromSecrets tells whether the secrets hold the TLS certificate and key,
+// which take precedence over Options.TLSCrtFile and Options.TLSKeyFile.
+func (server *Server) tlsFromSecrets() bool {
+	return server.secrets != nil && server.secrets.get(secretTLSCrt) != ""
 }
 
 func (server *Server) tlsConfig() (*tls.Config, error) {
@@ -312,3 +848,57 @@ func (server *Server) tlsConfig() (*tls.Config, error) {
 	}
 	return tlsConfig, nil
 }
+
+// Preflight checks that the resources required by Run are available,
+// without starting the server. All problems found are returned.
+func (server *Server) Preflight() []error {
+	var errs []error
+
+	if server.options.EnableTLS && !server.tlsFromSecrets() {
+		crtFile := homedir.Expand(server.options.TLSCrtFile)
+		keyFile := homedir.Expand(server.options.TLSKeyFile)
+		if _, err := tls.LoadX509KeyPair(crtFile, keyFile); err != nil {
+			errs = append(errs, fmt.Errorf("failed to load TLS crt file `%s` and key file `%s`: %w", crtFile, keyFile, err))
+		}
+	}
+	if server.options.EnableTLSClientAuth {
+		if _, err := server.tlsConfig(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if server.options.AdminCACrtFile != "" {
+		if _, err := server.adminTLSConfig(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if server.options.Port != "0" && len(server.listeners) == 0 {
+		listeners, err := server.listen(server.options.Address, server.options.Port)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+	if port := server.options.WSPort; port != "" && port != "0" && len(server.wsListeners) == 0 {
+		listeners, err := server.listen(server.wsAddress(), port)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+	if port := server.options.AdminPort; port != "" && port != "0" && server.options.adminEnabled() && len(server.adminListeners) == 0 {
+		listeners, err := server.listen(server.adminAddress(), port)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+
+	return errs
+}
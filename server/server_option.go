@@ -0,0 +1,156 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sorenisanerd/gotty/pkg/cluster"
+	"github.com/sorenisanerd/gotty/pkg/credentials"
+	"github.com/sorenisanerd/gotty/pkg/metrics"
+	"github.com/sorenisanerd/gotty/pkg/secrets"
+)
+
+// ServerOption is an option of New().
+type ServerOption func(*Server)
+
+// WithFactory sets the factory that creates a backend for each client.
+// It is required.
+func WithFactory(factory Factory) ServerOption {
+	return func(server *Server) {
+		server.factory = factory
+	}
+}
+
+// WithLogger sets the logger of the server and its sessions,
+// which is slog.Default() by default.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(server *Server) {
+		server.logger = logger
+	}
+}
+
+// WithAuthenticator replaces the Basic Authentication with the credential
+// of Options by a custom authenticator.
+func WithAuthenticator(authenticator Authenticator) ServerOption {
+	return func(server *Server) {
+		server.authenticator = authenticator
+	}
+}
+
+// WithCredentialStore enables Basic Authentication with the credential of
+// store instead of the one of Options, which Server.RotateCredential and
+// the api/credential endpoint rotate.
+func WithCredentialStore(store credentials.Store) ServerOption {
+	return func(server *Server) {
+		server.credentials = store
+	}
+}
+
+// WithSecrets loads the credential, the secret of access tokens and the
+// TLS certificate and key from source, under the keys credential,
+// token_secret, tls_crt and tls_key, instead of Options.SecretsVault or
+// Options.SecretsAWS. They are reloaded every Options.SecretsRefresh.
+func WithSecrets(source secrets.Source) ServerOption {
+	return func(server *Server) {
+		server.secrets = &secretValues{source: source}
+	}
+}
+
+// WithListener makes Run serve on listener instead of listening on the
+// address of Options. It can be given more than once.
+func WithListener(listener net.Listener) ServerOption {
+	return func(server *Server) {
+		server.listeners = append(server.listeners, listener)
+	}
+}
+
+// WithWebSocketListener makes Run serve the WebSocket endpoint on listener,
+// and only it, instead of listening on Options.WSPort. It can be given more
+// than once.
+func WithWebSocketListener(listener net.Listener) ServerOption {
+	return func(server *Server) {
+		server.wsListeners = append(server.wsListeners, listener)
+	}
+}
+
+// WithAdminListener makes Run serve the admin API on listener, and only it,
+// instead of listening on Options.AdminPort. It can be given more than once.
+func WithAdminListener(listener net.Listener) ServerOption {
+	return func(server *Server) {
+		server.adminListeners = append(server.adminListeners, listener)
+	}
+}
+
+// WithEvents registers events to receive the lifecycle events of the server.
+func WithEvents(events Events) ServerOption {
+	return func(server *Server) {
+		server.events = events
+	}
+}
+
+// WithMetrics sets the metrics of the server. By default, metrics are
+// discarded, or kept for Prometheus with Options.EnableMetrics.
+// Options.EnableMetrics serves metrics that implement http.Handler.
+func WithMetrics(m metrics.Metrics) ServerOption {
+	return func(server *Server) {
+		server.metrics = m
+	}
+}
+
+// WithStore shares the session state of the server with the other
+// instances using store, which enforces the single session and
+// Options.MaxConnection across them. It replaces Options.ClusterRedis.
+func WithStore(store cluster.Store) ServerOption {
+	return func(server *Server) {
+		server.store = store
+	}
+}
+
+// WithHostHandler serves the requests for host, by the hostname of SNI with
+// TLS, with handler instead, e.g. that of another Server with its own
+// options, on the listeners of Run. host may be a wildcard like
+// *.example.com.
+func WithHostHandler(host string, handler http.Handler) ServerOption {
+	return func(server *Server) {
+		if server.hostHandlers == nil {
+			server.hostHandlers = map[string]http.Handler{}
+		}
+		server.hostHandlers[strings.ToLower(host)] = handler
+	}
+}
+
+// WithReuse keeps the server serving new sessions once one ends, as with
+// Options.ExitAfterSessions but without limit, rather than terminating,
+// e.g. when mounted in another server. Options.Once and Options.Pod still
+// end it with its session.
+func WithReuse() ServerOption {
+	return func(server *Server) {
+		server.reusable = true
+	}
+}
+
+// WithOuterMiddleware adds middleware that runs for every request
+// before the built-in logging, authentication and headers.
+func WithOuterMiddleware(middleware ...Middleware) ServerOption {
+	return func(server *Server) {
+		server.middleware.outer = append(server.middleware.outer, middleware...)
+	}
+}
+
+// WithInnerMiddleware adds middleware that runs for the pages and static files
+// after the built-in logging, authentication and headers.
+func WithInnerMiddleware(middleware ...Middleware) ServerOption {
+	return func(server *Server) {
+		server.middleware.inner = append(server.middleware.inner, middleware...)
+	}
+}
+
+// WithWebSocketMiddleware adds middleware around the WebSocket handler,
+// which does not go through the built-in chain.
+func WithWebSocketMiddleware(middleware ...Middleware) ServerOption {
+	return func(server *Server) {
+		server.middleware.websocket = append(server.middleware.websocket, middleware...)
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// runServer runs a server until the end of the test and returns its URL.
+func runServer(t *testing.T, options *Options, opts ...ServerOption) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.Path = "/"
+	server, err := New(options, append([]ServerOption{WithFactory(echoFactory{}), WithListener(listener)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return "http://" + listener.Addr().String() + "/"
+}
+
+// dialSession opens a WebSocket connection to the server at url and sends
+// init.
+func dialSession(t *testing.T, url string, init InitMessage, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"ws", header)
+	if err != nil {
+		t.Fatalf("Dial() returned error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	message, _ := json.Marshal(init)
+	if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(&Options{}); err == nil {
+		t.Error("New() without a factory returned no error")
+	}
+
+	// servers with their own options do not share state
+	for _, credential := range []string{"alice:a", "bob:b"} {
+		server, err := New(&Options{EnableBasicAuth: true, Credential: credential}, WithFactory(echoFactory{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := server.wrapAuthenticator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for _, other := range []string{"alice:a", "bob:b"} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			user, password, _ := strings.Cut(other, ":")
+			req.SetBasicAuth(user, password)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if (recorder.Code == http.StatusOK) != (other == credential) {
+				t.Errorf("GET with %s of the server of %s = %d", other, credential, recorder.Code)
+			}
+		}
+	}
+}
+
+// tokenAuthenticator admits the requests with an X-Token header, whose
+// WebSocket connections must present the token secret.
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token := r.Header.Get("X-Token")
+	if token == "" {
+		http.Error(w, "no token", http.StatusForbidden)
+		return "", false
+	}
+	return token, true
+}
+
+func (tokenAuthenticator) Verify(token string) error {
+	if token != "secret" {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+func TestAuthenticator(t *testing.T) {
+	url := runServer(t, &Options{}, WithAuthenticator(tokenAuthenticator{}))
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d without a token, expected %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	header := http.Header{"X-Token": {"secret"}}
+	for _, authToken := range []string{"wrong", "secret"} {
+		// a server per connection, as the first one ends the server
+		url := runServer(t, &Options{}, WithAuthenticator(tokenAuthenticator{}))
+		conn := dialSession(t, url, InitMessage{AuthToken: authToken}, header)
+		_, _, err := conn.ReadMessage()
+		if (err == nil) != (authToken == "secret") {
+			t.Errorf("session with the token %s returned %v", authToken, err)
+		}
+	}
+}
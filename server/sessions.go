@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/randomstring"
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+var (
+	// ErrSessionNotFound is returned for IDs of sessions that are not running.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionTerminated ends sessions terminated with SessionManager.Terminate().
+	ErrSessionTerminated = errors.New("session terminated")
+)
+
+// SessionManager keeps the running sessions of a Server,
+// which can be inspected and controlled from Go code. It admits new sessions
+// up to Limits.MaxSessions.
+type SessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*managedSession
+	admitted map[string]*AdmittedSession // by ID, from admission until the end
+}
+
+// AdmittedSession is a session admitted by a SessionManager, from the
+// connection of its client, before it authenticates, until it ends.
+type AdmittedSession struct {
+	ID        string // of the SessionInfo once the session starts
+	Owner     string // user of the session, or else its remote address
+	CreatedAt time.Time
+	Dev       bool // in dev mode, which never decommissions the server
+}
+
+type managedSession struct {
+	info     SessionInfo
+	slave    Slave
+	tty      atomic.Pointer[webtty.WebTTY] // replaced when resumed
+	activity *activity
+	mirror   *mirror // with Options.EnablePresent
+	cancel   context.CancelCauseFunc
+}
+
+// current returns the info of the session with its last activity.
+func (session *managedSession) current() SessionInfo {
+	info := session.info
+	info.LastInput = session.activity.lastInput()
+	info.LastOutput = session.activity.lastOutput()
+	info.PermitWrite = session.tty.Load().PermitWrite()
+	info.BytesIn = session.activity.bytesIn.Load()
+	info.BytesOut = session.activity.bytesOut.Load()
+	info.Redactions = session.activity.redactions.Load()
+	session.activity.usage(&info)
+	return info
+}
+
+func newSessionManager() *SessionManager {
+	return &SessionManager{sessions: map[string]*managedSession{}, admitted: map[string]*AdmittedSession{}}
+}
+
+// Sessions returns the session manager of the server.
+func (server *Server) Sessions() *SessionManager {
+	return server.sessions
+}
+
+func (manager *SessionManager) add(info SessionInfo, slave Slave, tty *webtty.WebTTY, activity *activity, mirror *mirror, cancel context.CancelCauseFunc) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	session := &managedSession{info: info, slave: slave, activity: activity, mirror: mirror, cancel: cancel}
+	session.tty.Store(tty)
+	manager.sessions[info.ID] = session
+	if admitted, ok := manager.admitted[info.ID]; ok && info.User != "" {
+		admitted.Owner = info.User
+	}
+}
+
+// admit admits a session of owner, refusing it with errSessionActive when
+// maxSessions sessions are admitted already, 0 for no limit.
+func (manager *SessionManager) admit(owner string, dev bool, maxSessions int) (*AdmittedSession, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if maxSessions > 0 && len(manager.admitted) >= maxSessions {
+		return nil, errSessionActive
+	}
+	admitted := &AdmittedSession{ID: randomstring.Generate(16), Owner: owner, CreatedAt: time.Now(), Dev: dev}
+	manager.admitted[admitted.ID] = admitted
+	return admitted, nil
+}
+
+// release gives back the slot of the admitted session id, returning how
+// many sessions remain admitted.
+func (manager *SessionManager) release(id string) int {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	delete(manager.admitted, id)
+	return len(manager.admitted)
+}
+
+// Admitted returns the admitted sessions, including those not started yet,
+// e.g. waiting for their approval, oldest first.
+func (manager *SessionManager) Admitted() []AdmittedSession {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	list := make([]AdmittedSession, 0, len(manager.admitted))
+	for _, admitted := range manager.admitted {
+		list = append(list, *admitted)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+func (manager *SessionManager) remove(id string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	delete(manager.sessions, id)
+}
+
+func (manager *SessionManager) get(id string) (*managedSession, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	session, ok := manager.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// List returns the running sessions, oldest first.
+func (manager *SessionManager) List() []SessionInfo {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	list := make([]SessionInfo, 0, len(manager.sessions))
+	for _, session := range manager.sessions {
+		list = append(list, session.current())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.Before(list[j].StartedAt)
+	})
+	return list
+}
+
+// Get returns the running session with id.
+func (manager *SessionManager) Get(id string) (SessionInfo, error) {
+	session, err := manager.get(id)
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	return session.current(), nil
+}
+
+// Write writes p to the backend of a session as if the client typed it.
+func (manager *SessionManager) Write(id string, p []byte) error {
+	session, err := manager.get(id)
+	if err != nil {
+		return err
+	}
+	if _, err := session.slave.Write(p); err != nil {
+		return fmt.Errorf("failed to write to session `%s`: %w", id, err)
+	}
+	return nil
+}
+
+// Resize resizes the terminal of a session,
+// until its client sends its own size again.
+func (manager *SessionManager) Resize(id string, columns int, rows int) error {
+	session, err := manager.get(id)
+	if err != nil {
+		return err
+	}
+	if err := session.slave.ResizeTerminal(columns, rows); err != nil {
+		return fmt.Errorf("failed to resize session `%s`: %w", id, err)
+	}
+	return nil
+}
+
+// SetPermitWrite grants or revokes the input of the client of a session,
+// e.g. to hand the audience of a read-only demo the control. Granting
+// permits all of the input, whatever Options.InputPolicy.
+func (manager *SessionManager) SetPermitWrite(id string, permit bool) error {
+	session, err := manager.get(id)
+	if err != nil {
+		return err
+	}
+	if err := session.tty.Load().SetPermitWrite(permit); err != nil {
+		return fmt.Errorf("failed to set the write permission of session `%s`: %w", id, err)
+	}
+	return nil
+}
+
+// attach replaces the WebTTY of a resumed session.
+func (manager *SessionManager) attach(id string, tty *webtty.WebTTY) {
+	if session, err := manager.get(id); err == nil {
+		session.tty.Store(tty)
+	}
+}
+
+// Terminate ends a session, which then ends with ErrSessionTerminated.
+func (manager *SessionManager) Terminate(id string) error {
+	session, err := manager.get(id)
+	if err != nil {
+		return err
+	}
+	session.cancel(ErrSessionTerminated)
+	return nil
+}
+
+// sessionSelf is the JSON response of the api/session/self endpoint.
+type sessionSelf struct {
+	SessionID   string    `json:"session_id"`
+	Name        string    `json:"name,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	PermitWrite bool      `json:"permit_write"`
+	InputPolicy string    `json:"input_policy"` // write, read-only, scroll or allow
+	// Reconnect is the seconds after which the frontend reconnects, -1 if it does not.
+	Reconnect int `json:"reconnect"`
+	// IdleTimeout is the seconds without input before the session ends, 0 if none.
+	IdleTimeout int `json:"idle_timeout"`
+}
+
+// handleSessionSelf describes the running session of the client, the newest
+// one of its user and host, so that the frontend can show its status.
+func (server *Server) handleSessionSelf(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+
+	user := requestUser(r)
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	var self *SessionInfo
+	for _, session := range server.sessions.List() {
+		sessionHost, _, _ := net.SplitHostPort(session.RemoteAddr)
+		if session.User == user && sessionHost == host {
+			self = &session
+		}
+	}
+	if self == nil {
+		writeError(w, ErrSessionNotFound)
+		return
+	}
+
+	response := sessionSelf{
+		SessionID:   self.ID,
+		Name:        self.Name,
+		StartedAt:   self.StartedAt,
+		PermitWrite: self.PermitWrite,
+		InputPolicy: server.options.inputPolicy(),
+		Reconnect:   -1,
+		IdleTimeout: server.Limits().IdleTimeout,
+	}
+	if server.options.EnableReconnect {
+		response.Reconnect = server.options.ReconnectTime
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
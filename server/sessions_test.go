@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+func TestSessionManager(t *testing.T) {
+	listening := make(chan *Server, 1)
+	url := runServer(t, &Options{}, func(server *Server) { listening <- server })
+	manager := (<-listening).Sessions()
+
+	conn := dialSession(t, url, InitMessage{}, nil)
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); len(manager.List()) < 1; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("sessions = %+v, expected the session", manager.List())
+		}
+	}
+
+	sessions := manager.List()
+	if len(sessions) != 1 || sessions[0].StartedAt.IsZero() {
+		t.Fatalf("sessions = %+v, expected the session", sessions)
+	}
+	if info, err := manager.Get(sessions[0].ID); err != nil || info.ID != sessions[0].ID || info.StartedAt != sessions[0].StartedAt {
+		t.Errorf("Get(%s) = %+v, %v, expected the session", sessions[0].ID, info, err)
+	}
+	if _, err := manager.Get("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Get() of a missing session returned %v, expected ErrSessionNotFound", err)
+	}
+
+	// the backend echoes what is written to it
+	if err := manager.Write(sessions[0].ID, []byte("ls\r")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("no output of the written input: %v", err)
+		}
+		if message[0] == webtty.Output {
+			if output, _ := base64.StdEncoding.DecodeString(string(message[1:])); string(output) != "ls\r" {
+				t.Errorf("output = %q, expected the written input", output)
+			}
+			break
+		}
+	}
+	if err := manager.Resize(sessions[0].ID, 100, 30); err != nil {
+		t.Error(err)
+	}
+	for _, err := range []error{manager.Write("missing", nil), manager.Resize("missing", 80, 24), manager.Terminate("missing")} {
+		if !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("error = %v for a missing session, expected ErrSessionNotFound", err)
+		}
+	}
+
+	if err := manager.Terminate(sessions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	for deadline := time.Now().Add(time.Second); len(manager.List()) != 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("sessions = %+v, expected the terminated one to be removed", manager.List())
+		}
+	}
+	if _, err := manager.Get(sessions[0].ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Get() of the terminated session returned %v, expected ErrSessionNotFound", err)
+	}
+}
@@ -0,0 +1,24 @@
+package server
+
+// Policies of Options.SizePolicy.
+const (
+	sizeOwner    = "owner"    // of the client of the session
+	sizeSmallest = "smallest" // fitting all the terminals showing the session
+	sizeFixed    = "fixed"    // Options.Width and Options.Height
+)
+
+// fixedSize returns the size of the terminals set by Options.Width and
+// Options.Height, 80x24 by default with the size policy fixed, each 0 when
+// resized by the clients.
+func (options *Options) fixedSize() (columns int, rows int) {
+	columns, rows = options.Width, options.Height
+	if options.SizePolicy == sizeFixed {
+		if columns == 0 {
+			columns = 80
+		}
+		if rows == 0 {
+			rows = 24
+		}
+	}
+	return columns, rows
+}
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"context"
+	"errors"
+
 	"github.com/sorenisanerd/gotty/webtty"
 )
 
@@ -11,7 +14,39 @@ type Slave interface {
 	Close() error
 }
 
+// ProcessSlave is optionally implemented by slaves running a local process,
+// whose CPU and memory the server then samples with its descendants.
+type ProcessSlave interface {
+	Pid() int
+}
+
 type Factory interface {
 	Name() string
 	New(params map[string][]string, headers map[string][]string) (Slave, error)
 }
+
+// slaveWrapper wraps a slave, forwarding its webtty.SlaveLifecycle if any.
+type slaveWrapper struct {
+	Slave
+}
+
+func (sw slaveWrapper) Start(ctx context.Context) error {
+	if lifecycle, ok := sw.Slave.(webtty.SlaveLifecycle); ok {
+		return lifecycle.Start(ctx)
+	}
+	return nil
+}
+
+func (sw slaveWrapper) Stop(ctx context.Context) error {
+	if lifecycle, ok := sw.Slave.(webtty.SlaveLifecycle); ok {
+		return lifecycle.Stop(ctx)
+	}
+	return nil
+}
+
+func (sw slaveWrapper) Wait() (int, error) {
+	if lifecycle, ok := sw.Slave.(webtty.SlaveLifecycle); ok {
+		return lifecycle.Wait()
+	}
+	return 0, errors.New("slave has no lifecycle")
+}
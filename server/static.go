@@ -0,0 +1,77 @@
+package server
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// precompressed are the encodings of the precompressed siblings of static
+// files, by preference.
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticHandler serves the files of fsys, or their precompressed siblings,
+// e.g. js/gotty.js.gz for js/gotty.js, to clients accepting them, sparing
+// the compression of each response.
+type staticHandler struct {
+	fsys  fs.FS
+	files http.Handler
+}
+
+func newStaticHandler(fsys fs.FS) *staticHandler {
+	return &staticHandler{fsys: fsys, files: http.FileServer(http.FS(fsys))}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !slices.Contains(w.Header().Values("Vary"), "Accept-Encoding") {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	for _, p := range precompressed {
+		if !acceptsEncoding(r, p.encoding) {
+			continue
+		}
+		file, err := h.fsys.Open(name + p.extension)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+		stat, err := file.Stat()
+		content, ok := file.(io.ReadSeeker)
+		if err != nil || !ok || stat.IsDir() {
+			continue
+		}
+		if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+		w.Header().Set("Content-Encoding", p.encoding)
+		http.ServeContent(w, r, name, stat.ModTime(), content)
+		return
+	}
+	h.files.ServeHTTP(w, r)
+}
+
+// acceptsEncoding returns whether the Accept-Encoding of r includes encoding.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, accepted := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(accepted, ";")
+			if strings.TrimSpace(name) != encoding {
+				continue
+			}
+			q := strings.ReplaceAll(params, " ", "")
+			return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+		}
+	}
+	return false
+}
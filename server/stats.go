@@ -0,0 +1,133 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// statsHours is how many hours Stats.ConnectionsPerHour covers.
+const statsHours = 24
+
+// Stats are rolling statistics of the sessions of a Server, kept in memory
+// since it started.
+type Stats struct {
+	Sessions int64 // started
+	// PeakSessions is the most sessions running at once, first reached at PeakAt.
+	PeakSessions int
+	PeakAt       time.Time
+	// ConnectionsPerHour are the WebSocket connections of the last hours,
+	// the current one first.
+	ConnectionsPerHour []int64
+	// AverageDuration is the average duration of the sessions that ended.
+	AverageDuration time.Duration
+	// CloseReasons counts the closed connections by reason: cancelation,
+	// exit, backend, client, termination, idle, slow client, error, or
+	// rejected for connections that never started a session.
+	CloseReasons map[string]int64
+}
+
+// stats keeps the Stats of a Server.
+type stats struct {
+	mu           sync.Mutex
+	sessions     int64
+	running      int
+	peak         int
+	peakAt       time.Time
+	finished     int64             // sessions that ended
+	totalTime    time.Duration     // of the finished sessions
+	hours        [statsHours]int64 // connections, by hour since the epoch modulo statsHours
+	lastHour     int64             // of the latest connection
+	closeReasons map[string]int64
+}
+
+func newStats() *stats {
+	return &stats{closeReasons: map[string]int64{}}
+}
+
+// connected counts a connection at now.
+func (s *stats) connected(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hour := now.Unix() / 3600
+	s.expire(hour)
+	s.hours[hour%statsHours]++
+}
+
+// expire clears the hours between the latest connection and hour.
+func (s *stats) expire(hour int64) {
+	if hour <= s.lastHour {
+		return
+	}
+	for h := max(s.lastHour+1, hour-statsHours+1); h <= hour; h++ {
+		s.hours[h%statsHours] = 0
+	}
+	s.lastHour = hour
+}
+
+// started counts a session started at now, returning the peak when it is a new one.
+func (s *stats) started(now time.Time) (peak int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions++
+	s.running++
+	if s.running <= s.peak {
+		return s.peak, false
+	}
+	s.peak = s.running
+	s.peakAt = now
+	return s.peak, true
+}
+
+func (s *stats) ended(duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.finished++
+	s.totalTime += duration
+}
+
+// average returns the average duration of the sessions that ended, or 0.
+func (s *stats) average() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished == 0 {
+		return 0
+	}
+	return s.totalTime / time.Duration(s.finished)
+}
+
+func (s *stats) closed(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeReasons[reason]++
+}
+
+func (s *stats) snapshot(now time.Time) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hour := now.Unix() / 3600
+	s.expire(hour)
+
+	stats := Stats{
+		Sessions:           s.sessions,
+		PeakSessions:       s.peak,
+		PeakAt:             s.peakAt,
+		ConnectionsPerHour: make([]int64, statsHours),
+		CloseReasons:       make(map[string]int64, len(s.closeReasons)),
+	}
+	for i := range stats.ConnectionsPerHour {
+		stats.ConnectionsPerHour[i] = s.hours[(hour-int64(i))%statsHours]
+	}
+	if s.finished > 0 {
+		stats.AverageDuration = s.totalTime / time.Duration(s.finished)
+	}
+	for reason, count := range s.closeReasons {
+		stats.CloseReasons[reason] = count
+	}
+	return stats
+}
+
+// Stats returns the statistics of the sessions of the server.
+func (server *Server) Stats() Stats {
+	return server.stats.snapshot(time.Now())
+}
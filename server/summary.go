@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// sessionSummary is the payload of webtty.SessionSummary, see
+// Options.SessionSummary.
+type sessionSummary struct {
+	SessionID  string  `json:"session_id"`
+	Duration   float64 `json:"duration"` // in seconds
+	ExitStatus *int    `json:"exit_status,omitempty"`
+	BytesIn    int64   `json:"bytes_in"`
+	BytesOut   int64   `json:"bytes_out"`
+	Recording  string  `json:"recording,omitempty"` // URL of Options.RecordingURL
+}
+
+// sendSummary sends the summary of session, which ended with exitStatus,
+// -1 when unknown, to its client before conn is closed.
+func (server *Server) sendSummary(conn *websocket.Conn, session *SessionInfo, exitStatus int) {
+	summary := sessionSummary{
+		SessionID: session.ID,
+		Duration:  time.Since(session.StartedAt).Round(time.Millisecond).Seconds(),
+		BytesIn:   session.BytesIn,
+		BytesOut:  session.BytesOut,
+	}
+	if exitStatus >= 0 {
+		summary.ExitStatus = &exitStatus
+	}
+	if session.Recording != "" && server.recordingURL != nil {
+		buf := new(bytes.Buffer)
+		vars := map[string]interface{}{"name": session.Recording, "session_id": session.ID}
+		if err := server.recordingURL.Execute(buf, vars); err != nil {
+			server.logger.Warn("Failed to render the recording URL", "session_id", session.ID, "error", err)
+		} else {
+			summary.Recording = buf.String()
+		}
+	}
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		return
+	}
+	conn.WriteMessage(websocket.TextMessage, append([]byte{webtty.SessionSummary}, payload...))
+}
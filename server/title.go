@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	noesctmpl "text/template"
+	"time"
+)
+
+// titleFuncs are the functions available in the title format.
+var titleFuncs = noesctmpl.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	// short returns the first label of a host name, e.g. `web1` for `web1.example.com`
+	"short": func(host string) string {
+		short, _, _ := strings.Cut(host, ".")
+		return short
+	},
+	"now": time.Now,
+	// date formats a time with a Go layout, e.g. `{{ now | date "15:04" }}`
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+// routeTitles returns the title formats of Options.RouteTitles by path.
+func (options *Options) routeTitles() (map[string]*noesctmpl.Template, error) {
+	titles := map[string]*noesctmpl.Template{}
+	for _, s := range options.RouteTitles {
+		path, format, ok := strings.Cut(s, "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid route title `%s`, expected PATH=FORMAT", s)
+		}
+		title, err := noesctmpl.New("title").Funcs(titleFuncs).Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse window title format `%s` of %s: %w", format, path, err)
+		}
+		titles[routePath(path)] = title
+	}
+	return titles, nil
+}
+
+// routeTitle sets the title format and variables of route, those of its
+// path if any.
+func (server *Server) routeTitle(route *route) {
+	route.title = server.titleTemplate
+	if title, ok := server.routeTitles[route.path]; ok {
+		route.title = title
+	}
+	for path, vars := range server.options.RouteTitleVariables {
+		if routePath(path) == route.path {
+			route.titleVariables = vars
+		}
+	}
+}
+
+// requestRoute returns the route serving r, or a route of the title at
+// Options.Path.
+func (server *Server) requestRoute(r *http.Request) *route {
+	if route, ok := r.Context().Value(routeKey).(*route); ok {
+		return route
+	}
+	route := &route{path: routePath(server.options.Path)}
+	server.routeTitle(route)
+	return route
+}
+
+// wrapRoute passes handler the route serving its requests.
+func (server *Server) wrapRoute(handler http.Handler, route *route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeKey, route)))
+	})
+}
+
+// serverVariables returns Options.TitleVariables and those of route, with
+// the hostname unless given and the start time of the server.
+func (server *Server) serverVariables(route *route) map[string]interface{} {
+	vars := map[string]interface{}{}
+	if hostname, err := os.Hostname(); err == nil {
+		vars["hostname"] = hostname
+	}
+	for key, val := range server.options.TitleVariables {
+		vars[key] = val
+	}
+	for key, val := range route.titleVariables {
+		vars[key] = val
+	}
+	vars["server_started_at"] = server.started
+	return vars
+}
+
+// requestUser returns the user authenticated by r, given by a trusted proxy
+// or the OpenID Connect provider, with Basic Authentication or else a TLS
+// client certificate.
+func requestUser(r *http.Request) string {
+	if id, ok := r.Context().Value(identityKey).(*identity); ok {
+		return id.user
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	return ""
+}
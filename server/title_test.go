@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTitleFunctions(t *testing.T) {
+	options := &Options{
+		TitleVariables: map[string]interface{}{"command": "/usr/bin/top", "hostname": "web1.example.com"},
+		TitleFormat:    `{{ .command | upper }} {{ .hostname | short }} {{ " Ops " | trim | lower }} {{ now | date "2006" }}`,
+	}
+	server, err := New(options, WithFactory(echoFactory{}))
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.handleIndex(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if title := "<title>/USR/BIN/TOP web1 ops " + time.Now().Format("2006") + "</title>"; !strings.Contains(recorder.Body.String(), title) {
+		t.Errorf("index = %s, expected %s", recorder.Body.String(), title)
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/accesstoken"
+)
+
+const (
+	tokenQueryParam = "token"
+	tokenCookieName = "gotty.token"
+)
+
+type contextKey int
+
+const (
+	accessTokenKey contextKey = iota
+	authTokenKey
+	identityKey // of a trusted proxy
+	routeKey    // serving the request
+)
+
+// tokenStore remembers the one-time tokens that have been used until they expire.
+type tokenStore struct {
+	mu   sync.Mutex
+	used map[string]int64
+}
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{used: map[string]int64{}}
+}
+
+// consume marks a one-time token as used, and fails when it already was.
+func (store *tokenStore) consume(claims *accesstoken.Claims) error {
+	if !claims.Once {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now().Unix()
+	for id, expiresAt := range store.used {
+		if expiresAt <= now {
+			delete(store.used, id)
+		}
+	}
+	if _, used := store.used[claims.ID]; used {
+		return fmt.Errorf("access token has already been used: %w", ErrAuthFailed)
+	}
+	store.used[claims.ID] = claims.ExpiresAt
+	return nil
+}
+
+func (server *Server) verifyAccessToken(token string) (*accesstoken.Claims, error) {
+	secret := server.tokenSecret()
+	if secret == "" || token == "" {
+		return nil, accesstoken.ErrInvalid
+	}
+	return accesstoken.Verify([]byte(secret), token, time.Now())
+}
+
+// wrapAccessToken serves requests with a valid access token, given in the query
+// or in the cookie set on first use. Others are passed to fallback, or rejected
+// when it is nil.
+func (server *Server) wrapAccessToken(handler http.Handler, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get(tokenQueryParam)
+		if token == "" {
+			if cookie, err := r.Cookie(tokenCookieName); err == nil {
+				token = cookie.Value
+			}
+		}
+
+		claims, err := server.verifyAccessToken(token)
+		if err != nil {
+			if fallback != nil {
+				fallback.ServeHTTP(w, r)
+				return
+			}
+			server.authFailed(r.RemoteAddr, fmt.Errorf("%w: %w", ErrAuthFailed, err))
+			writeError(w, ErrAuthFailed)
+			return
+		}
+
+		if r.URL.Query().Get(tokenQueryParam) != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookieName,
+				Value:    token,
+				Path:     r.URL.Path,
+				Expires:  time.Unix(claims.ExpiresAt, 0),
+				HttpOnly: true,
+				Secure:   server.options.EnableTLS,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessTokenKey, token)))
+	})
+}
+
+// authenticateInit checks the AuthToken of an init message, which is either
+// an access token, a JWT, also given as bearer, or verified by the
+// authenticator, and returns the claims of access tokens and the user of
+// JWTs.
+func (server *Server) authenticateInit(ctx context.Context, authToken string, bearer string) (*accesstoken.Claims, string, error) {
+	if claims, err := server.verifyAccessToken(authToken); err == nil {
+		if err := server.tokens.consume(claims); err != nil {
+			return nil, "", err
+		}
+		return claims, "", nil
+	}
+
+	if server.jwt != nil {
+		user, err := server.verifyJWT(ctx, cmp.Or(bearer, authToken))
+		if err == nil {
+			return nil, user, nil
+		}
+		if server.authenticator == nil {
+			return nil, "", fmt.Errorf("websocket connection: %w: %w", ErrAuthFailed, err)
+		}
+	}
+	if server.authenticator == nil {
+		if server.tokenSecret() != "" {
+			return nil, "", fmt.Errorf("websocket connection: %w", ErrAuthFailed)
+		}
+		return nil, "", nil
+	}
+	if err := server.authenticator.Verify(authToken); err != nil {
+		return nil, "", fmt.Errorf("websocket connection: %w: %w", ErrAuthFailed, err)
+	}
+	return nil, "", nil
+}
+
+type tokenRequest struct {
+	TTL  string   `json:"ttl"`
+	Once bool     `json:"once"`
+	Args []string `json:"args"`
+}
+
+type tokenResponse struct {
+	Token     string `json:"token"`
+	URL       string `json:"url"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// handleTokens mints access tokens for callers authenticated with the credential.
+func (server *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if server.authenticator == nil || r.Context().Value(accessTokenKey) != nil {
+		http.Error(w, "Minting access tokens requires the credential", http.StatusForbidden)
+		return
+	}
+
+	request := tokenRequest{TTL: "1h"}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Malformed request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttl, err := time.ParseDuration(request.TTL)
+	if err != nil || ttl <= 0 {
+		http.Error(w, "Malformed request: invalid ttl", http.StatusBadRequest)
+		return
+	}
+
+	claims := accesstoken.New(ttl, request.Once, request.Args)
+	token, err := accesstoken.Sign([]byte(server.tokenSecret()), claims)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	tokenURL := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     strings.TrimSuffix(r.URL.Path, "api/tokens"),
+		RawQuery: url.Values{tokenQueryParam: {token}}.Encode(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokenResponse{Token: token, URL: tokenURL.String(), ExpiresAt: claims.ExpiresAt})
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrOutputTrigger ends sessions whose output fired a terminate trigger.
+var ErrOutputTrigger = errors.New("session terminated by an output trigger")
+
+// triggerWindow is how many bytes of the output of a read are kept to match
+// patterns split across the next one.
+const triggerWindow = 256
+
+// Actions of triggers
+const (
+	triggerLog       = "log"
+	triggerWebhook   = "webhook"
+	triggerNotify    = "notify"
+	triggerTerminate = "terminate"
+)
+
+// trigger fires its action on output matching its pattern.
+type trigger struct {
+	action  string
+	pattern *regexp.Regexp
+}
+
+// TriggerEvent is an output trigger fired by a session, see Options.Triggers.
+// It never holds the matching output, which may be sensitive.
+type TriggerEvent struct {
+	SessionID  string    `json:"session_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	User       string    `json:"user,omitempty"`
+	Action     string    `json:"action"`
+	Pattern    string    `json:"pattern"`
+	Time       time.Time `json:"time"`
+}
+
+// TriggerEvents are the Events of servers with output triggers.
+// Events implementing it are called when a trigger fires.
+type TriggerEvents interface {
+	OnTrigger(event TriggerEvent)
+}
+
+// parseTrigger parses ACTION:REGEXP.
+func parseTrigger(s string) (trigger, error) {
+	action, expr, ok := strings.Cut(s, ":")
+	switch action {
+	case triggerLog, triggerWebhook, triggerNotify, triggerTerminate:
+	default:
+		ok = false
+	}
+	if !ok || expr == "" {
+		return trigger{}, fmt.Errorf("invalid trigger `%s`, expected ACTION:REGEXP with ACTION log, webhook, notify or terminate", s)
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return trigger{}, fmt.Errorf("invalid pattern of trigger `%s`: %w", s, err)
+	}
+	return trigger{action: action, pattern: pattern}, nil
+}
+
+// triggers returns the triggers of Options.Triggers.
+func (options *Options) triggers() ([]trigger, error) {
+	triggers := make([]trigger, 0, len(options.Triggers))
+	for _, s := range options.Triggers {
+		t, err := parseTrigger(s)
+		if err != nil {
+			return nil, err
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, nil
+}
+
+// triggerSlave fires the triggers matching the output of a session.
+type triggerSlave struct {
+	slaveWrapper
+
+	server  *Server
+	session *SessionInfo
+	tail    []byte // of the output read last
+}
+
+func (ts *triggerSlave) Read(p []byte) (int, error) {
+	n, err := ts.Slave.Read(p)
+	if n > 0 {
+		output := append(ts.tail, p[:n]...)
+		for _, t := range ts.server.triggers {
+			// once per read, for matches not seen in the tail already
+			for _, match := range t.pattern.FindAllIndex(output, -1) {
+				if match[1] > len(ts.tail) {
+					ts.server.fireTrigger(ts.session, t)
+					break
+				}
+			}
+		}
+		ts.tail = append(ts.tail[:0], output[max(len(output)-triggerWindow, 0):]...)
+	}
+	return n, err
+}
+
+// fireTrigger runs the action of t for session.
+func (server *Server) fireTrigger(session *SessionInfo, t trigger) {
+	event := TriggerEvent{
+		SessionID:  session.ID,
+		RemoteAddr: session.RemoteAddr,
+		User:       session.User,
+		Action:     t.action,
+		Pattern:    t.pattern.String(),
+		Time:       time.Now(),
+	}
+	server.metrics.Add(metricTriggers, 1, "action", t.action)
+	server.logger.Warn("Output trigger fired", "session_id", session.ID, "action", t.action, "pattern", event.Pattern)
+	if events, ok := server.events.(TriggerEvents); ok {
+		events.OnTrigger(event)
+	}
+
+	switch t.action {
+	case triggerWebhook:
+		go func() {
+			if err := postJSON(server.options.TriggerWebhook, event); err != nil {
+				server.logger.Warn("Failed to post the trigger webhook", "error", err)
+			}
+		}()
+	case triggerNotify:
+		if managed, err := server.sessions.get(session.ID); err == nil {
+			managed.tty.Load().SendNotice("Output matched " + event.Pattern)
+		}
+	case triggerTerminate:
+		if managed, err := server.sessions.get(session.ID); err == nil {
+			managed.cancel(ErrOutputTrigger)
+		}
+	}
+}
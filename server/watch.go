@@ -0,0 +1,78 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sorenisanerd/gotty/webtty"
+)
+
+// watched returns the connection of the client of the session with id.
+func (server *Server) watched(id string) (*webtty.WebTTY, error) {
+	session, err := server.sessions.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return session.tty.Load(), nil
+}
+
+// handleWatch serves the watch view of a session at <id>/watch/, the index
+// page loading the rest from the path of the server.
+func (server *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	id, rest, _ := strings.Cut(r.URL.Path, "/")
+	if _, err := server.watched(id); err != nil || strings.TrimSuffix(rest, "/") != "watch" {
+		http.NotFound(w, r)
+		return
+	}
+	if !strings.HasSuffix(rest, "/") {
+		http.Redirect(w, r, "watch/", http.StatusFound)
+		return
+	}
+	server.serveView(w, r, "watch="+id)
+}
+
+// watchConfig returns the size of the session watched by a page loading
+// config.js with the query r, as JavaScript, or "null".
+func (server *Server) watchConfig(r *http.Request) string {
+	id := r.URL.Query().Get("watch")
+	if id == "" || !server.options.EnableWatch {
+		return "null"
+	}
+	tty, err := server.watched(id)
+	if err != nil {
+		return "null"
+	}
+	columns, rows := tty.Size()
+	if columns == 0 || rows == 0 {
+		columns, rows = server.options.fixedSize()
+		columns, rows = cmp.Or(columns, 80), cmp.Or(rows, 24)
+	}
+	config, _ := json.Marshal(map[string]int{"columns": columns, "rows": rows})
+	return string(config)
+}
+
+// handleWatchWS sends the output of a session to a watch view, rejecting
+// its input, until either ends.
+func (server *Server) handleWatchWS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+	tty, err := server.watched(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	conn, _, err := server.acceptInit(w, r, nil)
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+	if err != nil {
+		return
+	}
+	server.logger.Info("Watching session", "session_id", r.PathValue("id"), "remote_addr", r.RemoteAddr)
+	closeWithError(conn, tty.Watch(r.Context(), &wsWrapper{conn}))
+}
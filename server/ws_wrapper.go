@@ -1,10 +1,10 @@
 package server
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/gorilla/websocket"
-	"github.com/pkg/errors"
 )
 
 type wsWrapper struct {
@@ -31,11 +31,19 @@ func (wsw *wsWrapper) Read(p []byte) (n int, err error) {
 			continue
 		}
 
-		b, err := io.ReadAll(reader)
-		if len(b) > len(p) {
-			return 0, errors.Wrapf(err, "Client message exceeded buffer size")
+		// read into p directly instead of allocating each message
+		n, err = io.ReadFull(reader, p)
+		switch err {
+		case io.EOF, io.ErrUnexpectedEOF:
+			return n, nil
+		case nil:
+			var extra [1]byte
+			if _, err := io.ReadFull(reader, extra[:]); err != io.EOF {
+				return 0, fmt.Errorf("Client message exceeded buffer size")
+			}
+			return n, nil
+		default:
+			return n, err
 		}
-		n = copy(p, b)
-		return n, err
 	}
 }
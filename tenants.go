@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/sorenisanerd/gotty/pkg/metrics"
+	"github.com/sorenisanerd/gotty/server"
+	"github.com/sorenisanerd/gotty/utils"
+)
+
+type tenantOptions struct {
+	Tenants []string `hcl:"tenants" flagName:"tenant" flagDescribe:"Profile of the config file to serve at <path>t/<profile>/ as a tenant, with its own credentials, command, limits and sessions (can be repeated)"`
+}
+
+// tenants serves the tenants, profiles of the config file, each at
+// <path>t/<name>/ by a server of its own. Mount it with
+// server.WithOuterMiddleware(t.Middleware).
+type tenants struct {
+	path     string
+	handlers map[string]http.Handler // of the tenants, by name
+}
+
+// tenantsPath returns the path the tenants of the main server are served under.
+func tenantsPath(main *server.Options) string {
+	return strings.TrimSuffix(main.Path, "/") + "/t/"
+}
+
+// newTenants loads the profiles names of configFile as tenants served under
+// path until ctx is canceled, taking the base options of the file and those
+// of their profile, but not the flags. As they are served apart from the
+// server with options main, they must authenticate and restrict their
+// clients too when it does. The tenants share m, with a tenant label, and
+// logger.
+func newTenants(ctx context.Context, configFile string, names []string, path string, main *server.Options, m metrics.Metrics, logger *slog.Logger) (*tenants, error) {
+	t := &tenants{path: path, handlers: map[string]http.Handler{}}
+	for _, name := range names {
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid tenant `%s`", name)
+		}
+		cfg := newConfig()
+		if err := utils.ApplyConfigProfile(configFile, name, cfg.structs()...); err != nil {
+			return nil, err
+		}
+		options := cfg.app
+		if options.Credential != "" || options.CredentialFile != "" || options.CredentialVault != "" {
+			options.EnableBasicAuth = true
+		}
+		options.Path = path + name + "/"
+		options.EnableRandomUrl = false
+		options.Once = false
+		options.Pod = false
+		options.ExitAfterSessions = 0
+		options.ExitOnSlaveExit = false
+		options.Timeout = 0
+		if err := options.Validate(); err != nil {
+			return nil, fmt.Errorf("tenant `%s`: %w", name, err)
+		}
+		if main.Authenticates() && !options.Authenticates() {
+			return nil, fmt.Errorf("tenant `%s` must authenticate its clients, e.g. with a credential of its own, as the server does", name)
+		}
+		if len(main.AllowCountries)+len(main.DenyCountries) > 0 && len(options.AllowCountries)+len(options.DenyCountries) == 0 {
+			return nil, fmt.Errorf("tenant `%s` must restrict the countries of its clients, as the server does", name)
+		}
+
+		factory, err := newFactory(cfg, cfg.backend.Command)
+		if err != nil {
+			return nil, fmt.Errorf("tenant `%s`: %w", name, err)
+		}
+		options.TitleVariables = titleVariables(cfg.backend.Command, factory)
+		srv, err := server.New(options,
+			server.WithFactory(factory),
+			server.WithReuse(),
+			server.WithMetrics(metrics.WithLabels(m, "tenant", name)),
+			server.WithLogger(logger.With("tenant", name)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("tenant `%s`: %w", name, err)
+		}
+		t.handlers[name] = srv.HandlerContext(ctx)
+	}
+	return t, nil
+}
+
+// Middleware serves the tenants, passing other requests to next.
+func (t *tenants) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, t.path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name, _, found := strings.Cut(rest, "/")
+		handler, ok := t.handlers[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if !found {
+			http.Redirect(w, r, t.path+name+"/", http.StatusFound)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
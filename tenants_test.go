@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sorenisanerd/gotty/pkg/metrics"
+)
+
+const tenantsConfig = `
+profiles "acme" {
+  credential = "acme:secret"
+  command = ["true"]
+}
+
+profiles "globex" {
+  command = ["true"]
+}
+
+profiles "initech" {
+  command = ["true"]
+  title_format = "{{ .command"
+}
+`
+
+func writeTenantsConfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "gotty.hcl")
+	if err := os.WriteFile(path, []byte(tenantsConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTenants(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tenants, err := newTenants(ctx, writeTenantsConfig(t), []string{"acme", "globex"}, "/t/", newConfig().app, metrics.Nop{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	ts := httptest.NewServer(tenants.Middleware(next))
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	for _, test := range []struct {
+		path        string
+		credential  string
+		status      int
+		description string
+	}{
+		{"/", "", http.StatusTeapot, "passed on"},
+		{"/t/initech/", "", http.StatusNotFound, "not a tenant"},
+		{"/t/acme", "", http.StatusFound, "redirected"},
+		{"/t/acme/", "", http.StatusUnauthorized, "without the credential of the tenant"},
+		{"/t/acme/", "acme:secret", http.StatusOK, "with the credential of the tenant"},
+		{"/t/globex/", "", http.StatusOK, "without credential"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user, password, ok := strings.Cut(test.credential, ":"); ok {
+			req.SetBasicAuth(user, password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("GET %s %s returned %d, expected %d", test.path, test.description, resp.StatusCode, test.status)
+		}
+	}
+}
+
+func TestTenantsOptions(t *testing.T) {
+	config := writeTenantsConfig(t)
+	authenticated := newConfig().app
+	authenticated.Credential = "user:pass"
+	authenticated.EnableBasicAuth = true
+	restricted := newConfig().app
+	restricted.GeoIPDatabases = []string{"GeoLite2-Country.mmdb"}
+	restricted.AllowCountries = []string{"FR"}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, test := range []struct {
+		tenant      string
+		main        string
+		valid       bool
+		description string
+	}{
+		{"acme", "authenticated", true, "with a credential of its own"},
+		{"globex", "authenticated", false, "without authentication of its own"},
+		{"acme", "restricted", false, "without countries of its own"},
+		{"initech", "default", false, "with an invalid title format"},
+		{"umbrella", "default", false, "without profile"},
+		{"a/b", "default", false, "with an invalid name"},
+	} {
+		options := newConfig().app
+		switch test.main {
+		case "authenticated":
+			options = authenticated
+		case "restricted":
+			options = restricted
+		}
+		_, err := newTenants(context.Background(), config, []string{test.tenant}, "/t/", options, metrics.Nop{}, logger)
+		if (err == nil) != test.valid {
+			t.Errorf("newTenants() of tenant %s %s returned %v, expected valid: %v", test.tenant, test.description, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/sorenisanerd/gotty/pkg/accesstoken"
+)
+
+func tokenCommand(cfg *config) *cli.Command {
+	cliFlags, flagMappings := commandFlags(cfg)
+	cliFlags = append(cliFlags,
+		&cli.DurationFlag{
+			Name:  "ttl",
+			Value: time.Hour,
+			Usage: "Time the token is valid for",
+		},
+		&cli.BoolFlag{
+			Name:  "one-time",
+			Usage: "Permit a single session with the token",
+		},
+		&cli.StringSliceFlag{
+			Name:  "arg",
+			Usage: "Command argument the session is started with, replacing the client's (can be repeated)",
+		},
+		&cli.StringFlag{
+			Name:  "url",
+			Usage: "URL of the server to append the token to (default: derived from --address, --port and --path)",
+		},
+	)
+
+	return &cli.Command{
+		Name:  "token",
+		Usage: "Mint a signed, expiring access URL for a server sharing the same --token-secret",
+		Flags: cliFlags,
+		Action: func(c *cli.Context) error {
+			loadOptions(c, cliFlags, flagMappings, cfg)
+			if source, err := cfg.app.Secrets(); err != nil {
+				exit(err, 1)
+			} else if source != nil {
+				values, err := source.Fetch(c.Context)
+				if err != nil {
+					exit(err, 1)
+				}
+				if secret := values["token_secret"]; secret != "" {
+					cfg.app.TokenSecret = secret
+				}
+			}
+			if cfg.app.TokenSecret == "" {
+				exit(fmt.Errorf("Error: --token-secret is required"), 1)
+			}
+			if c.Duration("ttl") <= 0 {
+				exit(fmt.Errorf("Error: ttl must be positive"), 1)
+			}
+
+			claims := accesstoken.New(c.Duration("ttl"), c.Bool("one-time"), c.StringSlice("arg"))
+			token, err := accesstoken.Sign([]byte(cfg.app.TokenSecret), claims)
+			if err != nil {
+				exit(err, 1)
+			}
+
+			baseURL := c.String("url")
+			if baseURL == "" {
+				baseURL = defaultServerURL(cfg)
+			}
+			u, err := url.Parse(baseURL)
+			if err != nil {
+				exit(fmt.Errorf("Error: invalid URL `%s`: %s", baseURL, err), 1)
+			}
+			query := u.Query()
+			query.Set("token", token)
+			u.RawQuery = query.Encode()
+
+			fmt.Fprintf(os.Stderr, "Expires at %s\n", time.Unix(claims.ExpiresAt, 0).Format(time.RFC3339))
+			fmt.Println(u.String())
+			return nil
+		},
+	}
+}
+
+func defaultServerURL(cfg *config) string {
+	scheme := "http"
+	if cfg.app.EnableTLS {
+		scheme = "https"
+	}
+	host := cfg.app.Address
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host, _ = os.Hostname()
+	}
+	path := cfg.app.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return scheme + "://" + net.JoinHostPort(host, cfg.app.Port) + path
+}
@@ -0,0 +1,408 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fatih/structs"
+	"gopkg.in/yaml.v3"
+)
+
+// YAML and TOML config files are decoded with gopkg.in/yaml.v3 and
+// github.com/BurntSushi/toml, and their keys set the fields with the same
+// `hcl` tag, as in HCL config files. Options are set to a scalar or to a
+// list of scalars, and profiles are the mappings, or tables, under
+// `profiles`. Booleans are only `true` and `false`. Other values, e.g.
+// nested mappings or tables elsewhere, are rejected with a *ConfigError
+// rather than misread.
+
+// configValue is a single key of a YAML or TOML config file.
+type configValue struct {
+	line   int
+	scalar string
+	list   []string
+	isList bool
+}
+
+// configEntries holds the keys of a config file. Keys of a profile are
+// prefixed with `profiles.<name>.`, and `profiles.<name>` marks the profile itself.
+type configEntries map[string]*configValue
+
+const profilesKey = "profiles"
+
+// base returns the entries outside of profiles.
+func (entries configEntries) base() configEntries {
+	base := configEntries{}
+	for key, entry := range entries {
+		if !strings.HasPrefix(key, profilesKey+".") {
+			base[key] = entry
+		}
+	}
+	return base
+}
+
+// profile returns the entries of the named profile.
+func (entries configEntries) profile(name string) (configEntries, bool) {
+	prefix := profilesKey + "." + name
+	if _, ok := entries[prefix]; !ok {
+		return nil, false
+	}
+	profile := configEntries{}
+	for key, entry := range entries {
+		if strings.HasPrefix(key, prefix+".") {
+			profile[strings.TrimPrefix(key, prefix+".")] = entry
+		}
+	}
+	return profile, true
+}
+
+func (entries configEntries) profileNames() []string {
+	var names []string
+	for key := range entries {
+		if name, ok := strings.CutPrefix(key, profilesKey+"."); ok && !strings.Contains(name, ".") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// add adds a key, rejecting duplicates.
+func (entries configEntries) add(file string, key string, entry *configValue) error {
+	if _, exists := entries[key]; exists {
+		return &ConfigError{file, entry.line, fmt.Sprintf("duplicate key `%s`", key)}
+	}
+	entries[key] = entry
+	return nil
+}
+
+// ConfigError points at the offending line of a config file.
+type ConfigError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+const (
+	errNested      = "nested mappings are only supported in `profiles`"
+	errProfiles    = "`profiles` must be a mapping of profile names"
+	errProfileName = "profile names can not contain `.`"
+	errListItems   = "lists can only hold scalars"
+)
+
+// yamlLine matches the line yaml.v3 prefixes its errors with.
+var yamlLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+func parseYAML(file string, data string) (configEntries, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(data))
+	var document yaml.Node
+	if err := decoder.Decode(&document); err == io.EOF {
+		return configEntries{}, nil
+	} else if err != nil {
+		return nil, yamlError(file, err)
+	}
+	var next yaml.Node
+	if err := decoder.Decode(&next); err != io.EOF {
+		if err != nil {
+			return nil, yamlError(file, err)
+		}
+		return nil, &ConfigError{file, next.Line, "multiple documents are not supported"}
+	}
+
+	entries := configEntries{}
+	root := document.Content[0]
+	if isYAMLNull(root) {
+		return entries, nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, &ConfigError{file, root.Line, "expected a mapping of options"}
+	}
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], resolveYAML(root.Content[i+1])
+		if key.Value != profilesKey {
+			if err := addYAML(file, entries, key.Value, key, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if isYAMLNull(value) {
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, &ConfigError{file, value.Line, errProfiles}
+		}
+		for j := 0; j < len(value.Content); j += 2 {
+			name, profile := value.Content[j], resolveYAML(value.Content[j+1])
+			if strings.Contains(name.Value, ".") {
+				return nil, &ConfigError{file, name.Line, errProfileName}
+			}
+			prefix := profilesKey + "." + name.Value
+			if err := entries.add(file, prefix, &configValue{line: name.Line}); err != nil {
+				return nil, err
+			}
+			if isYAMLNull(profile) {
+				continue
+			}
+			if profile.Kind != yaml.MappingNode {
+				return nil, &ConfigError{file, profile.Line, "expected a mapping of options for profile `" + name.Value + "`"}
+			}
+			for k := 0; k < len(profile.Content); k += 2 {
+				key := profile.Content[k]
+				if err := addYAML(file, entries, prefix+"."+key.Value, key, resolveYAML(profile.Content[k+1])); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// addYAML adds the option at key, set to a scalar or to a list of scalars.
+func addYAML(file string, entries configEntries, name string, key *yaml.Node, value *yaml.Node) error {
+	entry := &configValue{line: key.Line}
+	switch value.Kind {
+	case yaml.ScalarNode:
+		if !isYAMLNull(value) {
+			entry.scalar = value.Value
+		}
+	case yaml.SequenceNode:
+		entry.isList = true
+		entry.list = []string{}
+		for _, item := range value.Content {
+			item = resolveYAML(item)
+			if item.Kind != yaml.ScalarNode {
+				return &ConfigError{file, item.Line, errListItems}
+			}
+			entry.list = append(entry.list, item.Value)
+		}
+	default:
+		return &ConfigError{file, value.Line, errNested}
+	}
+	return entries.add(file, name, entry)
+}
+
+// resolveYAML returns the node an alias refers to.
+func resolveYAML(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+func isYAMLNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+func yamlError(file string, err error) error {
+	match := yamlLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	line, _ := strconv.Atoi(match[1])
+	return &ConfigError{file, line, strings.TrimPrefix(err.Error(), match[0])}
+}
+
+func parseTOML(file string, data string) (configEntries, error) {
+	var document map[string]interface{}
+	if _, err := toml.Decode(data, &document); err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &ConfigError{file, parseErr.Position.Line, parseErr.Message}
+		}
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	lines := tomlLines(data)
+	entries := configEntries{}
+	for _, key := range sortedByLine(document, lines, "") {
+		if key != profilesKey {
+			if err := addTOML(file, entries, key, document[key], lines); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		profiles, ok := document[key].(map[string]interface{})
+		if !ok {
+			return nil, &ConfigError{file, lines[key], errProfiles}
+		}
+		for _, name := range sortedByLine(profiles, lines, profilesKey+".") {
+			prefix := profilesKey + "." + name
+			if strings.Contains(name, ".") {
+				return nil, &ConfigError{file, lines[prefix], errProfileName}
+			}
+			profile, ok := profiles[name].(map[string]interface{})
+			if !ok {
+				return nil, &ConfigError{file, lines[prefix], "expected a table of options for profile `" + name + "`"}
+			}
+			if err := entries.add(file, prefix, &configValue{line: lines[prefix]}); err != nil {
+				return nil, err
+			}
+			for _, key := range sortedByLine(profile, lines, prefix+".") {
+				if err := addTOML(file, entries, prefix+"."+key, profile[key], lines); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// addTOML adds the option at key, set to a scalar or to a list of scalars.
+func addTOML(file string, entries configEntries, key string, value interface{}, lines map[string]int) error {
+	entry := &configValue{line: lines[key]}
+	switch value := value.(type) {
+	case map[string]interface{}, []map[string]interface{}:
+		return &ConfigError{file, entry.line, errNested}
+	case []interface{}:
+		entry.isList = true
+		entry.list = []string{}
+		for _, item := range value {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return &ConfigError{file, entry.line, errListItems}
+			}
+			entry.list = append(entry.list, fmt.Sprint(item))
+		}
+	default:
+		entry.scalar = fmt.Sprint(value)
+	}
+	return entries.add(file, key, entry)
+}
+
+// sortedByLine returns the keys of a table in the order of their lines.
+func sortedByLine(table map[string]interface{}, lines map[string]int, prefix string) []string {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return lines[prefix+keys[i]] < lines[prefix+keys[j]] })
+	return keys
+}
+
+// tomlLines returns the line where each key of a TOML document, and each
+// table, is first seen, as the decoder does not report them. Parents of
+// dotted keys are seen with them.
+func tomlLines(data string) map[string]int {
+	lines := map[string]int{}
+	table := ""
+	for i, text := range strings.Split(data, "\n") {
+		text = strings.TrimSpace(text)
+		var key string
+		if header, ok := strings.CutPrefix(text, "["); ok {
+			header, _, _ = strings.Cut(strings.TrimPrefix(header, "["), "]")
+			table = normalizeTOMLKey(header)
+			key = table
+		} else if name, _, ok := strings.Cut(text, "="); ok && !strings.HasPrefix(text, "#") {
+			key = normalizeTOMLKey(name)
+			if table != "" {
+				key = table + "." + key
+			}
+		} else {
+			continue
+		}
+		for parent := key; parent != ""; {
+			if _, seen := lines[parent]; !seen {
+				lines[parent] = i + 1
+			}
+			dot := strings.LastIndexByte(parent, '.')
+			parent = parent[:max(dot, 0)]
+		}
+	}
+	return lines
+}
+
+// normalizeTOMLKey unquotes the parts of a dotted key.
+func normalizeTOMLKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
+
+// applyConfigEntries sets the fields whose `hcl` tag matches a key.
+func applyConfigEntries(file string, entries configEntries, options ...interface{}) error {
+	fields := map[string]*structs.Field{}
+	for _, struct_ := range options {
+		for _, field := range structs.New(struct_).Fields() {
+			if name := field.Tag("hcl"); name != "" {
+				fields[name] = field
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return entries[keys[i]].line < entries[keys[j]].line })
+
+	for _, key := range keys {
+		entry := entries[key]
+		field, ok := fields[key]
+		if !ok {
+			return &ConfigError{file, entry.line, fmt.Sprintf("unknown option `%s`", key)}
+		}
+
+		var val interface{}
+		switch field.Kind() {
+		case reflect.Slice:
+			if entry.isList {
+				val = entry.list
+			} else {
+				val = []string{entry.scalar}
+			}
+		case reflect.String, reflect.Bool, reflect.Int:
+			if entry.isList {
+				return &ConfigError{file, entry.line, fmt.Sprintf("`%s` does not accept a list", key)}
+			}
+			var err error
+			val, err = convertScalar(field.Kind(), entry.scalar)
+			if err != nil {
+				return &ConfigError{file, entry.line, fmt.Sprintf("invalid value for `%s`: %s", key, err)}
+			}
+		default:
+			return &ConfigError{file, entry.line, fmt.Sprintf("`%s` can not be set from this config format", key)}
+		}
+		if err := field.Set(val); err != nil {
+			return &ConfigError{file, entry.line, err.Error()}
+		}
+	}
+
+	return nil
+}
+
+func convertScalar(kind reflect.Kind, scalar string) (interface{}, error) {
+	switch kind {
+	case reflect.Bool:
+		switch scalar {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("expected true or false, got `%s`, other spellings of booleans are not supported", scalar)
+	case reflect.Int:
+		n, err := strconv.Atoi(scalar)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got `%s`", scalar)
+		}
+		return n, nil
+	}
+	return scalar, nil
+}
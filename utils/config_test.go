@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testOptions struct {
+	Address string   `hcl:"address"`
+	Port    int      `hcl:"port"`
+	Write   bool     `hcl:"permit_write"`
+	Scripts []string `hcl:"inject_scripts"`
+}
+
+func TestApplyConfigFileYAML(t *testing.T) {
+	options := &testOptions{}
+	err := applyTestConfig(t, "gotty.yaml", `
+# comment
+address: "127.0.0.1"   # trailing comment
+port: 9000
+permit_write: true
+inject_scripts:
+  - /a.js
+  - '/b.js'
+`, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &testOptions{Address: "127.0.0.1", Port: 9000, Write: true, Scripts: []string{"/a.js", "/b.js"}}
+	if !reflect.DeepEqual(options, expected) {
+		t.Errorf("options = %+v, expected %+v", options, expected)
+	}
+}
+
+func TestApplyConfigFileTOML(t *testing.T) {
+	options := &testOptions{}
+	err := applyTestConfig(t, "gotty.toml", `
+address = 'localhost'
+port = 9000 # trailing comment
+inject_scripts = ["/a.js", "/b,c.js"]
+`, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &testOptions{Address: "localhost", Port: 9000, Scripts: []string{"/a.js", "/b,c.js"}}
+	if !reflect.DeepEqual(options, expected) {
+		t.Errorf("options = %+v, expected %+v", options, expected)
+	}
+}
+
+func TestApplyConfigFileSyntax(t *testing.T) {
+	// the formats are read in full, not only their flat subset
+	for name, contents := range map[string]string{
+		"gotty.yaml": `
+defaults: &defaults
+  - /a.js
+address: |-
+  127.0.0.1
+port: 9000
+inject_scripts: *defaults
+`,
+		"gotty.toml": `
+address = """
+127.0.0.1"""
+"port" = 9000
+inject_scripts = [
+  "/a.js", # trailing comment
+]
+`,
+	} {
+		options := &testOptions{}
+		err := applyTestConfig(t, name, contents, options, &struct {
+			Defaults []string `hcl:"defaults"`
+		}{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		expected := &testOptions{Address: "127.0.0.1", Port: 9000, Scripts: []string{"/a.js"}}
+		if !reflect.DeepEqual(options, expected) {
+			t.Errorf("%s: options = %+v, expected %+v", name, options, expected)
+		}
+	}
+}
+
+func TestApplyConfigFileErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		file     string
+		contents string
+		line     int
+		expected string
+	}{
+		{"unknown key", "gotty.yaml", "address: x\nfoo: bar\n", 2, "unknown option `foo`"},
+		{"bad int", "gotty.toml", "\n\nport = \"abc\"\n", 3, "invalid value for `port`"},
+		{"bad bool", "gotty.yaml", "permit_write: yes\n", 1, "invalid value for `permit_write`"},
+		{"nested", "gotty.yaml", "address:\n  foo: bar\n", 2, "nested mappings are only supported in `profiles`"},
+		{"profile key", "gotty.yaml", "profiles:\n  dev:\n    foo: bar\n", 3, "unknown option `foo`"},
+		{"duplicate profile", "gotty.yaml", "profiles:\n  dev:\n  dev:\n", 3, "duplicate key `profiles.dev`"},
+		{"table", "gotty.toml", "[server]\n", 1, "nested mappings are only supported in `profiles`"},
+		{"unterminated", "gotty.toml", "address = \"abc\n", 1, "strings cannot contain newlines"},
+		{"yes", "gotty.yaml", "permit_write: True\n", 1, "invalid value for `permit_write`: expected true or false, got `True`"},
+		{"nested in profile", "gotty.yaml", "profiles:\n  dev:\n    address:\n      foo: bar\n", 4, "nested mappings are only supported in `profiles`"},
+		{"flow mapping", "gotty.yaml", "address: {foo: bar}\n", 1, "nested mappings are only supported in `profiles`"},
+		{"syntax", "gotty.yaml", "address: x\n  port: 9000\n", 2, "mapping values are not allowed in this context"},
+		{"documents", "gotty.yaml", "---\naddress: x\n---\nport: 9000\n", 3, "multiple documents are not supported"},
+		{"subtable", "gotty.toml", "[profiles.dev.server]\n", 1, "nested mappings are only supported in `profiles`"},
+		{"array of tables", "gotty.toml", "\n[[profiles]]\n", 2, "`profiles` must be a mapping of profile names"},
+		{"dotted key", "gotty.toml", "port = 9000\nserver.address = \"x\"\n", 2, "nested mappings are only supported in `profiles`"},
+		{"inline table", "gotty.toml", "address = { host = \"x\" }\n", 1, "nested mappings are only supported in `profiles`"},
+		{"nested list", "gotty.toml", "inject_scripts = [[\"/a.js\"]]\n", 1, "lists can only hold scalars"},
+		{"profile option", "gotty.toml", "[profiles.dev]\nport = 9000\nfoo = \"bar\"\n", 3, "unknown option `foo`"},
+	}
+
+	for _, c := range cases {
+		err := applyTestConfig(t, c.file, c.contents, &testOptions{})
+		configErr, ok := err.(*ConfigError)
+		if !ok {
+			t.Errorf("%s: error = %v, expected a *ConfigError", c.name, err)
+			continue
+		}
+		if configErr.Line != c.line || !strings.HasPrefix(configErr.Msg, c.expected) {
+			t.Errorf("%s: error = %q, expected line %d: %q", c.name, err, c.line, c.expected)
+		}
+	}
+}
+
+func TestApplyConfigProfile(t *testing.T) {
+	files := map[string]string{
+		"gotty.yaml": `
+address: "0.0.0.0"
+port: 8080
+profiles:
+  dev:
+    port: 9000
+    inject_scripts:
+      - /dev.js
+  prod:
+    address: "127.0.0.1"
+`,
+		"gotty.toml": `
+address = "0.0.0.0"
+port = 8080
+
+[profiles.dev]
+port = 9000
+inject_scripts = ["/dev.js"]
+
+[profiles.prod]
+address = "127.0.0.1"
+`,
+		"gotty": `
+address = "0.0.0.0"
+port = 8080
+
+profiles "dev" {
+  port = 9000
+  inject_scripts = ["/dev.js"]
+}
+
+profiles "prod" {
+  address = "127.0.0.1"
+}
+`,
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		options := &testOptions{}
+		if err := ApplyConfigProfile(path, "dev", options); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		expected := &testOptions{Address: "0.0.0.0", Port: 9000, Scripts: []string{"/dev.js"}}
+		if !reflect.DeepEqual(options, expected) {
+			t.Errorf("%s: options = %+v, expected %+v", name, options, expected)
+		}
+
+		if err := ApplyConfigProfile(path, "staging", &testOptions{}); err == nil || !strings.Contains(err.Error(), "unknown profile `staging`") {
+			t.Errorf("%s: error = %v, expected unknown profile", name, err)
+		}
+	}
+}
+
+func applyTestConfig(t *testing.T, name string, contents string, options ...interface{}) error {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return ApplyConfigFile(path, options...)
+}
+
+func TestWriteConfig(t *testing.T) {
+	options := &testOptions{Address: `"quoted" #`, Port: 9000, Scripts: []string{"/a.js", "b, c"}}
+	secrets := &struct {
+		Credential string `hcl:"credential" secret:"true"`
+	}{"user:pass"}
+
+	var buf strings.Builder
+	if err := WriteConfig(&buf, "yaml", options, secrets); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(buf.String(), "user:pass") {
+		t.Errorf("secret is not masked:\n%s", buf.String())
+	}
+
+	// the YAML output is a valid config file
+	parsed := &testOptions{}
+	parsedSecrets := &struct {
+		Credential string `hcl:"credential"`
+	}{}
+	if err := applyTestConfig(t, "gotty.yaml", buf.String(), parsed, parsedSecrets); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(parsed, options) {
+		t.Errorf("options = %+v, expected %+v", parsed, options)
+	}
+	if parsedSecrets.Credential != maskedSecret {
+		t.Errorf("credential = %q, expected %q", parsedSecrets.Credential, maskedSecret)
+	}
+
+	buf.Reset()
+	if err := WriteConfig(&buf, "json", options, secrets); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(buf.String()), &values); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if values["credential"] != maskedSecret || values["address"] != options.Address || values["port"] != float64(9000) {
+		t.Errorf("values = %v, expected the options with the credential masked", values)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/fatih/structs"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 func ApplyDefaultValues(struct_ interface{}) (err error) {
@@ -32,6 +33,8 @@ func ApplyDefaultValues(struct_ interface{}) (err error) {
 			if err != nil {
 				return err
 			}
+		case reflect.Slice:
+			val = strings.Split(defaultValue, ",")
 		default:
 			val = field.Value()
 		}
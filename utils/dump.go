@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fatih/structs"
+	"gopkg.in/yaml.v3"
+)
+
+const maskedSecret = "********"
+
+// WriteConfig writes the options as a YAML or JSON config file.
+// Fields tagged `secret:"true"` are masked when set.
+func WriteConfig(w io.Writer, format string, options ...interface{}) error {
+	values := map[string]interface{}{}
+	for _, struct_ := range options {
+		for _, field := range structs.New(struct_).Fields() {
+			name := field.Tag("hcl")
+			if name == "" {
+				continue
+			}
+			value := field.Value()
+			if field.Tag("secret") == "true" && !field.IsZero() {
+				value = maskedSecret
+			}
+			if list, ok := value.([]string); ok && list == nil {
+				value = []string{}
+			}
+			values[name] = value
+		}
+	}
+
+	var data []byte
+	var err error
+	switch format {
+	case "yaml":
+		data, err = yaml.Marshal(values)
+	case "json":
+		data, err = json.MarshalIndent(values, "", "  ")
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("unknown config format `%s`, expected yaml or json", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
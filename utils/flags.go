@@ -1,14 +1,17 @@
 package utils
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 
 	"github.com/fatih/structs"
 	"github.com/urfave/cli/v2"
 	"github.com/yudai/hcl"
+	hclobj "github.com/yudai/hcl/hcl"
 
 	"github.com/sorenisanerd/gotty/pkg/homedir"
 )
@@ -59,6 +62,14 @@ func GenerateFlags(options ...interface{}) (flags []cli.Flag, mappings map[strin
 					EnvVars: []string{envName},
 					Aliases: aliases,
 				})
+			case reflect.Slice:
+				flags = append(flags, &cli.StringSliceFlag{
+					Name:    flagName,
+					Value:   cli.NewStringSlice(field.Value().([]string)...),
+					Usage:   flagDescription,
+					EnvVars: []string{envName},
+					Aliases: aliases,
+				})
 			}
 		}
 	}
@@ -100,29 +111,97 @@ func ApplyFlags(
 			val = c.Bool(flagName)
 		case reflect.Int:
 			val = c.Int(flagName)
+		case reflect.Slice:
+			val = c.StringSlice(flagName)
 		}
 		field.Set(val)
 	}
 }
 
 func ApplyConfigFile(filePath string, options ...interface{}) error {
+	return ApplyConfigProfile(filePath, "", options...)
+}
+
+// ApplyConfigProfile applies the base options of the config file,
+// then the options of the named profile on top of them.
+// An empty profile applies the base options only.
+func ApplyConfigProfile(filePath string, profile string, options ...interface{}) error {
 	filePath = homedir.Expand(filePath)
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return err
 	}
 
 	fileString := []byte{}
-	log.Printf("Loading config file at: %s", filePath)
+	slog.Info("Loading config file", "path", filePath)
 	fileString, err := os.ReadFile(filePath)
 	if err != nil {
 		return err
 	}
 
-	for _, object := range options {
-		if err := hcl.Decode(object, string(fileString)); err != nil {
+	var entries configEntries
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yaml", ".yml":
+		entries, err = parseYAML(filePath, string(fileString))
+	case ".toml":
+		entries, err = parseTOML(filePath, string(fileString))
+	default:
+		return applyHCL(filePath, string(fileString), profile, options...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := applyConfigEntries(filePath, entries.base(), options...); err != nil {
+		return err
+	}
+
+	// check every profile, so that mistakes don't wait for the profile to be used
+	for _, name := range entries.profileNames() {
+		profileEntries, _ := entries.profile(name)
+		scratch := make([]interface{}, len(options))
+		for i, object := range options {
+			scratch[i] = reflect.New(reflect.TypeOf(object).Elem()).Interface()
+		}
+		if err := applyConfigEntries(filePath, profileEntries, scratch...); err != nil {
 			return err
 		}
 	}
 
+	if profile == "" {
+		return nil
+	}
+	profileEntries, ok := entries.profile(profile)
+	if !ok {
+		return fmt.Errorf("%s: unknown profile `%s`", filePath, profile)
+	}
+	return applyConfigEntries(filePath, profileEntries, options...)
+}
+
+func applyHCL(filePath string, content string, profile string, options ...interface{}) error {
+	for _, object := range options {
+		if err := hcl.Decode(object, content); err != nil {
+			return fmt.Errorf("%s: %s", filePath, err)
+		}
+	}
+	if profile == "" {
+		return nil
+	}
+
+	root, err := hclobj.Parse(content)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filePath, err)
+	}
+	var profileObject *hclobj.Object
+	if profiles := root.Get("profiles", false); profiles != nil {
+		profileObject = profiles.Get(profile, false)
+	}
+	if profileObject == nil {
+		return fmt.Errorf("%s: unknown profile `%s`", filePath, profile)
+	}
+	for _, object := range options {
+		if err := hcl.DecodeObject(object, profileObject); err != nil {
+			return fmt.Errorf("%s: profile `%s`: %s", filePath, profile, err)
+		}
+	}
 	return nil
 }
@@ -1,15 +1,48 @@
 package webtty
 
+import (
+	"encoding/base64"
+)
+
+// Decoder decodes the input received from masters.
+// dst is at least as long as src.
 type Decoder interface {
 	Decode(dst, src []byte) (int, error)
 }
 
+// Encoder encodes the output sent to masters.
 type Encoder interface {
+	// EncodedLen returns the length of n encoded bytes, the size of dst for Encode.
+	EncodedLen(n int) int
 	Encode(dst, src []byte) (int, error)
 }
 
+// Base64Codec encodes binary data as base64 text,
+// so that output can be sent over text-only streams. It is the default.
+type Base64Codec struct{}
+
+func (Base64Codec) EncodedLen(n int) int {
+	return base64.StdEncoding.EncodedLen(n)
+}
+
+func (Base64Codec) Encode(dst, src []byte) (int, error) {
+	base64.StdEncoding.Encode(dst, src)
+	return base64.StdEncoding.EncodedLen(len(src)), nil
+}
+
+func (Base64Codec) Decode(dst, src []byte) (int, error) {
+	return base64.StdEncoding.Decode(dst, src)
+}
+
+// NullCodec passes binary data as is.
+// Masters using it for output must carry arbitrary bytes,
+// e.g. binary WebSocket messages.
 type NullCodec struct{}
 
+func (NullCodec) EncodedLen(n int) int {
+	return n
+}
+
 func (NullCodec) Encode(dst, src []byte) (int, error) {
 	return copy(dst, src), nil
 }
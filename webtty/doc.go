@@ -1,3 +1,49 @@
-// Package webtty provides a protocl and an implementation to
-// controll terminals thorough networks.
+// Package webtty provides a protocol and an implementation to
+// control terminals through networks.
+//
+// A WebTTY bridges a Master, typically a WebSocket connection to a browser,
+// and a Slave, typically a command running in a PTY. It has no dependency on
+// GoTTY's server, so any pair of them can be bridged:
+//
+//	tty, err := webtty.New(master, slave, webtty.WithPermitWrite())
+//	if err != nil {
+//		return err
+//	}
+//	err = tty.Run(ctx)
+//
+// # Protocol
+//
+// Each read from and write to the master is a message, whose first byte is
+// its type and the rest its payload. Masters send Input, Ping,
+// ResizeTerminal and SetEncoding messages. WebTTY sends SetWindowTitle,
+// SetBufferSize and optionally SetPreferences and SetReconnect when it
+// starts, then Output and Pong messages, and SetTerminalSize when the slave
+// is resized to another size than the master asks for.
+//
+// Output is encoded by the Encoder of WithEncoder(), base64 by default.
+// Input is decoded by the Decoder the master selects by name with
+// SetEncoding, raw bytes ("null") until then. "base64" is always available,
+// others can be added with WithDecoder().
+//
+// # Observers
+//
+// Watch sends the output of a running WebTTY to more masters, which get
+// SetPermitWrite false when they start watching, a SetTerminalSize whenever
+// the slave is resized, and a ShowNotice when they send Input, which is
+// dropped. Observers lagging behind the output are disconnected rather than
+// slowing the session down.
+//
+// # Errors
+//
+// Run returns ErrSlaveClosed or ErrMasterClosed when either end is closed,
+// the error of the context when it is canceled, and errors wrapping
+// ErrMalformedMessage or ErrUnknownMessage, both ErrProtocol, when the master
+// breaks the protocol. Use errors.Is() to tell them apart.
+//
+// # Lifecycle
+//
+// Slaves implementing SlaveLifecycle are started by Run, stopped gracefully
+// within the timeout of WithStopTimeout() when the master or the context
+// ends the session, and waited for when they exit by themselves, in which
+// case Run returns an *ExitError with their exit code, also ErrSlaveClosed.
 package webtty
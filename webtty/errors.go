@@ -2,12 +2,42 @@ package webtty
 
 import (
 	"errors"
+	"fmt"
 )
 
+// Errors returned by WebTTY.Run(), possibly wrapped.
+// Use errors.Is() to compare them.
 var (
-	// ErrSlaveClosed indicates the function has exited by the slave
+	// ErrSlaveClosed is returned when the slave is closed, e.g. the command exited.
 	ErrSlaveClosed = errors.New("slave closed")
 
-	// ErrSlaveClosed is returned when the slave connection is closed.
+	// ErrMasterClosed is returned when the master is closed, e.g. the client left.
 	ErrMasterClosed = errors.New("master closed")
+
+	// ErrSlowMaster is returned when the master can not keep up with the
+	// output and WithOutputBuffer sets OutputDisconnect.
+	ErrSlowMaster = errors.New("master too slow")
+
+	// ErrProtocol is the cause of all errors caused by a master breaking the protocol.
+	ErrProtocol = errors.New("protocol error")
+
+	// ErrMalformedMessage is returned for messages from the master that can not be decoded.
+	ErrMalformedMessage = fmt.Errorf("malformed message: %w", ErrProtocol)
+
+	// ErrUnknownMessage is returned for messages from the master of an unknown type.
+	ErrUnknownMessage = fmt.Errorf("unknown message type: %w", ErrProtocol)
 )
+
+// ExitError is returned when a slave implementing SlaveLifecycle exits.
+// It wraps ErrSlaveClosed.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("slave exited with status %d", e.Code)
+}
+
+func (e *ExitError) Unwrap() error {
+	return ErrSlaveClosed
+}
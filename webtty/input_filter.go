@@ -0,0 +1,59 @@
+package webtty
+
+import "unicode/utf8"
+
+// InputFilter returns the part of the input of the master to write to the
+// slave, possibly reusing the memory of input.
+type InputFilter func(input []byte) []byte
+
+// ScrollKeys are the keys scrolling pagers and TUIs: the up and down arrows,
+// PgUp, PgDn, Home and End, in both of their encodings.
+var ScrollKeys = []string{
+	"\x1b[A", "\x1b[B", "\x1bOA", "\x1bOB",
+	"\x1b[5~", "\x1b[6~",
+	"\x1b[H", "\x1b[F", "\x1bOH", "\x1bOF", "\x1b[1~", "\x1b[4~",
+}
+
+// AllowInput returns an InputFilter passing only keys, each a character or
+// a whole escape sequence, e.g. "q", "\x03" for Ctrl+C or "\x1b[5~" for PgUp.
+// Other escape sequences are dropped whole, so that none of their
+// characters pass on their own.
+func AllowInput(keys ...string) InputFilter {
+	allowed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		allowed[key] = true
+	}
+	return func(input []byte) []byte {
+		output := input[:0]
+		for len(input) > 0 {
+			n := keyLength(input)
+			if allowed[string(input[:n])] {
+				output = append(output, input[:n]...)
+			}
+			input = input[n:]
+		}
+		return output
+	}
+}
+
+// keyLength returns the length of the key at the start of input: an escape
+// sequence, CSI or SS3, or a character.
+func keyLength(input []byte) int {
+	if input[0] != 0x1b || len(input) == 1 {
+		_, n := utf8.DecodeRune(input)
+		return n
+	}
+	switch input[1] {
+	case '[':
+		for i := 2; i < len(input); i++ {
+			if input[i] >= 0x40 && input[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(input)
+	case 'O':
+		return min(3, len(input))
+	default:
+		return 1 + keyLength(input[1:])
+	}
+}
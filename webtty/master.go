@@ -5,4 +5,5 @@ import (
 )
 
 // Master represents a PTY master, usually it's a websocket connection.
+// As for any io.Writer, Write must not retain p, whose buffer is reused.
 type Master io.ReadWriter
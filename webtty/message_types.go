@@ -1,8 +1,21 @@
 package webtty
 
-// Protocols defines the name of this protocol,
-// which is supposed to be used to the subprotocol of Websockt streams.
-var Protocols = []string{"webtty"}
+// Protocols are the names of the versions of this protocol, to be used as
+// the subprotocol of WebSocket streams, by preference. webtty is the
+// unversioned name used by older frontends, for any version.
+var Protocols = []string{"gotty.v2", "gotty.v1", "webtty"}
+
+// ProtocolVersion returns the version of protocol, one of Protocols,
+// or 0 for webtty and unknown protocols.
+func ProtocolVersion(protocol string) int {
+	switch protocol {
+	case "gotty.v1":
+		return 1
+	case "gotty.v2":
+		return 2
+	}
+	return 0
+}
 
 const (
 	// Unknown message type, maybe sent by a bug
@@ -15,6 +28,15 @@ const (
 	ResizeTerminal = '3'
 	// Change encoding
 	SetEncoding = '4'
+	// Share the text selection of the terminal, JSON or empty to clear it
+	Selection = '5'
+	// Send a chat message to the other participants of the session
+	Chat = '6'
+	// Drop a marker labelled with the payload into the recording of the session
+	Marker = '7'
+	// Control the playback of a recording, as JSON: paused, time in seconds
+	// and speed, each optional
+	Playback = '8'
 )
 
 const (
@@ -32,4 +54,24 @@ const (
 	SetReconnect = '5'
 	// Set the input buffer size
 	SetBufferSize = '6'
+	// Notify that input has been permitted (true) or revoked (false)
+	SetPermitWrite = '7'
+	// Notify that output of a slow browser has been dropped, in bytes
+	OutputDropped = '8'
+	// Set the token to resume the session with after reconnecting
+	SetResumeToken = '9'
+	// Show the text selection of another participant of the session
+	SetSelection = 'a'
+	// Show a chat message of a participant of the session
+	ShowChat = 'b'
+	// Show a notice of the server over the terminal, as a JSON string
+	ShowNotice = 'c'
+	// Summarize the session that ended, as JSON, right before the server
+	// closes the connection
+	SessionSummary = 'd'
+	// Set the state of the playback of a recording, as JSON
+	SetPlayback = 'e'
+	// Show the terminal at the size of the slave, when it is not the one
+	// asked for, as JSON columns and rows
+	SetTerminalSize = 'f'
 )
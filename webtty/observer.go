@@ -0,0 +1,181 @@
+package webtty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// observerBacklog is how many messages of output an observer may lag
+// behind before it is disconnected.
+const observerBacklog = 256
+
+// readOnlyNotice is shown to an observer once it tries to write.
+const readOnlyNotice = "This session is read-only"
+
+// observer is a master watching the output of a WebTTY, see Watch.
+type observer struct {
+	conn       Master
+	messages   chan []byte // of Output and SetTerminalSize, closed once the WebTTY is done with it
+	writeMutex sync.Mutex
+	done       bool // set when Watch returns, to stop writing to the observer
+}
+
+func (o *observer) write(data []byte) error {
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	if o.done {
+		return ErrMasterClosed
+	}
+	if _, err := o.conn.Write(data); err != nil {
+		return fmt.Errorf("failed to write to observer: %w", err)
+	}
+	return nil
+}
+
+// Watch sends the output of the slave to master too, from now on, until ctx
+// is canceled or either ends. The input of master is rejected, and it does
+// not resize the slave. It returns ErrSlaveClosed once Run returns, or
+// ErrSlowMaster when master lags behind the output.
+func (wt *WebTTY) Watch(ctx context.Context, master Master) error {
+	o := &observer{conn: master, messages: make(chan []byte, observerBacklog)}
+	if err := wt.sendObserverInitializeMessage(o); err != nil {
+		return err
+	}
+
+	wt.observerMutex.Lock()
+	if wt.done.Load() {
+		wt.observerMutex.Unlock()
+		return ErrSlaveClosed
+	}
+	if wt.observers == nil {
+		wt.observers = map[*observer]struct{}{}
+	}
+	wt.observers[o] = struct{}{}
+	wt.observerMutex.Unlock()
+	defer wt.unwatch(o)
+	// the caller may write to the observer once Watch returns
+	defer func() {
+		o.writeMutex.Lock()
+		o.done = true
+		o.writeMutex.Unlock()
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- wt.readObserver(o)
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case message, ok := <-o.messages:
+			if !ok {
+				if wt.done.Load() {
+					return ErrSlaveClosed
+				}
+				return ErrSlowMaster
+			}
+			if err := o.write(message); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (wt *WebTTY) sendObserverInitializeMessage(o *observer) error {
+	if err := o.write(append([]byte{SetWindowTitle}, wt.windowTitle...)); err != nil {
+		return fmt.Errorf("failed to send window title: %w", err)
+	}
+	bufSizeMsg, _ := json.Marshal(wt.bufferSize)
+	if err := o.write(append([]byte{SetBufferSize}, bufSizeMsg...)); err != nil {
+		return fmt.Errorf("failed to send buffer size: %w", err)
+	}
+	if err := o.write(append([]byte{SetPermitWrite}, "false"...)); err != nil {
+		return fmt.Errorf("failed to revoke writes: %w", err)
+	}
+	if wt.masterPrefs != nil {
+		if err := o.write(append([]byte{SetPreferences}, wt.masterPrefs...)); err != nil {
+			return fmt.Errorf("failed to set preferences: %w", err)
+		}
+	}
+	if columns, rows := wt.Size(); columns > 0 && rows > 0 {
+		if err := o.write(terminalSizeMessage(columns, rows)); err != nil {
+			return fmt.Errorf("failed to send terminal size: %w", err)
+		}
+	}
+	return nil
+}
+
+// readObserver answers the pings of o and rejects its input, telling it
+// once, until it is closed.
+func (wt *WebTTY) readObserver(o *observer) error {
+	buffer := getBuffer(wt.bufferSize)
+	defer putBuffer(buffer)
+	told := false
+	for {
+		n, err := o.conn.Read(*buffer)
+		if err != nil {
+			return ErrMasterClosed
+		}
+		if n == 0 {
+			return fmt.Errorf("unexpected zero length read from observer: %w", ErrMalformedMessage)
+		}
+		switch (*buffer)[0] {
+		case Ping:
+			err = o.write([]byte{Pong})
+		case Input:
+			if !told {
+				told = true
+				payload, _ := json.Marshal(readOnlyNotice)
+				err = o.write(append([]byte{ShowNotice}, payload...))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// broadcast sends message, an Output or SetTerminalSize one, to the
+// observers, disconnecting those lagging behind.
+func (wt *WebTTY) broadcast(message []byte) {
+	wt.observerMutex.Lock()
+	defer wt.observerMutex.Unlock()
+	if len(wt.observers) == 0 {
+		return
+	}
+	message = bytes.Clone(message)
+	for o := range wt.observers {
+		select {
+		case o.messages <- message:
+		default: // lagging, leaves the output to the others
+			delete(wt.observers, o)
+			close(o.messages)
+		}
+	}
+}
+
+// unwatch stops sending the output to o.
+func (wt *WebTTY) unwatch(o *observer) {
+	wt.observerMutex.Lock()
+	defer wt.observerMutex.Unlock()
+	if _, ok := wt.observers[o]; ok {
+		delete(wt.observers, o)
+		close(o.messages)
+	}
+}
+
+// closeObservers disconnects the observers once Run returns.
+func (wt *WebTTY) closeObservers() {
+	wt.observerMutex.Lock()
+	defer wt.observerMutex.Unlock()
+	for o := range wt.observers {
+		close(o.messages)
+	}
+	wt.observers = nil
+}
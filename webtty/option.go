@@ -2,8 +2,11 @@ package webtty
 
 import (
 	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
 
-	"github.com/pkg/errors"
+	"github.com/sorenisanerd/gotty/pkg/spill"
 )
 
 // Option is an option for WebTTY.
@@ -12,7 +15,18 @@ type Option func(*WebTTY) error
 // WithPermitWrite sets a WebTTY to accept input from slaves.
 func WithPermitWrite() Option {
 	return func(wt *WebTTY) error {
-		wt.permitWrite = true
+		wt.permitWrite.Store(true)
+		return nil
+	}
+}
+
+// WithInputFilter sets a WebTTY to accept the input from slaves passed by
+// filter only.
+func WithInputFilter(filter InputFilter) Option {
+	return func(wt *WebTTY) error {
+		wt.permitWrite.Store(true)
+		wt.inputFilter = filter
+		wt.filterInput.Store(true)
 		return nil
 	}
 }
@@ -33,6 +47,27 @@ func WithFixedRows(rows int) Option {
 	}
 }
 
+// WithArbitratedSize makes the slave, shared with others, decide its size:
+// resizing it only tells it the size the master asks for, and the size it
+// takes is reported with Resized.
+func WithArbitratedSize() Option {
+	return func(wt *WebTTY) error {
+		wt.arbitratedSize = true
+		return nil
+	}
+}
+
+// WithInitialSize sets the size of the TTY master to resize the slave to
+// before starting it, so that its first output fits, e.g. from the init
+// message of a client. Fixed columns and rows take precedence.
+func WithInitialSize(columns int, rows int) Option {
+	return func(wt *WebTTY) error {
+		wt.initialColumns = columns
+		wt.initialRows = rows
+		return nil
+	}
+}
+
 // WithWindowTitle sets the default window title of the session
 func WithWindowTitle(windowTitle []byte) Option {
 	return func(wt *WebTTY) error {
@@ -49,14 +84,134 @@ func WithReconnect(timeInSeconds int) Option {
 	}
 }
 
+// WithResumeToken sends the master a token to resume the session with,
+// reconnecting to the same slave, once its connection is lost.
+func WithResumeToken(token string) Option {
+	return func(wt *WebTTY) error {
+		wt.resumeToken = token
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the WebTTY, which is slog.Default() by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(wt *WebTTY) error {
+		wt.logger = logger
+		return nil
+	}
+}
+
+// WithEncoder sets the encoder of the output sent to the master,
+// which is Base64Codec by default.
+func WithEncoder(encoder Encoder) Option {
+	return func(wt *WebTTY) error {
+		wt.encoder = encoder
+		return nil
+	}
+}
+
+// WithDecoder adds a decoder for input that the master can select by name
+// with a SetEncoding message, besides "base64" and "null".
+func WithDecoder(name string, decoder Decoder) Option {
+	return func(wt *WebTTY) error {
+		wt.decoders[name] = decoder
+		return nil
+	}
+}
+
+// WithStopTimeout sets how long slaves implementing SlaveLifecycle are given
+// to exit when stopped, DefaultStopTimeout by default.
+func WithStopTimeout(timeout time.Duration) Option {
+	return func(wt *WebTTY) error {
+		wt.stopTimeout = timeout
+		return nil
+	}
+}
+
+// WithOutputBuffer queues up to limit bytes of output for the master
+// instead of blocking the slave when the master is slower, then applies
+// policy. Output is not queued by default.
+func WithOutputBuffer(limit int, policy OutputPolicy) Option {
+	return func(wt *WebTTY) error {
+		if limit < 0 {
+			return fmt.Errorf("invalid output buffer limit %d", limit)
+		}
+		wt.outputLimit = limit
+		wt.outputPolicy = policy
+		return nil
+	}
+}
+
+// WithOutputSpill takes the memory of the output buffer from budget, shared
+// with other WebTTYs, if not nil, and spills up to diskLimit bytes of output
+// to a temporary file in dir once the memory is used up, before applying
+// the policy of WithOutputBuffer.
+func WithOutputSpill(budget *spill.Budget, diskLimit int64, dir string) Option {
+	return func(wt *WebTTY) error {
+		if diskLimit < 0 {
+			return fmt.Errorf("invalid output spill limit %d", diskLimit)
+		}
+		wt.outputBudget = budget
+		wt.outputSpill = diskLimit
+		wt.outputDir = dir
+		return nil
+	}
+}
+
 // WithMasterPreferences sets an optional configuration of master.
 func WithMasterPreferences(preferences interface{}) Option {
 	return func(wt *WebTTY) error {
 		prefs, err := json.Marshal(preferences)
 		if err != nil {
-			return errors.Wrapf(err, "failed to marshal preferences as JSON")
+			return fmt.Errorf("failed to marshal preferences as JSON: %w", err)
 		}
 		wt.masterPrefs = prefs
 		return nil
 	}
 }
+
+// WithMasterTimeout ends Run with ErrMasterClosed when the master sends no
+// message, such as a Ping, for timeout. It applies to masters with read
+// deadlines, such as WebSocket connections.
+func WithMasterTimeout(timeout time.Duration) Option {
+	return func(wt *WebTTY) error {
+		wt.masterTimeout = timeout
+		return nil
+	}
+}
+
+// WithSelectionHandler calls handler with the text selections shared by the
+// master, which are ignored by default.
+func WithSelectionHandler(handler func(selection []byte)) Option {
+	return func(wt *WebTTY) error {
+		wt.onSelection = handler
+		return nil
+	}
+}
+
+// WithChatHandler calls handler with the chat messages sent by the master,
+// which are ignored by default.
+func WithChatHandler(handler func(text []byte)) Option {
+	return func(wt *WebTTY) error {
+		wt.onChat = handler
+		return nil
+	}
+}
+
+// WithMarkerHandler calls handler with the labels of the markers dropped by
+// the master, which are ignored by default.
+func WithMarkerHandler(handler func(label []byte)) Option {
+	return func(wt *WebTTY) error {
+		wt.onMarker = handler
+		return nil
+	}
+}
+
+// WithPlaybackHandler calls handler with the controls of the playback of a
+// recording sent by the master, which are ignored by default.
+func WithPlaybackHandler(handler func(control []byte)) Option {
+	return func(wt *WebTTY) error {
+		wt.onPlayback = handler
+		return nil
+	}
+}
@@ -0,0 +1,99 @@
+package webtty
+
+import (
+	"sync"
+
+	"github.com/sorenisanerd/gotty/pkg/spill"
+)
+
+// OutputPolicy is what WebTTY does with the output of slaves that masters
+// can not keep up with, once the buffer set by WithOutputBuffer is full.
+type OutputPolicy int
+
+const (
+	// OutputDrop drops the oldest output, keeping the latest.
+	OutputDrop OutputPolicy = iota
+	// OutputDisconnect ends the session with ErrSlowMaster.
+	OutputDisconnect
+)
+
+// outputQueue buffers the output of the slave for the master.
+type outputQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buffer  *spill.Buffer
+	policy  OutputPolicy
+	dropped int // since the last next()
+	closed  bool
+}
+
+func newOutputQueue(buffer *spill.Buffer, policy OutputPolicy) *outputQueue {
+	q := &outputQueue{buffer: buffer, policy: policy}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues p, returning ErrSlowMaster when it overflows with
+// OutputDisconnect.
+func (q *outputQueue) push(p []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+
+	for {
+		_, err := q.buffer.Write(p)
+		if err != spill.ErrFull {
+			if err == nil {
+				q.cond.Signal()
+			}
+			return err
+		}
+		if q.policy == OutputDisconnect {
+			return ErrSlowMaster
+		}
+		// drop the oldest output, then what does not fit of p once the
+		// buffer is empty, e.g. when other buffers took the memory. They
+		// may have freed it since, leaving nothing to drop but to retry.
+		overflow := max(int64(len(p))-q.buffer.Free(), 0)
+		if q.buffer.Len() > 0 {
+			q.dropped += int(q.buffer.Discard(max(overflow, 1)))
+		} else {
+			q.dropped += int(overflow)
+			p = p[overflow:]
+		}
+	}
+}
+
+// next copies the oldest output to p, waiting for some. It returns the
+// length copied and how much was dropped since, or ok false once the queue
+// is closed and empty.
+func (q *outputQueue) next(p []byte) (n int, dropped int, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.buffer.Len() == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.buffer.Len() == 0 {
+		return 0, 0, false
+	}
+	n, _ = q.buffer.Read(p)
+	dropped, q.dropped = q.dropped, 0
+	return n, dropped, true
+}
+
+// close ends the queue, once the queued output is taken by next().
+func (q *outputQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// release frees the buffer once the queue is no longer used.
+func (q *outputQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.buffer.Close()
+}
@@ -1,6 +1,7 @@
 package webtty
 
 import (
+	"context"
 	"io"
 )
 
@@ -15,3 +16,17 @@ type Slave interface {
 	// ResizeTerminal sets a new size of the terminal.
 	ResizeTerminal(columns int, rows int) error
 }
+
+// SlaveLifecycle is optionally implemented by slaves whose backend WebTTY can
+// control. Run() then starts the slave, stops it when the session ends
+// otherwise than by the slave, and reports the exit code of the slave in an
+// ExitError when it ends by itself.
+type SlaveLifecycle interface {
+	// Start starts the backend, unless it already is.
+	Start(ctx context.Context) error
+	// Stop asks the backend to exit, and forces it once ctx is done.
+	// It returns when the backend exited.
+	Stop(ctx context.Context) error
+	// Wait waits for the backend to exit and returns its exit code.
+	Wait() (exitCode int, err error)
+}
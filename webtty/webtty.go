@@ -1,14 +1,26 @@
 package webtty
 
 import (
+	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/pkg/errors"
+	"github.com/sorenisanerd/gotty/pkg/spill"
 )
 
+// DefaultStopTimeout is how long slaves are given to exit when stopped.
+const DefaultStopTimeout = 10 * time.Second
+
+// defaultWriteStopTimeout is how long a write to the master is waited for
+// when Run returns.
+const defaultWriteStopTimeout = 5 * time.Second
+
 // WebTTY bridges a PTY slave and its PTY master.
 // To support text-based streams and side channel commands such as
 // terminal resizing, WebTTY uses an original protocol.
@@ -19,15 +31,65 @@ type WebTTY struct {
 	slave Slave
 
 	windowTitle []byte
-	permitWrite bool
+	permitWrite atomic.Bool
+	inputFilter InputFilter // of the permitted input, all if nil
+	filterInput atomic.Bool // until SetPermitWrite
 	columns     int
 	rows        int
-	reconnect   int // in seconds
+	reconnect   int    // in seconds
+	resumeToken string // to reconnect to the same slave with
 	masterPrefs []byte
+	onSelection func(selection []byte) // of the master, ignored if nil
+	onChat      func(text []byte)      // of the master, ignored if nil
+	onMarker    func(label []byte)     // of the master, ignored if nil
+	onPlayback  func(control []byte)   // of the master, ignored if nil
+	encoder     Encoder
 	decoder     Decoder
+	decoders    map[string]Decoder // selectable by the master with SetEncoding
+	logger      *slog.Logger
+	stopTimeout time.Duration
+
+	writeStopTimeout time.Duration // of the write in progress when Run returns
+
+	initialColumns int // to resize the slave to before starting it
+	initialRows    int
+	size           atomic.Int64 // of the slave, columns<<32 | rows
+	masterSize     atomic.Int64 // asked by the master
+	shownSize      atomic.Int64 // last sent to the master with SetTerminalSize, 0 if none
+	initialized    atomic.Bool  // once sent the initializing messages
+	arbitratedSize bool         // reported with Resized by whoever shares the slave
+
+	bufferSize    int
+	outputLimit   int // of the output queue, none if 0
+	outputPolicy  OutputPolicy
+	outputBudget  *spill.Budget // of the memory of output queues, unlimited if nil
+	outputSpill   int64         // bytes of the output queue spilled to disk
+	outputDir     string        // of the spilled output
+	masterTimeout time.Duration // without messages from the master, none if 0
+	writeMutex    sync.Mutex
+	done          atomic.Bool // set under writeMutex when Run returns, to stop writing to the master
+	decodeBuffer  []byte      // of the input, used by the master read loop only
+
+	observerMutex sync.Mutex
+	observers     map[*observer]struct{} // of Watch
+}
+
+// bufferPool holds the buffers of the read loops, reused across connections
+// to spare the garbage collector under heavy output.
+var bufferPool sync.Pool // of *[]byte
 
-	bufferSize int
-	writeMutex sync.Mutex
+// getBuffer returns a pooled buffer of size bytes, to be returned with putBuffer.
+func getBuffer(size int) *[]byte {
+	if b, ok := bufferPool.Get().(*[]byte); ok && cap(*b) >= size {
+		*b = (*b)[:size]
+		return b
+	}
+	b := make([]byte, size)
+	return &b
+}
+
+func putBuffer(b *[]byte) {
+	bufferPool.Put(b)
 }
 
 // New creates a new instance of WebTTY.
@@ -39,16 +101,26 @@ func New(masterConn Master, slave Slave, options ...Option) (*WebTTY, error) {
 		masterConn: masterConn,
 		slave:      slave,
 
-		permitWrite: false,
-		columns:     0,
-		rows:        0,
+		columns: 0,
+		rows:    0,
 
 		bufferSize: 1024,
-		decoder:    &NullCodec{},
+		encoder:    Base64Codec{},
+		decoder:    NullCodec{},
+		decoders: map[string]Decoder{
+			"base64": Base64Codec{},
+			"null":   NullCodec{},
+		},
+		logger:      slog.Default(),
+		stopTimeout: DefaultStopTimeout,
+
+		writeStopTimeout: defaultWriteStopTimeout,
 	}
 
 	for _, option := range options {
-		option(wt)
+		if err := option(wt); err != nil {
+			return nil, err
+		}
 	}
 
 	return wt, nil
@@ -60,97 +132,298 @@ func New(masterConn Master, slave Slave, options ...Option) (*WebTTY, error) {
 // after the context is canceled. Closing them is caller's
 // responsibility.
 // If the connection to one end gets closed, returns ErrSlaveClosed or ErrMasterClosed.
+// Slaves implementing SlaveLifecycle are started first and stopped at the end,
+// and an ExitError is returned when they exit.
 func (wt *WebTTY) Run(ctx context.Context) error {
+	if wt.initialColumns > 0 && wt.initialRows > 0 {
+		wt.resize(wt.initialColumns, wt.initialRows)
+	}
+
+	lifecycle, _ := wt.slave.(SlaveLifecycle)
+	if lifecycle != nil {
+		if err := lifecycle.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start slave: %w", err)
+		}
+	}
+
 	err := wt.sendInitializeMessage()
 	if err != nil {
-		return errors.Wrapf(err, "failed to send initializing message")
+		err = fmt.Errorf("failed to send initializing message: %w", err)
+		wt.stop(lifecycle)
+		return err
 	}
 
-	errs := make(chan error, 2)
+	errs := make(chan error, 3)
 
-	go func() {
-		errs <- func() error {
-			buffer := make([]byte, wt.bufferSize)
-			for {
-				//base64 length
-				effectiveBufferSize := wt.bufferSize - 1
-				//max raw data length
-				maxChunkSize := int(effectiveBufferSize/4) * 3
-
-				n, err := wt.slave.Read(buffer[:maxChunkSize])
-				if err != nil {
-					return ErrSlaveClosed
-				}
-
-				err = wt.handleSlaveReadEvent(buffer[:n])
-				if err != nil {
-					return err
-				}
-			}
+	// masters with read deadlines are read by Run itself, and interrupted by
+	// a deadline, to spare a goroutine per session
+	deadliner, inline := wt.masterConn.(readDeadliner)
+	var interrupted atomic.Bool
+	interrupt := func() {
+		interrupted.Store(true)
+		deadliner.SetReadDeadline(time.Now())
+	}
+	fail := func(err error) {
+		errs <- err
+		if inline {
+			interrupt()
+		}
+	}
+
+	// the largest output whose encoding fits in the buffer of the master
+	// with the message type
+	maxChunkSize := wt.bufferSize - 1
+	for wt.encoder.EncodedLen(maxChunkSize) > wt.bufferSize-1 {
+		maxChunkSize--
+	}
+
+	var queue *outputQueue
+	queueDone := make(chan struct{}) // once sendQueuedOutput returned
+	if wt.outputLimit > 0 {
+		buffer := spill.NewBuffer(wt.outputBudget, int64(wt.outputLimit), wt.outputSpill, wt.outputDir)
+		queue = newOutputQueue(buffer, wt.outputPolicy)
+		go func() {
+			defer close(queueDone)
+			fail(wt.sendQueuedOutput(queue, maxChunkSize))
 		}()
-	}()
+	}
 
 	go func() {
-		errs <- func() error {
-			buffer := make([]byte, wt.bufferSize)
-			for {
-				n, err := wt.masterConn.Read(buffer)
-				if err != nil {
-					return ErrMasterClosed
-				}
-
-				err = wt.handleMasterReadEvent(buffer[:n])
-				if err != nil {
-					return err
-				}
+		err := wt.readSlave(queue, maxChunkSize)
+		if queue != nil && err == ErrSlaveClosed {
+			queue.close() // sendQueuedOutput ends the session once the output is sent
+			return
+		}
+		fail(err)
+	}()
+
+	if inline {
+		stop := context.AfterFunc(ctx, interrupt)
+		masterErr := wt.readMaster(deadliner, &interrupted)
+		stop()
+		select {
+		case err = <-errs:
+		default:
+			if err = ctx.Err(); err == nil {
+				err = masterErr
 			}
+		}
+	} else {
+		go func() {
+			errs <- wt.readMaster(nil, nil)
 		}()
-	}()
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case err = <-errs:
+		}
+	}
+	if queue != nil {
+		queue.close()
+	}
+	// the caller is the only writer of the master once Run returns. readSlave
+	// writes nothing more, and returns at the next output of the slave or
+	// once the caller closes it.
+	wt.stopWriting()
+	if queue != nil {
+		<-queueDone
+		queue.release()
+	}
+	wt.closeObservers()
 
-	select {
-	case <-ctx.Done():
-		err = ctx.Err()
-	case err = <-errs:
+	if lifecycle != nil {
+		if errors.Is(err, ErrSlaveClosed) {
+			if code, waitErr := lifecycle.Wait(); waitErr == nil {
+				err = &ExitError{Code: code}
+			}
+		} else {
+			wt.stop(lifecycle)
+		}
 	}
 
 	return err
 }
 
+// writeDeadliner is implemented by masters whose writes can be interrupted,
+// such as WebSocket and network connections.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// stopWriting stops writing to the master once the write in progress, if
+// any, is done, interrupting it after writeStopTimeout if the master allows.
+func (wt *WebTTY) stopWriting() {
+	if deadliner, ok := wt.masterConn.(writeDeadliner); ok {
+		interrupted := make(chan struct{})
+		timer := time.AfterFunc(wt.writeStopTimeout, func() {
+			deadliner.SetWriteDeadline(time.Now())
+			close(interrupted)
+		})
+		defer func() {
+			if !timer.Stop() {
+				<-interrupted
+				deadliner.SetWriteDeadline(time.Time{})
+			}
+		}()
+	}
+	wt.writeMutex.Lock()
+	wt.done.Store(true)
+	wt.writeMutex.Unlock()
+}
+
+// readDeadliner is implemented by masters whose reads can be interrupted,
+// such as WebSocket and network connections.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// readMaster handles the messages of the master until an error. With
+// deadliner, reads time out after the timeout of WithMasterTimeout, and
+// stop once interrupted is set.
+func (wt *WebTTY) readMaster(deadliner readDeadliner, interrupted *atomic.Bool) error {
+	pooled := getBuffer(wt.bufferSize)
+	defer putBuffer(pooled)
+	decodeBuffer := getBuffer(wt.bufferSize)
+	defer putBuffer(decodeBuffer)
+	wt.decodeBuffer = *decodeBuffer
+
+	buffer := *pooled
+	for {
+		if deadliner != nil && wt.masterTimeout > 0 {
+			deadliner.SetReadDeadline(time.Now().Add(wt.masterTimeout))
+			if interrupted.Load() { // before the deadline was extended
+				return ErrMasterClosed
+			}
+		}
+		n, err := wt.masterConn.Read(buffer)
+		if err != nil {
+			return ErrMasterClosed
+		}
+
+		err = wt.handleMasterReadEvent(buffer[:n])
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readSlave sends the output of the slave to the master, or to queue if not
+// nil, in chunks of up to maxChunkSize bytes.
+func (wt *WebTTY) readSlave(queue *outputQueue, maxChunkSize int) error {
+	buffer := getBuffer(maxChunkSize)
+	defer putBuffer(buffer)
+	message := getBuffer(1 + wt.encoder.EncodedLen(maxChunkSize))
+	defer putBuffer(message)
+	for {
+		n, err := wt.slave.Read(*buffer)
+		if err != nil {
+			return ErrSlaveClosed
+		}
+
+		if queue != nil {
+			err = queue.push((*buffer)[:n])
+		} else {
+			err = wt.handleSlaveReadEvent(*message, (*buffer)[:n])
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sendQueuedOutput sends the output of queue to the master, telling it how
+// much was dropped with OutputDropped if any, until the queue is closed.
+func (wt *WebTTY) sendQueuedOutput(queue *outputQueue, maxChunkSize int) error {
+	buffer := getBuffer(maxChunkSize)
+	defer putBuffer(buffer)
+	message := getBuffer(1 + wt.encoder.EncodedLen(maxChunkSize))
+	defer putBuffer(message)
+	for {
+		n, dropped, ok := queue.next(*buffer)
+		if !ok {
+			return ErrSlaveClosed
+		}
+
+		if dropped > 0 {
+			wt.logger.Debug("Dropped output of a slow master", "bytes", dropped)
+			notice, _ := json.Marshal(dropped)
+			if err := wt.masterWrite(append([]byte{OutputDropped}, notice...)); err != nil {
+				return fmt.Errorf("failed to notify dropped output: %w", err)
+			}
+		}
+		if err := wt.handleSlaveReadEvent(*message, (*buffer)[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// stop stops the slave, forcing it after the stop timeout.
+func (wt *WebTTY) stop(lifecycle SlaveLifecycle) {
+	if lifecycle == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wt.stopTimeout)
+	defer cancel()
+	if err := lifecycle.Stop(ctx); err != nil {
+		wt.logger.Warn("Failed to stop slave", "error", err)
+	}
+}
+
 func (wt *WebTTY) sendInitializeMessage() error {
 	err := wt.masterWrite(append([]byte{SetWindowTitle}, wt.windowTitle...))
 	if err != nil {
-		return errors.Wrapf(err, "failed to send window title")
+		return fmt.Errorf("failed to send window title: %w", err)
 	}
 
 	bufSizeMsg, _ := json.Marshal(wt.bufferSize)
 	err = wt.masterWrite(append([]byte{SetBufferSize}, bufSizeMsg...))
 	if err != nil {
-		return errors.Wrapf(err, "failed to send buffer size")
+		return fmt.Errorf("failed to send buffer size: %w", err)
 	}
 
 	if wt.reconnect > 0 {
 		reconnect, _ := json.Marshal(wt.reconnect)
 		err := wt.masterWrite(append([]byte{SetReconnect}, reconnect...))
 		if err != nil {
-			return errors.Wrapf(err, "failed to set reconnect")
+			return fmt.Errorf("failed to set reconnect: %w", err)
+		}
+	}
+
+	if wt.resumeToken != "" {
+		token, _ := json.Marshal(wt.resumeToken)
+		err := wt.masterWrite(append([]byte{SetResumeToken}, token...))
+		if err != nil {
+			return fmt.Errorf("failed to set resume token: %w", err)
 		}
 	}
 
 	if wt.masterPrefs != nil {
 		err := wt.masterWrite(append([]byte{SetPreferences}, wt.masterPrefs...))
 		if err != nil {
-			return errors.Wrapf(err, "failed to set preferences")
+			return fmt.Errorf("failed to set preferences: %w", err)
 		}
 	}
 
+	wt.initialized.Store(true)
+	wt.showSize()
 	return nil
 }
 
-func (wt *WebTTY) handleSlaveReadEvent(data []byte) error {
-	safeMessage := base64.StdEncoding.EncodeToString(data)
-	err := wt.masterWrite(append([]byte{Output}, []byte(safeMessage)...))
+// handleSlaveReadEvent sends data to the master, encoded in message, which
+// must hold the encoding of data and the message type.
+func (wt *WebTTY) handleSlaveReadEvent(message []byte, data []byte) error {
+	if wt.logger.Enabled(context.Background(), slog.LevelDebug) { // spares boxing the length
+		wt.logger.Debug("Output from slave", "bytes", len(data))
+	}
+	message[0] = Output
+	n, err := wt.encoder.Encode(message[1:], data)
 	if err != nil {
-		return errors.Wrapf(err, "failed to send message to master")
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	wt.broadcast(message[:1+n])
+	err = wt.masterWrite(message[:1+n])
+	if err != nil {
+		return fmt.Errorf("failed to send message to master: %w", err)
 	}
 
 	return nil
@@ -159,23 +432,71 @@ func (wt *WebTTY) handleSlaveReadEvent(data []byte) error {
 func (wt *WebTTY) masterWrite(data []byte) error {
 	wt.writeMutex.Lock()
 	defer wt.writeMutex.Unlock()
+	if wt.done.Load() {
+		return ErrMasterClosed
+	}
 
 	_, err := wt.masterConn.Write(data)
 	if err != nil {
-		return errors.Wrapf(err, "failed to write to master")
+		return fmt.Errorf("failed to write to master: %w", err)
 	}
 
 	return nil
 }
 
+// SetPermitWrite permits or revokes the input of the master while running,
+// all of it regardless of WithInputFilter, and notifies the master.
+func (wt *WebTTY) SetPermitWrite(permit bool) error {
+	wt.filterInput.Store(false)
+	wt.permitWrite.Store(permit)
+	payload, _ := json.Marshal(permit)
+	return wt.masterWrite(append([]byte{SetPermitWrite}, payload...))
+}
+
+// SendSelection shows the master the text selection of another participant.
+func (wt *WebTTY) SendSelection(selection []byte) error {
+	return wt.masterWrite(append([]byte{SetSelection}, selection...))
+}
+
+// SendChat shows the master a chat message of a participant.
+func (wt *WebTTY) SendChat(message []byte) error {
+	return wt.masterWrite(append([]byte{ShowChat}, message...))
+}
+
+// SendPlayback shows the master the state of the playback of a recording.
+func (wt *WebTTY) SendPlayback(state []byte) error {
+	return wt.masterWrite(append([]byte{SetPlayback}, state...))
+}
+
+// SendNotice shows the master a notice of the server over the terminal.
+func (wt *WebTTY) SendNotice(text string) error {
+	payload, _ := json.Marshal(text)
+	return wt.masterWrite(append([]byte{ShowNotice}, payload...))
+}
+
+// PermitWrite tells whether the input of the master is permitted,
+// at least in part.
+func (wt *WebTTY) PermitWrite() bool {
+	return wt.permitWrite.Load()
+}
+
+// SendTerminalSize shows the master its terminal at columns and rows, e.g.
+// the size of a slave it shares with others.
+func (wt *WebTTY) SendTerminalSize(columns int, rows int) error {
+	return wt.masterWrite(terminalSizeMessage(columns, rows))
+}
+
 func (wt *WebTTY) handleMasterReadEvent(data []byte) error {
 	if len(data) == 0 {
-		return errors.New("unexpected zero length read from master")
+		return fmt.Errorf("unexpected zero length read from master: %w", ErrMalformedMessage)
+	}
+	if wt.logger.Enabled(context.Background(), slog.LevelDebug) {
+		wt.logger.Debug("Message from master", "type", string(data[0]), "bytes", len(data)-1)
 	}
 
 	switch data[0] {
 	case Input:
-		if !wt.permitWrite {
+		if !wt.permitWrite.Load() {
 			return nil
 		}
 
@@ -183,63 +504,139 @@ func (wt *WebTTY) handleMasterReadEvent(data []byte) error {
 			return nil
 		}
 
-		var decodedBuffer = make([]byte, len(data))
+		decodedBuffer := wt.decodeBuffer
+		if len(decodedBuffer) < len(data) {
+			decodedBuffer = make([]byte, len(data))
+		}
 		n, err := wt.decoder.Decode(decodedBuffer, data[1:])
 		if err != nil {
-			return errors.Wrapf(err, "failed to decode received data")
+			return fmt.Errorf("failed to decode received data: %w: %w", ErrMalformedMessage, err)
 		}
 
-		_, err = wt.slave.Write(decodedBuffer[:n])
+		input := decodedBuffer[:n]
+		if wt.filterInput.Load() {
+			if input = wt.inputFilter(input); len(input) == 0 {
+				return nil
+			}
+		}
+		_, err = wt.slave.Write(input)
 		if err != nil {
-			return errors.Wrapf(err, "failed to write received data to slave")
+			return fmt.Errorf("failed to write received data to slave: %w", err)
 		}
 
 	case Ping:
 		err := wt.masterWrite([]byte{Pong})
 		if err != nil {
-			return errors.Wrapf(err, "failed to return Pong message to master")
+			return fmt.Errorf("failed to return Pong message to master: %w", err)
 		}
 
 	case SetEncoding:
-		switch string(data[1:]) {
-		case "base64":
-			wt.decoder = base64.StdEncoding
-		case "null":
-			wt.decoder = NullCodec{}
+		if decoder, ok := wt.decoders[string(data[1:])]; ok {
+			wt.decoder = decoder
 		}
 
 	case ResizeTerminal:
-		if wt.columns != 0 && wt.rows != 0 {
-			break
-		}
-
 		if len(data) <= 1 {
-			return errors.New("received malformed remote command for terminal resize: empty payload")
+			return fmt.Errorf("received remote command for terminal resize with empty payload: %w", ErrMalformedMessage)
 		}
 
 		var args argResizeTerminal
 		err := json.Unmarshal(data[1:], &args)
 		if err != nil {
-			return errors.Wrapf(err, "received malformed data for terminal resize")
+			return fmt.Errorf("received data for terminal resize: %w: %w", ErrMalformedMessage, err)
+		}
+		wt.resize(int(args.Columns), int(args.Rows))
+
+	case Selection:
+		if wt.onSelection != nil {
+			wt.onSelection(bytes.Clone(data[1:]))
+		}
+
+	case Chat:
+		if wt.onChat != nil {
+			wt.onChat(bytes.Clone(data[1:]))
 		}
-		rows := wt.rows
-		if rows == 0 {
-			rows = int(args.Rows)
+
+	case Marker:
+		if wt.onMarker != nil {
+			wt.onMarker(bytes.Clone(data[1:]))
 		}
 
-		columns := wt.columns
-		if columns == 0 {
-			columns = int(args.Columns)
+	case Playback:
+		if wt.onPlayback != nil {
+			wt.onPlayback(bytes.Clone(data[1:]))
 		}
 
-		wt.slave.ResizeTerminal(columns, rows)
 	default:
-		return errors.Errorf("unknown message type `%c`", data[0])
+		return fmt.Errorf("received `%c`: %w", data[0], ErrUnknownMessage)
 	}
 
 	return nil
 }
 
+// resize resizes the slave to columns and rows as the master asks, but for
+// the fixed ones.
+func (wt *WebTTY) resize(columns int, rows int) {
+	wt.masterSize.Store(packSize(columns, rows))
+	if wt.columns != 0 {
+		columns = wt.columns
+	}
+	if wt.rows != 0 {
+		rows = wt.rows
+	}
+	wt.slave.ResizeTerminal(columns, rows)
+	if !wt.arbitratedSize {
+		wt.Resized(columns, rows)
+	}
+}
+
+// Resized records that the slave was resized to columns and rows, showing
+// the observers, and the master its terminal at that size when it asked for
+// another one, e.g. fixed by WithFixedColumns or decided by others sharing
+// the slave.
+func (wt *WebTTY) Resized(columns int, rows int) {
+	if size := packSize(columns, rows); wt.size.Swap(size) != size {
+		wt.broadcast(terminalSizeMessage(columns, rows))
+	}
+	if wt.initialized.Load() {
+		wt.showSize()
+	}
+}
+
+// showSize sends the master the size of the slave unless it is the one the
+// master asked for. Once shown another size, the master is shown every size,
+// its own too, to size its terminal back.
+func (wt *WebTTY) showSize() {
+	size := wt.size.Load()
+	if size == 0 || size == wt.masterSize.Load() && wt.shownSize.Load() == 0 {
+		return
+	}
+	if wt.shownSize.Swap(size) != size {
+		if err := wt.SendTerminalSize(int(size>>32), int(uint32(size))); err != nil {
+			wt.logger.Debug("Failed to send terminal size", "error", err)
+		}
+	}
+}
+
+// Size returns the size the slave was last resized to, by the master,
+// WithFixedColumns and WithFixedRows, or Resized, or zeros if none.
+func (wt *WebTTY) Size() (columns int, rows int) {
+	size := wt.size.Load()
+	return int(size >> 32), int(uint32(size))
+}
+
+func packSize(columns int, rows int) int64 {
+	return int64(columns)<<32 | int64(uint32(rows))
+}
+
+func terminalSizeMessage(columns int, rows int) []byte {
+	payload, _ := json.Marshal(struct {
+		Columns int `json:"columns"`
+		Rows    int `json:"rows"`
+	}{columns, rows})
+	return append([]byte{SetTerminalSize}, payload...)
+}
+
 type argResizeTerminal struct {
 	Columns float64
 	Rows    float64
@@ -4,9 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"io"
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/sorenisanerd/gotty/pkg/spill"
 )
 
 func TestInitialization(t *testing.T) {
@@ -87,6 +98,53 @@ func TestWriteFromSlaveCommand(t *testing.T) {
 	cancel()
 	wg.Wait()
 }
+
+func TestWriteFromSlaveCommandWithEncoder(t *testing.T) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	mMaster, mSlave, _, cancel := prepareSUT(t, &wg, WithEncoder(NullCodec{}))
+	defer cancel()
+
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetWindowTitle)
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetBufferSize)
+
+	message := []byte("foo\x00bar")
+	mSlave.slaveToGottyWriter.Write(message)
+
+	msgType, payload := nextMsg(t, mMaster.gottyToMasterReader)
+	if msgType != Output {
+		t.Fatalf("Unexpected message type `%c`", msgType)
+	}
+	if !bytes.Equal(payload[:len(message)], message) {
+		t.Fatalf("Unexpected message received: `%s`", payload)
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func TestUnknownMessage(t *testing.T) {
+	mMaster := newMockMaster()
+	mSlave := newMockSlave()
+	dt, err := New(mMaster, mSlave)
+	if err != nil {
+		t.Fatalf("Unexpected error from New(): %s", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- dt.Run(context.Background())
+	}()
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetWindowTitle)
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetBufferSize)
+
+	mMaster.masterToGottyWriter.Write([]byte("9"))
+	if err := <-errs; !errors.Is(err, ErrUnknownMessage) || !errors.Is(err, ErrProtocol) {
+		t.Fatalf("Unexpected error from Run(): %v", err)
+	}
+}
+
 func TestWriteFromFrontend(t *testing.T) {
 	var wg sync.WaitGroup
 	defer wg.Wait()
@@ -147,6 +205,109 @@ func TestPing(t *testing.T) {
 	wg.Wait()
 }
 
+func TestWatch(t *testing.T) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	mMaster, mSlave, dt, cancel := prepareSUT(t, &wg, WithPermitWrite(), WithEncoder(NullCodec{}))
+	defer cancel()
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetWindowTitle)
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetBufferSize)
+
+	observer := newMockMaster()
+	defer observer.close()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- dt.Watch(context.Background(), observer)
+	}()
+	checkNextMsgType(t, observer.gottyToMasterReader, SetWindowTitle)
+	checkNextMsgType(t, observer.gottyToMasterReader, SetBufferSize)
+	if msgType, payload := nextMsg(t, observer.gottyToMasterReader); msgType != SetPermitWrite || !bytes.HasPrefix(payload, []byte("false")) {
+		t.Fatalf("Unexpected message `%c%s`, expected writes to be revoked", msgType, payload)
+	}
+
+	// wait until the observer is registered
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		dt.observerMutex.Lock()
+		watching := len(dt.observers) == 1
+		dt.observerMutex.Unlock()
+		if watching {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the observer was not registered")
+		}
+	}
+
+	mSlave.slaveToGottyWriter.Write([]byte("foobar"))
+	for _, reader := range []io.Reader{mMaster.gottyToMasterReader, observer.gottyToMasterReader} {
+		if msgType, payload := nextMsg(t, reader); msgType != Output || !bytes.HasPrefix(payload, []byte("foobar")) {
+			t.Fatalf("Unexpected message `%c%s`, expected the output", msgType, payload)
+		}
+	}
+
+	mSlave.wg.Add(1)
+	mMaster.masterToGottyWriter.Write([]byte(`3{"Columns": 100, "Rows": 30}` + "\n"))
+	mSlave.wg.Wait()
+	if msgType, payload := nextMsg(t, observer.gottyToMasterReader); msgType != SetTerminalSize || !bytes.HasPrefix(payload, []byte(`{"columns":100,"rows":30}`)) {
+		t.Fatalf("Unexpected message `%c%s`, expected the size of the terminal", msgType, payload)
+	}
+
+	observer.masterToGottyWriter.Write([]byte("1rm -rf /"))
+	if msgType, payload := nextMsg(t, observer.gottyToMasterReader); msgType != ShowNotice || !bytes.Contains(payload, []byte("read-only")) {
+		t.Fatalf("Unexpected message `%c%s`, expected the input to be rejected", msgType, payload)
+	}
+
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrSlaveClosed) {
+			t.Errorf("Watch() returned %v, expected ErrSlaveClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch() did not return after Run")
+	}
+}
+
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	return sb.buf.String()
+}
+
+func TestLogger(t *testing.T) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	logs := &syncBuffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	mMaster, mSlave, _, cancel := prepareSUT(t, &wg, WithLogger(logger.With("session", "abc")))
+	defer cancel()
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetWindowTitle)
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetBufferSize)
+
+	mMaster.masterToGottyWriter.Write([]byte{Ping})
+	checkNextMsgType(t, mMaster.gottyToMasterReader, Pong)
+	mSlave.slaveToGottyWriter.Write([]byte("foo"))
+	checkNextMsgType(t, mMaster.gottyToMasterReader, Output)
+
+	for _, expected := range []string{`msg="Message from master" session=abc type=2 bytes=0`, `msg="Output from slave" session=abc bytes=3`} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("logged %s, expected %s", logs.String(), expected)
+		}
+	}
+}
 func TestResizeTerminal(t *testing.T) {
 	var wg sync.WaitGroup
 	defer wg.Wait()
@@ -182,6 +343,352 @@ func TestResizeTerminal(t *testing.T) {
 	wg.Wait()
 }
 
+func TestInitialSize(t *testing.T) {
+	mMaster := newMockMaster()
+	mSlave := newMockSlave()
+
+	dt, err := New(mMaster, mSlave, WithInitialSize(120, 40), WithFixedRows(30))
+	if err != nil {
+		t.Fatalf("Unexpected error from New(): %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mSlave.wg.Add(1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dt.Run(ctx)
+	}()
+	mSlave.wg.Wait()
+
+	if mSlave.columns != 120 || mSlave.rows != 30 {
+		t.Fatalf("Unexpected initial size %dx%d, expected 120x30", mSlave.columns, mSlave.rows)
+	}
+
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetWindowTitle)
+	cancel()
+	mMaster.close()
+	mSlave.close()
+	<-done
+}
+
+func TestFixedSize(t *testing.T) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	mMaster, mSlave, dt, cancel := prepareSUT(t, &wg, WithFixedColumns(80), WithFixedRows(24))
+	defer cancel()
+
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetWindowTitle)
+	checkNextMsgType(t, mMaster.gottyToMasterReader, SetBufferSize)
+
+	mSlave.wg.Add(1)
+	mMaster.masterToGottyWriter.Write([]byte(`3{"Columns": 100, "Rows": 30}` + "\n"))
+	mSlave.wg.Wait()
+	if mSlave.columns != 80 || mSlave.rows != 24 {
+		t.Fatalf("Unexpected size %dx%d, expected the fixed 80x24", mSlave.columns, mSlave.rows)
+	}
+	if msgType, payload := nextMsg(t, mMaster.gottyToMasterReader); msgType != SetTerminalSize || !bytes.HasPrefix(payload, []byte(`{"columns":80,"rows":24}`)) {
+		t.Fatalf("Unexpected message `%c%s`, expected the size of the terminal", msgType, payload)
+	}
+
+	// the master is shown the size once only
+	mSlave.wg.Add(1)
+	mMaster.masterToGottyWriter.Write([]byte(`3{"Columns": 120, "Rows": 40}` + "\n"))
+	mSlave.wg.Wait()
+	go dt.Resized(100, 30)
+	if msgType, payload := nextMsg(t, mMaster.gottyToMasterReader); msgType != SetTerminalSize || !bytes.HasPrefix(payload, []byte(`{"columns":100,"rows":30}`)) {
+		t.Fatalf("Unexpected message `%c%s`, expected the size resized to", msgType, payload)
+	}
+	if columns, rows := dt.Size(); columns != 100 || rows != 30 {
+		t.Errorf("Size() = %dx%d, expected 100x30", columns, rows)
+	}
+
+	cancel()
+	mMaster.close()
+	mSlave.close()
+}
+
+func TestAllowInput(t *testing.T) {
+	filter := AllowInput(append([]string{"q", "\x03"}, ScrollKeys...)...)
+	for input, expected := range map[string]string{
+		"q":                    "q",
+		"quit\r":               "q",
+		"\x1b[5~\x1b[6~":       "\x1b[5~\x1b[6~",
+		"\x1b[1;5Cq\x1bOAx":    "q\x1bOA",
+		"\x1bq\x03":            "\x03",
+		"\u00e9q\x1b[":         "q",
+		"\x1b[200~rm\x1b[201~": "",
+	} {
+		if output := filter([]byte(input)); string(output) != expected {
+			t.Errorf("filter(%q) = %q, expected %q", input, output, expected)
+		}
+	}
+}
+
+func TestOutputBuffer(t *testing.T) {
+	output := bytes.Repeat([]byte("0123456789"), 10000)
+	for _, policy := range []OutputPolicy{OutputDrop, OutputDisconnect} {
+		// the master blocks its first write until the slave output everything
+		slave := &bulkSlave{data: output, done: make(chan struct{})}
+		master := &slowMaster{discardMaster: discardMaster{closed: make(chan struct{})}, release: slave.done, interrupted: make(chan struct{})}
+		wt, err := New(master, slave, WithOutputBuffer(1000, policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wt.writeStopTimeout = 10 * time.Millisecond
+		err = wt.Run(context.Background())
+		close(master.closed)
+
+		switch policy {
+		case OutputDrop:
+			if !errors.Is(err, ErrSlaveClosed) {
+				t.Fatalf("Run() returned %v, expected ErrSlaveClosed", err)
+			}
+			received := master.output()
+			if !bytes.HasSuffix(received, output[len(output)-1000:]) {
+				t.Errorf("received %d bytes without the tail of the output", len(received))
+			}
+			if len(received) > 2000 {
+				t.Errorf("received %d bytes, expected at most the buffer", len(received))
+			}
+			if len(received)+master.dropped != len(output) {
+				t.Errorf("received %d bytes and was notified of %d dropped, expected %d in all", len(received), master.dropped, len(output))
+			}
+		case OutputDisconnect:
+			if !errors.Is(err, ErrSlowMaster) {
+				t.Errorf("Run() returned %v, expected ErrSlowMaster", err)
+			}
+		}
+	}
+}
+
+func TestOutputSpill(t *testing.T) {
+	output := bytes.Repeat([]byte("0123456789"), 10000)
+	slave := &bulkSlave{data: output, done: make(chan struct{})}
+	master := &slowMaster{discardMaster: discardMaster{closed: make(chan struct{})}, release: slave.done, interrupted: make(chan struct{})}
+	budget := spill.NewBudget(1000, nil)
+	wt, err := New(master, slave, WithOutputBuffer(1000, OutputDisconnect), WithOutputSpill(budget, int64(len(output)), t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wt.Run(context.Background())
+	close(master.closed)
+	if !errors.Is(err, ErrSlaveClosed) {
+		t.Fatalf("Run() returned %v, expected ErrSlaveClosed", err)
+	}
+	if !bytes.Equal(master.output(), output) {
+		t.Errorf("received %d bytes, expected the %d bytes of output", len(master.output()), len(output))
+	}
+	if budget.Memory() != 0 || budget.Disk() != 0 {
+		t.Errorf("the buffer kept %d bytes of memory and %d on disk", budget.Memory(), budget.Disk())
+	}
+}
+
+func TestOutputQueueSharedBudget(t *testing.T) {
+	// the other queue frees its memory right after the queue found the
+	// budget used up, before it makes room for its output
+	var budget *spill.Budget
+	var other *outputQueue
+	var armed atomic.Bool
+	freed := make(chan struct{})
+	budget = spill.NewBudget(16, func(memory, disk int64) {
+		if armed.Swap(false) {
+			go func() {
+				other.next(make([]byte, 16))
+				close(freed)
+			}()
+			for budget.Memory() > 0 {
+				runtime.Gosched()
+			}
+		}
+	})
+	other = newOutputQueue(spill.NewBuffer(budget, 16, 0, ""), OutputDrop)
+	q := newOutputQueue(spill.NewBuffer(budget, 16, 0, ""), OutputDrop)
+	if err := other.push([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+
+	armed.Store(true)
+	if err := q.push([]byte("abcdefghij")); err != nil {
+		t.Fatalf("push() returned %v", err)
+	}
+	<-freed
+	buf := make([]byte, 16)
+	if n, dropped, _ := q.next(buf); string(buf[:n]) != "abcdefghij" || dropped != 0 {
+		t.Errorf("next() = %q with %d dropped, expected the output", buf[:n], dropped)
+	}
+}
+
+// slowMaster blocks writing output until release is closed, or a write
+// deadline is set, and keeps it.
+type slowMaster struct {
+	discardMaster
+	release     <-chan struct{}
+	interrupt   sync.Once
+	interrupted chan struct{}
+
+	mu       sync.Mutex
+	received []byte
+	dropped  int // bytes, as notified
+}
+
+func (sm *slowMaster) SetWriteDeadline(t time.Time) error {
+	if !t.IsZero() {
+		sm.interrupt.Do(func() { close(sm.interrupted) })
+	}
+	return nil
+}
+
+func (sm *slowMaster) Write(buf []byte) (int, error) {
+	if buf[0] == OutputDropped {
+		var dropped int
+		if err := json.Unmarshal(buf[1:], &dropped); err != nil {
+			return 0, err
+		}
+		sm.mu.Lock()
+		sm.dropped += dropped
+		sm.mu.Unlock()
+	}
+	if buf[0] == Output {
+		select {
+		case <-sm.release:
+		case <-sm.interrupted:
+			return 0, os.ErrDeadlineExceeded
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(buf[1:]))
+		if err != nil {
+			return 0, err
+		}
+		sm.mu.Lock()
+		sm.received = append(sm.received, decoded...)
+		sm.mu.Unlock()
+	}
+	return len(buf), nil
+}
+
+func (sm *slowMaster) output() []byte {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.received
+}
+
+func TestMasterWithDeadline(t *testing.T) {
+	for _, timeout := range []time.Duration{50 * time.Millisecond, 0} {
+		master, client := net.Pipe()
+		go io.Copy(io.Discard, client)
+		slave := newMockSlave()
+		wt, err := New(master, slave, WithMasterTimeout(timeout))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// without a timeout, Run ends when canceled
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		err = wt.Run(ctx)
+		cancel()
+		expected := ErrMasterClosed
+		if timeout == 0 {
+			expected = context.DeadlineExceeded
+		}
+		if !errors.Is(err, expected) || time.Since(start) > 5*time.Second {
+			t.Errorf("Run() returned %v after %s with timeout %s, expected %v", err, time.Since(start), timeout, expected)
+		}
+		slave.close()
+		client.Close()
+	}
+}
+
+func TestRunStopsWriting(t *testing.T) {
+	master := &lateMaster{discardMaster: discardMaster{closed: make(chan struct{})}}
+	wt, err := New(master, &bulkSlave{data: make([]byte, 1<<30)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := wt.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() returned %v, expected context.DeadlineExceeded", err)
+	}
+	master.returned.Store(true)
+	time.Sleep(50 * time.Millisecond)
+	close(master.closed)
+	if master.late.Load() {
+		t.Error("the master was written to after Run returned")
+	}
+}
+
+// lateMaster takes a while to write, and tells whether a write ended once
+// returned was set.
+type lateMaster struct {
+	discardMaster
+	returned atomic.Bool
+	late     atomic.Bool
+}
+
+func (lm *lateMaster) Write(buf []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	if lm.returned.Load() {
+		lm.late.Store(true)
+	}
+	return len(buf), nil
+}
+
+func BenchmarkRunOutput(b *testing.B) {
+	const size = 1 << 20
+	b.SetBytes(size)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		master := &discardMaster{closed: make(chan struct{})}
+		wt, err := New(master, &bulkSlave{data: make([]byte, size)})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := wt.Run(context.Background()); !errors.Is(err, ErrSlaveClosed) {
+			b.Fatalf("Run() returned %v, expected ErrSlaveClosed", err)
+		}
+		close(master.closed)
+	}
+}
+
+// discardMaster discards output and sends no input until closed.
+type discardMaster struct {
+	closed chan struct{}
+}
+
+func (dm *discardMaster) Read(buf []byte) (int, error) {
+	<-dm.closed
+	return 0, io.EOF
+}
+
+func (dm *discardMaster) Write(buf []byte) (int, error) {
+	return len(buf), nil
+}
+
+// bulkSlave outputs data as fast as it is read, closing done if not nil
+// at the end.
+type bulkSlave struct {
+	mockSlave
+	data []byte
+	done chan struct{}
+}
+
+func (bs *bulkSlave) Read(buf []byte) (int, error) {
+	if len(bs.data) == 0 {
+		if bs.done != nil {
+			close(bs.done)
+			bs.done = nil
+		}
+		return 0, io.EOF
+	}
+	n := copy(buf, bs.data)
+	bs.data = bs.data[n:]
+	return n, nil
+}
+
 type mockMaster struct {
 	gottyToMasterReader *io.PipeReader
 	gottyToMasterWriter *io.PipeWriter